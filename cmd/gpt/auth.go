@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/internal/config"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+	"github.com/chzyer/readline"
+	"github.com/mattn/go-isatty"
+)
+
+// apiKeyPath returns the path of the API key saved by `gpt auth login`.
+func apiKeyPath() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "api_key"), nil
+}
+
+// apiKey returns the API key from the OPENAI_API_KEY env var, or else the
+// saved one, and where it came from. It returns "" if there is none.
+func apiKey() (key, source string, err error) {
+	if key := os.Getenv("OPENAI_API_KEY"); key != "" {
+		return key, "the OPENAI_API_KEY env var", nil
+	}
+	path, err := apiKeyPath()
+	if err != nil {
+		return "", "", err
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(string(b)), path, nil
+}
+
+// saveAPIKey saves the API key for later runs, and returns the path of the
+// file it's saved in. The key isn't encrypted, since there's no keyring to
+// keep it in on every OS; the file is only readable by the user.
+func saveAPIKey(key string) (string, error) {
+	path, err := apiKeyPath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(key+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// runAuth implements `gpt auth`, which manages the saved API key.
+func runAuth(ctx context.Context, _ *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("auth", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt auth login\n       gpt auth status\n       gpt auth logout\n\nlogin reads an API key from the terminal or stdin, checks it, and saves it\nto the config dir, unencrypted, in a file only you can read. To keep the\nkey elsewhere, such as in a password manager, set the OPENAI_API_KEY env\nvar instead, which takes precedence over the saved key. status shows\nwhich key is used, and logout deletes the saved key.\n\n")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	verb := args[0]
+	fs.Parse(args[1:])
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	path, err := apiKeyPath()
+	if err != nil {
+		return err
+	}
+
+	switch verb {
+	case "login":
+		var key string
+		if isatty.IsTerminal(os.Stdin.Fd()) {
+			b, err := readline.Password("API key: ")
+			if err != nil {
+				return err
+			}
+			key = string(b)
+		} else {
+			key, err = bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && key == "" {
+				return fmt.Errorf("read API key: %w", err)
+			}
+		}
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return fmt.Errorf("no API key given")
+		}
+		client := &openai.Client{Token: key, BaseURL: baseURL()}
+		if _, err := availableModels(ctx, client); err != nil {
+			return fmt.Errorf("check API key: %w", err)
+		}
+		if _, err := saveAPIKey(key); err != nil {
+			return err
+		}
+		fmt.Printf("Saved API key to %s, unencrypted\n", path)
+		if os.Getenv("OPENAI_API_KEY") != "" {
+			fmt.Println("The OPENAI_API_KEY env var is set, and is used instead.")
+		}
+	case "status":
+		key, source, err := apiKey()
+		if err != nil {
+			return err
+		}
+		if key == "" {
+			return fmt.Errorf("no API key: set OPENAI_API_KEY, or run `gpt auth login`")
+		}
+		fmt.Printf("Using API key %s from %s\n", maskKey(key), source)
+	case "logout":
+		if err := os.Remove(path); errors.Is(err, os.ErrNotExist) {
+			fmt.Println("No saved API key.")
+		} else if err != nil {
+			return err
+		} else {
+			fmt.Printf("Deleted %s\n", path)
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	return nil
+}
+
+// maskKey returns a key with all but its prefix and last 4 characters
+// hidden.
+func maskKey(key string) string {
+	if len(key) <= 12 {
+		return strings.Repeat("*", len(key))
+	}
+	prefix, _, ok := strings.Cut(key, "-")
+	if !ok || len(prefix) > 8 {
+		prefix = ""
+	} else {
+		prefix += "-"
+	}
+	return prefix + "..." + key[len(key)-4:]
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+type batchItem struct {
+	ID     string `json:"id,omitempty"`
+	Prompt string `json:"prompt"`
+	// Model and System override the defaults for this item.
+	Model  string `json:"model,omitempty"`
+	System string `json:"system,omitempty"`
+}
+
+type batchResult struct {
+	// Index is the position of the item in the input, starting at 0.
+	Index     int        `json:"index"`
+	ID        string     `json:"id,omitempty"`
+	Model     string     `json:"model"`
+	Reply     string     `json:"reply,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Usage     *llm.Usage `json:"usage,omitempty"`
+	LatencyMS int64      `json:"latency_ms"`
+	Attempts  int        `json:"attempts"`
+}
+
+// runBatch implements `gpt batch`, which runs many independent prompts
+// concurrently.
+func runBatch(ctx context.Context, client *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: gpt batch [flags]
+
+Runs each prompt in a JSONL file and writes one JSON result per line, in
+completion order. Each input line is an object like:
+
+  {"id": "q1", "prompt": "...", "model": "optional", "system": "optional"}
+
+`)
+		fs.PrintDefaults()
+	}
+	in := fs.String("f", "-", "Input JSONL file. - reads stdin.")
+	out := fs.String("o", "-", "Output JSONL file. - writes stdout.")
+	concurrency := fs.Int("concurrency", 4, "Max number of requests in flight.")
+	rpm := fs.Int("rpm", 0, "Max requests started per minute. 0 means no limit.")
+	retries := fs.Int("retries", 3, "Max retries per item for rate limits, server errors, and timeouts.")
+	fs.Parse(args)
+	if *concurrency <= 0 {
+		return fmt.Errorf("-concurrency must be positive")
+	}
+
+	items, err := readBatchItems(*in)
+	if err != nil {
+		return err
+	}
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	// Limit the rate at which requests start, including retries.
+	var limiter <-chan time.Time
+	if *rpm > 0 {
+		t := time.NewTicker(time.Minute / time.Duration(*rpm))
+		defer t.Stop()
+		limiter = t.C
+	}
+	wait := func() {
+		if limiter != nil {
+			<-limiter
+		}
+	}
+
+	var (
+		mu     sync.Mutex
+		done   int
+		failed int
+		enc    = json.NewEncoder(w)
+		sem    = make(chan struct{}, *concurrency)
+		wg     sync.WaitGroup
+		encErr error
+	)
+	progress := func() {
+		fmt.Fprintf(os.Stderr, "\r%d/%d done, %d failed", done, len(items), failed)
+	}
+	progress()
+	for i, item := range items {
+		i, item := i, item
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			res := runBatchItem(ctx, client, item, *retries, wait)
+			res.Index = i
+			mu.Lock()
+			defer mu.Unlock()
+			done++
+			if res.Error != "" {
+				failed++
+			}
+			if err := enc.Encode(res); err != nil && encErr == nil {
+				encErr = err
+			}
+			progress()
+		}()
+	}
+	wg.Wait()
+	fmt.Fprintln(os.Stderr)
+	if encErr != nil {
+		return encErr
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d items failed", failed, len(items))
+	}
+	return nil
+}
+
+func runBatchItem(ctx context.Context, client *openai.Client, item *batchItem, retries int, wait func()) *batchResult {
+	res := &batchResult{ID: item.ID, Model: *model}
+	if item.Model != "" {
+		res.Model = item.Model
+	}
+	system := *systemPrompt
+	if item.System != "" {
+		system = item.System
+	}
+	start := time.Now()
+	backoff := time.Second
+	for {
+		wait()
+		res.Attempts++
+		reply, usage, err := completeQuietly(ctx, client, res.Model, system, item.Prompt)
+		if err == nil {
+			res.Reply, res.Usage = reply, usage
+			break
+		}
+		if res.Attempts > retries || !llm.IsRetryable(err) {
+			res.Error = err.Error()
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	res.LatencyMS = time.Since(start).Milliseconds()
+	return res
+}
+
+func readBatchItems(path string) ([]*batchItem, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	var items []*batchItem
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 16<<20)
+	for line := 1; s.Scan(); line++ {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		item := &batchItem{}
+		if err := json.Unmarshal(s.Bytes(), item); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if item.Prompt == "" {
+			return nil, fmt.Errorf("%s:%d: missing prompt", path, line)
+		}
+		items = append(items, item)
+	}
+	return items, s.Err()
+}
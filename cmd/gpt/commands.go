@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+// command is a subcommand, invoked as `gpt [global flags] <name> [args]`.
+type command struct {
+	run func(ctx context.Context, client *openai.Client, args []string) error
+	// summary is shown in `gpt -h`.
+	summary string
+	// offline commands don't need an API key, and are passed a nil client.
+	offline bool
+	// takes reports whether words, the args after the command name when
+	// the first isn't a flag, are the command's args rather than the rest
+	// of a prompt that starts with its name, as in `gpt commit message for
+	// this`. Nil takes any words.
+	takes func(words []string) bool
+}
+
+// upTo returns a command.takes that takes at most n words.
+func upTo(n int) func(words []string) bool {
+	return func(words []string) bool { return len(words) <= n }
+}
+
+// lookupCommand returns the command that args, the args after the global
+// flags, invoke. It returns false if they're a prompt for `gpt chat`:
+// if they don't start with a command name, if the command doesn't take
+// the words that follow its name, or if the global flags ended with --.
+func lookupCommand(args []string) (*command, bool) {
+	if len(args) == 0 || len(os.Args) > len(args) && os.Args[len(os.Args)-len(args)-1] == "--" {
+		return nil, false
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return nil, false
+	}
+	words := args[1:]
+	if len(words) > 0 && !strings.HasPrefix(words[0], "-") && cmd.takes != nil && !cmd.takes(words) {
+		return nil, false
+	}
+	return cmd, true
+}
+
+// commands are the subcommands. Args that don't start with a command name
+// are a prompt for `gpt chat`, as are those lookupCommand finds aren't meant
+// for the command they start with.
+var commands = map[string]*command{
+	"agent":        {run: runAgent, summary: "Work on a task with tools, such as running commands and editing files."},
+	"auth":         {run: runAuth, summary: "Save, check, or remove the API key.", offline: true},
+	"batch":        {run: runBatch, summary: "Run the prompts in a JSONL file concurrently.", takes: upTo(0)},
+	"chat":         {run: runChat, summary: "Chat with a model. This is the default command."},
+	"commit":       {run: runCommit, summary: "Write a commit message for the staged changes.", takes: upTo(0)},
+	"compare":      {run: runCompare, summary: "Send a prompt to several models and compare the replies."},
+	"config":       {run: runConfig, summary: "Show or change settings in the config file.", offline: true},
+	"doctor":       {run: runDoctor, summary: "Check the API key, connection, and setup, and diagnose problems.", offline: true, takes: upTo(0)},
+	"embed":        {run: runEmbed, summary: "Print embeddings for texts or files."},
+	"eval":         {run: runEval, summary: "Check the replies to a suite of prompts against assertions.", takes: upTo(0)},
+	"explain-diff": {run: runExplainDiff, summary: "Explain the changes in a git diff file by file, and summarize them.", takes: upTo(1)},
+	"history":      {run: runHistory, summary: "List the prompts sent most often, and suggest templates for them.", offline: true, takes: upTo(0)},
+	"hook":         {run: runHook, summary: "Write commit messages from git hooks, or install the hooks.", offline: true},
+	"index":        {run: runIndex, summary: "Embed the files in a directory, for chat -rag.", takes: upTo(1)},
+	"models":       {run: runModels, summary: "Choose the default model.", takes: upTo(0)},
+	"replay":       {run: runReplay, summary: "Rerun a saved session against another model.", takes: upTo(1)},
+	"repomap":      {run: runRepoMap, summary: "Print a map of the files and exported symbols in a directory.", offline: true, takes: upTo(1)},
+	"run":          {run: runTemplate, summary: "Run a prompt template.", takes: isTemplate},
+	"serve":        {run: runServe, summary: "Serve an OpenAI-compatible API.", takes: upTo(0)},
+	"setup":        {run: runSetup, summary: "Choose a provider, save an API key, and pick the default model.", offline: true, takes: upTo(0)},
+	"sessions":     {run: runSessions, summary: "List, show, export, or delete saved sessions.", offline: true},
+	"sh":           {run: runSh, summary: "Write a shell command for a request, and ask whether to run it."},
+	"stats":        {run: runStats, summary: "Report the latency, tokens, and cost of recorded replies.", offline: true, takes: upTo(0)},
+	"transcribe":   {run: runTranscribe, summary: "Print the text spoken in an audio file.", takes: upTo(1)},
+	"translate":    {run: runTranslate, summary: "Translate text or files into another language, keeping their formatting."},
+	"tts":          {run: runTTS, summary: "Speak text aloud."},
+	"usage":        {run: runUsage, summary: "Total the tokens and cost of recorded replies by day, model, or provider.", offline: true, takes: upTo(0)},
+}
+
+// globalFlags apply to every command, and are given before the command
+// name. `gpt chat` and `gpt agent` also accept them after it.
+var globalFlags = []string{
+	"model", "models", "effort", "connect_timeout", "first_token_timeout", "timeout",
+	"show_usage", "show_thinking", "stats", "prompt_cache_key", "otel_endpoint", "dry_run", "raw",
+	"scrub_secrets", "fallback", "project_config",
+}
+
+// chatFlags are the flags of `gpt chat`, which bare `gpt` also accepts.
+var chatFlags = []string{
+	"system", "repo_map", "project_instructions", "prompt_file", "audio", "record", "interactive",
+	"save", "title_model", "resume", "auto_continue", "web", "rag", "rag_k",
+	"speak", "voice", "speed", "no_cache", "cache_ttl", "q",
+	"out", "append_out", "out_exchange", "code_only", "code_block", "pager",
+	"attach", "attach_trim", "attach_max_tokens", "council", "council_prompt",
+	"refine", "refine_prompt", "filter",
+	"follow", "follow_file", "follow_interval", "follow_delimiter",
+	"notify", "spinner", "reasoning_progress", "status_file", "status_title",
+	"wrap", "render_math", "render_tables",
+}
+
+// agentFlags are the flags of `gpt agent`. The -auto_ prefix is dropped, so
+// that `gpt agent -plan` is `gpt -auto -auto_plan`.
+var agentFlags = []string{
+	"repo_map", "project_instructions", "auto_continue", "search_engine", "searxng_url",
+	"auto_plan", "auto_http_timeout", "auto_secret_env", "auto_audit", "auto_audit_log",
+	"auto_max_turns", "auto_max_tokens", "auto_max_time", "auto_max_cost", "auto_policy",
+	"auto_checkpoint", "auto_sandbox", "auto_sandbox_image", "auto_sandbox_network",
+	"auto_sandbox_runtime", "auto_output_limit", "notify", "spinner",
+	"reasoning_progress", "status_file", "status_title", "wrap", "render_math",
+	"render_tables",
+}
+
+// usage prints the top-level help.
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "usage: gpt [flags] [--] [PROMPT]\n       gpt [global flags] COMMAND [flags] [args]\n\nWith no COMMAND, gpt runs `gpt chat`: it replies to PROMPT, or stdin, or\nstarts an interactive session. A PROMPT that starts with a COMMAND\nname runs the command if the rest of it reads as the command's args;\nput -- before PROMPT to send it as a prompt regardless.\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-14s%s\n", name, commands[name].summary)
+	}
+	fmt.Fprintf(w, "\nGlobal flags:\n")
+	fs := flag.NewFlagSet("gpt", flag.ContinueOnError)
+	fs.SetOutput(w)
+	shareFlags(fs, "", globalFlags...)
+	fs.PrintDefaults()
+	fmt.Fprintf(w, "\nRun `gpt COMMAND -h` for the flags of a command.\n")
+}
+
+// shareFlags adds global flags to a command's flag set, without prefix in
+// their names. The flags share their values, so setting one in either set
+// sets both.
+func shareFlags(fs *flag.FlagSet, prefix string, names ...string) {
+	for _, name := range names {
+		f := flag.Lookup(name)
+		if f == nil {
+			panic("unknown flag " + name)
+		}
+		fs.Var(f.Value, strings.TrimPrefix(name, prefix), f.Usage)
+	}
+}
+
+// parseShared parses a command's args, then marks the global flags that
+// they set as set, for isFlagSet.
+func parseShared(fs *flag.FlagSet, args []string) {
+	fs.Parse(args)
+	fs.Visit(func(f *flag.Flag) {
+		flag.VisitAll(func(g *flag.Flag) {
+			if g.Value == f.Value {
+				flag.Set(g.Name, f.Value.String())
+			}
+		})
+	})
+}
+
+// runChat implements `gpt chat`, which is also run by bare `gpt`.
+func runChat(ctx context.Context, client *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("chat", flag.ExitOnError)
+	shareFlags(fs, "", chatFlags...)
+	shareFlags(fs, "", globalFlags...)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt chat [flags] [PROMPT]\n\nReplies to PROMPT, or the prompt read from -prompt_file, -audio, or stdin.\nIf none is given and stdin is a terminal, starts an interactive session.\nThe command name may be left out, as in `gpt -system=... PROMPT`.\n\n")
+		fs.PrintDefaults()
+	}
+	parseShared(fs, args)
+	return startChat(ctx, client, fs.Args())
+}
+
+// runAgent implements `gpt agent`, which is `gpt -auto`.
+func runAgent(ctx context.Context, client *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	shareFlags(fs, "auto_", agentFlags...)
+	shareFlags(fs, "", globalFlags...)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt agent [flags] [TASK]\n\nWorks on TASK, or on tasks read from the terminal, with tools to run\ncommands, edit files, and search the web. Same as `gpt -auto`, where the\nagent's own flags are prefixed with auto_, as in -auto_plan for -plan.\n\n")
+		fs.PrintDefaults()
+	}
+	parseShared(fs, args)
+	*autoMode = true
+	return startChat(ctx, client, fs.Args())
+}
+
+// errNoAPIKey is returned by newClient when there is no API key.
+var errNoAPIKey = errors.New("missing OPENAI_API_KEY env var: set it, or save a key with `gpt auth login` or `gpt setup`")
+
+// newClient returns an API client with the key from the OPENAI_API_KEY env
+// var, or else the one saved by `gpt auth login`.
+func newClient() (*openai.Client, error) {
+	key, _, err := apiKey()
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, errNoAPIKey
+	}
+	return &openai.Client{Token: key, BaseURL: baseURL()}, nil
+}
+
+// baseURL returns the API server from the OPENAI_BASE_URL env var, or else
+// the config file. "" means OpenAI's.
+func baseURL() string {
+	if u := os.Getenv("OPENAI_BASE_URL"); u != "" {
+		return u
+	}
+	return userConfig.BaseURL
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/pkg/openai"
+	"github.com/chzyer/readline"
+	"github.com/mattn/go-isatty"
+)
+
+const (
+	commitSystemPrompt = `You write git commit messages in the Conventional Commits format.
+
+The first line is "type(scope): summary", where type is one of feat, fix, docs, style, refactor, perf, test, build, ci, or chore, and scope is optional. The summary is in the imperative mood, lowercase, without a trailing period, and at most 72 characters.
+
+If the change needs explaining, add a blank line and then a body wrapped at 72 columns that explains what changed and why. Don't describe the diff line by line.
+
+Reply with only the commit message. No code fences or commentary.`
+
+	// maxDiffLen bounds the diff sent to the model. Larger diffs are truncated.
+	maxDiffLen = 100_000
+)
+
+// runCommit implements `gpt commit`, which writes a commit message for the
+// staged changes.
+func runCommit(ctx context.Context, client *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("commit", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt commit [flags]\n\nGenerates a commit message for the staged changes, then asks whether to\ncommit with it, edit it first, or cancel.\n\n")
+		fs.PrintDefaults()
+	}
+	yes := fs.Bool("y", false, "Commit without asking for approval.")
+	printOnly := fs.Bool("print", false, "Only print the message; don't commit.")
+	hint := fs.String("hint", "", "Extra context about the change to guide the message.")
+	fs.Parse(args)
+
+	prompt, err := commitPrompt(*hint)
+	if err != nil {
+		return err
+	}
+
+	c, err := newChat(client, *model, commitSystemPrompt)
+	if err != nil {
+		return err
+	}
+	msg, err := complete(ctx, c, prompt)
+	if err != nil {
+		return err
+	}
+	msg = strings.TrimSpace(msg) + "\n"
+	if *printOnly {
+		return nil
+	}
+
+	edit := false
+	if !*yes {
+		if !isatty.IsTerminal(os.Stdin.Fd()) {
+			return nil
+		}
+		answer, err := readline.Line("Commit with this message? (yes / edit / no) ")
+		if err != nil {
+			return nil
+		}
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+		case "e", "edit":
+			edit = true
+		default:
+			return nil
+		}
+	}
+	return gitCommit(msg, edit)
+}
+
+// commitPrompt returns the prompt asking for a message for the staged
+// changes, with extra context about them if hint isn't empty.
+func commitPrompt(hint string) (string, error) {
+	diff, err := exec.Command("git", "diff", "--staged").Output()
+	if err != nil {
+		return "", fmt.Errorf("git diff --staged: %w", err)
+	}
+	if len(strings.TrimSpace(string(diff))) == 0 {
+		return "", fmt.Errorf("no staged changes")
+	}
+	prompt := "Write a commit message for this diff:\n\n" + truncateDiff(string(diff))
+	if hint != "" {
+		prompt = "Context about the change: " + hint + "\n\n" + prompt
+	}
+	return prompt, nil
+}
+
+// gitCommit commits the staged changes with the given message. If edit is
+// true, git opens the message in the user's editor first.
+func gitCommit(msg string, edit bool) error {
+	f, err := os.CreateTemp("", "gpt-commit-msg-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(msg); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	args := []string{"commit", "-F", f.Name()}
+	if edit {
+		args = append(args, "-e")
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+func truncateDiff(diff string) string {
+	if len(diff) <= maxDiffLen {
+		return diff
+	}
+	return diff[:maxDiffLen] + fmt.Sprintf("\n[diff truncated: %d more bytes omitted]\n", len(diff)-maxDiffLen)
+}
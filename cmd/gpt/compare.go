@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+// runCompare implements `gpt compare`, which sends the same prompt to
+// several models at once and shows each reply.
+func runCompare(ctx context.Context, client *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt compare -models MODEL,MODEL,... [PROMPT]\n\nSends PROMPT (or stdin) to each model concurrently, and prints each reply\nas it finishes, labeled with its latency and cost.\n\n")
+		fs.PrintDefaults()
+	}
+	modelList := fs.String("models", "", "Comma-separated models to compare.")
+	fs.Parse(args)
+
+	ids := splitModels(*modelList)
+	if len(ids) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	prompt := strings.Join(fs.Args(), " ")
+	if prompt == "" {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		prompt = string(b)
+	}
+
+	type result struct {
+		model   string
+		reply   string
+		latency time.Duration
+		usage   *llm.Usage
+		err     error
+	}
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		id := id
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := result{model: id}
+			start := time.Now()
+			res.reply, res.usage, res.err = completeQuietly(ctx, client, id, *systemPrompt, prompt)
+			res.latency = time.Since(start)
+			results <- res
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	failed := 0
+	for res := range results {
+		label := fmt.Sprintf("=== %s (%s", res.model, res.latency.Round(10*time.Millisecond))
+		if res.usage != nil {
+			label += ", " + chat.UsageLine(res.model, res.usage, nil)
+		}
+		label += ") ==="
+		fmt.Println(chat.Styled(chat.StyleHeading, label))
+		if res.err != nil {
+			failed++
+			fmt.Println(chat.Styled(chat.StyleError, "error: "+res.err.Error()))
+			continue
+		}
+		fmt.Println(strings.TrimRight(res.reply, "\n"))
+		fmt.Println()
+	}
+	if failed == len(ids) {
+		return fmt.Errorf("all models failed")
+	}
+	return nil
+}
+
+// splitModels splits a comma-separated list of models.
+func splitModels(list string) []string {
+	var ids []string
+	for _, id := range strings.Split(list, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// completeQuietly sends a single prompt to a model and returns the reply
+// without displaying it.
+func completeQuietly(ctx context.Context, client *openai.Client, model, system, prompt string) (string, *llm.Usage, error) {
+	c, err := newChat(client, model, system)
+	if err != nil {
+		return "", nil, err
+	}
+	c.ShowThinking = false
+	return send(ctx, c, prompt)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bduffany/gpt-cli/internal/config"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+	"gopkg.in/yaml.v3"
+)
+
+// runConfig implements `gpt config`, which shows and changes settings in
+// the config file.
+func runConfig(ctx context.Context, _ *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt config path [NAME]\n       gpt config show\n       gpt config get KEY\n       gpt config set KEY VALUE\n\npath prints where the config file, data, state, and cache are kept, and\nthe files in them, or just the path of NAME, such as config or sessions.\nThey're set by the XDG_*_HOME env vars, and the paths in the config file.\n\nKEY is a setting in the config file, with nested keys separated by dots,\nlike sessions.max_age. VALUE is parsed as YAML.\n\n")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	verb := args[0]
+	fs.Parse(args[1:])
+	nargs := map[string]int{"path": 0, "show": 0, "get": 1, "set": 2}
+	if n, ok := nargs[verb]; !ok || fs.NArg() != n && !(verb == "path" && fs.NArg() == 1) {
+		fs.Usage()
+		os.Exit(2)
+	}
+	path, err := config.Path()
+	if err != nil {
+		return err
+	}
+
+	switch verb {
+	case "path":
+		return printPaths(fs.Arg(0))
+	case "show":
+		b, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(b)
+	case "get":
+		b, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		var v any = map[string]any{}
+		if err := yaml.Unmarshal(b, &v); err != nil {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+		for _, part := range strings.Split(fs.Arg(0), ".") {
+			m, _ := v.(map[string]any)
+			if v = m[part]; v == nil {
+				return fmt.Errorf("%s is not set", fs.Arg(0))
+			}
+		}
+		if _, ok := v.(map[string]any); !ok {
+			fmt.Println(v)
+			return nil
+		}
+		out, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(out)
+	case "set":
+		key := fs.Arg(0)
+		var value any
+		if err := yaml.Unmarshal([]byte(fs.Arg(1)), &value); err != nil {
+			return fmt.Errorf("invalid value: %w", err)
+		}
+		if err := checkSetting(key, value); err != nil {
+			return err
+		}
+		if err := config.Set(key, value); err != nil {
+			return err
+		}
+		fmt.Printf("Set %s in %s\n", key, path)
+	}
+	return nil
+}
+
+// checkSetting returns an error if key isn't a setting in the config file,
+// or value has the wrong type for it.
+func checkSetting(key string, value any) error {
+	parts := strings.Split(key, ".")
+	var doc any = value
+	for i := len(parts) - 1; i >= 0; i-- {
+		doc = map[string]any{parts[i]: doc}
+	}
+	b, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&config.Config{}); err != nil {
+		return fmt.Errorf("invalid setting %s: %w", key, err)
+	}
+	return nil
+}
+
+// printPaths prints the resolved locations of gpt's files, or just the
+// named one.
+func printPaths(name string) error {
+	locations := []struct {
+		name   string
+		locate func() (string, error)
+	}{
+		{"config", config.Path},
+		{"data", func() (string, error) { return userConfig.KindDir(config.Data) }},
+		{"state", func() (string, error) { return userConfig.KindDir(config.State) }},
+		{"cache", func() (string, error) { return userConfig.KindDir(config.Cache) }},
+		{"sessions", func() (string, error) { return userConfig.Locate(config.Data, "sessions") }},
+		{"stats", statsPath},
+		{"audit", func() (string, error) { return userConfig.Locate(config.State, "audit") }},
+		{"responses", func() (string, error) { return userConfig.Locate(config.Cache, "responses") }},
+		{"api_key", apiKeyPath},
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, l := range locations {
+		if name != "" && l.name != name {
+			continue
+		}
+		path, err := l.locate()
+		if err != nil {
+			return fmt.Errorf("%s: %w", l.name, err)
+		}
+		if name != "" {
+			fmt.Println(path)
+			return nil
+		}
+		fmt.Fprintf(w, "%s\t%s\n", l.name, path)
+	}
+	if name != "" {
+		return fmt.Errorf("unknown path %q", name)
+	}
+	return w.Flush()
+}
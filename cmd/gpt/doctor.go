@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/config"
+	"github.com/bduffany/gpt-cli/internal/serve"
+	"github.com/bduffany/gpt-cli/internal/session"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+// runDoctor implements `gpt doctor`, which checks the setup and prints a
+// diagnosis of anything that would stop gpt from working. It's an offline
+// command, so that it runs without an API key.
+func runDoctor(ctx context.Context, _ *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt doctor\n\nChecks the config file, the API key, the connection to the API, including\nproxy settings, TLS, and clock skew, a small request to -model, the\nupstream servers of `gpt serve` routes, and the saved sessions. Exits with\nstatus 1 if any check fails.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	d := &doctor{}
+	d.config()
+	if client := d.apiKey(); client != nil {
+		if d.connect(ctx, client, "API") {
+			d.request(ctx, client)
+		}
+	}
+	d.routes(ctx)
+	d.sessions()
+	if d.failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", d.failed, d.checks)
+	}
+	fmt.Println("\nEverything looks good.")
+	return nil
+}
+
+// doctor prints the results of checks.
+type doctor struct {
+	checks, failed int
+}
+
+func (d *doctor) ok(check, format string, args ...any) {
+	d.checks++
+	fmt.Printf("ok    %s: %s\n", check, fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) warn(check, format string, args ...any) {
+	d.checks++
+	fmt.Println(chat.Styled(chat.StyleWarning, fmt.Sprintf("warn  %s: %s", check, fmt.Sprintf(format, args...))))
+}
+
+func (d *doctor) fail(check, format string, args ...any) {
+	d.checks++
+	d.failed++
+	fmt.Println(chat.Styled(chat.StyleError, fmt.Sprintf("FAIL  %s: %s", check, fmt.Sprintf(format, args...))))
+}
+
+// config reports the config file. It was already loaded at startup, which
+// fails if it doesn't parse.
+func (d *doctor) config() {
+	path, err := config.Path()
+	if err != nil {
+		d.fail("config", "%s", err)
+		return
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		d.ok("config", "%s doesn't exist; using defaults", path)
+		return
+	}
+	d.ok("config", "%s", path)
+}
+
+// apiKey checks that there's an API key, and returns a client using it.
+func (d *doctor) apiKey() *openai.Client {
+	key, source, err := apiKey()
+	if err != nil {
+		d.fail("API key", "%s", err)
+		return nil
+	}
+	if key == "" {
+		d.fail("API key", "none found; set OPENAI_API_KEY, or run `gpt auth login`")
+		return nil
+	}
+	if strings.TrimSpace(key) != key || strings.ContainsAny(key, "\"'") {
+		d.warn("API key", "%s from %s has spaces or quotes around it", maskKey(key), source)
+	} else {
+		d.ok("API key", "%s from %s", maskKey(key), source)
+	}
+	return &openai.Client{Token: key, BaseURL: baseURL()}
+}
+
+// connect checks the connection to a server by listing its models, and
+// reports the proxy, TLS, and clock skew along the way. It returns whether
+// the server accepted the key.
+func (d *doctor) connect(ctx context.Context, client *openai.Client, name string) bool {
+	base := client.BaseURL
+	if base == "" {
+		base = openai.DefaultBaseURL
+	}
+	u, err := url.Parse(base)
+	if err != nil || u.Host == "" {
+		d.fail(name, "invalid base URL %q", base)
+		return false
+	}
+	if proxy, err := http.ProxyFromEnvironment(&http.Request{URL: u}); err != nil {
+		d.fail("proxy", "invalid proxy setting: %s", err)
+	} else if proxy != nil {
+		d.ok("proxy", "requests to %s go through %s", u.Host, proxy.Redacted())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	start := time.Now()
+	rsp, err := client.Request(ctx, "GET", "/v1/models", nil)
+	if err != nil {
+		d.fail(name, "%s: %s", base, diagnose(err))
+		return false
+	}
+	defer rsp.Body.Close()
+	io.Copy(io.Discard, rsp.Body)
+	d.ok(name, "%s answered in %s", base, time.Since(start).Round(time.Millisecond))
+	if rsp.TLS != nil && len(rsp.TLS.PeerCertificates) > 0 {
+		cert := rsp.TLS.PeerCertificates[0]
+		d.ok("TLS", "%s, certificate issued by %s", tls.VersionName(rsp.TLS.Version), issuer(cert))
+	}
+	if date, err := http.ParseTime(rsp.Header.Get("Date")); err == nil {
+		// Allow for the request's own latency.
+		skew := time.Since(date) - time.Since(start)/2
+		if skew.Abs() > time.Minute {
+			d.warn("clock", "off by %s from the server's; fix the system clock, or TLS and signed requests may fail", skew.Round(time.Second))
+		} else {
+			d.ok("clock", "within a minute of the server's")
+		}
+	}
+	return true
+}
+
+// diagnose explains a failed request, with a hint about the likely fix.
+func diagnose(err error) string {
+	var he *openai.HTTPError
+	var ua x509.UnknownAuthorityError
+	var ci x509.CertificateInvalidError
+	var hn x509.HostnameError
+	var dns *net.DNSError
+	var op *net.OpError
+	switch {
+	case errors.As(err, &he) && (he.StatusCode == http.StatusUnauthorized || he.StatusCode == http.StatusForbidden):
+		return fmt.Sprintf("the API key was rejected (%s); check it, or run `gpt auth login`", err)
+	case errors.As(err, &he) && he.StatusCode == http.StatusNotFound:
+		return fmt.Sprintf("%s; check that the base URL is an OpenAI-compatible server, without /v1", err)
+	case errors.As(err, &ua):
+		return fmt.Sprintf("the server's TLS certificate isn't trusted (%s); if a proxy inspects TLS, set SSL_CERT_FILE to its CA certificate", issuer(ua.Cert))
+	case errors.As(err, &ci) && ci.Reason == x509.Expired:
+		return fmt.Sprintf("%s; check that the system clock is right", err)
+	case errors.As(err, &ci), errors.As(err, &hn):
+		return fmt.Sprintf("%s; a proxy may be intercepting TLS", err)
+	case errors.As(err, &dns):
+		return fmt.Sprintf("couldn't look up %s; check the network, DNS, or HTTPS_PROXY", dns.Name)
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timed out; check the network, or whether a proxy is needed (HTTPS_PROXY)"
+	case errors.As(err, &op) && op.Op == "proxyconnect":
+		return fmt.Sprintf("couldn't connect to the proxy: %s; check HTTPS_PROXY", op.Err)
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused; check that the server is running, and the base URL"
+	}
+	return err.Error()
+}
+
+func issuer(cert *x509.Certificate) string {
+	if cert == nil {
+		return "unknown"
+	}
+	if len(cert.Issuer.Organization) > 0 {
+		return cert.Issuer.Organization[0]
+	}
+	return cert.Issuer.CommonName
+}
+
+// request sends a tiny prompt to -model.
+func (d *doctor) request(ctx context.Context, client *openai.Client) {
+	check := "model " + *model
+	start := time.Now()
+	s, err := client.GetCompletion(ctx, &llm.Request{
+		Model:    *model,
+		Messages: []llm.Message{{Role: llm.RoleUser, Content: "Reply with just the word OK."}},
+		Options:  llm.RequestOptions{Timeout: time.Minute},
+	})
+	if err != nil {
+		d.fail(check, "%s", diagnose(err))
+		return
+	}
+	r := llm.NewReader(s)
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		d.fail(check, "%s", diagnose(err))
+		return
+	}
+	d.ok(check, "replied %q in %s", strings.TrimSpace(string(b)), time.Since(start).Round(time.Millisecond))
+}
+
+// routes checks the upstream servers of the `gpt serve` config, if any.
+func (d *doctor) routes(ctx context.Context) {
+	dir, err := config.Dir()
+	if err != nil {
+		return
+	}
+	path := filepath.Join(dir, "serve.yaml")
+	cfg, err := serve.LoadConfigIfExists(path)
+	if err != nil {
+		d.fail("serve config", "%s", err)
+		return
+	}
+	seen := map[string]bool{}
+	for _, r := range cfg.Routes {
+		if r.BaseURL == "" || seen[r.BaseURL] {
+			continue
+		}
+		seen[r.BaseURL] = true
+		name := "route " + r.Model
+		var key string
+		if r.APIKeyEnv != "" {
+			if key = os.Getenv(r.APIKeyEnv); key == "" {
+				d.fail(name, "%s isn't set", r.APIKeyEnv)
+				continue
+			}
+		}
+		d.connect(ctx, &openai.Client{Token: key, BaseURL: r.BaseURL}, name)
+	}
+}
+
+// sessions checks that sessions can be saved and read.
+func (d *doctor) sessions() {
+	store, err := sessionStore()
+	if err != nil {
+		d.fail("sessions", "%s", err)
+		return
+	}
+	files, ok := store.(*session.FileStore)
+	if !ok {
+		sessions, err := store.List()
+		if errors.Is(err, session.ErrEncrypted) {
+			d.fail("sessions", "%s; set GPT_SESSION_PASSPHRASE, or restore session.key in the config dir", err)
+			return
+		}
+		if err != nil {
+			d.fail("sessions", "%s", err)
+			return
+		}
+		d.ok("sessions", "%d saved in the %s backend", len(sessions), userConfig.Sessions.Backend)
+		return
+	}
+	if err := os.MkdirAll(files.Dir, 0700); err != nil {
+		d.fail("sessions", "%s", err)
+		return
+	}
+	f, err := os.CreateTemp(files.Dir, ".doctor-*")
+	if err != nil {
+		d.fail("sessions", "%s isn't writable: %s", files.Dir, err)
+		return
+	}
+	f.Close()
+	os.Remove(f.Name())
+	sessions, err := files.List()
+	if errors.Is(err, session.ErrEncrypted) {
+		d.fail("sessions", "%s; set GPT_SESSION_PASSPHRASE, or restore session.key in the config dir", err)
+		return
+	}
+	if err != nil {
+		d.fail("sessions", "%s", err)
+		return
+	}
+	paths, _ := filepath.Glob(filepath.Join(files.Dir, "*.json"))
+	if corrupt := len(paths) - len(sessions); corrupt > 0 {
+		d.warn("sessions", "%d saved in %s, and %d that couldn't be read", len(sessions), files.Dir, corrupt)
+		return
+	}
+	d.ok("sessions", "%d saved in %s", len(sessions), files.Dir)
+}
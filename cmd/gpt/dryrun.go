@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+// errDryRun stops the program once -dry_run has printed a request. It is
+// not reported as an error.
+var errDryRun = errors.New("dry run: request not sent")
+
+// dryRunClient prints the body of a request instead of sending it, then
+// fails with errDryRun.
+type dryRunClient struct {
+	w io.Writer
+}
+
+func (c *dryRunClient) GetCompletion(ctx context.Context, req *llm.Request) (llm.Stream, error) {
+	body, err := openai.CompletionRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	out := &bytes.Buffer{}
+	if err := json.Indent(out, body, "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	if _, err := out.WriteTo(c.w); err != nil {
+		return nil, err
+	}
+	return nil, errDryRun
+}
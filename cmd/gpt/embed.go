@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+// runEmbed implements `gpt embed`, which prints embedding vectors for the
+// input texts.
+func runEmbed(ctx context.Context, client *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("embed", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt embed [flags] [TEXT ... | -files FILE ...]\n\nPrints embeddings for TEXT, FILEs, or stdin.\n\n")
+		fs.PrintDefaults()
+	}
+	model := fs.String("model", "text-embedding-3-small", "Embedding model to use.")
+	dimensions := fs.Int("dimensions", 0, "Shorten vectors to this many dimensions. 0 uses the model's default.")
+	format := fs.String("format", "json", "Output format: `json` or `csv`.")
+	files := fs.Bool("files", false, "Treat args as paths of files to embed, one embedding per file.")
+	lines := fs.Bool("lines", false, "Embed each non-empty input line separately.")
+	batchSize := fs.Int("batch_size", 100, "Max number of inputs to send per request.")
+	fs.Parse(args)
+
+	if *format != "json" && *format != "csv" {
+		return fmt.Errorf("invalid -format %q: must be json or csv", *format)
+	}
+	if *batchSize <= 0 {
+		return fmt.Errorf("-batch_size must be positive")
+	}
+
+	var inputs []string
+	switch {
+	case *files:
+		for _, path := range fs.Args() {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			inputs = append(inputs, string(b))
+		}
+	case fs.NArg() > 0:
+		inputs = append(inputs, strings.Join(fs.Args(), " "))
+	default:
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, string(b))
+	}
+	if *lines {
+		var split []string
+		for _, in := range inputs {
+			for _, line := range strings.Split(in, "\n") {
+				if strings.TrimSpace(line) != "" {
+					split = append(split, line)
+				}
+			}
+		}
+		inputs = split
+	}
+	if len(inputs) == 0 {
+		return fmt.Errorf("no input to embed")
+	}
+
+	var vectors [][]float64
+	for start := 0; start < len(inputs); start += *batchSize {
+		end := min(start+*batchSize, len(inputs))
+		batch, err := client.CreateEmbeddings(ctx, &openai.EmbeddingRequest{
+			Model:      *model,
+			Input:      inputs[start:end],
+			Dimensions: *dimensions,
+		})
+		if err != nil {
+			return err
+		}
+		vectors = append(vectors, batch...)
+	}
+
+	if *format == "csv" {
+		w := csv.NewWriter(os.Stdout)
+		for i, v := range vectors {
+			row := []string{inputs[i]}
+			for _, x := range v {
+				row = append(row, strconv.FormatFloat(x, 'g', -1, 64))
+			}
+			if err := w.Write(row); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		return w.Error()
+	}
+	type result struct {
+		Index     int       `json:"index"`
+		Input     string    `json:"input"`
+		Embedding []float64 `json:"embedding"`
+	}
+	results := make([]result, len(vectors))
+	for i, v := range vectors {
+		results[i] = result{Index: i, Input: inputs[i], Embedding: v}
+	}
+	return json.NewEncoder(os.Stdout).Encode(results)
+}
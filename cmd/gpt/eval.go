@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bduffany/gpt-cli/internal/eval"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+// runEval implements `gpt eval`, which checks the replies to a suite of
+// prompts against assertions.
+func runEval(ctx context.Context, client *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("eval", flag.ExitOnError)
+	suitePath := fs.String("suite", "", "YAML file of cases to run.")
+	modelList := fs.String("models", "", "Comma-separated models to run each case against, overriding the suite's models.")
+	judge := fs.String("judge_model", "", "Model that checks judge assertions, overriding the suite's judge.")
+	parallel := fs.Int("parallel", 4, "Max requests at once.")
+	jsonOut := fs.Bool("json", false, "Write the results as JSON lines instead of a report.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt eval -suite evals.yaml [flags]\n\nRuns each case of a suite against each model, and checks the replies\nagainst the case's assertions: contains, not_contains, regex, json_schema,\nor judge, which asks a judge model. Exits with status 1 if any case fails.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *suitePath == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	suite, err := eval.LoadSuite(*suitePath)
+	if err != nil {
+		return err
+	}
+	if *modelList != "" {
+		suite.Models = splitModels(*modelList)
+	}
+	if len(suite.Models) == 0 {
+		suite.Models = []string{*model}
+	}
+	if *judge != "" {
+		suite.Judge = *judge
+	}
+
+	mw, err := middleware()
+	if err != nil {
+		return err
+	}
+	c := llm.Chain(client, mw...)
+	results := (&eval.Runner{Client: c, Parallel: *parallel}).Run(ctx, suite)
+	failed := 0
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		for _, r := range results {
+			if !r.Passed() {
+				failed++
+			}
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+	} else {
+		failed = eval.Report(os.Stdout, results)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d cases failed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/bduffany/gpt-cli/internal/models"
+	"github.com/bduffany/gpt-cli/internal/textdiff"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+const (
+	explainChunkPrompt = `You explain code changes to a reviewer. For each file changed in the diff, write a heading like "### path/to/file", then explain what changed and why it matters, in a few sentences or bullets. Point out risks, such as changes in behavior or missing tests, if you see any. Don't restate the diff line by line. The diff may be part of a larger one; explain only the files in it.`
+
+	explainSummaryPrompt = `You summarize code changes for a reviewer. Given explanations of the changes to each file, write a short overall summary: what the change does as a whole, and what a reviewer should look at most closely. Reply with only the summary.`
+
+	// explainParallel is how many chunks of a diff are explained at once.
+	explainParallel = 4
+	// explainBytesPerToken is a rough average for code.
+	explainBytesPerToken = 4
+)
+
+// runExplainDiff implements `gpt explain-diff`, which explains the changes
+// in a git diff file by file, then summarizes them.
+func runExplainDiff(ctx context.Context, client *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("explain-diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt explain-diff [flags] [COMMIT | RANGE]\n\nExplains the changes to each file in a git diff, then summarizes them:\nthe uncommitted changes, or those of COMMIT, or of a RANGE like\nmain..HEAD. Large diffs are split into chunks that fit the model's\ncontext window, which are explained concurrently.\n\n")
+		fs.PrintDefaults()
+	}
+	chunkTokens := fs.Int("chunk_tokens", 0, "Max estimated tokens of diff sent in each request. 0 means half the model's context window.")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	diff, message, err := gitDiff(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	maxBytes := maxDiffLen
+	if *chunkTokens > 0 {
+		maxBytes = *chunkTokens * explainBytesPerToken
+	} else if m, ok := models.Lookup(*model); ok && m.ContextWindow > 0 {
+		maxBytes = m.ContextWindow / 2 * explainBytesPerToken
+	}
+	chunks := textdiff.SplitChunks(diff, maxBytes)
+	if len(chunks) == 0 {
+		return fmt.Errorf("no changes to explain")
+	}
+	preamble := ""
+	if message != "" {
+		preamble = "The commit message is:\n\n" + message + "\n\n"
+	}
+
+	explanations := make([]string, len(chunks))
+	errs := make([]error, len(chunks))
+	sem := make(chan struct{}, explainParallel)
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, diff string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if len(chunks) > 1 {
+				fmt.Fprintf(os.Stderr, "Explaining part %d of %d...\n", i+1, len(chunks))
+			}
+			explanations[i], _, errs[i] = completeQuietly(ctx, client, *model, explainChunkPrompt, preamble+"Explain this diff:\n\n"+diff)
+		}(i, chunk.Diff)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("explain %s: %w", strings.Join(chunks[i].Paths, ", "), err)
+		}
+	}
+
+	files := strings.TrimSpace(strings.Join(explanations, "\n\n"))
+	summary, _, err := completeQuietly(ctx, client, *model, explainSummaryPrompt, preamble+"Explanations of the changes to each file:\n\n"+files)
+	if err != nil {
+		return fmt.Errorf("summarize: %w", err)
+	}
+	fmt.Printf("## Summary\n\n%s\n\n## Changes by file\n\n%s\n", strings.TrimSpace(summary), files)
+	return nil
+}
+
+// gitDiff returns the diff of a commit or range, or of the uncommitted
+// changes if rev is empty, along with the commit's message if rev is a
+// single commit.
+func gitDiff(rev string) (diff, message string, err error) {
+	args := []string{"diff", "HEAD"}
+	single := rev != "" && !strings.Contains(rev, "..")
+	switch {
+	case single:
+		// The commit compared to its first parent.
+		args = []string{"diff", rev + "^!"}
+	case rev != "":
+		args = []string{"diff", rev}
+	}
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return "", "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	if single {
+		msg, err := exec.Command("git", "log", "-1", "--format=%B", rev).Output()
+		if err != nil {
+			return "", "", fmt.Errorf("git log %s: %w", rev, err)
+		}
+		message = strings.TrimSpace(string(msg))
+	}
+	return string(out), message, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/internal/codeblock"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+const filterSystemPrompt = `You are a text filter in a text editor. The user selected some text and gave an instruction. Apply the instruction to the text, and reply with only the resulting text, which replaces the selection.
+
+Keep the text's indentation, line endings, and style unless the instruction says otherwise. Don't add code fences around the text, explanations, or any other commentary.`
+
+// runFilter implements -filter: it applies an instruction to the text read
+// from stdin, and writes only the result to stdout, so that gpt can be
+// used as an editor filter, like :'<,'>!gpt -filter "sort by name". If the
+// request fails, the text is written back unchanged, so that the selection
+// isn't lost.
+func runFilter(ctx context.Context, client *openai.Client, instruction string) error {
+	if instruction == "" {
+		return fmt.Errorf("-filter needs an instruction")
+	}
+	b, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	text := string(b)
+	out, err := filterText(ctx, client, instruction, text)
+	if err != nil {
+		os.Stdout.WriteString(text)
+		return err
+	}
+	_, err = os.Stdout.WriteString(out)
+	return err
+}
+
+// filterText returns text with the instruction applied.
+func filterText(ctx context.Context, client *openai.Client, instruction, text string) (string, error) {
+	c, err := newChat(client, *model, filterSystemPrompt)
+	if err != nil {
+		return "", err
+	}
+	c.ShowThinking = false
+	c.Display = io.Discard
+	c.Notes = io.Discard
+	out, err := complete(ctx, c, "Instruction: "+instruction+"\n\nText:\n\n"+text)
+	if err != nil {
+		return "", err
+	}
+	out = unfence(out, text)
+	// Match the selection's final newline, which editors expect back.
+	if strings.HasSuffix(text, "\n") && !strings.HasSuffix(out, "\n") {
+		out += "\n"
+	} else if !strings.HasSuffix(text, "\n") {
+		out = strings.TrimRight(out, "\n")
+	}
+	return out, nil
+}
+
+// unfence returns the code in reply if the whole reply is one fenced code
+// block, which models add despite being asked not to, unless the text
+// filtered was fenced too.
+func unfence(reply, text string) string {
+	trimmed := strings.TrimSpace(reply)
+	if !strings.HasPrefix(trimmed, "```") || !strings.HasSuffix(trimmed, "```") || strings.HasPrefix(strings.TrimSpace(text), "```") {
+		return reply
+	}
+	blocks := codeblock.Parse(trimmed)
+	if len(blocks) != 1 {
+		return reply
+	}
+	return blocks[0].Code
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+const (
+	defaultFollowInstructions = "Summarize what these new log lines show, and flag anything anomalous, such as errors, unusual latency, or suspicious activity. If nothing notable happened, say so in one line."
+
+	// maxBatchLines bounds the size of a single batch, so that a burst of
+	// output doesn't produce a huge prompt.
+	maxBatchLines = 500
+	// followHistory is the number of past batches (and their replies) kept in
+	// context, so the model can spot trends without the context growing
+	// forever.
+	followHistory = 5
+)
+
+// runFollow tails stdin or a file, and asks the model to analyze new lines in
+// batches.
+func runFollow(ctx context.Context, client *openai.Client, instructions string) error {
+	if instructions == "" {
+		instructions = defaultFollowInstructions
+	}
+	var delim *regexp.Regexp
+	if *followDelimiter != "" {
+		var err error
+		delim, err = regexp.Compile(*followDelimiter)
+		if err != nil {
+			return fmt.Errorf("invalid -follow_delimiter: %w", err)
+		}
+	}
+
+	var r io.Reader = os.Stdin
+	if *followFile != "" {
+		f, err := os.Open(*followFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = &tailReader{f: f}
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+	}
+	lines := make(chan string)
+	errs := make(chan error, 1)
+	go func() {
+		s := bufio.NewScanner(r)
+		s.Buffer(nil, 1<<20)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+		errs <- s.Err()
+		close(lines)
+	}()
+
+	c, err := newChat(client, *model, "You are a log analyst watching a live stream of log lines. "+instructions)
+	if err != nil {
+		return err
+	}
+	base := len(c.Messages)
+	var batch []string
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		fmt.Fprintf(c.Display, "%s--- %s: %d new lines ---%s\n", chat.Color(chat.StyleNote), time.Now().Format(time.TimeOnly), len(batch), chat.Esc())
+		_, err := complete(ctx, c, strings.Join(batch, "\n"))
+		batch = nil
+		// Drop the oldest batches once the history limit is reached.
+		if n := len(c.Messages) - base; n > 2*followHistory {
+			c.Messages = append(c.Messages[:base], c.Messages[len(c.Messages)-2*followHistory:]...)
+		}
+		return err
+	}
+
+	ticker := time.NewTicker(*followInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				if err := flush(); err != nil {
+					return err
+				}
+				return <-errs
+			}
+			batch = append(batch, line)
+			if len(batch) >= maxBatchLines || (delim != nil && delim.MatchString(line)) {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// tailReader reads from a file, waiting for more data to be appended at EOF
+// like `tail -f`. If the file is truncated, it reads from the start again.
+type tailReader struct {
+	f *os.File
+}
+
+func (t *tailReader) Read(p []byte) (int, error) {
+	for {
+		n, err := t.f.Read(p)
+		if n > 0 || err != io.EOF {
+			return n, err
+		}
+		pos, err := t.f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+		if info, err := t.f.Stat(); err == nil && info.Size() < pos {
+			if _, err := t.f.Seek(0, io.SeekStart); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
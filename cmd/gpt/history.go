@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/history"
+	"github.com/bduffany/gpt-cli/internal/session"
+	"github.com/bduffany/gpt-cli/internal/templates"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+// runHistory implements `gpt history`, which analyzes the prompts in saved
+// sessions.
+func runHistory(ctx context.Context, _ *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	n := fs.Int("n", 20, "Number of prompts to list.")
+	since := fs.String("since", "0", "Only include sessions updated this long ago, like 30d or 12h. 0 includes all sessions.")
+	minCount := fs.Int("min", 3, "Suggest a template for prompts that start the same way at least this many times.")
+	save := fs.Bool("save", false, "Save the suggested templates that don't exist yet.")
+	fs.Usage = func() {
+		dir, _ := templates.Dir()
+		fmt.Fprintf(fs.Output(), "usage: gpt history top [flags]\n\nLists the prompts sent most often in saved sessions, ignoring case and\nwhitespace. Then suggests templates for prompts that start with the same\ninstruction, like \"Translate to French: ...\", which -save writes to\n%s for `gpt run`.\n\n", dir)
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 || args[0] != "top" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	fs.Parse(args[1:])
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	age, err := session.ParseAge(*since)
+	if err != nil {
+		return fmt.Errorf("-since: %w", err)
+	}
+	store, err := sessionStore()
+	if err != nil {
+		return err
+	}
+	sessions, err := store.List()
+	if err != nil {
+		return err
+	}
+	if age > 0 {
+		start := time.Now().Add(-age)
+		var recent []*session.Session
+		for _, s := range sessions {
+			if !s.Updated.Before(start) {
+				recent = append(recent, s)
+			}
+		}
+		sessions = recent
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "COUNT\tSESSIONS\tLAST\tPROMPT")
+	for _, p := range history.Top(sessions, *n) {
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%s\n", p.Count, p.Sessions, p.Last.Format(time.DateOnly), oneLine(p.Text, 60))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	suggestions := history.Suggest(sessions, *minCount)
+	if len(suggestions) == 0 {
+		return nil
+	}
+	dir, err := templates.Dir()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nThese prompts recur with different input, and could be templates:\n\n")
+	for _, s := range suggestions {
+		fmt.Printf("  %s (%d times): %s\n", s.Name, s.Count, oneLine(s.Stem+" "+s.Example, 60))
+	}
+	if !*save {
+		fmt.Printf("\nRun `gpt history top -save` to save them to %s, then run one\nwith `gpt run NAME INPUT`.\n", dir)
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	fmt.Println()
+	for _, s := range suggestions {
+		if _, err := templates.Load(s.Name); err == nil {
+			fmt.Printf("Skipped %s, which already exists\n", s.Name)
+			continue
+		}
+		path := filepath.Join(dir, s.Name+".md")
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = f.WriteString(s.Body())
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Saved %s\n", path)
+	}
+	return nil
+}
+
+// oneLine returns s with its whitespace collapsed, cut to at most n runes.
+func oneLine(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+// hookScript runs `gpt hook` from a git hook. Commits go ahead without a
+// message from gpt if it isn't installed.
+const hookScript = `#!/bin/sh
+# Installed by ` + "`gpt hook install`" + `.
+command -v gpt >/dev/null 2>&1 || exit 0
+exec gpt hook %s "$@"
+`
+
+// runHook implements `gpt hook`, which writes commit messages from git
+// hooks. It's an offline command, so that a missing API key doesn't abort
+// commits: errors writing a message are only warnings.
+func runHook(ctx context.Context, _ *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("hook", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt hook install [-f] [prepare-commit-msg | commit-msg]\n       gpt hook prepare-commit-msg MSG_FILE [SOURCE [SHA]]\n       gpt hook commit-msg MSG_FILE\n\nWrites commit messages for the staged changes from git hooks.\nprepare-commit-msg fills in a message when git has none yet, as for a\nplain `git commit`, so that it can be edited before committing.\ncommit-msg writes one when the message was left empty. Install adds the\nhook to the current repo, prepare-commit-msg by default. Prompts are\nscrubbed of secrets before they're sent unless -scrub_secrets=false.\n\n")
+		fs.PrintDefaults()
+	}
+	force := fs.Bool("f", false, "Replace an existing hook when installing.")
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	verb, args := args[0], args[1:]
+	fs.Parse(args)
+	switch verb {
+	case "install":
+		name := "prepare-commit-msg"
+		switch fs.NArg() {
+		case 0:
+		case 1:
+			name = fs.Arg(0)
+		default:
+			fs.Usage()
+			os.Exit(2)
+		}
+		if name != "prepare-commit-msg" && name != "commit-msg" {
+			fs.Usage()
+			os.Exit(2)
+		}
+		return installHook(name, *force)
+	case "prepare-commit-msg":
+		if fs.NArg() < 1 || fs.NArg() > 3 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		// Only fill in a message when git has none, rather than for -m, -F,
+		// templates, merges, squashes, or amends.
+		if fs.Arg(1) != "" {
+			return nil
+		}
+		return hookMessage(ctx, fs.Arg(0), true)
+	case "commit-msg":
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		return hookMessage(ctx, fs.Arg(0), false)
+	}
+	fs.Usage()
+	os.Exit(2)
+	return nil
+}
+
+// hookMessage writes a message for the staged changes to a commit message
+// file, if it has no message yet. If keepComments is set, the comments
+// that git adds for the editor are kept below the message.
+func hookMessage(ctx context.Context, path string, keepComments bool) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if hasMessage(string(b)) {
+		return nil
+	}
+	msg, err := generateCommitMessage(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, chat.Styled(chat.StyleWarning, "gpt: no commit message written: "+err.Error()))
+		return nil
+	}
+	if keepComments {
+		msg += "\n" + string(b)
+	}
+	return os.WriteFile(path, []byte(msg), 0644)
+}
+
+// hasMessage returns whether a commit message file has any lines besides
+// comments and blank lines.
+func hasMessage(s string) bool {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			return true
+		}
+	}
+	return false
+}
+
+// generateCommitMessage asks the model for a message for the staged
+// changes, without displaying it.
+func generateCommitMessage(ctx context.Context) (string, error) {
+	client, err := newClient()
+	if err != nil {
+		return "", err
+	}
+	prompt, err := commitPrompt("")
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(os.Stderr, "Writing a commit message with %s...\n", *model)
+	msg, _, err := completeQuietly(ctx, client, *model, commitSystemPrompt, prompt)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(msg) + "\n", nil
+}
+
+// installHook adds a git hook to the current repo that runs `gpt hook`.
+func installHook(name string, force bool) error {
+	out, err := exec.Command("git", "rev-parse", "--git-path", "hooks").Output()
+	if err != nil {
+		return fmt.Errorf("not in a git repo: %w", err)
+	}
+	path := filepath.Join(strings.TrimSpace(string(out)), name)
+	if _, err := os.Stat(path); err == nil && !force {
+		return fmt.Errorf("%s already exists; pass -f to replace it", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(fmt.Sprintf(hookScript, name)), 0755); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Installed %s\n", path)
+	return nil
+}
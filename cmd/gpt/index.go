@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bduffany/gpt-cli/internal/rag"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+// runIndex implements `gpt index`, which builds a retrieval index for use
+// with -rag.
+func runIndex(ctx context.Context, client *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt index [flags] DIR\n\nEmbeds the files in DIR so they can be searched with gpt -rag.\n\n")
+		fs.PrintDefaults()
+	}
+	out := fs.String("o", "", "Path to write the index to. Defaults to "+rag.DefaultFilename+" in DIR.")
+	model := fs.String("model", rag.DefaultModel, "Embedding model to use.")
+	chunkLines := fs.Int("chunk_lines", 60, "Max number of lines per indexed chunk.")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	dir := fs.Arg(0)
+	if *out == "" {
+		*out = filepath.Join(dir, rag.DefaultFilename)
+	}
+
+	ix, err := rag.Build(ctx, client, dir, rag.BuildOptions{
+		Model:      *model,
+		ChunkLines: *chunkLines,
+	})
+	if err != nil {
+		return err
+	}
+	if err := ix.Save(*out); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Indexed %d chunks to %s\n", len(ix.Chunks), *out)
+	return nil
+}
@@ -2,69 +2,381 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/bduffany/gpt-cli/internal/api"
+	"github.com/bduffany/gpt-cli/internal/attach"
 	"github.com/bduffany/gpt-cli/internal/auto"
-	"github.com/bduffany/gpt-cli/internal/chat"
+	"github.com/bduffany/gpt-cli/internal/codeblock"
+	"github.com/bduffany/gpt-cli/internal/config"
+	"github.com/bduffany/gpt-cli/internal/council"
+	"github.com/bduffany/gpt-cli/internal/fallback"
+	"github.com/bduffany/gpt-cli/internal/httpx"
+	"github.com/bduffany/gpt-cli/internal/log"
+	"github.com/bduffany/gpt-cli/internal/models"
+	"github.com/bduffany/gpt-cli/internal/otlp"
+	"github.com/bduffany/gpt-cli/internal/pager"
+	"github.com/bduffany/gpt-cli/internal/pin"
+	"github.com/bduffany/gpt-cli/internal/project"
+	"github.com/bduffany/gpt-cli/internal/rag"
+	"github.com/bduffany/gpt-cli/internal/ratelimit"
+	"github.com/bduffany/gpt-cli/internal/refine"
+	"github.com/bduffany/gpt-cli/internal/repomap"
+	"github.com/bduffany/gpt-cli/internal/respcache"
+	"github.com/bduffany/gpt-cli/internal/scrub"
+	"github.com/bduffany/gpt-cli/internal/search"
+	"github.com/bduffany/gpt-cli/internal/stats"
+	"github.com/bduffany/gpt-cli/internal/status"
+	"github.com/bduffany/gpt-cli/internal/vt"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+	"github.com/mattn/go-isatty"
 
 	_ "embed"
 )
 
 var (
-	model      = flag.String("model", "gpt-4o-2024-08-06", "`gpt-*` model to use")
+	model      = flag.String("model", models.Default, "`gpt-*` model to use")
 	listModels = flag.Bool("models", false, "List available models and exit.")
+	effort     = flag.String("effort", "", "Reasoning effort for reasoning models: "+strings.Join(models.Efforts, ", ")+". Supported values depend on the model.")
 
-	systemPrompt = flag.String("system", "You are a helpful assistant.", "System prompt.")
-	promptFile   = flag.String("prompt_file", "", "Load prompt from a file at this path. If unset, read from stdin.")
-	interactive  = flag.Bool("interactive", false, "Start an interactive session even after loading prompt_file or reading the prompt from args. stdin must be a terminal.")
+	systemPrompt        = flag.String("system", "You are a helpful assistant.", "System prompt.")
+	repoMap             = flag.Bool("repo_map", false, "Add a map of the files and exported symbols in the working directory to the system prompt, in chat and -auto modes. See `gpt repomap`.")
+	projectInstructions = flag.Bool("project_instructions", true, "Add instructions from AGENTS.md, CLAUDE.md, or .gpt/instructions.md in the working directory and its parents, up to the git root, to the system prompt.")
+	useProjectConfig    = flag.Bool("project_config", true, "Apply the settings in the nearest .gpt.yaml in the working directory or its parents, up to the git root: the model, system prompt, pinned files, -auto tool permissions, and -rag index.")
+	promptFile          = flag.String("prompt_file", "", "Load prompt from a file at this path. If unset, read from stdin.")
+	audioPrompt         = flag.String("audio", "", "Transcribe the audio file at this path and use the text as the prompt. Use - to read audio from stdin.")
+	recordPrompt        = flag.Bool("record", false, "Record the prompt from the microphone until Enter is pressed, then transcribe it and use the text as the prompt. Needs sox, arecord, or ffmpeg.")
+	saveSessions        = flag.Bool("save", true, "Save interactive sessions after each reply, to resume later with -resume. See `gpt sessions`.")
+	titleModel          = flag.String("title_model", models.Small, "Model that titles saved sessions from their first exchange. Empty titles them with their first prompt instead.")
+	resume              = flag.String("resume", "", "Resume the saved session with this ID, or `last` for the most recent one.")
+	interactive         = flag.Bool("interactive", false, "Start an interactive session even after loading prompt_file or reading the prompt from args or stdin. If stdin is piped, later prompts are read from the terminal.")
 
-	autoMode = flag.Bool("auto", false, "Function as a fully automated assistant, with access to tools.")
+	filter          = flag.Bool("filter", false, "Apply the instruction in args to the text read from stdin, and write only the resulting text to stdout, for editor filters like :'<,'>!gpt -filter \"sort by name\" in Vim. If the request fails, the text is written back unchanged.")
+	follow          = flag.Bool("follow", false, "Follow stdin (or -follow_file) like tail -f, and analyze new lines in batches. Args are instructions for the analysis.")
+	followFile      = flag.String("follow_file", "", "File to follow with -follow, instead of stdin.")
+	followInterval  = flag.Duration("follow_interval", 10*time.Second, "How often to analyze new lines with -follow.")
+	followDelimiter = flag.String("follow_delimiter", "", "Regexp matching lines that end a batch with -follow, such as the end of a request.")
+
+	autoMode           = flag.Bool("auto", false, "Function as a fully automated assistant, with access to tools.")
+	autoPlan           = flag.Bool("auto_plan", false, "Have the -auto agent propose a plan for each task and wait for approval before running commands.")
+	autoHTTPTimeout    = flag.Duration("auto_http_timeout", auto.DefaultHTTPTimeout, "Max time for each HTTP request made by the agent's curl command.")
+	autoSecretEnv      = flag.String("auto_secret_env", "", "Comma-separated env vars that the agent may reference as ${NAME} in curl headers, such as `GITHUB_TOKEN`. Their values are never shown to the model.")
+	autoAudit          = flag.Bool("auto_audit", true, "Record each -auto session's commands, confirmations, file writes, and HTTP requests to a JSONL audit log.")
+	autoAuditLog       = flag.String("auto_audit_log", "", "Path of the -auto audit log to append to. Defaults to a new file per session in the audit directory under the state dir. See `gpt config path`.")
+	autoMaxTurns       = flag.Int("auto_max_turns", auto.DefaultMaxTurns, "Max model replies per -auto task, from one prompt to the next. Once any limit is reached, the agent summarizes its work and prompts for what to do next. -1 means no limit.")
+	autoMaxTokens      = flag.Int("auto_max_tokens", 0, "Max tokens per -auto task. 0 means no limit.")
+	autoMaxTime        = flag.Duration("auto_max_time", 0, "Max time per -auto task. 0 means no limit.")
+	autoMaxCost        = flag.Float64("auto_max_cost", 0, "Max cost in USD per -auto task, for models with known pricing. 0 means no limit.")
+	autoPolicy         = flag.String("auto_policy", "", "Path of a YAML policy setting which -auto tools are allowed, need confirmation, or are denied. Defaults to policy.yaml in the config dir, if it exists.")
+	autoCheckpoint     = flag.Bool("auto_checkpoint", true, "Snapshot the git working tree before the -auto agent's first write, so its changes can be reviewed with /diff and reverted with /rollback.")
+	autoSandbox        = flag.Bool("auto_sandbox", false, "Run the -auto agent's file commands in a disposable container, with the working directory mounted read-write.")
+	autoSandboxImage   = flag.String("auto_sandbox_image", auto.DefaultSandboxImage, "Container image for -auto_sandbox.")
+	autoSandboxNetwork = flag.String("auto_sandbox_network", "none", "Container network for -auto_sandbox, such as `bridge`. Defaults to no network access.")
+	autoSandboxRuntime = flag.String("auto_sandbox_runtime", "docker", "Container CLI for -auto_sandbox, such as `podman`.")
+	autoOutputLimit    = flag.String("auto_output_limit", strconv.Itoa(auto.DefaultOutputLimit), "Max bytes of command output fed back to the model with -auto, optionally followed by per-command limits, like `16000,curl=8000`. -1 means no limit.")
+
+	connectTimeout    = flag.Duration("connect_timeout", 30*time.Second, "Max time to wait for the API to start responding. 0 means no limit.")
+	firstTokenTimeout = flag.Duration("first_token_timeout", 5*time.Minute, "Max time to wait for the first token of a reply. 0 means no limit.")
+	timeout           = flag.Duration("timeout", 10*time.Minute, "Max total time for a single reply. 0 means no limit.")
+
+	web          = flag.Bool("web", false, "Let the model search the web before replying. Requires a search model, such as gpt-4o-search-preview.")
+	searchEngine = flag.String("search_engine", "openai", "Engine for the agent's search command: openai, searxng (with -searxng_url), or brave (with BRAVE_API_KEY). Empty disables search.")
+	searxngURL   = flag.String("searxng_url", "", "Base URL of the SearXNG instance to use with -search_engine=searxng.")
+
+	attachFiles = flag.Bool("attach", true, "Attach the contents of files and web pages referenced in prompts as @path or @URL, such as @main.go.")
+	attachTrim  = flag.Bool("attach_trim", false, "Strip license headers from files attached with @path, and leave out minified files, to save tokens.")
+	attachMax   = flag.Int("attach_max_tokens", attach.DefaultMaxTokens, "Estimated token budget for the files attached from each directory referenced as @dir/, and for each web page.")
+
+	councilModels = flag.String("council", "", "Comma-separated models to ask each prompt, before -model merges their answers into the reply.")
+	councilPrompt = flag.String("council_prompt", "", "Instructions for merging the answers of -council, in place of the default.")
+	refineRounds  = flag.Int("refine", 0, "Rounds of critique and revision the model runs on each answer before it's shown.")
+	refinePrompt  = flag.String("refine_prompt", "", "Prompt asking the model to critique its answer for -refine, in place of the default.")
+
+	ragIndex = flag.String("rag", "", "Path to an index built with `gpt index`. The most relevant chunks are added as context to each prompt.")
+	ragK     = flag.Int("rag_k", 5, "Number of chunks to retrieve per prompt with -rag.")
+
+	speak      = flag.Bool("speak", false, "Read replies aloud.")
+	speakVoice = flag.String("voice", defaultVoice, "Voice to use with -speak.")
+	speakSpeed = flag.Float64("speed", 1, "Speech speed to use with -speak, from 0.25 to 4.")
+
+	noCache        = flag.Bool("no_cache", false, "Don't reuse cached replies. Non-interactive runs otherwise return a cached reply for an identical request made within -cache_ttl.")
+	cacheTTL       = flag.Duration("cache_ttl", respcache.DefaultTTL, "How long replies to non-interactive runs are cached.")
+	showUsage      = flag.Bool("show_usage", false, "Display the tokens used by each reply, including input tokens read from the prompt cache, and the cost for models with known pricing.")
+	recordStats    = flag.Bool("stats", true, "Record the tokens used and latency of each reply, for `gpt stats`.")
+	promptCacheKey = flag.String("prompt_cache_key", "", "Key sent with each request so that requests sharing a long prefix, like the turns of a session, are routed to the same prompt cache.")
+	otelEndpoint   = flag.String("otel_endpoint", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "OTLP/HTTP collector to export trace spans to, such as `http://localhost:4318`, with a span for each completion request, -auto turn, and command. Headers are read from OTEL_EXPORTER_OTLP_HEADERS.")
+	showThinking   = flag.Bool("show_thinking", false, "Display the model's reasoning dimmed before each reply, if the API exposes it.")
+	codeOnly       = flag.Bool("code_only", false, "In non-interactive runs, write only the code from the fenced code blocks of the reply, or the whole reply if it has none.")
+	codeBlock      = flag.String("code_block", "", "Which code blocks -code_only writes: a number, counting from 1, or a language, such as `bash`. Empty writes all of them.")
+	pageReplies    = flag.Bool("pager", false, "In non-interactive runs on a terminal, show the reply in $PAGER once it's complete if it's longer than the screen, instead of streaming it.")
+	outFile        = flag.String("out", "", "File to copy each reply to as it streams, in addition to displaying it. The file is overwritten unless -append_out is set.")
+	appendOut      = flag.Bool("append_out", false, "Append to the -out file instead of overwriting it.")
+	outExchange    = flag.Bool("out_exchange", false, "Also write each prompt to the -out file, for a transcript of the full exchange.")
+	quiet          = flag.Bool("q", false, "Don't write warnings, reasoning, or usage to stderr in non-interactive runs. Errors are still written.")
+	raw            = flag.Bool("raw", false, "Write the API's response stream to stdout as received, such as server-sent events, instead of the reply text.")
+	dryRun         = flag.Bool("dry_run", false, "Print the JSON body of the first request to the API, with the assembled messages and parameters, and exit without sending it.")
+	scrubSecrets   = flag.Bool("scrub_secrets", true, "Mask obvious secrets, such as AWS keys, API tokens, and private keys, in prompts before they're sent, with a warning, and apply the redact settings in the config file.")
+	fallbackModels = flag.String("fallback", "", "Comma-separated models to retry a request on, in order, if it fails on its model before the reply starts, such as for a rate limit, an overload, or the content filter.")
+	wrapLines      = flag.Bool("wrap", true, "Break lines of replies between words to fit the terminal, instead of letting the terminal break them mid-word. Code blocks aren't wrapped.")
+	renderMath     = flag.Bool("render_math", true, "Display LaTeX math in replies, like $x^2$ or \\[x^2\\], as unicode, like x², when output is a terminal. Files from -out keep the LaTeX.")
+	renderTables   = flag.Bool("render_tables", true, "Draw markdown tables in replies with box drawing characters, fit to the terminal, when output is a terminal. Files from -out keep the markdown.")
+	showSpinner    = flag.Bool("spinner", true, "Show an animated indicator with the elapsed time while waiting for each reply to start, when output is a terminal.")
+	showProgress   = flag.Bool("reasoning_progress", false, "Show the latest line of the model's reasoning next to the spinner as it thinks, for servers that stream reasoning. -show_thinking displays it in full instead.")
+	notifyDone     = flag.Bool("notify", false, "Send a desktop notification when a reply or -auto task that took over 10s finishes, using notify-send, osascript, or a Windows toast.")
+	statusFile     = flag.String("status_file", "", "Keep a one-line status in the file at this `path`, like \"gpt-4.1 $0.0123 thinking…\", for tmux or screen status bars: the model, the cost of the session so far, and whether it's waiting on the model. Removed on exit.")
+	statusTitle    = flag.Bool("status_title", false, "Set the terminal title to the status, as for -status_file, so that tmux can show it as #{pane_title}.")
+	autoContinue   = flag.Int("auto_continue", 0, "Automatically continue replies truncated by max tokens, up to this many times. After that, interactive sessions ask whether to continue.")
 )
 
+// tracer exports spans to -otel_endpoint. It is nil if tracing is disabled.
+var tracer *otlp.Exporter
+
+// userConfig is the config file, loaded at startup.
+var userConfig *config.Config
+
+// projectConfig is the .gpt.yaml of the project in the working directory,
+// loaded at startup. It is nil if there is none, or -project_config=false.
+var projectConfig *project.Config
+
+// limiter enforces the rate limits in the config file across all the
+// requests of the process. It is nil if there are none.
+var limiter *ratelimit.Limiter
+
 func main() {
-	if err := run(); err != nil {
+	if err := run(); err != nil && !errors.Is(err, errDryRun) {
 		fmt.Fprintf(os.Stderr, "error: %s\n", err)
 		os.Exit(1)
 	}
 }
 
 func run() error {
+	flag.Usage = usage
 	flag.Parse()
 
 	ctx := context.Background()
 
-	token := os.Getenv("OPENAI_API_KEY")
-	if token == "" {
-		return fmt.Errorf("missing OPENAI_API_KEY env var")
+	if !vt.Enable() {
+		// The console would print escape sequences literally.
+		os.Setenv("NO_COLOR", "1")
+	}
+
+	if *otelEndpoint != "" {
+		tracer = otlp.NewExporter(*otelEndpoint, "gpt-cli")
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := tracer.Flush(ctx); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %s\n", err)
+			}
+		}()
+	}
+
+	var err error
+	userConfig, err = config.Load()
+	if err != nil {
+		return err
+	}
+	if !isFlagSet("model") && userConfig.Model != "" {
+		*model = userConfig.Model
+	}
+	if *useProjectConfig {
+		if projectConfig, err = project.LoadConfig("."); err != nil {
+			return err
+		}
+	}
+	if projectConfig != nil {
+		log.Debugf("Using project config %s", projectConfig.Path)
+		if !isFlagSet("model") && projectConfig.Model != "" {
+			*model = projectConfig.Model
+		}
+		if !isFlagSet("system") && projectConfig.System != "" {
+			*systemPrompt = projectConfig.System
+		}
+		if !isFlagSet("rag") && projectConfig.RAG != "" {
+			*ragIndex = projectConfig.Resolve(projectConfig.RAG)
+		}
+	}
+	if err := setTheme(userConfig.Theme); err != nil {
+		return err
+	}
+	if len(userConfig.RateLimits) > 0 {
+		if limiter, err = ratelimit.New(userConfig.RateLimits); err != nil {
+			return err
+		}
+		limiter.Notef = func(format string, args ...any) {
+			fmt.Fprintln(os.Stderr, chat.Styled(chat.StyleNote, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	cmd, ok := lookupCommand(flag.Args())
+	if ok && cmd.offline {
+		return cmd.run(ctx, nil, flag.Args()[1:])
+	}
+	client, err := newClient()
+	if errors.Is(err, errNoAPIKey) && canSetup() {
+		var id string
+		if client, id, err = setup(ctx); err != nil {
+			return err
+		}
+		if !isFlagSet("model") && (projectConfig == nil || projectConfig.Model == "") {
+			*model = id
+		}
+		if flag.NArg() == 0 {
+			// Don't drop into a chat straight after setup.
+			return nil
+		}
+	}
+	if err != nil {
+		return err
 	}
-	client := &api.Client{Token: token}
 	if *listModels {
 		return printAvailableModels(ctx, client)
 	}
+	if ok {
+		return cmd.run(ctx, client, flag.Args()[1:])
+	}
+	return startChat(ctx, client, flag.Args())
+}
 
-	// TODO: allow loading messages from a previous session
-	var messages []api.Message
-	if *systemPrompt != "" {
-		messages = append(messages, api.Message{
-			Role:    "system",
-			Content: *systemPrompt,
-		})
+// startChat runs `gpt chat`, or `gpt agent` if -auto is set, with args as
+// the first prompt.
+func startChat(ctx context.Context, client *openai.Client, args []string) error {
+	if *follow {
+		return runFollow(ctx, client, strings.Join(args, " "))
 	}
-	c, err := chat.New(client, messages)
+	if *filter {
+		return runFilter(ctx, client, strings.Join(args, " "))
+	}
+
+	var instructions string
+	if *projectInstructions {
+		var err error
+		instructions, err = project.Instructions(".")
+		if err != nil {
+			return err
+		}
+	}
+
+	if *repoMap {
+		m, err := repomap.Build(".", repomap.DefaultMaxBytes)
+		if err != nil {
+			return fmt.Errorf("repo map: %w", err)
+		}
+		if instructions != "" {
+			instructions += "\n\n"
+		}
+		instructions += "Map of the files in the working directory, with their exported symbols:\n\n" + m
+	}
+
+	system := *systemPrompt
+	if instructions != "" {
+		system = instructions + "\n\n" + system
+	}
+	c, err := newChat(client, *model, system)
 	if err != nil {
 		return err
 	}
-	c.Model = *model
+	if *statusFile != "" || *statusTitle {
+		var title io.Writer
+		if *statusTitle && isatty.IsTerminal(os.Stderr.Fd()) {
+			title = os.Stderr
+		}
+		r := status.New(c.Model, *statusFile, title)
+		defer r.Close()
+		c.Client = llm.Chain(c.Client, r.Middleware)
+	}
 	if *autoMode {
-		return auto.Run(ctx, c)
+		opts, err := autoOptions(client)
+		if err != nil {
+			return err
+		}
+		opts.Instructions = instructions
+		if *notifyDone {
+			opts.TaskDone = notifyTask
+		}
+		if *autoAudit {
+			f, err := openAuditLog()
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			opts.Audit = auto.NewAuditLog(f)
+		}
+		if len(args) > 0 {
+			c.PromptReader = strings.NewReader(strings.Join(args, " "))
+		}
+		preconnect(client)
+		setTerminal(c)
+		return auto.Run(ctx, c, opts)
+	}
+
+	pins := &pin.Set{}
+	if projectConfig != nil && len(projectConfig.Pin) > 0 {
+		var paths []string
+		for _, p := range projectConfig.Pin {
+			paths = append(paths, projectConfig.Resolve(p))
+		}
+		if err := pins.Add(paths...); err != nil {
+			return fmt.Errorf("%s: %w", projectConfig.Path, err)
+		}
+	}
+	pins.Register(c)
+	codeblock.Register(c)
+	pager.Register(c)
+	if *notifyDone {
+		notifyReplies(c)
+	}
+	registerSummarize(c)
+	if *attachFiles {
+		(&attach.Expander{Trim: *attachTrim, MaxTokens: *attachMax}).Register(c)
+	}
+	var cc *council.Client
+	if *councilModels != "" {
+		if *refineRounds > 0 {
+			return fmt.Errorf("-refine can't be combined with -council")
+		}
+		cc = newCouncil(c)
+	}
+	if *refineRounds > 0 {
+		c.Client = &refine.Client{
+			Client: c.Client,
+			Rounds: *refineRounds,
+			Prompt: *refinePrompt,
+			Notef: func(format string, args ...any) {
+				c.Notef(chat.StyleNote, format, args...)
+			},
+			UsageHooks: c.UsageHooks,
+		}
 	}
 
-	promptFromArgs := strings.Join(flag.Args(), " ")
-	if *promptFile != "" {
+	promptFromArgs := strings.Join(args, " ")
+	if *recordPrompt {
+		if *audioPrompt != "" {
+			return fmt.Errorf("-record and -audio can't be used together")
+		}
+		text, err := recordAndTranscribe(ctx, client)
+		if err != nil {
+			return fmt.Errorf("record: %w", err)
+		}
+		c.PromptReader = strings.NewReader(text)
+		c.Interactive = *interactive
+	} else if *audioPrompt != "" {
+		text, err := transcribeFile(ctx, client, &openai.TranscriptionRequest{Model: models.Transcription}, *audioPrompt)
+		if err != nil {
+			return fmt.Errorf("transcribe %s: %w", *audioPrompt, err)
+		}
+		c.PromptReader = strings.NewReader(text)
+		c.Interactive = *interactive
+	} else if *promptFile != "" {
 		f, err := os.Open(*promptFile)
 		if err != nil {
 			return fmt.Errorf("open %s: %w", *promptFile, err)
@@ -76,21 +388,449 @@ func run() error {
 		c.PromptReader = strings.NewReader(promptFromArgs)
 		c.Interactive = *interactive
 	}
+	if *interactive && !isatty.IsTerminal(os.Stdin.Fd()) {
+		// stdin is a pipe, which is read for the first prompt unless one was
+		// given already, so read the rest from the terminal.
+		tty, err := chat.OpenTerminal()
+		if err != nil {
+			return fmt.Errorf("-interactive: stdin is not a terminal: %w", err)
+		}
+		defer tty.Close()
+		c.Terminal = tty
+		c.Interactive = true
+	}
+	if *saveSessions && (c.Interactive || *resume != "") {
+		closeSession, err := autosave(c, cc)
+		if err != nil {
+			return err
+		}
+		defer closeSession()
+	}
+	if *outFile != "" {
+		mode := os.O_TRUNC
+		if *appendOut {
+			mode = os.O_APPEND
+		}
+		f, err := os.OpenFile(*outFile, os.O_WRONLY|os.O_CREATE|mode, 0644)
+		if err != nil {
+			return fmt.Errorf("-out: %w", err)
+		}
+		defer f.Close()
+		c.Out = f
+		c.OutPrompts = *outExchange
+	}
+	if c.Interactive {
+		preconnect(client)
+	} else {
+		// Keep stdout to just the reply, so that it can be piped.
+		c.Notes = os.Stderr
+		if *quiet {
+			c.Notes = io.Discard
+		}
+		if *codeOnly {
+			c.Display = io.Discard
+			c.ReplyHooks = append(c.ReplyHooks, writeCode)
+		} else if *pageReplies && isatty.IsTerminal(os.Stdout.Fd()) {
+			c.Display = io.Discard
+			c.ReplyHooks = append(c.ReplyHooks, pageReply)
+		}
+	}
+	// The cache is keyed by the request, which doesn't say whether the reply
+	// was refined or merged from a council, so those replies aren't cached.
+	if !c.Interactive && !*noCache && !*dryRun && !*raw && cc == nil && *refineRounds == 0 {
+		dir, err := userConfig.Locate(config.Cache, "responses")
+		if err != nil {
+			return err
+		}
+		c.Client = llm.Chain(c.Client, respcache.Middleware(dir, *cacheTTL))
+	}
+	setTerminal(c)
 	if err := c.Run(ctx); err != nil {
 		return err
 	}
 	return nil
 }
 
-func printAvailableModels(ctx context.Context, c *api.Client) error {
-	rsp := &api.GenericObject{}
-	if err := c.GetJSON(ctx, "/v1/models", rsp); err != nil {
+// setTerminal sets the options of c that need a terminal. It shows a
+// spinner while c waits for replies to start, if its notes go to a
+// terminal and -spinner is set, with reasoning progress if
+// -reasoning_progress is set, and wraps replies and renders their math and
+// tables if -wrap, -render_math, and -render_tables are set.
+func setTerminal(c *chat.Chat) {
+	w := c.Notes
+	if w == nil {
+		w = c.Display
+	}
+	f, ok := w.(*os.File)
+	c.Spinner = *showSpinner && ok && isatty.IsTerminal(f.Fd()) && os.Getenv("TERM") != "dumb"
+	c.ReasoningProgress = *showProgress
+	f, ok = c.Display.(*os.File)
+	terminal := ok && isatty.IsTerminal(f.Fd())
+	c.Wrap = *wrapLines && terminal
+	c.RenderMath = *renderMath && terminal
+	c.RenderTables = *renderTables && terminal
+}
+
+// newCouncil makes c reply by merging the answers of the -council models.
+// Their usage is recorded like that of c's replies.
+func newCouncil(c *chat.Chat) *council.Client {
+	cc := &council.Client{
+		Client: c.Client,
+		Models: splitModels(*councilModels),
+		Prompt: *councilPrompt,
+		Notef: func(format string, args ...any) {
+			c.Notef(chat.StyleNote, format, args...)
+		},
+	}
+	cc.AnswerHooks = append(cc.AnswerHooks, func(answers []council.Answer) {
+		for _, a := range answers {
+			if a.Err != nil {
+				continue
+			}
+			for _, hook := range c.UsageHooks {
+				hook(a.Model, a.Usage, &llm.Metrics{Duration: a.Duration})
+			}
+		}
+	})
+	c.Client = cc
+	return cc
+}
+
+// pageReply shows a reply in a pager if it's too long for the terminal,
+// and otherwise writes it to stdout, for -pager.
+func pageReply(ctx context.Context, reply string) error {
+	if pager.TooLong(reply) {
+		return pager.Page(reply)
+	}
+	if !strings.HasSuffix(reply, "\n") {
+		reply += "\n"
+	}
+	_, err := io.WriteString(os.Stdout, reply)
+	return err
+}
+
+// writeCode writes the code blocks of a reply selected by -code_block to
+// stdout, or the whole reply if it has none.
+func writeCode(ctx context.Context, reply string) error {
+	blocks := codeblock.Parse(reply)
+	if len(blocks) == 0 {
+		if !strings.HasSuffix(reply, "\n") {
+			reply += "\n"
+		}
+		_, err := io.WriteString(os.Stdout, reply)
 		return err
 	}
-	for _, obj := range rsp.Data {
-		if strings.HasPrefix(obj.ID, "gpt-") {
-			fmt.Println(obj.ID)
+	blocks, err := codeblock.Select(blocks, *codeBlock)
+	if err != nil {
+		return err
+	}
+	return codeblock.Write(os.Stdout, blocks)
+}
+
+// newChat returns a chat with the given model and system prompt, configured
+// from the global flags.
+func newChat(client *openai.Client, model, system string) (*chat.Chat, error) {
+	var inner llm.CompletionClient = client
+	if *raw {
+		// Copy only this chat's replies, not other requests such as for
+		// session titles.
+		rc := *client
+		rc.RawStream = os.Stdout
+		inner = &rc
+	}
+	if *dryRun {
+		inner = &dryRunClient{w: os.Stdout}
+	}
+	mw, err := middleware()
+	if err != nil {
+		return nil, err
+	}
+	c, err := baseChat(llm.Chain(inner, mw...), client, model, system)
+	if err != nil {
+		return nil, err
+	}
+	if *raw {
+		c.Display = io.Discard
+	}
+	if *speak {
+		c.ReplyHooks = append(c.ReplyHooks, speakReply(c, client, *speakVoice, *speakSpeed))
+	}
+	return c, nil
+}
+
+// baseChat returns a chat with the given model and system prompt, which
+// sends its requests to client as it is, configured from the global flags
+// that suit any chat, including the sessions held by `gpt serve`. Flags
+// for the CLI's own output, such as -raw, -dry_run, and -speak, are left
+// to newChat. Embeddings for -rag are made with embedder.
+func baseChat(client llm.CompletionClient, embedder *openai.Client, model, system string) (*chat.Chat, error) {
+	if err := models.CheckSupported(model); err != nil {
+		return nil, err
+	}
+	if err := models.CheckEffort(model, *effort); err != nil {
+		return nil, err
+	}
+	if *web {
+		if err := models.CheckWebSearch(model); err != nil {
+			return nil, err
+		}
+	}
+	var messages []llm.Message
+	if system != "" {
+		messages = append(messages, llm.Message{
+			Role:    llm.RoleSystem,
+			Content: system,
+		})
+	}
+	c, err := chat.New(client, messages)
+	if err != nil {
+		return nil, err
+	}
+	c.Model = model
+	c.ReasoningEffort = *effort
+	c.RequestOptions = llm.RequestOptions{
+		ConnectTimeout:    *connectTimeout,
+		FirstTokenTimeout: *firstTokenTimeout,
+		Timeout:           *timeout,
+	}
+	c.AutoContinue = *autoContinue
+	c.ShowThinking = *showThinking
+	c.ShowUsage = *showUsage
+	c.CacheKey = *promptCacheKey
+	c.WebSearch = *web
+	if *recordStats {
+		path, err := statsPath()
+		if err != nil {
+			return nil, err
+		}
+		l := &stats.Log{Path: path}
+		c.UsageHooks = append(c.UsageHooks, func(model string, u *llm.Usage, m *llm.Metrics) {
+			if err := l.Record(model, u, m); err != nil {
+				log.Debugf("Failed to record stats: %s", err)
+			}
+		})
+	}
+	if *ragIndex != "" {
+		ix, err := rag.Load(*ragIndex)
+		if err != nil {
+			return nil, err
+		}
+		ix.Register(c, embedder, *ragK)
+	}
+	return c, nil
+}
+
+// middleware returns the middleware that the global flags put around each
+// request to a provider, outermost first: masking secrets and applying the
+// redact settings in the config file, failing over to -fallback models,
+// waiting for rate limits, then tracing.
+func middleware() ([]llm.Middleware, error) {
+	var mw []llm.Middleware
+	if *scrubSecrets {
+		f, err := scrub.NewFilter(userConfig.Redact)
+		if err != nil {
+			return nil, err
+		}
+		// Warn on stderr, since subcommands may write replies to stdout.
+		mw = append(mw, scrub.Middleware(f, func(format string, args ...any) {
+			fmt.Fprintln(os.Stderr, chat.Styled(chat.StyleWarning, "warning: "+fmt.Sprintf(format, args...)))
+		}))
+	}
+	if *fallbackModels != "" {
+		ids := splitModels(*fallbackModels)
+		for _, id := range ids {
+			if err := models.CheckSupported(id); err != nil {
+				return nil, fmt.Errorf("-fallback: %w", err)
+			}
+		}
+		mw = append(mw, fallback.Middleware(ids, func(format string, args ...any) {
+			fmt.Fprintln(os.Stderr, chat.Styled(chat.StyleWarning, fmt.Sprintf(format, args...)))
+		}))
+	}
+	if limiter != nil {
+		mw = append(mw, limiter.Middleware)
+	}
+	// Dry runs send nothing to trace.
+	if tracer != nil && !*dryRun {
+		mw = append(mw, otlp.Middleware(tracer))
+	}
+	return mw, nil
+}
+
+// setTheme sets the theme from the config file, overridden by the
+// GPT_PROMPT, GPT_AI_PROMPT, and GPT_COLORS env vars. GPT_COLORS is a
+// comma-separated list like "warning=#ffaa00,error=bold red".
+func setTheme(theme *chat.Theme) error {
+	t := &chat.Theme{Colors: map[string]string{}}
+	if theme != nil {
+		t.Prompt, t.AIPrompt = theme.Prompt, theme.AIPrompt
+		for style, color := range theme.Colors {
+			t.Colors[style] = color
+		}
+	}
+	if v := os.Getenv("GPT_PROMPT"); v != "" {
+		t.Prompt = v
+	}
+	if v := os.Getenv("GPT_AI_PROMPT"); v != "" {
+		t.AIPrompt = v
+	}
+	for _, kv := range strings.Split(os.Getenv("GPT_COLORS"), ",") {
+		if kv == "" {
+			continue
+		}
+		style, color, ok := strings.Cut(kv, "=")
+		if !ok {
+			return fmt.Errorf("GPT_COLORS: expected style=color, got %q", kv)
+		}
+		t.Colors[strings.TrimSpace(style)] = strings.TrimSpace(color)
+	}
+	return chat.SetTheme(t)
+}
+
+// preconnect warms up a connection to the API while the user types their
+// first prompt.
+func preconnect(client *openai.Client) {
+	if client.HTTPClient != nil {
+		return
+	}
+	baseURL := client.BaseURL
+	if baseURL == "" {
+		baseURL = openai.DefaultBaseURL
+	}
+	httpx.Preconnect(httpx.Default, baseURL)
+}
+
+// autoOptions returns agent options from the global flags.
+func autoOptions(client *openai.Client) (*auto.Options, error) {
+	opts := &auto.Options{
+		OutputLimits: map[string]int{},
+		HTTPTimeout:  *autoHTTPTimeout,
+		MaxTurns:     *autoMaxTurns,
+		MaxTokens:    *autoMaxTokens,
+		MaxDuration:  *autoMaxTime,
+		MaxCost:      *autoMaxCost,
+		Plan:         *autoPlan,
+		Checkpoint:   *autoCheckpoint,
+		Tracer:       tracer,
+	}
+	if *autoPolicy != "" {
+		policy, err := auto.LoadPolicy(*autoPolicy)
+		if err != nil {
+			return nil, err
+		}
+		opts.Policy = policy
+	} else {
+		dir, err := config.Dir()
+		if err != nil {
+			return nil, err
+		}
+		policy, err := auto.LoadPolicyIfExists(filepath.Join(dir, "policy.yaml"))
+		if err != nil {
+			return nil, err
+		}
+		opts.Policy = policy
+	}
+	if projectConfig != nil && len(projectConfig.Tools) > 0 {
+		policy, err := opts.Policy.Restrict(projectConfig.Tools)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", projectConfig.Path, err)
+		}
+		opts.Policy = policy
+	}
+	if *autoSandbox {
+		opts.Sandbox = &auto.Sandbox{
+			Runtime: *autoSandboxRuntime,
+			Image:   *autoSandboxImage,
+			Network: *autoSandboxNetwork,
+		}
+	}
+	if *autoSecretEnv != "" {
+		opts.SecretEnv = strings.Split(*autoSecretEnv, ",")
+	}
+	switch *searchEngine {
+	case "openai":
+		opts.Search = &search.OpenAI{Client: client}
+	case "searxng":
+		if *searxngURL == "" {
+			return nil, fmt.Errorf("-search_engine=searxng requires -searxng_url")
+		}
+		opts.Search = &search.SearXNG{BaseURL: *searxngURL}
+	case "brave":
+		token := os.Getenv("BRAVE_API_KEY")
+		if token == "" {
+			return nil, fmt.Errorf("-search_engine=brave requires the BRAVE_API_KEY env var")
 		}
+		opts.Search = &search.Brave{Token: token}
+	case "":
+	default:
+		return nil, fmt.Errorf("unknown -search_engine %q", *searchEngine)
+	}
+	for _, part := range strings.Split(*autoOutputLimit, ",") {
+		cmd, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			cmd, value = "", cmd
+		}
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -auto_output_limit %q", *autoOutputLimit)
+		}
+		if cmd == "" {
+			opts.OutputLimit = limit
+		} else {
+			opts.OutputLimits[cmd] = limit
+		}
+	}
+	return opts, nil
+}
+
+// openAuditLog opens the -auto audit log for appending.
+func openAuditLog() (*os.File, error) {
+	path := *autoAuditLog
+	if path == "" {
+		dir, err := userConfig.Locate(config.State, "audit")
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(dir, time.Now().Format("20060102-150405")+".jsonl")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+}
+
+// complete sends a single prompt, displaying the reply as it streams, and
+// returns the full reply.
+func complete(ctx context.Context, c *chat.Chat, prompt string) (string, error) {
+	c.PromptReader = strings.NewReader(prompt)
+	c.Interactive = false
+	if err := c.Run(ctx); err != nil {
+		return "", err
+	}
+	last := c.Messages[len(c.Messages)-1]
+	if last.Role != "assistant" {
+		return "", fmt.Errorf("no reply received")
+	}
+	return last.Content, nil
+}
+
+func printAvailableModels(ctx context.Context, c *openai.Client) error {
+	ids, err := availableModels(ctx, c)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		fmt.Println(id)
 	}
 	return nil
 }
+
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/internal/config"
+	"github.com/bduffany/gpt-cli/internal/models"
+	"github.com/bduffany/gpt-cli/internal/picker"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+	"github.com/mattn/go-isatty"
+)
+
+// runModels implements `gpt models`, which lets the user choose the default
+// model from the available models.
+func runModels(ctx context.Context, client *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("models", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt models\n\nChoose a default model from the available models, and save it to the config file.\nIf stdin or stdout is not a terminal, the models are just listed.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	ids, err := availableModels(ctx, client)
+	if err != nil {
+		return err
+	}
+	if !isatty.IsTerminal(os.Stdin.Fd()) || !isatty.IsTerminal(os.Stdout.Fd()) {
+		for _, id := range ids {
+			fmt.Println(id)
+		}
+		return nil
+	}
+
+	catalog := models.Merge(models.OpenAI, ids)
+	items := make([]picker.Item, len(catalog))
+	for i, m := range catalog {
+		items[i] = picker.Item{Key: m.ID, Label: modelLabel(m)}
+	}
+	i, err := picker.Pick("model>", modelHeader, items)
+	if errors.Is(err, picker.ErrCanceled) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := config.Set("model", catalog[i].ID); err != nil {
+		return err
+	}
+	path, _ := config.Path()
+	fmt.Printf("Default model set to %s in %s\n", catalog[i].ID, path)
+	return nil
+}
+
+// modelHeader is the header of the columns of modelLabel.
+var modelHeader = fmt.Sprintf("%-32s %-10s %10s %12s", "MODEL", "PROVIDER", "CONTEXT", "$/1M IN/OUT")
+
+func modelLabel(m *models.Model) string {
+	label := fmt.Sprintf("%-32s %-10s", m.ID, m.Provider)
+	if m.ContextWindow > 0 {
+		label += fmt.Sprintf(" %10d", m.ContextWindow)
+	}
+	if m.InputPrice > 0 {
+		label += fmt.Sprintf(" %12s", fmt.Sprintf("%g/%g", m.InputPrice, m.OutputPrice))
+	}
+	return label
+}
+
+// availableModels returns the sorted IDs of the chat models available to the
+// API key.
+func availableModels(ctx context.Context, c *openai.Client) ([]string, error) {
+	rsp := &openai.GenericObject{}
+	if err := c.GetJSON(ctx, "/v1/models", rsp); err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, obj := range rsp.Data {
+		if isChatModel(obj.ID) {
+			ids = append(ids, obj.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func isChatModel(id string) bool {
+	for _, prefix := range []string{"gpt-", "o1", "o3", "o4", "chatgpt-"} {
+		if strings.HasPrefix(id, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/log"
+	"github.com/bduffany/gpt-cli/internal/notify"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+)
+
+// notifyMinDuration is how long a reply or agent task must take for -notify
+// to send a notification, since after a quick one the user is likely still
+// watching.
+const notifyMinDuration = 10 * time.Second
+
+// notifyReplies makes c send a desktop notification after each slow reply,
+// with the start of the reply.
+func notifyReplies(c *chat.Chat) {
+	var start time.Time
+	c.PromptHooks = append([]chat.PromptHook{func(ctx context.Context, prompt string) (string, error) {
+		start = time.Now()
+		return prompt, nil
+	}}, c.PromptHooks...)
+	c.ReplyHooks = append(c.ReplyHooks, func(ctx context.Context, reply string) error {
+		if time.Since(start) >= notifyMinDuration {
+			sendNotification(c.Model+" replied", oneLine(reply, 120))
+		}
+		return nil
+	})
+}
+
+// notifyTask sends a desktop notification when an agent task took long
+// enough, for auto.Options.TaskDone.
+func notifyTask(d time.Duration) {
+	if d >= notifyMinDuration {
+		sendNotification("Agent task finished", "Finished after "+d.Round(time.Second).String())
+	}
+}
+
+// sendNotification shows a desktop notification. Failures are only logged,
+// so as not to interrupt the session.
+func sendNotification(title, body string) {
+	if err := notify.Send(title, body); err != nil {
+		log.Debugf("Failed to send notification: %s", err)
+	}
+}
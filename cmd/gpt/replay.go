@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+	"github.com/chzyer/readline"
+)
+
+// runReplay implements `gpt replay`, which reruns the prompts of a saved
+// session against another model and shows the replies side by side.
+func runReplay(ctx context.Context, client *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	replayModel := fs.String("model", *model, "Model to replay the session's prompts against.")
+	width := fs.Int("width", 0, "Width of the side-by-side output. 0 fits the terminal.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt replay [flags] SESSION_ID\n\nSends each prompt of a saved session to another model, in order, so that\nlater prompts see its earlier replies, and shows each of its replies next to\nthe original.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	store, err := sessionStore()
+	if err != nil {
+		return err
+	}
+	sess, err := store.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *width <= 0 {
+		*width = 120
+		if w, _, err := readline.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+			*width = w
+		}
+	}
+
+	c, err := newChat(client, *replayModel, "")
+	if err != nil {
+		return err
+	}
+	c.ShowThinking = false
+	usage := &llm.Usage{}
+	prompts := sess.Prompts()
+	n := 0
+	for i, m := range sess.Messages {
+		if m.Role == llm.RoleSystem && n == 0 {
+			c.Messages = append(c.Messages, m)
+			continue
+		}
+		if m.Role != llm.RoleUser {
+			continue
+		}
+		n++
+		original := ""
+		if i+1 < len(sess.Messages) && sess.Messages[i+1].Role == llm.RoleAssistant {
+			original = sess.Messages[i+1].Content
+		}
+		before := len(c.Messages)
+		reply, u, err := send(ctx, c, m.Content)
+		if err != nil {
+			reply = "error: " + err.Error()
+			// Continue from the original reply, so that the following prompts
+			// still make sense.
+			c.Messages = append(c.Messages[:before], m, llm.Message{Role: llm.RoleAssistant, Content: original})
+		}
+		if u != nil {
+			usage.InputTokens += u.InputTokens
+			usage.CachedInputTokens += u.CachedInputTokens
+			usage.OutputTokens += u.OutputTokens
+		}
+		fmt.Println(chat.Styled(chat.StyleHeading, fmt.Sprintf("=== Prompt %d/%d ===", n, prompts)))
+		fmt.Println(strings.TrimSpace(m.Content))
+		fmt.Println()
+		sideBySide(os.Stdout, *width,
+			[2]string{chat.Styled(chat.StyleHeading, sess.Model), chat.Styled(chat.StyleHeading, *replayModel)},
+			[2]string{original, reply})
+		fmt.Println()
+	}
+	fmt.Println(chat.Styled(chat.StyleNote, fmt.Sprintf("Replayed %d prompts with %s: %s", n, *replayModel, chat.UsageLine(*replayModel, usage, nil))))
+	return nil
+}
+
+// send sends a prompt in c and returns the reply without displaying it.
+func send(ctx context.Context, c *chat.Chat, prompt string) (string, *llm.Usage, error) {
+	reply, err := c.Send(ctx, prompt)
+	if err != nil {
+		return "", nil, err
+	}
+	defer reply.Close()
+	buf := &bytes.Buffer{}
+	if _, err := io.Copy(buf, reply); err != nil {
+		return "", nil, err
+	}
+	return buf.String(), reply.Usage, nil
+}
+
+// sideBySide writes two texts in columns, wrapped to fit width, under
+// headings that may be styled.
+func sideBySide(w io.Writer, width int, headings, texts [2]string) {
+	col := max((width-3)/2, 10)
+	left, right := wrap(texts[0], col), wrap(texts[1], col)
+	fmt.Fprintf(w, "%s%s │ %s\n", headings[0], strings.Repeat(" ", max(col-visibleLen(headings[0]), 0)), headings[1])
+	for i := 0; i < max(len(left), len(right)); i++ {
+		var l, r string
+		if i < len(left) {
+			l = left[i]
+		}
+		if i < len(right) {
+			r = right[i]
+		}
+		fmt.Fprintf(w, "%s%s │ %s\n", l, strings.Repeat(" ", col-visibleLen(l)), r)
+	}
+}
+
+// wrap splits text into lines of at most width runes, breaking at spaces
+// where possible.
+func wrap(text string, width int) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		line = strings.ReplaceAll(line, "\t", "    ")
+		for {
+			r := []rune(line)
+			if len(r) <= width {
+				lines = append(lines, line)
+				break
+			}
+			cut := width
+			if i := strings.LastIndex(string(r[:width]), " "); i > 0 {
+				cut = len([]rune(string(r[:width])[:i]))
+			}
+			lines = append(lines, string(r[:cut]))
+			line = strings.TrimLeft(string(r[cut:]), " ")
+		}
+	}
+	return lines
+}
+
+// visibleLen returns the number of runes in s that take up space, skipping
+// color escape sequences.
+func visibleLen(s string) int {
+	n, esc := 0, false
+	for _, r := range s {
+		switch {
+		case r == '\x1b':
+			esc = true
+		case esc:
+			esc = r != 'm'
+		default:
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bduffany/gpt-cli/internal/repomap"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+// runRepoMap implements `gpt repomap`, which prints the map that -repo_map
+// adds to the system prompt.
+func runRepoMap(ctx context.Context, client *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("repomap", flag.ExitOnError)
+	maxBytes := fs.Int("max_bytes", repomap.DefaultMaxBytes, "Max size of the map. Past it, files are listed without symbols.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt repomap [DIR]\n\nPrint a map of the files in DIR, or the working directory, with their exported symbols.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+	m, err := repomap.Build(dir, *maxBytes)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.WriteString(m)
+	return err
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/internal/templates"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+	"github.com/mattn/go-isatty"
+)
+
+// isTemplate is the takes of `gpt run`: its first word must name a
+// template.
+func isTemplate(words []string) bool {
+	return templates.Exists(words[0])
+}
+
+// runTemplate implements `gpt run`, which sends a prompt rendered from a
+// named template.
+func runTemplate(ctx context.Context, client *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	fs.Usage = func() {
+		dir, _ := templates.Dir()
+		fmt.Fprintf(fs.Output(), `usage: gpt run TEMPLATE [KEY=VALUE ...] [INPUT ...]
+
+Renders the named template from %s and sends it as a prompt.
+KEY=VALUE args set template vars. {{.input}} is set to stdin if it is
+piped, otherwise to the remaining args. With no TEMPLATE, lists templates.
+
+`, dir)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return listTemplates()
+	}
+
+	t, err := templates.Load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	vars := map[string]string{}
+	var rest []string
+	for _, arg := range fs.Args()[1:] {
+		if k, v, ok := strings.Cut(arg, "="); ok && k != "" && !strings.ContainsAny(k, " \t") {
+			vars[k] = v
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	if _, ok := vars["input"]; !ok {
+		vars["input"] = strings.Join(rest, " ")
+		if !isatty.IsTerminal(os.Stdin.Fd()) {
+			b, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			vars["input"] = string(b)
+		}
+	}
+	prompt, err := t.Render(vars)
+	if err != nil {
+		return err
+	}
+
+	m := *model
+	if t.Model != "" && !isFlagSet("model") {
+		m = t.Model
+	}
+	system := *systemPrompt
+	if t.System != "" && !isFlagSet("system") {
+		system = t.System
+	}
+	c, err := newChat(client, m, system)
+	if err != nil {
+		return err
+	}
+	if t.Format == "json" {
+		c.ResponseFormat = "json_object"
+	}
+	c.PromptReader = strings.NewReader(prompt)
+	c.Interactive = *interactive
+	return c.Run(ctx)
+}
+
+func listTemplates() error {
+	ts, err := templates.List()
+	if err != nil {
+		return err
+	}
+	if len(ts) == 0 {
+		dir, _ := templates.Dir()
+		fmt.Fprintf(os.Stderr, "No templates found in %s\n", dir)
+		return nil
+	}
+	for _, t := range ts {
+		fmt.Printf("%-20s %s\n", t.Name, t.Description)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/config"
+	"github.com/bduffany/gpt-cli/internal/serve"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+// runServe implements `gpt serve`, which exposes the configured providers
+// as a local OpenAI-compatible API.
+func runServe(ctx context.Context, client *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	host := fs.String("host", "127.0.0.1", "Address to listen on. Listening beyond localhost requires keys in the config.")
+	port := fs.Int("port", 8080, "Port to listen on.")
+	configPath := fs.String("config", "", "Path of the server config, with API keys and model routes. Defaults to serve.yaml in the config dir, if it exists.")
+	logPath := fs.String("log", "-", "File to append a JSON line to for each request. - writes stderr; empty disables the log.")
+	newKey := fs.Bool("new_key", false, "Print a new random API key to add to the config, and exit.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt serve [flags]\n\nServe an OpenAI-compatible /v1/chat/completions API, routing each model to\nthe configured provider, and a /v1/sessions API for editor integrations.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *newKey {
+		fmt.Println(serve.NewKey())
+		return nil
+	}
+
+	path, load := *configPath, serve.LoadConfig
+	if path == "" {
+		dir, err := config.Dir()
+		if err != nil {
+			return err
+		}
+		path, load = filepath.Join(dir, "serve.yaml"), serve.LoadConfigIfExists
+	}
+	cfg, err := load(path)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(*host); len(cfg.Keys) == 0 && (ip == nil || !ip.IsLoopback()) && *host != "localhost" {
+		return fmt.Errorf("refusing to listen on %s without API keys: add keys to %s (see -new_key)", *host, path)
+	}
+
+	mw, err := middleware()
+	if err != nil {
+		return err
+	}
+	// Requests get the same middleware as the CLI's, such as secret
+	// scrubbing and rate limits, whichever provider they're routed to.
+	s := &serve.Server{Client: client, Config: cfg, Middleware: mw}
+	// Sessions get the same chat as the CLI, including hooks like -rag and
+	// -stats, but not options for the CLI's own output, like -speak.
+	s.NewChat = func(c llm.CompletionClient, m, system string) (*chat.Chat, error) {
+		if m == "" {
+			m = *model
+		}
+		if system == "" {
+			system = *systemPrompt
+		}
+		return baseChat(c, client, m, system)
+	}
+	switch *logPath {
+	case "":
+	case "-":
+		s.Log = os.Stderr
+	default:
+		f, err := os.OpenFile(*logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		s.Log = f
+	}
+	return listenAndServe(ctx, net.JoinHostPort(*host, strconv.Itoa(*port)), s.Handler())
+}
+
+// listenAndServe serves handler until interrupted, then waits briefly for
+// requests in flight.
+func listenAndServe(ctx context.Context, addr string, handler http.Handler) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	srv := &http.Server{Addr: addr, Handler: handler}
+	go func() {
+		<-ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+	fmt.Fprintf(os.Stderr, "Listening on http://%s\n", addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/config"
+	"github.com/bduffany/gpt-cli/internal/council"
+	"github.com/bduffany/gpt-cli/internal/log"
+	"github.com/bduffany/gpt-cli/internal/session"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+// sessionStore returns the store that sessions are saved to, as set by
+// sessions.backend in the config file.
+func sessionStore() (session.Store, error) {
+	switch b := userConfig.Sessions.Backend; b {
+	case "", "files":
+		return fileStore()
+	case "sqlite":
+		return sqliteStore()
+	default:
+		return nil, fmt.Errorf("sessions.backend: unknown backend %q; use files or sqlite", b)
+	}
+}
+
+// fileStore returns the store that keeps sessions as files in the data dir.
+func fileStore() (*session.FileStore, error) {
+	sessionsDir, err := userConfig.Locate(config.Data, "sessions")
+	if err != nil {
+		return nil, err
+	}
+	key, err := sessionKey(filepath.Join(sessionsDir, "salt"))
+	if err != nil {
+		return nil, err
+	}
+	return &session.FileStore{Dir: sessionsDir, Key: key, Encrypt: userConfig.Sessions.Encrypt}, nil
+}
+
+// sqliteStore returns the store that keeps sessions in a SQLite database
+// in the data dir.
+func sqliteStore() (*session.SQLiteStore, error) {
+	path, err := userConfig.Locate(config.Data, "sessions.db")
+	if err != nil {
+		return nil, err
+	}
+	key, err := sessionKey(path + ".salt")
+	if err != nil {
+		return nil, err
+	}
+	return &session.SQLiteStore{Path: path, Key: key, Encrypt: userConfig.Sessions.Encrypt}, nil
+}
+
+// sessionKey returns the key that sessions are encrypted with, derived from
+// GPT_SESSION_PASSPHRASE with the salt kept at saltPath, or else kept in
+// session.key in the config dir. It's nil if there's no key and encryption
+// is off.
+func sessionKey(saltPath string) (*session.Key, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	// Sessions that are already encrypted still need the key after
+	// encryption is turned off.
+	passphrase := os.Getenv("GPT_SESSION_PASSPHRASE")
+	keyPath := filepath.Join(dir, "session.key")
+	_, statErr := os.Stat(keyPath)
+	var key *session.Key
+	switch {
+	case passphrase != "":
+		key, err = session.NewPassphraseKey(passphrase, saltPath)
+	case userConfig.Sessions.Encrypt || statErr == nil:
+		key, err = session.NewKeyFile(keyPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("session key: %w", err)
+	}
+	return key, nil
+}
+
+// syncRemote returns the remote bundle set by sessions.sync in the config.
+func syncRemote() (*session.Remote, error) {
+	cfg := userConfig.Sessions.Sync
+	if cfg.URL == "" {
+		path, _ := config.Path()
+		return nil, fmt.Errorf("set sessions.sync.url in %s first", path)
+	}
+	passphrase := os.Getenv("GPT_SYNC_PASSPHRASE")
+	if passphrase == "" {
+		return nil, fmt.Errorf("set GPT_SYNC_PASSPHRASE to the passphrase shared by the team")
+	}
+	return &session.Remote{URL: cfg.URL, Headers: cfg.Headers, Passphrase: passphrase}, nil
+}
+
+// sessionRetention returns the limits on saved sessions set in the config.
+func sessionRetention() (session.Retention, error) {
+	cfg := userConfig.Sessions
+	r := session.Retention{MaxSessions: cfg.MaxSessions}
+	var err error
+	if cfg.MaxAge != "" {
+		if r.MaxAge, err = session.ParseAge(cfg.MaxAge); err != nil {
+			return r, fmt.Errorf("sessions.max_age: %w", err)
+		}
+	}
+	if cfg.MaxSize != "" {
+		if r.MaxBytes, err = session.ParseSize(cfg.MaxSize); err != nil {
+			return r, fmt.Errorf("sessions.max_size: %w", err)
+		}
+	}
+	return r, nil
+}
+
+// openSession returns the session that c is saved to: the one named by
+// -resume, or else one interrupted by a crash if the user chooses to
+// recover it, or else a new one. Its messages replace those of c.
+func openSession(store session.Store, c *chat.Chat) (*session.Session, error) {
+	if *resume != "" {
+		id := *resume
+		if id == "last" {
+			sessions, err := store.List()
+			if err != nil {
+				return nil, err
+			}
+			if len(sessions) == 0 {
+				return nil, fmt.Errorf("no saved sessions")
+			}
+			id = sessions[0].ID
+		}
+		sess, err := store.Load(id)
+		if err != nil {
+			return nil, err
+		}
+		return reopen(c, sess), nil
+	}
+	// Only offer to recover a session when starting a plain interactive
+	// session, not one with a prompt of its own.
+	if c.Interactive && c.PromptReader == nil {
+		interrupted, err := session.Interrupted(store)
+		if err != nil {
+			return nil, err
+		}
+		for i, sess := range interrupted {
+			if i == 0 {
+				ok, _, err := c.Confirmf("A session from %s with %d prompts wasn't closed cleanly. Resume it?", sess.Updated.Format(time.DateTime), sess.Prompts())
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					return reopen(c, sess), nil
+				}
+			}
+			// Don't ask about it again.
+			sess.PID = 0
+			if err := store.Save(sess); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return session.New(c.Model), nil
+}
+
+// reopen continues a saved session in c.
+func reopen(c *chat.Chat, sess *session.Session) *session.Session {
+	c.Messages = append(c.Messages[:0:0], sess.Messages...)
+	if !isFlagSet("model") && sess.Model != "" {
+		c.Model = sess.Model
+	}
+	sess.PID = os.Getpid()
+	fmt.Fprintf(os.Stderr, "%s\n", chat.Styled(chat.StyleNote, fmt.Sprintf("Resumed session %s (%d prompts)", sess.ID, sess.Prompts())))
+	return sess
+}
+
+// autosave saves c to the session store after each reply, so that a crash
+// loses at most the reply in progress, along with the answers of cc's
+// members, if c has a council. The returned func closes the session when
+// the chat ends.
+func autosave(c *chat.Chat, cc *council.Client) (close func(), err error) {
+	store, err := sessionStore()
+	if err != nil {
+		return nil, err
+	}
+	r, err := sessionRetention()
+	if err != nil {
+		return nil, err
+	}
+	if r != (session.Retention{}) {
+		if pruned, err := session.Prune(store, r, false); err != nil {
+			log.Debugf("Failed to prune sessions: %s", err)
+		} else if len(pruned) > 0 {
+			log.Debugf("Pruned %d sessions", len(pruned))
+		}
+	}
+	sess, err := openSession(store, c)
+	if err != nil {
+		return nil, err
+	}
+	// mu guards sess, which is also saved once its title is generated.
+	var mu sync.Mutex
+	warned := false
+	save := func() {
+		sess.Updated = time.Now()
+		err := store.Save(sess)
+		if errors.Is(err, session.ErrConflict) {
+			// The session is also open in another process, which saved it
+			// first. Keep both conversations.
+			id := sess.ID
+			sess.Fork()
+			fmt.Fprintf(os.Stderr, "%s\n", chat.Styled(chat.StyleNote, fmt.Sprintf("Session %s was changed by another gpt process; saving this one as %s.", id, sess.ID)))
+			err = store.Save(sess)
+		}
+		if err != nil && !warned {
+			warned = true
+			fmt.Fprintf(os.Stderr, "%s\n", chat.Styled(chat.StyleWarning, "warning: failed to save session: "+err.Error()))
+		}
+	}
+	if cc != nil {
+		cc.AnswerHooks = append(cc.AnswerHooks, func(answers []council.Answer) {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, a := range answers {
+				// The reply follows the prompt, the last message so far.
+				d := session.Draft{Message: len(c.Messages), Model: a.Model, Content: a.Content}
+				if a.Err != nil {
+					d.Error = a.Err.Error()
+				}
+				sess.Drafts = append(sess.Drafts, d)
+			}
+		})
+	}
+	c.ReplyHooks = append(c.ReplyHooks, func(ctx context.Context, reply string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sess.Model = c.Model
+		sess.Messages = append(sess.Messages[:0:0], c.Messages...)
+		if sess.Name == "" {
+			// Name the session from its first prompt until the model names it.
+			sess.Name = session.Title(sess.Messages)
+			if *titleModel != "" {
+				client := c.Client
+				if cc != nil {
+					// Ask the title model alone.
+					client = cc.Client
+				}
+				go nameSession(client, sess.Messages, func(title string) {
+					mu.Lock()
+					defer mu.Unlock()
+					sess.Name = title
+					save()
+				})
+			}
+		}
+		save()
+		return nil
+	})
+	if c.Commands == nil {
+		c.Commands = map[string]chat.Command{}
+	}
+	c.Commands["tag"] = func(ctx context.Context, args string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sess.Tag(strings.Fields(args)...)
+		if sess.Prompts() > 0 {
+			save()
+		}
+		if len(sess.Tags) == 0 {
+			io.WriteString(c.Display, chat.Styled(chat.StyleNote, "No tags. Add some with /tag NAME ...")+"\n")
+			return nil
+		}
+		io.WriteString(c.Display, chat.Styled(chat.StyleNote, "Tags: "+strings.Join(sess.Tags, ", "))+"\n")
+		return nil
+	}
+	c.Commands["untag"] = func(ctx context.Context, args string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sess.Untag(strings.Fields(args)...)
+		if sess.Prompts() > 0 {
+			save()
+		}
+		return nil
+	}
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		sess.PID = 0
+		sess.Messages = c.Messages
+		// Sessions without a prompt aren't worth keeping.
+		if sess.Prompts() > 0 {
+			save()
+		}
+	}, nil
+}
+
+// nameSession generates a title for a session from its first exchange with
+// -title_model, and calls set with it. Failures are only logged, since the
+// session already has a title from its first prompt.
+func nameSession(client llm.CompletionClient, messages []llm.Message, set func(title string)) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	title, err := session.GenerateTitle(ctx, client, *titleModel, messages)
+	if err != nil {
+		log.Debugf("Failed to generate session title: %s", err)
+		return
+	}
+	set(title)
+}
+
+// runSessions implements `gpt sessions`, which manages saved sessions.
+func runSessions(ctx context.Context, client *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("sessions", flag.ExitOnError)
+	tag := fs.String("tag", "", "Only list sessions with this tag, added with /tag.")
+	since := fs.String("since", "", "Only list or export sessions updated this long ago, like `7d` or 12h.")
+	all := fs.Bool("all", false, "Export or push all sessions, or those matching -tag and -since.")
+	out := fs.String("o", "-", "File to export to. - writes stdout.")
+	replace := fs.Bool("replace", false, "Replace sessions that already exist when importing. Pull always replaces older copies.")
+	dryRun := fs.Bool("dry_run", false, "List the sessions that prune would delete, without deleting them.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt sessions list [flags]\n       gpt sessions show ID\n       gpt sessions summarize ID\n       gpt sessions delete ID\n       gpt sessions export [flags] (-all | ID ...)\n       gpt sessions import [flags] FILE\n       gpt sessions push [flags] (-all | ID ...)\n       gpt sessions pull\n       gpt sessions encrypt\n       gpt sessions prune [flags]\n\nManage the interactive sessions saved after each reply. Resume one with\n`gpt -resume ID`, or `gpt -resume last`. Summarize asks the session's\nmodel for a summary of it. Export and import move sessions between\nmachines as a JSON bundle. Push and pull share sessions with a team through\nthe encrypted bundle at sessions.sync.url in the config. Encrypt encrypts sessions saved before\nsessions.encrypt was set in the config. Prune deletes the sessions beyond\nthe limits set in the config, which is also done as each interactive\nsession starts.\n\n")
+		fs.PrintDefaults()
+	}
+	verb := "list"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		verb, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+	store, err := sessionStore()
+	if err != nil {
+		return err
+	}
+	// list returns the sessions matching -tag and -since.
+	list := func() ([]*session.Session, error) {
+		var start time.Time
+		if *since != "" {
+			age, err := session.ParseAge(*since)
+			if err != nil {
+				return nil, fmt.Errorf("-since: %w", err)
+			}
+			start = time.Now().Add(-age)
+		}
+		sessions, err := store.List()
+		if err != nil {
+			return nil, err
+		}
+		var out []*session.Session
+		for _, s := range sessions {
+			if !s.Updated.Before(start) && (*tag == "" || s.HasTag(*tag)) {
+				out = append(out, s)
+			}
+		}
+		return out, nil
+	}
+	// selected returns the sessions named by the args, or those matching
+	// -tag and -since with -all.
+	selected := func() ([]*session.Session, error) {
+		var sessions []*session.Session
+		switch {
+		case *all && fs.NArg() == 0:
+			return list()
+		case !*all && fs.NArg() > 0:
+			for _, id := range fs.Args() {
+				sess, err := store.Load(id)
+				if err != nil {
+					return nil, err
+				}
+				sessions = append(sessions, sess)
+			}
+			return sessions, nil
+		}
+		fs.Usage()
+		os.Exit(2)
+		return nil, nil
+	}
+	switch verb {
+	case "list":
+		sessions, err := list()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tUPDATED\tMODEL\tPROMPTS\tTAGS\tTITLE")
+		for _, s := range sessions {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", s.ID, s.Updated.Format(time.DateTime), s.Model, s.Prompts(), strings.Join(s.Tags, ","), s.Name)
+		}
+		return tw.Flush()
+	case "show":
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		sess, err := store.Load(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		for i, m := range sess.Messages {
+			for _, d := range sess.Drafts {
+				if d.Message != i {
+					continue
+				}
+				content := d.Content
+				if d.Error != "" {
+					content = chat.Styled(chat.StyleError, "error: "+d.Error)
+				}
+				fmt.Printf("%s\n%s\n\n", chat.Styled(chat.StyleHeading, "draft from "+d.Model+":"), content)
+			}
+			fmt.Printf("%s\n%s\n\n", chat.Styled(chat.StyleHeading, m.Role+":"), m.Content)
+		}
+		return nil
+	case "summarize":
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		sess, err := store.Load(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		return summarizeSession(ctx, sess)
+	case "delete":
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		return store.Delete(fs.Arg(0))
+	case "export":
+		sessions, err := selected()
+		if err != nil {
+			return err
+		}
+		if *out == "-" {
+			return session.WriteBundle(os.Stdout, sessions)
+		}
+		f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		if err := session.WriteBundle(f, sessions); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d sessions to %s\n", len(sessions), *out)
+		return nil
+	case "encrypt":
+		if !userConfig.Sessions.Encrypt {
+			path, _ := config.Path()
+			return fmt.Errorf("set sessions.encrypt to true in %s first", path)
+		}
+		sessions, err := store.List()
+		if err != nil {
+			return err
+		}
+		for _, sess := range sessions {
+			if err := store.Save(sess); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(os.Stderr, "Encrypted %d sessions\n", len(sessions))
+		return nil
+	case "prune":
+		r, err := sessionRetention()
+		if err != nil {
+			return err
+		}
+		if r == (session.Retention{}) {
+			path, _ := config.Path()
+			return fmt.Errorf("no limits set: set sessions.max_sessions, max_age, or max_size in %s", path)
+		}
+		pruned, err := session.Prune(store, r, *dryRun)
+		if err != nil {
+			return err
+		}
+		for _, s := range pruned {
+			fmt.Printf("%s\t%s\n", s.ID, s.Name)
+		}
+		did := "Deleted"
+		if *dryRun {
+			did = "Would delete"
+		}
+		fmt.Fprintf(os.Stderr, "%s %d sessions\n", did, len(pruned))
+		return nil
+	case "import":
+		if fs.NArg() != 1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		var r io.Reader = os.Stdin
+		if fs.Arg(0) != "-" {
+			f, err := os.Open(fs.Arg(0))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		b, err := session.ReadBundle(r)
+		if err != nil {
+			return err
+		}
+		n, err := session.Import(store, b, *replace)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Imported %d of %d sessions\n", n, len(b.Sessions))
+		return nil
+	case "push":
+		remote, err := syncRemote()
+		if err != nil {
+			return err
+		}
+		sessions, err := selected()
+		if err != nil {
+			return err
+		}
+		n, err := remote.Push(ctx, sessions)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Pushed %d of %d sessions\n", n, len(sessions))
+		return nil
+	case "pull":
+		if fs.NArg() != 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		remote, err := syncRemote()
+		if err != nil {
+			return err
+		}
+		b, err := remote.Pull(ctx)
+		if err != nil {
+			return err
+		}
+		// Only import sessions that are new, or newer than the local copy.
+		total := len(b.Sessions)
+		b.Sessions = slices.DeleteFunc(b.Sessions, func(s *session.Session) bool {
+			local, err := store.Load(s.ID)
+			return err == nil && local.ID == s.ID && !s.Updated.After(local.Updated)
+		})
+		n, err := session.Import(store, b, true)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Pulled %d of %d sessions\n", n, total)
+		return nil
+	}
+	fs.Usage()
+	os.Exit(2)
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/internal/config"
+	"github.com/bduffany/gpt-cli/internal/models"
+	"github.com/bduffany/gpt-cli/internal/picker"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+	"github.com/chzyer/readline"
+	"github.com/mattn/go-isatty"
+)
+
+// provider is a server that the setup wizard offers to connect to.
+type provider struct {
+	name string
+	// baseURL is the server's base URL. It's "" for OpenAI, the default.
+	baseURL string
+	// keysURL is where to create API keys, if known.
+	keysURL string
+	// custom asks for the base URL.
+	custom bool
+}
+
+var providers = []provider{
+	{name: "OpenAI", keysURL: "https://platform.openai.com/api-keys"},
+	{name: "DeepSeek", baseURL: "https://api.deepseek.com", keysURL: "https://platform.deepseek.com/api_keys"},
+	{name: "Another OpenAI-compatible server", custom: true},
+}
+
+// runSetup implements `gpt setup`, which also runs on first use, when there
+// is no API key.
+func runSetup(ctx context.Context, _ *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("setup", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt setup\n\nAsks for the provider and API key, checks the key, and saves it as with\n`gpt auth login`, unencrypted, in a file in the config dir that only you\ncan read. Then asks for the default model, saves it to the config file,\nand sends it a test request. Runs automatically the first time gpt is\nrun from a terminal without an API key.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if !canSetup() {
+		return fmt.Errorf("setup needs a terminal")
+	}
+	_, _, err := setup(ctx)
+	return err
+}
+
+// canSetup returns whether the setup wizard can ask questions.
+func canSetup() bool {
+	return isatty.IsTerminal(os.Stdin.Fd()) && isatty.IsTerminal(os.Stdout.Fd())
+}
+
+// setup asks for the provider, API key, and default model, and saves them.
+// It returns a client for the provider and the chosen model.
+func setup(ctx context.Context) (*openai.Client, string, error) {
+	in := bufio.NewReader(os.Stdin)
+	fmt.Println("Welcome to gpt! Let's choose a provider and save an API key. Press Ctrl+C\nto quit, and run `gpt setup` to start over at any time.")
+
+	fmt.Println("\nProvider:")
+	for i, p := range providers {
+		fmt.Printf("  %d) %s\n", i+1, p.name)
+	}
+	var p provider
+	for {
+		answer, err := ask(in, "Choose [1]: ")
+		if err != nil {
+			return nil, "", err
+		}
+		if answer == "" {
+			answer = "1"
+		}
+		if i, err := strconv.Atoi(answer); err == nil && i >= 1 && i <= len(providers) {
+			p = providers[i-1]
+			break
+		}
+		fmt.Printf("Enter a number from 1 to %d.\n", len(providers))
+	}
+	base := p.baseURL
+	for p.custom && base == "" {
+		answer, err := ask(in, "Base URL, without /v1, such as http://localhost:8080: ")
+		if err != nil {
+			return nil, "", err
+		}
+		base = strings.TrimSuffix(strings.TrimSuffix(answer, "/"), "/v1")
+	}
+
+	if p.keysURL != "" {
+		fmt.Printf("\nCreate an API key at %s if you don't have one.\n", p.keysURL)
+	}
+	fmt.Println("The key is saved unencrypted, in a file in the config dir that only\nyou can read. To keep it elsewhere, such as in a password manager, press\nCtrl-C and set the OPENAI_API_KEY env var instead.")
+	var client *openai.Client
+	var ids []string
+	for {
+		b, err := readline.Password("API key: ")
+		if err != nil {
+			return nil, "", err
+		}
+		key := strings.TrimSpace(string(b))
+		if key == "" {
+			continue
+		}
+		client = &openai.Client{Token: key, BaseURL: base}
+		fmt.Println("Checking the key...")
+		if ids, err = serverModels(ctx, client, base == ""); err == nil {
+			break
+		}
+		fmt.Println(chat.Styled(chat.StyleError, diagnose(err)))
+	}
+	path, err := saveAPIKey(client.Token)
+	if err != nil {
+		return nil, "", err
+	}
+	fmt.Printf("Saved the API key to %s, unencrypted\n", path)
+	if os.Getenv("OPENAI_API_KEY") != "" {
+		fmt.Println("The OPENAI_API_KEY env var is set, and is used instead.")
+	}
+	if base != "" || userConfig.BaseURL != "" {
+		if err := config.Set("base_url", base); err != nil {
+			return nil, "", err
+		}
+	}
+
+	id, err := chooseModel(ids)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := config.Set("model", id); err != nil {
+		return nil, "", err
+	}
+	userConfig.BaseURL = base
+	userConfig.Model = id
+	cfgPath, _ := config.Path()
+	fmt.Printf("Default model set to %s in %s\n", id, cfgPath)
+
+	fmt.Printf("\nSending a test request to %s...\n", id)
+	reply, _, err := completeQuietly(ctx, client, id, "", "Reply with just the word OK.")
+	if err != nil {
+		return nil, "", fmt.Errorf("test request: %s; run `gpt doctor` for more", diagnose(err))
+	}
+	fmt.Printf("%s replied %q. You're all set: try `gpt \"Hello\"`, or run `gpt -h` for more.\n\n", id, strings.TrimSpace(reply))
+	return client, id, nil
+}
+
+// ask prints a prompt and reads a line of the answer.
+func ask(in *bufio.Reader, prompt string) (string, error) {
+	fmt.Print(prompt)
+	line, err := in.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// serverModels returns the sorted IDs of the models on a server. For
+// OpenAI, only chat models are listed.
+func serverModels(ctx context.Context, c *openai.Client, openAI bool) ([]string, error) {
+	if openAI {
+		return availableModels(ctx, c)
+	}
+	rsp := &openai.GenericObject{}
+	if err := c.GetJSON(ctx, "/v1/models", rsp); err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, obj := range rsp.Data {
+		ids = append(ids, obj.ID)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// chooseModel asks which of ids to use by default.
+func chooseModel(ids []string) (string, error) {
+	if len(ids) == 0 {
+		return "", fmt.Errorf("the server lists no models")
+	}
+	catalog := models.Merge(models.OpenAI, ids)
+	items := make([]picker.Item, len(catalog))
+	for i, m := range catalog {
+		items[i] = picker.Item{Key: m.ID, Label: modelLabel(m)}
+	}
+	fmt.Println("\nChoose the default model. Type to filter the list.")
+	i, err := picker.Pick("model>", modelHeader, items)
+	if errors.Is(err, picker.ErrCanceled) {
+		return "", fmt.Errorf("no model chosen; run `gpt setup` to start over")
+	}
+	if err != nil {
+		return "", err
+	}
+	return catalog[i].ID, nil
+}
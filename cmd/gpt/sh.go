@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/pkg/openai"
+	"github.com/chzyer/readline"
+	"github.com/mattn/go-isatty"
+)
+
+// runSh implements `gpt sh`, which turns a request into a shell command and
+// offers to run it, or explains a command with -explain.
+func runSh(ctx context.Context, client *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("sh", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt sh [flags] REQUEST\n\nPrints a shell command that does what REQUEST describes, then asks\nwhether to run it.\n\n")
+		fs.PrintDefaults()
+	}
+	explain := fs.Bool("explain", false, "Treat the args as a shell command and explain what it does.")
+	printOnly := fs.Bool("print", false, "Only print the command; don't offer to run it.")
+	fs.Parse(args)
+	request := strings.Join(fs.Args(), " ")
+	if request == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	shell := detectShell()
+	env := fmt.Sprintf("The user's shell is %s, on %s.", filepath.Base(shell), describeOS())
+	if *explain {
+		c, err := newChat(client, *model, "You explain shell commands. "+env+" Briefly say what the command does overall, then explain each part. Point out anything destructive or surprising.")
+		if err != nil {
+			return err
+		}
+		_, err = complete(ctx, c, request)
+		return err
+	}
+
+	c, err := newChat(client, *model, "You turn requests into a single shell command. "+env+" Use only tools that are commonly installed there. Reply with only the command, on one line if possible, with no code fences or explanation.")
+	if err != nil {
+		return err
+	}
+	command, err := complete(ctx, c, request)
+	if err != nil {
+		return err
+	}
+	command = stripCodeFence(command)
+	if *printOnly || !isatty.IsTerminal(os.Stdin.Fd()) {
+		return nil
+	}
+	answer, err := readline.Line("Run this command? (yes / no) ")
+	if err != nil {
+		return nil
+	}
+	if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, shell, shellFlag(shell), command)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// detectShell returns the path of the user's shell.
+func detectShell() string {
+	if runtime.GOOS == "windows" {
+		if os.Getenv("PSModulePath") != "" {
+			return "powershell"
+		}
+		if comspec := os.Getenv("ComSpec"); comspec != "" {
+			return comspec
+		}
+		return "cmd"
+	}
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	return "/bin/sh"
+}
+
+// shellFlag returns the flag that makes the shell run a command string.
+func shellFlag(shell string) string {
+	switch strings.ToLower(strings.TrimSuffix(filepath.Base(shell), ".exe")) {
+	case "cmd":
+		return "/C"
+	case "powershell", "pwsh":
+		return "-Command"
+	}
+	return "-c"
+}
+
+// describeOS returns a human-readable OS name, including the Linux
+// distribution when it can be determined.
+func describeOS() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return "macOS"
+	case "linux":
+		b, err := os.ReadFile("/etc/os-release")
+		if err != nil {
+			return "Linux"
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			if v, ok := strings.CutPrefix(line, "PRETTY_NAME="); ok {
+				return strings.Trim(v, `"`)
+			}
+		}
+		return "Linux"
+	}
+	return runtime.GOOS
+}
+
+// stripCodeFence removes a Markdown code fence wrapping s, if any.
+func stripCodeFence(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+	lines := strings.Split(s, "\n")
+	lines = lines[1:]
+	if n := len(lines); n > 0 && strings.TrimSpace(lines[n-1]) == "```" {
+		lines = lines[:n-1]
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
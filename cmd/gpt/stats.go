@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/config"
+	"github.com/bduffany/gpt-cli/internal/stats"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+// statsPath is the log that -stats appends to.
+func statsPath() (string, error) {
+	return userConfig.Locate(config.State, "stats.jsonl")
+}
+
+// runStats implements `gpt stats`, which reports the latency, throughput,
+// and usage of recorded replies, per model.
+func runStats(ctx context.Context, client *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	since := fs.Duration("since", 30*24*time.Hour, "Only include replies from this long ago. 0 includes all replies.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt stats\n\nReport the time to first token, tokens per second, tokens used, and cost of replies recorded with -stats, per model.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	path, err := statsPath()
+	if err != nil {
+		return err
+	}
+	var start time.Time
+	if *since > 0 {
+		start = time.Now().Add(-*since)
+	}
+	records, err := (&stats.Log{Path: path}).Load(start)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("no replies recorded in %s", path)
+	}
+	return stats.Report(os.Stdout, records)
+}
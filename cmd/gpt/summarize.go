@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/bduffany/gpt-cli/internal/session"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+// registerSummarize adds /summarize to c, which shows a summary of the
+// conversation so far, then replaces the conversation with it if the user
+// agrees, or right away with "/summarize replace". Summaries are requested
+// with c's client as it is now, before any -council or -refine wrapping.
+func registerSummarize(c *chat.Chat) {
+	if c.Commands == nil {
+		c.Commands = map[string]chat.Command{}
+	}
+	client := c.Client
+	c.Commands["summarize"] = func(ctx context.Context, args string) error {
+		if args != "" && args != "replace" {
+			io.WriteString(c.Display, chat.Styled(chat.StyleError, "error: usage: /summarize [replace]")+"\n")
+			return nil
+		}
+		c.Notef(chat.StyleNote, "Summarizing...")
+		summary, err := session.Summarize(ctx, client, c.Model, c.Messages)
+		if err != nil {
+			io.WriteString(c.Display, chat.Styled(chat.StyleError, "error: "+err.Error())+"\n")
+			return nil
+		}
+		fmt.Fprintf(c.Display, "%s\n", summary)
+		replace := args == "replace"
+		if !replace {
+			if replace, _, err = c.Confirmf("Replace the conversation with this summary?"); err != nil {
+				return err
+			}
+		}
+		if replace {
+			n := len(c.Messages)
+			c.Messages = session.Compact(c.Messages, summary)
+			c.Notef(chat.StyleNote, "Replaced %d messages with the summary.", n-len(c.Messages)+1)
+		}
+		return nil
+	}
+}
+
+// summarizeSession prints a summary of a saved session, for
+// `gpt sessions summarize`.
+func summarizeSession(ctx context.Context, sess *session.Session) error {
+	oc, err := newClient()
+	if err != nil {
+		return err
+	}
+	mw, err := middleware()
+	if err != nil {
+		return err
+	}
+	client := llm.Chain(oc, mw...)
+	m := sess.Model
+	if isFlagSet("model") || m == "" {
+		m = *model
+	}
+	summary, err := session.Summarize(ctx, client, m, sess.Messages)
+	if err != nil {
+		return err
+	}
+	fmt.Println(summary)
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bduffany/gpt-cli/internal/audio"
+	"github.com/bduffany/gpt-cli/internal/models"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+	"github.com/mattn/go-isatty"
+)
+
+// runTranscribe implements `gpt transcribe`, which prints the text spoken in
+// an audio file.
+func runTranscribe(ctx context.Context, client *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("transcribe", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt transcribe [flags] FILE\n\nPrints the text spoken in an audio file. Use - to read audio from stdin.\n\n")
+		fs.PrintDefaults()
+	}
+	model := fs.String("model", models.Transcription, "Transcription model to use, such as whisper-1.")
+	language := fs.String("language", "", "ISO-639-1 code of the spoken language. Improves accuracy and latency if set.")
+	prompt := fs.String("prompt", "", "Text to guide the transcription, such as spellings of uncommon words.")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	text, err := transcribeFile(ctx, client, &openai.TranscriptionRequest{
+		Model:    *model,
+		Language: *language,
+		Prompt:   *prompt,
+	}, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Println(text)
+	return nil
+}
+
+// transcribeFile transcribes the audio file at path, or stdin if path is "-".
+func transcribeFile(ctx context.Context, client *openai.Client, req *openai.TranscriptionRequest, path string) (string, error) {
+	var r io.Reader = os.Stdin
+	req.Filename = "audio.mp3"
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		r = f
+		req.Filename = path
+	}
+	req.Audio = r
+	return client.Transcribe(ctx, req)
+}
+
+// recordAndTranscribe records from the microphone until Enter is pressed,
+// and returns the text spoken.
+func recordAndTranscribe(ctx context.Context, client *openai.Client) (string, error) {
+	if !isatty.IsTerminal(os.Stdin.Fd()) {
+		return "", fmt.Errorf("recording needs a terminal, to press Enter to stop")
+	}
+	stop := make(chan struct{})
+	go func() {
+		bufio.NewReader(os.Stdin).ReadString('\n')
+		close(stop)
+	}()
+	fmt.Fprintln(os.Stderr, chat.Styled(chat.StyleNote, "Recording. Press Enter to stop."))
+	var wav bytes.Buffer
+	if err := audio.Record(ctx, &wav, stop); err != nil {
+		return "", err
+	}
+	return client.Transcribe(ctx, &openai.TranscriptionRequest{
+		Model:    models.Transcription,
+		Filename: "prompt.wav",
+		Audio:    &wav,
+	})
+}
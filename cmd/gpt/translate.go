@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+const (
+	translateSystemPrompt = `You translate documents into {language}.
+
+Translate all of the prose: headings, paragraphs, list items, table cells, link text, image alt text, and comments in code. Keep the formatting exactly as it is: Markdown and HTML syntax, line breaks, blank lines, and indentation. Don't translate code, inline code, URLs, file paths, commands, or placeholders like {name} and %s. Keep names of people and products as they are, unless they have a well-known translation.
+
+Reply with only the translation, without code fences around it or any commentary.`
+
+	// translateParallel is how many files are translated at once.
+	translateParallel = 4
+	// translateAutoContinue is how many times a translation truncated by max
+	// tokens is continued, since long documents often are.
+	translateAutoContinue = 5
+)
+
+// runTranslate implements `gpt translate`, which translates text or files
+// into another language, keeping their formatting.
+func runTranslate(ctx context.Context, client *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("translate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt translate -to LANG [flags] [FILE ...]\n\nTranslates FILE (or stdin) into LANG, such as ja or German, keeping its\nformatting and leaving code untranslated. One file, or stdin, is written\nto stdout. Several files are each written next to the original with the\nlanguage before the extension, like README.ja.md, or under -o.\n\n")
+		fs.PrintDefaults()
+	}
+	to := fs.String("to", "", "Language to translate into, such as ja or German.")
+	from := fs.String("from", "", "Language to translate from. Empty detects it.")
+	outDir := fs.String("o", "", "Directory to write translated files to, keeping their relative paths.")
+	fs.Parse(args)
+	if *to == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	system := strings.ReplaceAll(translateSystemPrompt, "{language}", *to)
+	if *from != "" {
+		system += "\n\nThe documents are in " + *from + "."
+	}
+
+	files := fs.Args()
+	if len(files) <= 1 && *outDir == "" {
+		var r io.Reader = os.Stdin
+		if len(files) == 1 {
+			f, err := os.Open(files[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		text, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		c, err := newTranslateChat(client, system)
+		if err != nil {
+			return err
+		}
+		_, err = complete(ctx, c, string(text))
+		return err
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("-o needs files to translate")
+	}
+	sem := make(chan struct{}, translateParallel)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := 0
+	for _, path := range files {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			dst, err := translateFile(ctx, client, system, path, *to, *outDir)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed++
+				fmt.Fprintln(os.Stderr, chat.Styled(chat.StyleError, fmt.Sprintf("error: %s: %s", path, err)))
+				return
+			}
+			fmt.Fprintf(os.Stderr, "Translated %s to %s\n", path, dst)
+		}(path)
+	}
+	wg.Wait()
+	if failed > 0 {
+		return fmt.Errorf("failed to translate %d of %d files", failed, len(files))
+	}
+	return nil
+}
+
+// newTranslateChat returns a chat that translates its prompt, displaying
+// the translation.
+func newTranslateChat(client *openai.Client, system string) (*chat.Chat, error) {
+	c, err := newChat(client, *model, system)
+	if err != nil {
+		return nil, err
+	}
+	c.AutoContinue = max(c.AutoContinue, translateAutoContinue)
+	c.ShowThinking = false
+	c.Notes = os.Stderr
+	return c, nil
+}
+
+// translateFile translates a file, writing the translation to its path
+// under dir, or else next to it, and returns where it was written.
+func translateFile(ctx context.Context, client *openai.Client, system, path, lang, dir string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	c, err := newTranslateChat(client, system)
+	if err != nil {
+		return "", err
+	}
+	c.Display = io.Discard
+	text, err := complete(ctx, c, string(b))
+	if err != nil {
+		return "", err
+	}
+	if strings.HasSuffix(string(b), "\n") && !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	dst := translatedPath(path, lang, dir)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+	return dst, os.WriteFile(dst, []byte(text), 0644)
+}
+
+// translatedPath returns where the translation of a file is written: at
+// its path under dir, or else next to it with the language before the
+// extension.
+func translatedPath(path, lang, dir string) string {
+	if dir != "" {
+		if !filepath.IsLocal(path) {
+			path = filepath.Base(path)
+		}
+		return filepath.Join(dir, path)
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + lang + ext
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/internal/audio"
+	"github.com/bduffany/gpt-cli/internal/models"
+	"github.com/bduffany/gpt-cli/internal/speech"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+const defaultVoice = "alloy"
+
+// runTTS implements `gpt tts`, which speaks text aloud or saves it as audio.
+func runTTS(ctx context.Context, client *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("tts", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt tts [flags] [TEXT]\n\nSpeaks TEXT, or stdin if no TEXT is given.\n\n")
+		fs.PrintDefaults()
+	}
+	model := fs.String("model", models.Speech, "Text-to-speech model to use.")
+	voice := fs.String("voice", defaultVoice, "Voice to use, such as alloy, echo, or nova.")
+	speed := fs.Float64("speed", 1, "Speech speed, from 0.25 to 4.")
+	out := fs.String("o", "", "Write audio to this file instead of playing it. The format is taken from the extension, such as .mp3 or .wav.")
+	fs.Parse(args)
+
+	text := strings.Join(fs.Args(), " ")
+	if text == "" {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		text = string(b)
+	}
+	format := "mp3"
+	if *out != "" {
+		if ext := strings.TrimPrefix(filepath.Ext(*out), "."); ext != "" {
+			format = ext
+		}
+	}
+	req := openai.SpeechRequest{
+		Model:          *model,
+		Input:          text,
+		Voice:          *voice,
+		Speed:          *speed,
+		ResponseFormat: format,
+	}
+	if *out == "" {
+		if err := audio.CheckPlayer(); err != nil {
+			return err
+		}
+		return speech.Each(ctx, client, req, func(r io.Reader) error {
+			return audio.Play(ctx, r, format)
+		})
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := speech.Write(ctx, client, req, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// speakReply returns a chat.ReplyHook that reads replies aloud. Since a
+// reply that can't be spoken is no reason to end the chat, errors are shown
+// as warnings.
+func speakReply(c *chat.Chat, client *openai.Client, voice string, speed float64) chat.ReplyHook {
+	return func(ctx context.Context, reply string) error {
+		if err := audio.CheckPlayer(); err != nil {
+			c.Notef(chat.StyleWarning, "Can't speak replies: %s", err)
+			return nil
+		}
+		err := speech.Each(ctx, client, openai.SpeechRequest{
+			Model:          models.Speech,
+			Input:          reply,
+			Voice:          voice,
+			Speed:          speed,
+			ResponseFormat: "mp3",
+		}, func(r io.Reader) error {
+			return audio.Play(ctx, r, "mp3")
+		})
+		if err != nil && ctx.Err() == nil {
+			c.Notef(chat.StyleWarning, "Can't speak reply: %s", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/session"
+	"github.com/bduffany/gpt-cli/internal/stats"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+// runUsage implements `gpt usage`, which totals the tokens and cost of
+// recorded replies by day, model, or provider.
+func runUsage(ctx context.Context, _ *openai.Client, args []string) error {
+	fs := flag.NewFlagSet("usage", flag.ExitOnError)
+	since := fs.String("since", "30d", "Only include replies from this long ago, like 7d, 2w, or 12h. 0 includes all replies.")
+	by := fs.String("by", "day", "Group replies by day, model, or provider.")
+	csv := fs.Bool("csv", false, "Write CSV instead of a table, such as for expense reports.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gpt usage [-since 30d] [-by day|model|provider] [-csv]\n\nTotals the tokens used and cost of replies recorded with -stats, with a\nsparkline of the daily cost.\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	age, err := session.ParseAge(*since)
+	if err != nil {
+		return fmt.Errorf("-since: %w", err)
+	}
+	path, err := statsPath()
+	if err != nil {
+		return err
+	}
+	end := time.Now()
+	var start time.Time
+	if age > 0 {
+		start = end.Add(-age)
+	}
+	records, err := (&stats.Log{Path: path}).Load(start)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("no replies recorded in %s", path)
+	}
+	usage, err := stats.GroupUsage(records, *by)
+	if err != nil {
+		return fmt.Errorf("-by: %w", err)
+	}
+	if *csv {
+		return stats.WriteUsageCSV(os.Stdout, *by, usage)
+	}
+	if start.IsZero() {
+		start = records[0].Time
+	}
+	return stats.WriteUsage(os.Stdout, *by, usage, records, start, end)
+}
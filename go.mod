@@ -5,6 +5,8 @@ go 1.21
 require (
 	github.com/chzyer/readline v1.5.1
 	github.com/mattn/go-isatty v0.0.19
+	golang.org/x/crypto v0.18.0
+	golang.org/x/net v0.20.0
+	golang.org/x/sys v0.16.0
+	gopkg.in/yaml.v3 v3.0.1
 )
-
-require golang.org/x/sys v0.6.0 // indirect
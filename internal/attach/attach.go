@@ -0,0 +1,235 @@
+// Package attach expands @path references in prompts into the contents of
+// the files they name, so that files can be mentioned inline. PDF and Word
+// documents are attached as their text. A reference to a directory
+// attaches the files in it, and a reference to a URL attaches the page as
+// text.
+package attach
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+// Expander expands @references in prompts.
+type Expander struct {
+	// Dir is the directory that paths are relative to. Empty means the
+	// working directory.
+	Dir string
+	// Trim strips license headers from attached files, and leaves out
+	// minified files, to save tokens.
+	Trim bool
+	// MaxTokens bounds the estimated tokens of the files attached from each
+	// directory, and of each web page. 0 means DefaultMaxTokens.
+	MaxTokens int
+	// Client fetches web pages. Nil means httpx.Default.
+	Client *http.Client
+	// Notef reports attachments that were left out or trimmed. Nil means
+	// they aren't reported.
+	Notef func(format string, args ...any)
+
+	// pages caches the sections of fetched web pages by URL.
+	pages map[string]string
+	// prompts caches expanded prompts by the prompt as typed.
+	prompts map[string]string
+}
+
+// DefaultMaxTokens is the default budget for each attached directory or
+// web page.
+const DefaultMaxTokens = 50000
+
+// bytesPerToken is a rough average for English text and code.
+const bytesPerToken = 4
+
+// Register expands the @references in the prompts of each request of a
+// chat, leaving the history as typed, so that attachments aren't saved
+// with the session. Each prompt is expanded once, when it's first sent, and
+// sent the same way with the requests after it.
+func (e *Expander) Register(c *chat.Chat) {
+	if e.Notef == nil {
+		e.Notef = func(format string, args ...any) {
+			c.Notef(chat.StyleNote, format, args...)
+		}
+	}
+	c.MessageHooks = append(c.MessageHooks, e.expandMessages)
+}
+
+// expandMessages expands the @references in the user messages of a
+// request.
+func (e *Expander) expandMessages(ctx context.Context, messages []llm.Message) ([]llm.Message, error) {
+	copied := false
+	for i, m := range messages {
+		if m.Role != llm.RoleUser || !ref.MatchString(m.Content) {
+			continue
+		}
+		expanded, ok := e.prompts[m.Content]
+		if !ok {
+			var err error
+			if expanded, err = e.Expand(ctx, m.Content); err != nil {
+				return nil, err
+			}
+			if e.prompts == nil {
+				e.prompts = map[string]string{}
+			}
+			e.prompts[m.Content] = expanded
+		}
+		if !copied {
+			messages = append([]llm.Message{}, messages...)
+			copied = true
+		}
+		messages[i].Content = expanded
+	}
+	return messages, nil
+}
+
+// ref matches an @reference at the start of the prompt or after whitespace.
+var ref = regexp.MustCompile(`(^|\s)@(\S+)`)
+
+// Expand appends the contents of each file referenced in prompt as @path,
+// and of each page referenced as @https://... References to paths that
+// don't exist, such as @username, are left alone.
+func (e *Expander) Expand(ctx context.Context, prompt string) (string, error) {
+	var sections []string
+	seen := map[string]bool{}
+	for _, m := range ref.FindAllStringSubmatch(prompt, -1) {
+		if isURL(m[2]) {
+			url := trimURL(m[2])
+			if !seen[url] {
+				seen[url] = true
+				sections = append(sections, e.page(ctx, url))
+			}
+			continue
+		}
+		path, ok := e.resolve(m[2])
+		if !ok || seen[path] {
+			continue
+		}
+		seen[path] = true
+		if info, err := os.Stat(e.join(path)); err == nil && info.IsDir() {
+			dirSections, err := e.dir(path, prompt, seen)
+			if err != nil {
+				return "", err
+			}
+			sections = append(sections, dirSections...)
+			continue
+		}
+		section, err := e.file(ctx, path)
+		if err != nil {
+			return "", err
+		}
+		sections = append(sections, section)
+	}
+	if len(sections) == 0 {
+		return prompt, nil
+	}
+	return prompt + "\n\nAttached files:\n\n" + strings.Join(sections, "\n"), nil
+}
+
+// resolve returns the path named by a reference, dropping trailing
+// punctuation that isn't part of it, as in "see @main.go.".
+func (e *Expander) resolve(s string) (string, bool) {
+	for s != "" {
+		if _, err := os.Stat(e.join(s)); err == nil {
+			return filepath.Clean(s), true
+		}
+		trimmed := strings.TrimRight(s, `.,;:!?)]}'"`)
+		if trimmed == s {
+			break
+		}
+		s = trimmed
+	}
+	return "", false
+}
+
+func (e *Expander) maxTokens() int {
+	if e.MaxTokens <= 0 {
+		return DefaultMaxTokens
+	}
+	return e.MaxTokens
+}
+
+func (e *Expander) join(path string) string {
+	if e.Dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(e.Dir, path)
+}
+
+// file returns the section attaching a file: its path, size, and contents
+// in a code block. Documents such as PDFs are attached as their text.
+func (e *Expander) file(ctx context.Context, path string) (string, error) {
+	b, err := os.ReadFile(e.join(path))
+	if err != nil {
+		return "", err
+	}
+	if section, ok := e.document(ctx, path, len(b)); ok {
+		return section, nil
+	}
+	return e.section(path, b), nil
+}
+
+// section returns the section attaching a file with the given contents.
+func (e *Expander) section(path string, b []byte) string {
+	name := filepath.ToSlash(path)
+	header := fmt.Sprintf("%s (%s)", name, formatSize(len(b)))
+	if isBinary(b) {
+		e.note("Left out %s: binary file.", name)
+		return header + ": binary file, left out\n"
+	}
+	content := string(b)
+	if e.Trim {
+		if isMinified(content) {
+			e.note("Left out %s: minified.", name)
+			return header + ": minified, left out\n"
+		}
+		if trimmed := stripLicense(content); len(trimmed) < len(content) {
+			e.note("Stripped the license header from %s.", name)
+			content = trimmed
+		}
+	}
+	return header + ":\n" + fence(content, Language(path, content))
+}
+
+func (e *Expander) note(format string, args ...any) {
+	if e.Notef != nil {
+		e.Notef(format, args...)
+	}
+}
+
+// fence returns content in a fenced code block, with a fence longer than
+// any run of backticks in content.
+func fence(content, lang string) string {
+	n := 3
+	for _, run := range regexp.MustCompile("`{3,}").FindAllString(content, -1) {
+		n = max(n, len(run)+1)
+	}
+	f := strings.Repeat("`", n)
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return f + lang + "\n" + content + f + "\n"
+}
+
+// isBinary returns whether b looks like binary data rather than text.
+func isBinary(b []byte) bool {
+	return bytes.IndexByte(b[:min(len(b), 8000)], 0) >= 0
+}
+
+// formatSize formats a number of bytes like "12 B" or "1.5 KB".
+func formatSize(n int) string {
+	switch {
+	case n < 1000:
+		return fmt.Sprintf("%d B", n)
+	case n < 1000*1000:
+		return fmt.Sprintf("%.1f KB", float64(n)/1000)
+	}
+	return fmt.Sprintf("%.1f MB", float64(n)/(1000*1000))
+}
@@ -0,0 +1,245 @@
+package attach_test
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/internal/attach"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm/llmtest"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestExpand(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.go":   "// Copyright 2024 Example.\n// Licensed under the MIT License.\n\npackage main\n",
+		"bin/run":   "#!/usr/bin/env python3\nprint('```')\n",
+		"logo.png":  "\x89PNG\x00\x00",
+		"dist/a.js": strings.Repeat("var a=1;", 1000),
+	})
+	var notes []string
+	e := &attach.Expander{Dir: dir, Trim: true, Notef: func(format string, args ...any) {
+		notes = append(notes, format)
+	}}
+	got, err := e.Expand(context.Background(), "Compare @main.go with @bin/run, @logo.png, and @dist/a.js. Thanks @someone! Again: @main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Compare @main.go with @bin/run, @logo.png, and @dist/a.js. Thanks @someone! Again: @main.go\n\n" +
+		"Attached files:\n\n" +
+		"main.go (76 B):\n```go\npackage main\n```\n\n" +
+		"bin/run (36 B):\n````python\n#!/usr/bin/env python3\nprint('```')\n````\n\n" +
+		"logo.png (6 B): binary file, left out\n\n" +
+		"dist/a.js (8.0 KB): minified, left out\n"
+	if got != want {
+		t.Errorf("Expand() = %q, want %q", got, want)
+	}
+	if len(notes) != 3 {
+		t.Errorf("notes = %q, want 3", notes)
+	}
+}
+
+func TestExpandDir(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"src/.gitignore":       "*.log\n/build/\n",
+		"src/.gptignore":       "testdata/*\n!testdata/keep.go\n",
+		"src/main.go":          "package main\n",
+		"src/parser.go":        strings.Repeat("// parse\n", 10),
+		"src/huge.go":          strings.Repeat("// huge\n", 100),
+		"src/debug.log":        "log\n",
+		"src/build/out.go":     "package out\n",
+		"src/util/build/b.go":  "package build\n",
+		"src/testdata/a.txt":   "a\n",
+		"src/testdata/keep.go": "package testdata\n",
+		"src/logo.png":         "\x89PNG\x00",
+		"src/.env":             "SECRET=1\n",
+	})
+	var notes []string
+	e := &attach.Expander{Dir: dir, MaxTokens: 50, Notef: func(format string, args ...any) {
+		notes = append(notes, fmt.Sprintf(format, args...))
+	}}
+	got, err := e.Expand(context.Background(), "Fix the parser in @src/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Fix the parser in @src/\n\n" +
+		"Attached files:\n\n" +
+		"src/main.go (13 B):\n```go\npackage main\n```\n\n" +
+		"src/parser.go (90 B):\n```go\n" + strings.Repeat("// parse\n", 10) + "```\n\n" +
+		"src/testdata/keep.go (17 B):\n```go\npackage testdata\n```\n\n" +
+		"src/util/build/b.go (14 B):\n```go\npackage build\n```\n\n" +
+		"Left out of src for length: src/huge.go\n"
+	if got != want {
+		t.Errorf("Expand() = %q, want %q", got, want)
+	}
+	wantNotes := []string{
+		"Left out 1 binary files from src.",
+		"Left out 1 of 5 files from src to stay within 50 tokens: src/huge.go",
+	}
+	if !reflect.DeepEqual(notes, wantNotes) {
+		t.Errorf("notes = %q, want %q", notes, wantNotes)
+	}
+}
+
+func TestExpandURL(t *testing.T) {
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, "<html><head><title>Docs</title><script>x()</script></head><body><h2>Usage</h2><p>Run <code>gpt</code>.</p></body></html>")
+		case "/long":
+			w.Header().Set("Content-Type", "text/plain")
+			io.WriteString(w, strings.Repeat("line\n", 100))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	var notes []string
+	e := &attach.Expander{MaxTokens: 10, Notef: func(format string, args ...any) {
+		notes = append(notes, fmt.Sprintf(format, args...))
+	}}
+	prompt := fmt.Sprintf("Summarize @%s/page. Also @%s/long, and @%s/missing.", srv.URL, srv.URL, srv.URL)
+	got, err := e.Expand(context.Background(), prompt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := prompt + "\n\nAttached files:\n\n" +
+		srv.URL + "/page (25 B):\n```markdown\nDocs\n\n## Usage\n\nRun gpt.\n```\n\n" +
+		srv.URL + "/long (500 B, cut to 40 B):\n```\n" + strings.Repeat("line\n", 8) + "```\n\n" +
+		srv.URL + "/missing: couldn't fetch: 404 Not Found\n"
+	if got != want {
+		t.Errorf("Expand() = %q, want %q", got, want)
+	}
+	if len(notes) != 2 {
+		t.Errorf("notes = %q, want 2", notes)
+	}
+
+	// Pages are fetched once per session.
+	if _, err := e.Expand(context.Background(), fmt.Sprintf("And @%s/page?", srv.URL)); err != nil {
+		t.Fatal(err)
+	}
+	if fetches != 3 {
+		t.Errorf("fetched %d times, want 3", fetches)
+	}
+}
+
+func TestExpandDocuments(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"scan.pdf": "%PDF-1.4\n\x00"})
+	f, err := os.Create(filepath.Join(dir, "spec.docx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	z := zip.NewWriter(f)
+	w, err := z.Create("word/document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t>Spec</w:t></w:r></w:p>
+<w:p><w:r><w:t xml:space="preserve">Tokens </w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t>expire</w:t></w:r><w:r><w:tab/><w:t>hourly.</w:t></w:r></w:p>
+</w:body></w:document>`)
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Without pdftotext, PDFs are left out.
+	t.Setenv("PATH", "")
+
+	e := &attach.Expander{Dir: dir}
+	got, err := e.Expand(context.Background(), "Compare @spec.docx and @scan.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "spec.docx (") || !strings.Contains(got, ", extracted text):\n```\n# Spec\nTokens expire\thourly.\n```\n") {
+		t.Errorf("Expand() = %q, want the text of spec.docx", got)
+	}
+	if !strings.Contains(got, "scan.pdf (10 B): couldn't extract text, left out\n") {
+		t.Errorf("Expand() = %q, want scan.pdf left out", got)
+	}
+}
+
+func TestExpandWithoutReferences(t *testing.T) {
+	e := &attach.Expander{Dir: t.TempDir()}
+	const prompt = "Email me@example.com about @nothing"
+	if got, err := e.Expand(context.Background(), prompt); err != nil || got != prompt {
+		t.Errorf("Expand() = %q, %v, want the prompt unchanged", got, err)
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	for _, test := range []struct{ path, content, want string }{
+		{"a.TS", "", "typescript"},
+		{"Dockerfile", "FROM alpine", "dockerfile"},
+		{"script", "#!/bin/bash\necho", "bash"},
+		{"script", "#!/usr/bin/env -S node --no-warnings\n", "javascript"},
+		{"notes", "hello", ""},
+	} {
+		if got := attach.Language(test.path, test.content); got != test.want {
+			t.Errorf("Language(%q, %q) = %q, want %q", test.path, test.content, got, test.want)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	dir := writeFiles(t, map[string]string{"main.go": "package main\n"})
+	client := llmtest.NewClient(llmtest.Text("It's empty."), llmtest.Text("Sure."))
+	c, err := chat.New(client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Display = io.Discard
+	(&attach.Expander{Dir: dir}).Register(c)
+
+	ctx := context.Background()
+	for _, prompt := range []string{"What's in @main.go?", "Thanks"} {
+		reply, err := c.Send(ctx, prompt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.ReadAll(reply)
+		reply.Close()
+		// Later requests still attach the file as it was first sent.
+		os.WriteFile(filepath.Join(dir, "main.go"), []byte("package changed\n"), 0644)
+	}
+
+	for i, req := range client.Requests() {
+		if got := req.Messages[0].Content; !strings.Contains(got, "Attached files:") || !strings.Contains(got, "package main") {
+			t.Errorf("request %d sent the first prompt as %q, want main.go attached", i, got)
+		}
+	}
+	for _, m := range c.Messages {
+		if strings.Contains(m.Content, "Attached files:") {
+			t.Errorf("attachments were kept in the history: %q", m.Content)
+		}
+	}
+}
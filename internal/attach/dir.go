@@ -0,0 +1,157 @@
+package attach
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dir returns the sections attaching the text files in a directory, as
+// listed by git, so that ignored files are left out, and also leaving out
+// files matching the directory's .gptignore. Files that don't fit in
+// MaxTokens are listed as left out. Files named in the prompt are attached
+// first, then smaller files before larger ones. Files in seen are skipped,
+// and the attached files are added to it.
+func (e *Expander) dir(dir, prompt string, seen map[string]bool) ([]string, error) {
+	root := e.join(dir)
+	files, err := listFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	var ig ignorer
+	if err := ig.readIgnoreFile(filepath.Join(root, ".gptignore")); err != nil {
+		return nil, err
+	}
+
+	type candidate struct {
+		path      string
+		content   []byte
+		mentioned bool
+	}
+	var candidates []*candidate
+	binary := 0
+	lower := strings.ToLower(prompt)
+	for _, rel := range files {
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		if ig.match(rel) || seen[p] {
+			continue
+		}
+		b, err := os.ReadFile(e.join(p))
+		if err != nil {
+			// Listed by git, but deleted.
+			continue
+		}
+		if isBinary(b) {
+			binary++
+			continue
+		}
+		stem := strings.TrimSuffix(path.Base(rel), path.Ext(rel))
+		candidates = append(candidates, &candidate{
+			path:      p,
+			content:   b,
+			mentioned: len(stem) >= 3 && strings.Contains(lower, strings.ToLower(stem)),
+		})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.mentioned != b.mentioned {
+			return a.mentioned
+		}
+		return len(a.content) < len(b.content)
+	})
+
+	budget := e.maxTokens() * bytesPerToken
+	var attached []*candidate
+	var skipped []string
+	used := 0
+	for _, c := range candidates {
+		if used+len(c.content) > budget {
+			skipped = append(skipped, filepath.ToSlash(c.path))
+			continue
+		}
+		used += len(c.content)
+		attached = append(attached, c)
+	}
+	sort.Slice(attached, func(i, j int) bool { return attached[i].path < attached[j].path })
+	sort.Strings(skipped)
+
+	name := filepath.ToSlash(dir)
+	var sections []string
+	for _, c := range attached {
+		seen[c.path] = true
+		sections = append(sections, e.section(c.path, c.content))
+	}
+	if len(attached) == 0 {
+		sections = append(sections, name+": no text files\n")
+	}
+	if binary > 0 {
+		e.note("Left out %d binary files from %s.", binary, name)
+	}
+	if len(skipped) > 0 {
+		e.note("Left out %d of %d files from %s to stay within %d tokens: %s", len(skipped), len(candidates), name, budget/bytesPerToken, summarize(skipped, 10))
+		sections = append(sections, fmt.Sprintf("Left out of %s for length: %s\n", name, strings.Join(skipped, ", ")))
+	}
+	return sections, nil
+}
+
+// listFiles returns the slash-separated paths of the files in dir. In a git
+// repo, files ignored by git are left out. Otherwise, hidden files and
+// dependency directories are left out, along with those matching dir's
+// .gitignore.
+func listFiles(dir string) ([]string, error) {
+	c := exec.Command("git", "ls-files", "--cached", "--others", "--exclude-standard")
+	c.Dir = dir
+	if out, err := c.Output(); err == nil {
+		var files []string
+		for _, f := range strings.Split(string(out), "\n") {
+			if f != "" {
+				files = append(files, f)
+			}
+		}
+		return files, nil
+	}
+	var ig ignorer
+	if err := ig.readIgnoreFile(filepath.Join(dir, ".gitignore")); err != nil {
+		return nil, err
+	}
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		name := d.Name()
+		if d.IsDir() {
+			if strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor" || ig.matchOne(rel, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(name, ".") || ig.match(rel) {
+			return nil
+		}
+		files = append(files, rel)
+		return nil
+	})
+	return files, err
+}
+
+// summarize lists up to n names, followed by how many more there are.
+func summarize(names []string, n int) string {
+	if len(names) <= n {
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("%s, and %d more", strings.Join(names[:n], ", "), len(names)-n)
+}
@@ -0,0 +1,133 @@
+package attach
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// extractors convert documents to plain text, by file extension.
+var extractors = map[string]func(ctx context.Context, path string) (string, error){
+	".docx": extractDOCX,
+	".pdf":  extractPDF,
+}
+
+// document returns the section attaching the text extracted from a
+// document, cut to MaxTokens, and whether path is a kind of document.
+func (e *Expander) document(ctx context.Context, path string, size int) (string, bool) {
+	extract, ok := extractors[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return "", false
+	}
+	name := filepath.ToSlash(path)
+	header := fmt.Sprintf("%s (%s", name, formatSize(size))
+	text, err := extract(ctx, e.join(path))
+	if err != nil {
+		e.note("Left out %s: %s", name, err)
+		return header + "): couldn't extract text, left out\n", true
+	}
+	header += ", extracted text"
+	if limit := e.maxTokens() * bytesPerToken; len(text) > limit {
+		text = truncate(text, limit)
+		header += fmt.Sprintf(" cut to %s", formatSize(len(text)))
+		e.note("Cut the text of %s to %d tokens.", name, e.maxTokens())
+	}
+	return header + "):\n" + fence(text, ""), true
+}
+
+// extractPDF extracts the text of a PDF with pdftotext, from poppler.
+func extractPDF(ctx context.Context, path string) (string, error) {
+	if _, err := exec.LookPath("pdftotext"); err != nil {
+		return "", fmt.Errorf("pdftotext not found; install poppler to attach PDFs")
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "pdftotext", "-layout", "-enc", "UTF-8", path, "-")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("pdftotext: %s", msg)
+		}
+		return "", fmt.Errorf("pdftotext: %w", err)
+	}
+	// Pages are separated by form feeds.
+	text := strings.ReplaceAll(string(out), "\f", "\n")
+	if strings.TrimSpace(text) == "" {
+		return "", fmt.Errorf("no text found; it may be scanned images")
+	}
+	return text, nil
+}
+
+// extractDOCX extracts the text of a Word document, one line per
+// paragraph, with headings marked as in Markdown.
+func extractDOCX(ctx context.Context, path string) (string, error) {
+	z, err := zip.OpenReader(path)
+	if err != nil {
+		return "", err
+	}
+	defer z.Close()
+	f, err := z.Open("word/document.xml")
+	if err != nil {
+		return "", fmt.Errorf("not a Word document: %w", err)
+	}
+	defer f.Close()
+	return docxText(f)
+}
+
+func docxText(r io.Reader) (string, error) {
+	var b, para strings.Builder
+	heading := 0
+	inText := false
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				para.WriteByte('\t')
+			case "br", "cr":
+				para.WriteByte('\n')
+			case "pStyle":
+				for _, a := range t.Attr {
+					if a.Name.Local == "val" && strings.HasPrefix(a.Value, "Heading") {
+						heading, _ = strconv.Atoi(strings.TrimPrefix(a.Value, "Heading"))
+					}
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if heading > 0 && para.Len() > 0 {
+					b.WriteString(strings.Repeat("#", min(heading, 6)) + " ")
+				}
+				b.WriteString(para.String())
+				b.WriteByte('\n')
+				para.Reset()
+				heading = 0
+			}
+		case xml.CharData:
+			if inText {
+				para.Write(t)
+			}
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,112 @@
+package attach
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// languages maps file extensions to the language names used in code
+// fences.
+var languages = map[string]string{
+	".bash": "bash", ".c": "c", ".cc": "cpp", ".cpp": "cpp", ".cs": "csharp",
+	".css": "css", ".dart": "dart", ".ex": "elixir", ".exs": "elixir",
+	".fish": "fish", ".go": "go", ".h": "c", ".hpp": "cpp", ".hs": "haskell",
+	".html": "html", ".java": "java", ".js": "javascript", ".json": "json",
+	".jsx": "jsx", ".kt": "kotlin", ".lua": "lua", ".md": "markdown",
+	".mjs": "javascript", ".php": "php", ".pl": "perl", ".proto": "protobuf",
+	".ps1": "powershell", ".py": "python", ".r": "r", ".rb": "ruby",
+	".rs": "rust", ".scala": "scala", ".scss": "scss", ".sh": "sh",
+	".sql": "sql", ".svelte": "svelte", ".swift": "swift", ".tf": "hcl",
+	".toml": "toml", ".ts": "typescript", ".tsx": "tsx", ".vue": "vue",
+	".xml": "xml", ".yaml": "yaml", ".yml": "yaml", ".zsh": "zsh",
+}
+
+// interpreters maps the programs named in shebang lines to languages.
+var interpreters = map[string]string{
+	"bash": "bash", "sh": "sh", "zsh": "zsh", "dash": "sh", "fish": "fish",
+	"python": "python", "node": "javascript", "deno": "typescript",
+	"ruby": "ruby", "perl": "perl", "php": "php", "lua": "lua", "Rscript": "r",
+}
+
+// Language returns the language of a file for its code fence, from its
+// extension or name, or else its shebang line. It returns "" if unknown.
+func Language(path, content string) string {
+	if lang, ok := languages[strings.ToLower(filepath.Ext(path))]; ok {
+		return lang
+	}
+	switch base := filepath.Base(path); {
+	case base == "Dockerfile" || strings.HasPrefix(base, "Dockerfile."):
+		return "dockerfile"
+	case base == "Makefile" || base == "GNUmakefile":
+		return "makefile"
+	}
+	line, _, _ := strings.Cut(content, "\n")
+	if !strings.HasPrefix(line, "#!") {
+		return ""
+	}
+	fields := strings.Fields(line[2:])
+	for len(fields) > 0 && (filepath.Base(fields[0]) == "env" || strings.HasPrefix(fields[0], "-")) {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	prog := filepath.Base(fields[0])
+	// Drop versions, as in python3 or python3.12.
+	prog = strings.TrimRight(prog, "0123456789.")
+	return interpreters[prog]
+}
+
+// isMinified returns whether content looks like minified code, with few,
+// very long lines.
+func isMinified(content string) bool {
+	if len(content) < 5000 {
+		return false
+	}
+	lines := strings.Count(content, "\n") + 1
+	return len(content)/lines > 500
+}
+
+// commentPrefixes start the lines of line comments in common languages.
+var commentPrefixes = []string{"//", "#", "--", ";", "%"}
+
+// stripLicense removes a license or copyright comment from the top of
+// content, after any shebang line, along with the blank lines after it.
+func stripLicense(content string) string {
+	var head string
+	if strings.HasPrefix(content, "#!") {
+		line, rest, _ := strings.Cut(content, "\n")
+		head, content = line+"\n", rest
+	}
+	body := strings.TrimLeft(content, "\n")
+	end := -1
+	if strings.HasPrefix(body, "/*") {
+		if i := strings.Index(body, "*/"); i >= 0 {
+			end = i + 2
+		}
+	} else {
+		for _, p := range commentPrefixes {
+			if !strings.HasPrefix(body, p) {
+				continue
+			}
+			end = 0
+			for end < len(body) && strings.HasPrefix(body[end:], p) {
+				i := strings.IndexByte(body[end:], '\n')
+				if i < 0 {
+					end = len(body)
+					break
+				}
+				end += i + 1
+			}
+			break
+		}
+	}
+	if end <= 0 {
+		return head + content
+	}
+	comment := strings.ToLower(body[:end])
+	if !strings.Contains(comment, "license") && !strings.Contains(comment, "copyright") {
+		return head + content
+	}
+	return head + strings.TrimLeft(body[end:], "\r\n")
+}
@@ -0,0 +1,126 @@
+package attach
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/htmltext"
+	"github.com/bduffany/gpt-cli/internal/httpx"
+)
+
+const (
+	// fetchTimeout bounds how long fetching a page may take.
+	fetchTimeout = 30 * time.Second
+	// maxResponseBytes bounds how much of a response body is read, before
+	// conversion.
+	maxResponseBytes = 10 << 20
+)
+
+// isURL returns whether a reference names a web page rather than a path.
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://")
+}
+
+// trimURL drops trailing punctuation that isn't part of a URL, as in
+// "see @https://example.com.", keeping closing brackets that have a
+// matching opening one, as in Wikipedia links.
+func trimURL(s string) string {
+	for {
+		trimmed := strings.TrimRight(s, `.,;:!?'"`)
+		for _, pair := range []string{"()", "[]", "{}"} {
+			if strings.HasSuffix(trimmed, pair[1:]) && strings.Count(trimmed, pair[:1]) < strings.Count(trimmed, pair[1:]) {
+				trimmed = trimmed[:len(trimmed)-1]
+			}
+		}
+		if trimmed == s {
+			return s
+		}
+		s = trimmed
+	}
+}
+
+// page returns the section attaching a web page, converted from HTML to
+// readable text and cut to MaxTokens. Pages are fetched once per Expander,
+// so that mentioning a page again in a session reuses it.
+func (e *Expander) page(ctx context.Context, url string) string {
+	if e.pages == nil {
+		e.pages = map[string]string{}
+	}
+	if section, ok := e.pages[url]; ok {
+		return section
+	}
+	section, err := e.fetch(ctx, url)
+	if err != nil {
+		e.note("Couldn't fetch %s: %s", url, err)
+		// Not cached, so that it's retried next time.
+		return fmt.Sprintf("%s: couldn't fetch: %s\n", url, err)
+	}
+	e.pages[url] = section
+	return section
+}
+
+func (e *Expander) fetch(ctx context.Context, url string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "text/html, text/*;q=0.9, application/json;q=0.8")
+	client := e.Client
+	if client == nil {
+		client = httpx.Default
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s", res.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(res.Body, maxResponseBytes))
+	if err != nil {
+		return "", err
+	}
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	text, lang := string(b), ""
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		if text, err = htmltext.Convert(strings.NewReader(text)); err != nil {
+			return "", err
+		}
+		lang = "markdown"
+	case mediaType == "application/json":
+		lang = "json"
+	case strings.HasPrefix(mediaType, "text/") && !isBinary(b):
+		if mediaType == "text/markdown" {
+			lang = "markdown"
+		}
+	default:
+		return "", fmt.Errorf("unsupported content type %q", mediaType)
+	}
+
+	header := fmt.Sprintf("%s (%s", url, formatSize(len(text)))
+	if limit := e.maxTokens() * bytesPerToken; len(text) > limit {
+		text = truncate(text, limit)
+		header += fmt.Sprintf(", cut to %s", formatSize(len(text)))
+		e.note("Cut %s to %d tokens.", url, e.maxTokens())
+	}
+	return header + "):\n" + fence(text, lang), nil
+}
+
+// truncate cuts s to at most n bytes, at a line break if there's one in the
+// last quarter.
+func truncate(s string, n int) string {
+	s = s[:n]
+	if i := strings.LastIndexByte(s, '\n'); i >= n*3/4 {
+		return s[:i+1]
+	}
+	return strings.ToValidUTF8(s, "")
+}
@@ -0,0 +1,70 @@
+// Package audio plays audio using whichever command-line player is
+// installed.
+package audio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// players are tried in order. Each is passed the path of an audio file.
+var players = [][]string{
+	{"afplay"},
+	{"ffplay", "-nodisp", "-autoexit", "-loglevel", "quiet"},
+	{"mpv", "--no-video", "--really-quiet"},
+	{"mpg123", "-q"},
+}
+
+// Play plays the audio read from r, blocking until playback is done. Format
+// is the file extension of the audio format, such as "mp3".
+func Play(ctx context.Context, r io.Reader, format string) error {
+	player, err := findPlayer()
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp("", "gpt-*."+format)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	args := append(player[1:len(player):len(player)], f.Name())
+	cmd := exec.CommandContext(ctx, player[0], args...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("%s: %w", player[0], err)
+	}
+	return nil
+}
+
+// CheckPlayer returns an error if there's no player installed to play
+// audio with.
+func CheckPlayer() error {
+	_, err := findPlayer()
+	return err
+}
+
+func findPlayer() ([]string, error) {
+	for _, p := range players {
+		if p[0] == "afplay" && runtime.GOOS != "darwin" {
+			continue
+		}
+		if _, err := exec.LookPath(p[0]); err == nil {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("no audio player found (tried afplay, ffplay, mpv, mpg123)")
+}
@@ -0,0 +1,89 @@
+package audio
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// recorder is a command that records from the default microphone to the
+// WAV file whose path is appended to args, and finishes the file when
+// interrupted.
+type recorder struct {
+	// goos is the only OS the recorder works on, or "" for any.
+	goos string
+	args []string
+}
+
+// recorders are tried in order.
+var recorders = []recorder{
+	{args: []string{"rec", "-q", "-c", "1", "-r", "16000"}},
+	{goos: "linux", args: []string{"arecord", "-q", "-f", "S16_LE", "-c", "1", "-r", "16000"}},
+	{goos: "darwin", args: []string{"ffmpeg", "-loglevel", "quiet", "-f", "avfoundation", "-i", ":0", "-ac", "1", "-ar", "16000", "-y"}},
+	{goos: "linux", args: []string{"ffmpeg", "-loglevel", "quiet", "-f", "pulse", "-i", "default", "-ac", "1", "-ar", "16000", "-y"}},
+}
+
+// Record records from the microphone until stop is closed, then writes the
+// recording to w as a WAV file. If ctx is done first, the recording is
+// dropped and ctx's error is returned.
+func Record(ctx context.Context, w io.Writer, stop <-chan struct{}) error {
+	rec, err := findRecorder()
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp("", "gpt-*.wav")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	args := append(rec.args[1:len(rec.args):len(rec.args)], f.Name())
+	cmd := exec.Command(rec.args[0], args...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%s: %w", rec.args[0], err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		// The recorder only stops on its own if it fails.
+		if err == nil {
+			err = fmt.Errorf("stopped unexpectedly")
+		}
+		return fmt.Errorf("%s: %w", rec.args[0], err)
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		<-done
+		return ctx.Err()
+	case <-stop:
+	}
+	// Interrupting the recorder lets it finish the file's header. Windows
+	// has no interrupt to send, so the recorder is killed instead.
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		cmd.Process.Kill()
+	}
+	<-done
+	r, err := os.Open(f.Name())
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func findRecorder() (*recorder, error) {
+	for i, r := range recorders {
+		if r.goos != "" && r.goos != runtime.GOOS {
+			continue
+		}
+		if _, err := exec.LookPath(r.args[0]); err == nil {
+			return &recorders[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no audio recorder found (tried rec from sox, arecord, and ffmpeg)")
+}
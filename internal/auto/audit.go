@@ -0,0 +1,95 @@
+package auto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// AuditLog records everything an agent session does as JSON lines, so that
+// automated changes can be reviewed after the fact. A nil *AuditLog records
+// nothing.
+type AuditLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{enc: json.NewEncoder(w)}
+}
+
+// AuditEvent is one line of an audit log. Type is one of "start", "command",
+// "confirm", "write", "http", "checkpoint", "rollback", or "end"; the other fields are set depending
+// on the type.
+type AuditEvent struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+
+	// start
+	Model string `json:"model,omitempty"`
+	Dir   string `json:"dir,omitempty"`
+
+	// command
+	Command     string   `json:"command,omitempty"`
+	Args        []string `json:"args,omitempty"`
+	Comment     string   `json:"comment,omitempty"`
+	OutputBytes int      `json:"output_bytes,omitempty"`
+
+	// confirm
+	Question string `json:"question,omitempty"`
+	Answer   string `json:"answer,omitempty"`
+	Approved *bool  `json:"approved,omitempty"`
+
+	// write
+	Path string `json:"path,omitempty"`
+	// SHA256Before is empty if the file didn't exist.
+	SHA256Before string `json:"sha256_before,omitempty"`
+	SHA256After  string `json:"sha256_after,omitempty"`
+
+	// http
+	Method string `json:"method,omitempty"`
+	URL    string `json:"url,omitempty"`
+	Status int    `json:"status,omitempty"`
+
+	// checkpoint, rollback
+	Ref   string   `json:"ref,omitempty"`
+	Paths []string `json:"paths,omitempty"`
+
+	// Error is set on any event that failed.
+	Error string `json:"error,omitempty"`
+}
+
+func (l *AuditLog) record(e *AuditEvent) {
+	if l == nil {
+		return
+	}
+	e.Time = time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enc.Encode(e)
+}
+
+// fileSHA256 returns the hex SHA-256 of a file, or "" if it doesn't exist.
+func (c *Command) fileSHA256(path string) (string, error) {
+	b, err := c.readFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
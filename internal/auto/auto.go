@@ -5,38 +5,60 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
-	"os/exec"
 	"strings"
+	"time"
 
 	_ "embed"
 
-	"github.com/bduffany/gpt-cli/internal/api"
-	"github.com/bduffany/gpt-cli/internal/chat"
 	"github.com/bduffany/gpt-cli/internal/log"
+	"github.com/bduffany/gpt-cli/internal/otlp"
+	"github.com/bduffany/gpt-cli/internal/search"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
 	"github.com/chzyer/readline"
 )
 
-const aiPS1 = "\x1b[90mgpt>\x1b[m "
-
 var availableCommands = []CommandSpec{
 	{
-		Cmd:  "prompt",
-		Desc: "Requests the user for the next prompt and returns the result.",
-		Run:  runPrompt,
+		Cmd:      "prompt",
+		ReadOnly: true,
+		Desc:     "Requests the user for the next prompt and returns the result.",
+		Run:      runPrompt,
+	},
+	{
+		Cmd:      "plan",
+		ReadOnly: true,
+		Desc:     "Proposes a plan for the user to approve. Give the numbered steps on the lines following the command. Once approved, the plan stays in your instructions.",
+		Run:      runPlan,
+	},
+	{
+		Cmd:      "cat",
+		ReadOnly: true,
+		Args:     "FILES ...",
+		Desc:     "Returns the concatenated contents of one or more files.",
+		Run:      runCat,
 	},
 	{
-		Cmd:  "cat",
-		Args: "FILES ...",
-		Desc: "Returns the concatenated contents of one or more files.",
-		Run:  safeShellCommand("cat"),
+		Cmd:      "ls",
+		ReadOnly: true,
+		Args:     "PATH ...",
+		Desc:     "Runs ls -la on the given paths and returns the result.",
+		Run:      runLs,
 	},
 	{
-		Cmd:  "ls",
-		Args: "PATH ...",
-		Desc: "Runs ls -la on the given paths and returns the result.",
-		Run:  safeShellCommand("ls", "-la"),
+		Cmd:      "search",
+		ReadOnly: true,
+		Args:     "QUERY ...",
+		Desc:     "Searches the web and returns the title, URL, and a snippet of the top results. Use curl to read a result.",
+		Run:      runSearch,
+	},
+	{
+		Cmd:      "lines",
+		ReadOnly: true,
+		Args:     "PATH START [END]",
+		Desc:     "Returns lines START through END of a file, numbered from 1. END defaults to the last line. Use this to read parts of a file that were elided from earlier output.",
+		Run:      runLines,
 	},
 	{
 		Cmd:  "write",
@@ -46,9 +68,9 @@ var availableCommands = []CommandSpec{
 	},
 	{
 		Cmd:  "curl",
-		Args: "URL",
-		Desc: "Issue an HTTP GET request. You can use this for things like searching google or requesting from https://api.github.com. The first line will contain the response code. Next a blank line. Following that, the HTTP response body.",
-		Run:  runHTTPGet,
+		Args: "[METHOD] URL",
+		Desc: "Issue an HTTP request, GET by default. You can use this for things like searching google or requesting from https://api.github.com. On the lines following the command, you may give request headers, then a blank line, then a request body, as in an HTTP request. Header values may use ${NAME} to reference secrets the user has made available; you never see their values. The first line of the result will contain the response code. Next a blank line. Following that, the HTTP response body, with HTML converted to plain text.",
+		Run:  runCurl,
 	},
 }
 
@@ -64,16 +86,164 @@ func (e *FixableError) Error() string {
 	return fmt.Sprintf("%s\n# GPT: %s", e.Err, e.Hint)
 }
 
-func Run(ctx context.Context, c *chat.Chat) error {
-	c.Messages = []api.Message{{
-		Role:    "system",
-		Content: systemPrompt(),
+// Options configure an agent session.
+type Options struct {
+	// OutputLimit is the max size in bytes of command output fed back to the
+	// model. Longer output keeps its head and tail and elides the middle.
+	// Zero means DefaultOutputLimit; negative means no limit.
+	OutputLimit int
+	// OutputLimits overrides OutputLimit for specific commands.
+	OutputLimits map[string]int
+
+	// HTTPTimeout is the max time for a curl request, including reading the
+	// response. Zero means DefaultHTTPTimeout.
+	HTTPTimeout time.Duration
+	// SecretEnv lists env vars that curl headers may reference as ${NAME}.
+	// Their values are redacted from everything the model sees.
+	SecretEnv []string
+
+	// Search is the engine used by the search command. Nil disables search.
+	Search search.Engine
+	// SearchResults is the number of results returned per search. Zero means
+	// DefaultSearchResults.
+	SearchResults int
+
+	// Audit, if set, records each command, confirmation, file write, and HTTP
+	// request.
+	Audit *AuditLog
+
+	// Limits on each task, from one prompt to the next. Once one is reached,
+	// the agent may only summarize its work and prompt the user. MaxTurns of
+	// zero means DefaultMaxTurns; other zero limits, and negative MaxTurns,
+	// mean no limit.
+	MaxTurns    int
+	MaxTokens   int
+	MaxDuration time.Duration
+	// MaxCost is in USD, for models with known pricing.
+	MaxCost float64
+
+	// Policy sets which commands the agent may use, and which need
+	// confirmation. Nil uses the default permissions.
+	Policy *Policy
+
+	// Sandbox, if set, runs file commands in a container instead of on the
+	// host.
+	Sandbox *Sandbox
+
+	// Checkpoint snapshots the git working tree before the agent's first
+	// write, so that the user can review its changes with /diff and revert
+	// them with /rollback.
+	Checkpoint bool
+
+	// Instructions, such as from the project's AGENTS.md, are prepended to
+	// the agent's system prompt.
+	Instructions string
+
+	// Plan requires the agent to propose a plan for each task with the plan
+	// command, and have it approved, before running other commands.
+	Plan bool
+
+	// Tracer, if set, records a span for the session, each turn, and each
+	// command run.
+	Tracer *otlp.Exporter
+
+	// TaskDone, if set, is called when the agent finishes a task and
+	// prompts for the next one, with how long the task took.
+	TaskDone func(d time.Duration)
+
+	checkpoint *checkpoint
+	// taskStart is when the current task was given.
+	taskStart time.Time
+	// writesApproved is set once the user approves all writes for the
+	// session.
+	writesApproved bool
+}
+
+const DefaultSearchResults = 5
+
+const DefaultHTTPTimeout = 30 * time.Second
+
+// DefaultOutputLimit is roughly 4k tokens of output per command.
+const DefaultOutputLimit = 16_000
+
+func (o *Options) policy() *Policy {
+	if o == nil {
+		return nil
+	}
+	return o.Policy
+}
+
+func (o *Options) tracer() *otlp.Exporter {
+	if o == nil {
+		return nil
+	}
+	return o.Tracer
+}
+
+func (o *Options) outputLimit(cmd string) int {
+	limit, ok := o.OutputLimits[cmd]
+	if !ok {
+		limit = o.OutputLimit
+	}
+	if limit == 0 {
+		limit = DefaultOutputLimit
+	}
+	return limit
+}
+
+func Run(ctx context.Context, c *chat.Chat, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+	c.Messages = []llm.Message{{
+		Role:    llm.RoleSystem,
+		Content: systemPrompt(opts),
 	}}
+	if opts.Sandbox != nil {
+		if err := opts.Sandbox.start(ctx); err != nil {
+			return err
+		}
+		defer opts.Sandbox.stop()
+	}
+	opts.writesApproved = false
+	opts.taskStart = time.Now()
+	if opts.Checkpoint {
+		opts.checkpoint = &checkpoint{}
+	}
+	ctx, session := opts.Tracer.Start(ctx, "auto.session", otlp.KindInternal, otlp.String("gen_ai.request.model", c.Model))
+	defer session.End(nil)
 	input := ""
+	turn := 0
 	log.Debugf("Beginning session.")
+	dir, _ := os.Getwd()
+	opts.Audit.record(&AuditEvent{Type: "start", Model: c.Model, Dir: dir})
+	defer opts.Audit.record(&AuditEvent{Type: "end"})
+	b := &budget{opts: opts, model: c.Model}
+	b.reset()
+	// ignored counts replies that ignored a limit notice.
+	limited, ignored := false, 0
+	// planning is set while a task's plan is waiting for approval.
+	planning := false
 	for {
-		err := (func() error {
-			h := &ReplyHandler{chat: c}
+		turn++
+		err := (func() (err error) {
+			ctx, span := opts.Tracer.Start(ctx, "auto.turn", otlp.KindInternal, otlp.Int("gpt_cli.auto.turn", turn))
+			defer func() { span.End(err) }()
+			if limited && ignored >= 2 {
+				// The model won't stop on its own, so prompt for it.
+				io.WriteString(c.Display, chat.Styled(chat.StyleWarning, "Agent limit reached ("+b.exceeded()+").")+"\n")
+				if opts.TaskDone != nil {
+					opts.TaskDone(time.Since(opts.taskStart))
+				}
+				prompt, err := c.GetPrompt()
+				if err != nil {
+					return err
+				}
+				opts.taskStart = time.Now()
+				input, limited, ignored = prompt, false, 0
+				b.reset()
+			}
+			h := &ReplyHandler{ctx: ctx, chat: c, opts: opts, promptOnly: limited, planOnly: planning}
 			r, err := c.Send(ctx, input)
 			if err != nil {
 				return err
@@ -81,6 +251,32 @@ func Run(ctx context.Context, c *chat.Chat) error {
 			defer r.Close()
 
 			output, err := h.Handle(r)
+			b.add(r.Usage)
+			if limited {
+				ignored++
+			}
+			if h.cmd != nil && h.cmd.Spec.Cmd == "prompt" && err == nil {
+				limited, ignored = false, 0
+				b.reset()
+				if opts.Plan {
+					planning = true
+					output += planNotice
+				}
+			}
+			if h.cmd != nil && h.cmd.approvedPlan != "" {
+				planning = false
+				pinPlan(c, opts, h.cmd.approvedPlan)
+			}
+			if h.cmd != nil {
+				opts.Audit.record(&AuditEvent{
+					Type:        "command",
+					Command:     h.cmd.Spec.Cmd,
+					Args:        h.cmd.args,
+					Comment:     strings.TrimSpace(strings.TrimPrefix(h.comment, "#")),
+					OutputBytes: len(output),
+					Error:       errorString(err),
+				})
+			}
 			if e, ok := err.(*FixableError); ok {
 				input = e.Error()
 				return nil
@@ -88,6 +284,13 @@ func Run(ctx context.Context, c *chat.Chat) error {
 
 			// Next input is based on the output of the command.
 			input = output
+			if h.cmd != nil {
+				input = truncateOutput(output, opts.outputLimit(h.cmd.Spec.Cmd))
+			}
+			if reason := b.exceeded(); reason != "" && !limited && err == nil {
+				limited = true
+				input += limitNotice(reason)
+			}
 			return err
 		})()
 		if err == io.EOF || err == readline.ErrInterrupt {
@@ -100,7 +303,17 @@ func Run(ctx context.Context, c *chat.Chat) error {
 }
 
 type ReplyHandler struct {
-	chat       *chat.Chat
+	// ctx is the turn's context, which traces each command as a child of the
+	// turn.
+	ctx  context.Context
+	chat *chat.Chat
+	opts *Options
+	// promptOnly rejects any command but prompt, once a limit is reached.
+	promptOnly bool
+	// planOnly rejects any command but plan and prompt, until a plan is
+	// approved.
+	planOnly bool
+
 	comment    string
 	parsedArgs bool
 	args       []string
@@ -110,8 +323,15 @@ type ReplyHandler struct {
 	result     chan Result
 }
 
+func (h *ReplyHandler) context() context.Context {
+	if h.ctx == nil {
+		return context.Background()
+	}
+	return h.ctx
+}
+
 func (h *ReplyHandler) Handle(r io.Reader) (string, error) {
-	io.WriteString(h.chat.Display, aiPS1)
+	io.WriteString(h.chat.Display, chat.AIPrompt(h.chat.Model))
 
 	_, err := io.Copy(h, r)
 	if err != nil {
@@ -157,7 +377,7 @@ func (h *ReplyHandler) consume(finalize bool) error {
 			}
 			h.chat.Display.Write(part)
 			if newline {
-				io.WriteString(h.chat.Display, aiPS1)
+				io.WriteString(h.chat.Display, chat.AIPrompt(h.chat.Model))
 			}
 			h.comment += string(part)
 			h.buf.Next(len(part))
@@ -188,21 +408,44 @@ func (h *ReplyHandler) consume(finalize bool) error {
 	// If we've parsed the command and args, start the command.
 	if h.cmd == nil && h.parsedArgs {
 		for _, spec := range availableCommands {
-			if spec.Cmd != h.args[0] {
+			if spec.Cmd != h.args[0] || h.opts.policy().permission(spec.Cmd) == Deny {
 				continue
 			}
+			if h.planOnly && spec.Cmd != "plan" && spec.Cmd != "prompt" {
+				return &FixableError{
+					Err:  fmt.Errorf("command %q not run: the plan for this task isn't approved yet", spec.Cmd),
+					Hint: "Propose a numbered plan with the plan command first.",
+				}
+			}
+			if h.promptOnly && spec.Cmd != "prompt" {
+				return &FixableError{
+					Err:  fmt.Errorf("command %q not run: the limit for this task was reached", spec.Cmd),
+					Hint: "Briefly summarize what you did in the comment, then use the prompt command.",
+				}
+			}
 			h.result = make(chan Result, 1)
 			pr, pw := io.Pipe()
 			h.cmd = &Command{
 				Spec:  &spec,
 				Chat:  h.chat,
+				opts:  h.opts,
 				args:  h.args[1:],
 				input: pr,
 			}
 			h.pw = pw
 			h.args = h.args[1:]
 			go func() {
-				output, err := h.cmd.Spec.Run(h.cmd)
+				var output string
+				err := error(nil)
+				_, span := h.opts.tracer().Start(h.context(), "auto.tool "+h.cmd.Spec.Cmd, otlp.KindInternal, otlp.String("gen_ai.tool.name", h.cmd.Spec.Cmd))
+				if h.cmd.Spec.ReadOnly {
+					err = h.cmd.authorize(true, "Run %s?", strings.Join(append([]string{h.cmd.Spec.Cmd}, h.cmd.args...), " "))
+				}
+				if err == nil {
+					output, err = h.cmd.Spec.Run(h.cmd)
+				}
+				span.Set(otlp.Int("gpt_cli.auto.output_bytes", len(output)))
+				span.End(err)
 				pr.Close()
 				h.result <- Result{output, err}
 			}()
@@ -240,28 +483,58 @@ type CommandSpec struct {
 	Args string
 	Desc string
 	Run  func(*Command) (string, error)
+	// ReadOnly is whether the command never changes anything. Read-only
+	// commands are authorized by the policy before they run. Others must
+	// authorize each use themselves, since whether a use is read-only may
+	// depend on its args.
+	ReadOnly bool
 }
 
 func (c *CommandSpec) String() string {
 	return fmt.Sprintf("%s %s", c.Cmd, c.Args)
 }
 
-func systemPrompt() string {
+func systemPrompt(opts *Options) string {
 	specs := ""
 	for _, c := range availableCommands {
+		if opts.policy().permission(c.Cmd) == Deny {
+			continue
+		}
 		specs += "- command: " + c.Cmd + "\n"
 		specs += "  description: " + c.Desc + "\n"
 	}
-	return strings.Replace(promptTemplate, "#{COMMANDS}", specs, 1)
+	prompt := strings.Replace(promptTemplate, "#{COMMANDS}", specs, 1)
+	if opts != nil && opts.Instructions != "" {
+		prompt = opts.Instructions + "\n\n" + prompt
+	}
+	return prompt
 }
 
 type Command struct {
 	Spec *CommandSpec
 	Chat *chat.Chat
 
+	opts   *Options
 	args   []string // does not include command name
 	input  *io.PipeReader
 	result chan Result
+
+	// approvedPlan is set by the plan command once the user approves it.
+	approvedPlan string
+}
+
+// confirmf asks the user to confirm an action, recording the answer in the
+// audit log.
+func (c *Command) confirmf(format string, args ...any) (bool, string, error) {
+	ok, reply, err := c.Chat.Confirmf(format, args...)
+	c.audit(&AuditEvent{Type: "confirm", Question: fmt.Sprintf(format, args...), Answer: reply, Approved: &ok, Error: errorString(err)})
+	return ok, reply, err
+}
+
+func (c *Command) audit(e *AuditEvent) {
+	if c.opts != nil {
+		c.opts.Audit.record(e)
+	}
 }
 
 type Result struct {
@@ -270,12 +543,34 @@ type Result struct {
 }
 
 func runPrompt(cmd *Command) (string, error) {
-	return cmd.Chat.GetPrompt()
+	if o := cmd.opts; o != nil && o.TaskDone != nil {
+		o.TaskDone(time.Since(o.taskStart))
+	}
+	var note string
+	for {
+		prompt, err := cmd.Chat.GetPrompt()
+		if err != nil {
+			return "", err
+		}
+		if cmd.opts != nil {
+			cmd.opts.taskStart = time.Now()
+		}
+		switch strings.TrimSpace(prompt) {
+		case "/diff":
+			cmd.showDiff()
+		case "/rollback":
+			if cmd.rollback() {
+				note = "(I rolled back all of the files you wrote to how they were before you started.)\n\n"
+			}
+		default:
+			return note + prompt, nil
+		}
+	}
 }
 
 func safeShellCommand(command string, flags ...string) func(cmd *Command) (string, error) {
 	return func(cmd *Command) (string, error) {
-		c := exec.Command(command, append(flags, cmd.args...)...)
+		c := cmd.command(command, append(flags, cmd.args...)...)
 		b, err := c.CombinedOutput()
 		if err != nil {
 			return "", &FixableError{
@@ -287,57 +582,29 @@ func safeShellCommand(command string, flags ...string) func(cmd *Command) (strin
 	}
 }
 
-func runWrite(cmd *Command) (string, error) {
-	if len(cmd.args) > 1 {
+func runSearch(cmd *Command) (string, error) {
+	if len(cmd.args) == 0 {
 		return "", &FixableError{
-			Err:  fmt.Errorf("unexpected arg %q", cmd.args[1]),
-			Hint: "The write command only accepts one filename arg. If you are trying to write this as output to the file, note that output must come on the line after the command.",
+			Err:  fmt.Errorf("missing query"),
+			Hint: "Example search command: search golang generics tutorial",
 		}
 	}
-	b, err := io.ReadAll(io.TeeReader(cmd.input, cmd.Chat.Display))
-	if err != nil {
-		return "", err
-	}
-	path := cmd.args[0]
-	log.Debugf("Read all input from gpt. Confirming.")
-	ok, reply, err := cmd.Chat.Confirmf("Write the above contents to %q?", path)
-	if err != nil {
-		return "", err
-	}
-	if !ok {
+	if cmd.opts == nil || cmd.opts.Search == nil {
 		return "", &FixableError{
-			Err:  fmt.Errorf("permission denied"),
-			Hint: fmt.Sprintf("I denied your request: %q", reply),
+			Err:  fmt.Errorf("web search is not configured"),
+			Hint: "Use curl on a site you know instead, or prompt for directions.",
 		}
 	}
-	if err := os.WriteFile(path, b, 0644); err != nil {
-		return "", &FixableError{
-			Err:  err,
-			Hint: "The file failed to write.",
-		}
+	n := cmd.opts.SearchResults
+	if n == 0 {
+		n = DefaultSearchResults
 	}
-	return "", nil
-}
-
-func runHTTPGet(cmd *Command) (string, error) {
-	if len(cmd.args) != 1 {
-		return "", &FixableError{
-			Err:  fmt.Errorf("expected exactly one URL arg"),
-			Hint: "Example curl command: curl https://google.com/search?q=Hello",
-		}
-	}
-	res, err := http.Get(cmd.args[0])
-	if err != nil {
-		return "", err
-	}
-	defer res.Body.Close()
-	reply := res.Status + "\n\n"
-	b, err := io.ReadAll(res.Body)
+	results, err := cmd.opts.Search.Search(context.Background(), strings.Join(cmd.args, " "), n)
 	if err != nil {
 		return "", &FixableError{
-			Err:  fmt.Errorf("failed to read response body: %w", err),
-			Hint: "Does this seem like a transient error? Maybe retry it?",
+			Err:  err,
+			Hint: "The search failed. Try again with a different query.",
 		}
 	}
-	return reply + string(b), nil
+	return search.Format(results), nil
 }
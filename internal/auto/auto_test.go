@@ -0,0 +1,151 @@
+package auto_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/internal/auto"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/llm/llmtest"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	client := llmtest.NewClient(
+		llmtest.Text("# Look around.\nls "+dir),
+		llmtest.Text("# Made a typo.\nsl "+dir),
+		llmtest.Text("# Ask what to do.\nprompt"),
+		llmtest.Text("# Ask again.\nprompt"),
+	)
+	c, err := chat.New(client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Display = &bytes.Buffer{}
+	c.PromptReader = strings.NewReader("Summarize the notes.")
+	c.Interactive = false
+
+	// Run ends once the prompt command reaches the end of the prompt input.
+	audit := &bytes.Buffer{}
+	if err := auto.Run(context.Background(), c, &auto.Options{Audit: auto.NewAuditLog(audit)}); err != nil {
+		t.Fatal(err)
+	}
+	reqs := client.Requests()
+	if len(reqs) != 4 {
+		t.Fatalf("got %d requests, want 4", len(reqs))
+	}
+	if reqs[0].Messages[0].Role != llm.RoleSystem {
+		t.Errorf("first message is %q, want the system prompt", reqs[0].Messages[0].Role)
+	}
+	if got := lastMessage(reqs[1]); !strings.Contains(got, "notes.txt") {
+		t.Errorf("ls output %q doesn't list notes.txt", got)
+	}
+	if got := lastMessage(reqs[2]); !strings.Contains(got, `invalid command "sl"`) {
+		t.Errorf("got %q after an invalid command, want a fixable error", got)
+	}
+	if got := lastMessage(reqs[3]); got != "Summarize the notes." {
+		t.Errorf("prompt command returned %q, want the user's prompt", got)
+	}
+
+	var events []string
+	dec := json.NewDecoder(audit)
+	for dec.More() {
+		e := &auto.AuditEvent{}
+		if err := dec.Decode(e); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, strings.TrimSpace(e.Type+" "+e.Command+" "+e.Comment))
+	}
+	want := []string{"start", "command ls Look around.", "command prompt Ask what to do.", "command prompt Ask again.", "end"}
+	if strings.Join(events, "\n") != strings.Join(want, "\n") {
+		t.Errorf("audit events = %q, want %q", events, want)
+	}
+}
+
+func lastMessage(req *llm.Request) string {
+	return req.Messages[len(req.Messages)-1].Content
+}
+
+func TestRunLimits(t *testing.T) {
+	dir := t.TempDir()
+	client := llmtest.NewClient(
+		llmtest.Text("# One.\nls "+dir),
+		llmtest.Text("# Two.\nls "+dir),
+		llmtest.Text("# Ignore the limit.\nls "+dir),
+		llmtest.Text("# Ignore it again.\nls "+dir),
+		llmtest.Text("# Done.\nprompt"),
+	)
+	c, err := chat.New(client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	display := &bytes.Buffer{}
+	c.Display = display
+	c.PromptReader = strings.NewReader("Keep going.")
+	c.Interactive = false
+
+	if err := auto.Run(context.Background(), c, &auto.Options{MaxTurns: 2}); err != nil {
+		t.Fatal(err)
+	}
+	reqs := client.Requests()
+	if len(reqs) != 5 {
+		t.Fatalf("got %d requests, want 5", len(reqs))
+	}
+	if got := lastMessage(reqs[2]); !strings.Contains(got, "reached the limit for this task (2 turns)") {
+		t.Errorf("got %q after 2 turns, want a limit notice", got)
+	}
+	if got := lastMessage(reqs[3]); !strings.Contains(got, `command "ls" not run`) {
+		t.Errorf("got %q after ignoring the limit, want an error", got)
+	}
+	// After ignoring the limit twice, the user is prompted directly.
+	if !strings.Contains(display.String(), "Agent limit reached") {
+		t.Errorf("display doesn't mention the limit: %q", display.String())
+	}
+	if got := lastMessage(reqs[4]); got != "Keep going." {
+		t.Errorf("got %q after prompting the user, want their prompt", got)
+	}
+}
+
+func TestRunPlan(t *testing.T) {
+	dir := t.TempDir()
+	client := llmtest.NewClient(
+		llmtest.Text("# Initial prompt.\nprompt"),
+		llmtest.Text("# Skip planning.\nls "+dir),
+		llmtest.Text("# Plan.\nplan\n1. List files.\n2. Summarize."),
+		llmtest.Text("# Ask what to change.\nprompt"),
+	)
+	c, err := chat.New(client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Display = &bytes.Buffer{}
+	c.PromptReader = strings.NewReader("Summarize the files.")
+	c.Interactive = false
+
+	if err := auto.Run(context.Background(), c, &auto.Options{Plan: true}); err != nil {
+		t.Fatal(err)
+	}
+	reqs := client.Requests()
+	if len(reqs) != 4 {
+		t.Fatalf("got %d requests, want 4", len(reqs))
+	}
+	if got := lastMessage(reqs[1]); !strings.HasPrefix(got, "Summarize the files.") || !strings.Contains(got, "propose a numbered plan") {
+		t.Errorf("got %q after the task prompt, want a request for a plan", got)
+	}
+	if got := lastMessage(reqs[2]); !strings.Contains(got, `command "ls" not run`) {
+		t.Errorf("got %q for a command before planning, want an error", got)
+	}
+	// Without a terminal, plans can't be approved.
+	if got := lastMessage(reqs[3]); !strings.Contains(got, "plan not approved") {
+		t.Errorf("got %q after proposing a plan, want it rejected", got)
+	}
+}
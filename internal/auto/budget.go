@@ -0,0 +1,70 @@
+package auto
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/models"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+// Default limits per task, where a task is everything the agent does
+// between prompts.
+const (
+	DefaultMaxTurns = 50
+)
+
+// budget tracks what the agent has spent on the current task.
+type budget struct {
+	opts  *Options
+	model string
+
+	start  time.Time
+	turns  int
+	tokens int
+	cost   float64
+}
+
+func (b *budget) reset() {
+	b.start = time.Now()
+	b.turns, b.tokens, b.cost = 0, 0, 0
+}
+
+func (b *budget) add(u *llm.Usage) {
+	b.turns++
+	if u == nil {
+		return
+	}
+	b.tokens += u.TotalTokens()
+	if m, ok := models.Lookup(b.model); ok {
+		b.cost += m.Cost(u.InputTokens, u.CachedInputTokens, u.OutputTokens)
+	}
+}
+
+// exceeded describes the limits that have been reached, or returns "" if
+// there is budget left.
+func (b *budget) exceeded() string {
+	var reasons []string
+	maxTurns := b.opts.MaxTurns
+	if maxTurns == 0 {
+		maxTurns = DefaultMaxTurns
+	}
+	if maxTurns > 0 && b.turns >= maxTurns {
+		reasons = append(reasons, fmt.Sprintf("%d turns", b.turns))
+	}
+	if b.opts.MaxTokens > 0 && b.tokens >= b.opts.MaxTokens {
+		reasons = append(reasons, fmt.Sprintf("%d tokens", b.tokens))
+	}
+	if d := time.Since(b.start); b.opts.MaxDuration > 0 && d >= b.opts.MaxDuration {
+		reasons = append(reasons, d.Round(time.Second).String())
+	}
+	if b.opts.MaxCost > 0 && b.cost >= b.opts.MaxCost {
+		reasons = append(reasons, fmt.Sprintf("$%.2f", b.cost))
+	}
+	return strings.Join(reasons, ", ")
+}
+
+func limitNotice(reason string) string {
+	return fmt.Sprintf("\n# GPT: You have reached the limit for this task (%s). Do not run any more commands. Briefly summarize what you did and what is left in the comment, then use the prompt command.", reason)
+}
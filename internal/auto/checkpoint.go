@@ -0,0 +1,307 @@
+package auto
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/log"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+)
+
+// checkpoint snapshots the git working tree before the agent's first write,
+// so that everything it writes can be reviewed with /diff and reverted with
+// /rollback. The snapshot is a commit under refs/gpt-cli/checkpoints, made
+// without touching HEAD, the index, or any files.
+type checkpoint struct {
+	top    string
+	commit string
+	// head is the commit checked out when the checkpoint was made, which is
+	// its parent.
+	head string
+	// ref names the checkpoint commit, once it's made.
+	ref string
+	// paths are the repo-relative paths the agent wrote, in order.
+	paths []string
+	// err is why no checkpoint could be made.
+	err error
+}
+
+// record adds a path about to be written to the checkpoint, making the
+// checkpoint first if needed. Paths outside the repo aren't covered.
+func (cp *checkpoint) record(path string) error {
+	if cp == nil {
+		return nil
+	}
+	if cp.commit == "" && cp.err == nil {
+		cp.err = cp.create()
+	}
+	if cp.err != nil {
+		return cp.err
+	}
+	rel, err := cp.relPath(path)
+	if err != nil {
+		log.Debugf("Not checkpointing %s: %s", path, err)
+		return nil
+	}
+	for _, p := range cp.paths {
+		if p == rel {
+			return nil
+		}
+	}
+	if err := cp.include(rel); err != nil {
+		return err
+	}
+	cp.paths = append(cp.paths, rel)
+	return nil
+}
+
+func (cp *checkpoint) create() error {
+	top, err := git("", nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return fmt.Errorf("not in a git repository")
+	}
+	cp.top = strings.TrimSpace(top)
+	if head, err := git(cp.top, nil, "rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+		cp.head = strings.TrimSpace(head)
+	}
+	tree, err := cp.snapshot()
+	if err != nil {
+		return err
+	}
+	cp.ref = "refs/gpt-cli/checkpoints/" + time.Now().Format("20060102-150405")
+	return cp.save(tree)
+}
+
+// include adds a file that's about to be written to the checkpoint if it
+// isn't in it yet, such as an ignored file like .env, or one created since
+// the checkpoint was made. Rolling back then restores the file instead of
+// deleting it. Only files that don't exist yet are left out.
+func (cp *checkpoint) include(rel string) error {
+	if _, err := os.Lstat(filepath.Join(cp.top, filepath.FromSlash(rel))); err != nil {
+		return nil
+	}
+	if _, err := git(cp.top, nil, "cat-file", "-e", cp.commit+":"+rel); err == nil {
+		return nil
+	}
+	tree, err := cp.writeTree(func(env []string) error {
+		if _, err := git(cp.top, env, "read-tree", cp.commit); err != nil {
+			return err
+		}
+		_, err := git(cp.top, env, "add", "--force", "--", rel)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return cp.save(tree)
+}
+
+// save commits a tree as the checkpoint, pointing its ref at it.
+func (cp *checkpoint) save(tree string) error {
+	args := []string{"commit-tree", tree, "-m", "gpt-cli checkpoint"}
+	if cp.head != "" {
+		args = append(args, "-p", cp.head)
+	}
+	// Author the checkpoint as gpt-cli, which also works without a
+	// configured git identity.
+	env := []string{"GIT_AUTHOR_NAME=gpt-cli", "GIT_AUTHOR_EMAIL=gpt-cli@localhost", "GIT_COMMITTER_NAME=gpt-cli", "GIT_COMMITTER_EMAIL=gpt-cli@localhost"}
+	commit, err := git(cp.top, env, args...)
+	if err != nil {
+		return err
+	}
+	commit = strings.TrimSpace(commit)
+	if _, err := git(cp.top, nil, "update-ref", cp.ref, commit); err != nil {
+		return err
+	}
+	cp.commit = commit
+	return nil
+}
+
+// snapshot returns a tree of the working tree as it is now, including
+// untracked files that aren't ignored, and the paths recorded even if they
+// are.
+func (cp *checkpoint) snapshot() (string, error) {
+	return cp.writeTree(func(env []string) error {
+		// Starting from HEAD saves rehashing unchanged files. It fails in a
+		// repo with no commits, in which case everything is hashed.
+		git(cp.top, env, "read-tree", "HEAD")
+		if _, err := git(cp.top, env, "add", "--all"); err != nil {
+			return err
+		}
+		var existing []string
+		for _, p := range cp.paths {
+			if _, err := os.Lstat(filepath.Join(cp.top, filepath.FromSlash(p))); err == nil {
+				existing = append(existing, p)
+			}
+		}
+		if len(existing) == 0 {
+			return nil
+		}
+		_, err := git(cp.top, env, append([]string{"add", "--force", "--"}, existing...)...)
+		return err
+	})
+}
+
+// writeTree fills a scratch index with fill, which is passed the
+// environment that selects it, and returns the index as a tree. The user's
+// staged changes are left alone.
+func (cp *checkpoint) writeTree(fill func(env []string) error) (string, error) {
+	dir, err := os.MkdirTemp("", "gpt-checkpoint-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(dir, "index")}
+	if err := fill(env); err != nil {
+		return "", err
+	}
+	tree, err := git(cp.top, env, "write-tree")
+	return strings.TrimSpace(tree), err
+}
+
+func (cp *checkpoint) relPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	// Resolve symlinks in the parent the same way git resolves the top
+	// level, such as /tmp on macOS.
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		abs = filepath.Join(dir, filepath.Base(abs))
+	}
+	rel, err := filepath.Rel(cp.top, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("outside of %s", cp.top)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// diff returns a diff of the agent's changes since the checkpoint.
+func (cp *checkpoint) diff() (string, error) {
+	if cp == nil || cp.commit == "" {
+		return "", cp.unavailable()
+	}
+	if len(cp.paths) == 0 {
+		return "", nil
+	}
+	tree, err := cp.snapshot()
+	if err != nil {
+		return "", err
+	}
+	return git(cp.top, nil, append([]string{"diff", cp.commit, tree, "--"}, cp.paths...)...)
+}
+
+// rollback reverts every file the agent wrote to its state before the
+// first write to it, deleting files that didn't exist then. It returns the paths
+// reverted.
+func (cp *checkpoint) rollback() ([]string, error) {
+	if cp == nil || cp.commit == "" {
+		return nil, cp.unavailable()
+	}
+	var reverted []string
+	for _, p := range cp.paths {
+		if _, err := git(cp.top, nil, "cat-file", "-e", cp.commit+":"+p); err != nil {
+			err := os.Remove(filepath.Join(cp.top, filepath.FromSlash(p)))
+			if err != nil && !os.IsNotExist(err) {
+				return reverted, err
+			}
+		} else if _, err := git(cp.top, nil, "restore", "--source="+cp.commit, "--worktree", "--", p); err != nil {
+			return reverted, err
+		}
+		reverted = append(reverted, p)
+	}
+	cp.paths = nil
+	return reverted, nil
+}
+
+func (cp *checkpoint) unavailable() error {
+	if cp != nil && cp.err != nil {
+		return fmt.Errorf("no checkpoint: %w", cp.err)
+	}
+	return fmt.Errorf("no checkpoint: the agent hasn't written any files")
+}
+
+// git runs git in dir, returning its output.
+func git(dir string, env []string, args ...string) (string, error) {
+	c := exec.Command("git", args...)
+	c.Dir = dir
+	if len(env) > 0 {
+		c.Env = append(os.Environ(), env...)
+	}
+	out, err := c.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w", args[0], commandError(err, out))
+	}
+	return string(out), nil
+}
+
+// session returns the checkpoint for the current session, if checkpointing
+// is enabled.
+func (o *Options) session() *checkpoint {
+	if o == nil {
+		return nil
+	}
+	return o.checkpoint
+}
+
+// checkpoint records a path about to be written, letting the user know when
+// the session's checkpoint is made.
+func (c *Command) checkpoint(path string) {
+	cp := c.opts.session()
+	if cp == nil {
+		return
+	}
+	made := cp.ref != ""
+	if err := cp.record(path); err != nil {
+		log.Debugf("Not checkpointing %s: %s", path, err)
+		return
+	}
+	if !made && cp.ref != "" {
+		c.audit(&AuditEvent{Type: "checkpoint", Ref: cp.ref})
+		io.WriteString(c.Chat.Display, chat.Styled(chat.StyleNote, "Saved a checkpoint as "+cp.ref+". Enter /diff at the prompt to review the agent's changes, or /rollback to undo them.")+"\n")
+	}
+}
+
+func (c *Command) showDiff() {
+	diff, err := c.opts.session().diff()
+	switch {
+	case err != nil:
+		io.WriteString(c.Chat.Display, chat.Styled(chat.StyleError, "error: "+err.Error())+"\n")
+	case diff == "":
+		io.WriteString(c.Chat.Display, "No changes.\n")
+	default:
+		io.WriteString(c.Chat.Display, diff)
+	}
+}
+
+// rollback reverts the agent's changes once the user confirms, returning
+// whether any were reverted.
+func (c *Command) rollback() bool {
+	cp := c.opts.session()
+	if cp == nil || cp.commit == "" {
+		io.WriteString(c.Chat.Display, chat.Styled(chat.StyleError, "error: "+cp.unavailable().Error())+"\n")
+		return false
+	}
+	if len(cp.paths) == 0 {
+		io.WriteString(c.Chat.Display, "No changes.\n")
+		return false
+	}
+	ok, _, err := c.confirmf("Revert %s to checkpoint %s?", strings.Join(cp.paths, ", "), cp.ref)
+	if err != nil || !ok {
+		return false
+	}
+	reverted, err := cp.rollback()
+	c.audit(&AuditEvent{Type: "rollback", Ref: cp.ref, Paths: reverted, Error: errorString(err)})
+	if err != nil {
+		io.WriteString(c.Chat.Display, chat.Styled(chat.StyleError, "error: "+err.Error())+"\n")
+	}
+	for _, p := range reverted {
+		io.WriteString(c.Chat.Display, "Reverted "+p+"\n")
+	}
+	return len(reverted) > 0
+}
@@ -0,0 +1,135 @@
+package auto
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	// Stage some files without committing, as the user might have.
+	for _, name := range []string{"old.txt", "staged.txt"} {
+		if err := os.WriteFile(name, []byte(strings.TrimSuffix(name, ".txt")+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, args := range [][]string{{"init", "-q"}, {"add", "."}} {
+		if _, err := git("", nil, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cp := &checkpoint{}
+	for _, path := range []string{"old.txt", "new.txt", "old.txt"} {
+		if err := cp.record(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cp.record(filepath.Join(os.TempDir(), "elsewhere.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(cp.paths, ","); got != "old.txt,new.txt" {
+		t.Errorf("recorded %q, want old.txt,new.txt", got)
+	}
+	os.WriteFile("old.txt", []byte("changed\n"), 0644)
+	os.WriteFile("new.txt", []byte("new\n"), 0644)
+
+	diff, err := cp.diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"-old", "+changed", "+new"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("diff is missing %q:\n%s", want, diff)
+		}
+	}
+
+	if _, err := cp.rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile("old.txt"); string(b) != "old\n" {
+		t.Errorf("old.txt is %q after rollback, want it restored", b)
+	}
+	if _, err := os.Stat("new.txt"); !os.IsNotExist(err) {
+		t.Errorf("new.txt still exists after rollback")
+	}
+	// The checkpoint mustn't disturb the user's staged changes.
+	if staged, _ := git("", nil, "diff", "--cached", "--name-only"); strings.TrimSpace(staged) != "old.txt\nstaged.txt" {
+		t.Errorf("staged files are %q, want them unchanged", staged)
+	}
+}
+
+// TestCheckpointIgnoredFile checks that rolling back restores a file that
+// git ignores, and one created after the checkpoint, instead of deleting
+// them.
+func TestCheckpointIgnoredFile(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	for name, content := range map[string]string{".gitignore": ".env\n", ".env": "TOKEN=secret\n"} {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := git("", nil, "init", "-q"); err != nil {
+		t.Fatal(err)
+	}
+
+	cp := &checkpoint{}
+	if err := cp.record("new.txt"); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile("new.txt", []byte("new\n"), 0644)
+	os.WriteFile("later.txt", []byte("later\n"), 0644)
+	for _, path := range []string{".env", "later.txt"} {
+		if err := cp.record(path); err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(path, []byte("overwritten\n"), 0644)
+	}
+
+	diff, err := cp.diff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"-TOKEN=secret", "-later", "+overwritten", "+new"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("diff is missing %q:\n%s", want, diff)
+		}
+	}
+
+	if _, err := cp.rollback(); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{".env": "TOKEN=secret\n", "later.txt": "later\n"} {
+		if b, err := os.ReadFile(name); string(b) != want {
+			t.Errorf("%s is %q, %v after rollback, want %q", name, b, err, want)
+		}
+	}
+	if _, err := os.Stat("new.txt"); !os.IsNotExist(err) {
+		t.Errorf("new.txt still exists after rollback")
+	}
+}
@@ -0,0 +1,173 @@
+package auto
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/internal/htmltext"
+	"github.com/bduffany/gpt-cli/internal/httpx"
+)
+
+const (
+	// maxRedirects is the number of redirects curl follows.
+	maxRedirects = 5
+	// maxResponseBytes bounds how much of a response body is read, before
+	// any conversion or output limits apply.
+	maxResponseBytes = 10 << 20
+)
+
+var (
+	headerLine = regexp.MustCompile(`^[A-Za-z0-9-]+:`)
+	secretRef  = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+)
+
+func runCurl(cmd *Command) (string, error) {
+	method, url := http.MethodGet, ""
+	switch len(cmd.args) {
+	case 1:
+		url = cmd.args[0]
+	case 2:
+		method, url = strings.ToUpper(cmd.args[0]), cmd.args[1]
+	default:
+		return "", &FixableError{
+			Err:  fmt.Errorf("expected [METHOD] URL args"),
+			Hint: "Example curl command: curl https://google.com/search?q=Hello",
+		}
+	}
+	opts := cmd.opts
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	payload, err := io.ReadAll(io.TeeReader(cmd.input, cmd.Chat.Display))
+	if err != nil {
+		return "", err
+	}
+	header, body := parseRequest(string(payload))
+	secrets := map[string]string{}
+	for name, values := range header {
+		for i, v := range values {
+			v, err := expandSecrets(v, opts.SecretEnv, secrets)
+			if err != nil {
+				return "", err
+			}
+			header[name][i] = v
+		}
+	}
+
+	readOnly := method == http.MethodGet || method == http.MethodHead
+	if err := cmd.authorize(readOnly, "Send %s request to %s?", method, url); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		return "", &FixableError{Err: err, Hint: "Check the method and URL."}
+	}
+	req.Header = header
+	timeout := opts.HTTPTimeout
+	if timeout == 0 {
+		timeout = DefaultHTTPTimeout
+	}
+	client := &http.Client{
+		Transport: httpx.Default.Transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+	res, err := client.Do(req)
+	event := &AuditEvent{Type: "http", Method: method, URL: url, Error: errorString(err)}
+	if err == nil {
+		event.Status = res.StatusCode
+	}
+	cmd.audit(event)
+	if err != nil {
+		return "", &FixableError{
+			Err:  fmt.Errorf("%s", redact(err.Error(), secrets)),
+			Hint: "The request failed. Check the URL, or try another source.",
+		}
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(res.Body, maxResponseBytes))
+	if err != nil {
+		return "", &FixableError{
+			Err:  fmt.Errorf("failed to read response body: %w", err),
+			Hint: "Does this seem like a transient error? Maybe retry it?",
+		}
+	}
+	text := string(b)
+	if mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mediaType == "text/html" {
+		if t, err := htmltext.Convert(strings.NewReader(text)); err == nil {
+			text = t
+		}
+	}
+
+	reply := res.Status + "\n"
+	if final := res.Request.URL.String(); final != req.URL.String() {
+		reply += "Redirected to " + final + "\n"
+	}
+	reply += "\n" + text
+	return redact(reply, secrets), nil
+}
+
+// parseRequest splits the lines following a curl command into headers and a
+// body, like an HTTP request. If the first line isn't a header, it's all
+// body.
+func parseRequest(payload string) (http.Header, string) {
+	header := http.Header{}
+	payload = strings.TrimLeft(payload, "\n")
+	for payload != "" {
+		line, rest, _ := strings.Cut(payload, "\n")
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			return header, strings.TrimRight(rest, "\n")
+		}
+		if !headerLine.MatchString(line) {
+			break
+		}
+		name, value, _ := strings.Cut(line, ":")
+		header.Add(name, strings.TrimSpace(value))
+		payload = rest
+	}
+	return header, strings.TrimRight(payload, "\n")
+}
+
+// expandSecrets replaces ${NAME} references in s with the values of allowed
+// env vars, recording each value used in secrets so it can be redacted.
+func expandSecrets(s string, allowed []string, secrets map[string]string) (string, error) {
+	var err error
+	s = secretRef.ReplaceAllStringFunc(s, func(ref string) string {
+		name := secretRef.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !slices.Contains(allowed, name) || !ok {
+			err = &FixableError{
+				Err:  fmt.Errorf("secret %s is not available", name),
+				Hint: "Ask the user to make the secret available, or try a request that doesn't need it.",
+			}
+			return ref
+		}
+		secrets[name] = value
+		return value
+	})
+	return s, err
+}
+
+// redact replaces secret values in s with their names.
+func redact(s string, secrets map[string]string) string {
+	for name, value := range secrets {
+		if value != "" {
+			s = strings.ReplaceAll(s, value, "[REDACTED:"+name+"]")
+		}
+	}
+	return s
+}
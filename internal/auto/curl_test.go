@@ -0,0 +1,68 @@
+package auto
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/pkg/chat"
+)
+
+func TestCurl(t *testing.T) {
+	t.Setenv("TEST_TOKEN", "s3cret")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/page", http.StatusFound)
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprintf(w, "<html><head><title>Page</title><script>x()</script></head><body><p>Auth was %s</p></body></html>", r.Header.Get("Authorization"))
+		}
+	}))
+	defer srv.Close()
+
+	out, err := curl(t, &Options{SecretEnv: []string{"TEST_TOKEN"}}, []string{srv.URL + "/old"}, "Authorization: Bearer ${TEST_TOKEN}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "200 OK\nRedirected to " + srv.URL + "/page\n\nPage\n\nAuth was Bearer [REDACTED:TEST_TOKEN]\n"
+	if out != want {
+		t.Errorf("curl output = %q, want %q", out, want)
+	}
+
+	// Secrets must be allowed explicitly.
+	if _, err := curl(t, &Options{}, []string{srv.URL + "/page"}, "Authorization: Bearer ${TEST_TOKEN}\n"); err == nil || !strings.Contains(err.Error(), "not available") {
+		t.Errorf("got error %v using a secret that isn't allowed", err)
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	header, body := parseRequest("\nContent-Type: application/json\nX-Test: 1\n\n{\"a\": 1}\n")
+	if header.Get("Content-Type") != "application/json" || header.Get("X-Test") != "1" || body != `{"a": 1}` {
+		t.Errorf("parseRequest = %v, %q", header, body)
+	}
+	header, body = parseRequest("{\"a\": 1}\n")
+	if len(header) != 0 || body != `{"a": 1}` {
+		t.Errorf("parseRequest of body only = %v, %q", header, body)
+	}
+}
+
+func curl(t *testing.T, opts *Options, args []string, payload string) (string, error) {
+	t.Helper()
+	pr, pw := io.Pipe()
+	go func() {
+		io.WriteString(pw, payload)
+		pw.Close()
+	}()
+	return runCurl(&Command{
+		Spec:  &CommandSpec{Cmd: "curl"},
+		Chat:  &chat.Chat{Display: &bytes.Buffer{}},
+		opts:  opts,
+		args:  args,
+		input: pr,
+	})
+}
@@ -0,0 +1,93 @@
+package auto
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// runCat concatenates files. It reads them itself, rather than running cat,
+// so that it works on hosts without cat, such as Windows.
+func runCat(cmd *Command) (string, error) {
+	if len(cmd.args) == 0 {
+		return "", &FixableError{Err: fmt.Errorf("missing FILES"), Hint: "Example: cat main.go"}
+	}
+	var b strings.Builder
+	for _, path := range cmd.args {
+		f, err := cmd.open(path)
+		if err != nil {
+			return "", &FixableError{Err: err, Hint: "Check the path with ls."}
+		}
+		_, err = io.Copy(&b, f)
+		f.Close()
+		if err != nil {
+			return "", &FixableError{Err: err, Hint: "Check the path with ls."}
+		}
+	}
+	return b.String(), nil
+}
+
+// runLs runs ls -la, or lists the paths itself on hosts without ls.
+func runLs(cmd *Command) (string, error) {
+	if cmd.opts.sandbox() != nil {
+		return safeShellCommand("ls", "-la")(cmd)
+	}
+	if _, err := exec.LookPath("ls"); err == nil {
+		return safeShellCommand("ls", "-la")(cmd)
+	}
+	paths := cmd.args
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	var b strings.Builder
+	for i, path := range paths {
+		if len(paths) > 1 {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "%s:\n", path)
+		}
+		if err := list(&b, filepath.FromSlash(path)); err != nil {
+			return "", &FixableError{
+				Err:  err,
+				Hint: "The command failed. Try something else, or prompt on how to proceed",
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+// list writes a listing of a file, or of a directory's entries, in the
+// style of ls -l.
+func list(w io.Writer, path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		writeEntry(w, info, path)
+		return nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		writeEntry(w, info, e.Name())
+	}
+	return nil
+}
+
+func writeEntry(w io.Writer, info os.FileInfo, name string) {
+	if info.IsDir() {
+		name += "/"
+	}
+	fmt.Fprintf(w, "%s %10d %s %s\n", info.Mode(), info.Size(), info.ModTime().Format("Jan _2 15:04"), name)
+}
@@ -0,0 +1,126 @@
+package auto
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/pkg/chat"
+)
+
+// aiPS1 is the default label before each line of the agent's output.
+var aiPS1 = chat.AIPrompt("")
+
+// echoSpec is a command that returns its args and input, so tests can see
+// exactly what the parser passed to it.
+var echoSpec = CommandSpec{
+	Cmd: "echo",
+	Run: func(cmd *Command) (string, error) {
+		b, err := io.ReadAll(cmd.input)
+		if err != nil {
+			return "", err
+		}
+		return strings.Join(cmd.args, ",") + "|" + string(b), nil
+	},
+}
+
+var failSpec = CommandSpec{
+	Cmd: "fail",
+	Run: func(cmd *Command) (string, error) {
+		io.Copy(io.Discard, cmd.input)
+		return "", &FixableError{Err: errors.New("failed"), Hint: "Try again."}
+	},
+}
+
+// chunkReader returns its input n bytes at a time, like a streamed reply.
+type chunkReader struct {
+	s string
+	n int
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if r.s == "" {
+		return 0, io.EOF
+	}
+	n := copy(p, r.s[:min(r.n, len(r.s))])
+	r.s = r.s[n:]
+	return n, nil
+}
+
+func TestReplyHandler(t *testing.T) {
+	defer func(specs []CommandSpec) { availableCommands = specs }(availableCommands)
+	availableCommands = []CommandSpec{echoSpec, failSpec}
+
+	for _, test := range []struct {
+		name    string
+		reply   string
+		output  string
+		display string
+		// errContains is a substring of the expected FixableError, if any.
+		errContains string
+	}{
+		{
+			name:    "command with args",
+			reply:   "# Echo some args.\necho a b\n",
+			output:  "a,b|",
+			display: aiPS1 + "# Echo some args.\n" + aiPS1 + "echo a b\n\n",
+		},
+		{
+			name:    "command without args",
+			reply:   "# Echo nothing.\necho\n",
+			output:  "|",
+			display: aiPS1 + "# Echo nothing.\n" + aiPS1 + "echo\n\n",
+		},
+		{
+			name:    "payload",
+			reply:   "# Write a file.\necho out.txt\nline 1\nline 2\n",
+			output:  "out.txt|line 1\nline 2\n",
+			display: aiPS1 + "# Write a file.\n" + aiPS1 + "echo out.txt\n\n",
+		},
+		{
+			name:    "comment only",
+			reply:   "# Just thinking.\n",
+			display: aiPS1 + "# Just thinking.\n" + aiPS1,
+		},
+		{
+			name:        "missing comment",
+			reply:       "echo a\n",
+			errContains: "unexpected input",
+		},
+		{
+			name:        "unknown command",
+			reply:       "# Do something.\nrm -rf /\n",
+			errContains: `invalid command "rm"`,
+		},
+		{
+			name:        "command error",
+			reply:       "# Fail.\nfail\npayload\n",
+			errContains: "failed",
+		},
+	} {
+		for _, size := range []int{1, 2, 5, len(test.reply)} {
+			display := &bytes.Buffer{}
+			h := &ReplyHandler{chat: &chat.Chat{Display: display}}
+			output, err := h.Handle(&chunkReader{s: test.reply, n: size})
+			if test.errContains != "" {
+				var fe *FixableError
+				if !errors.As(err, &fe) || !strings.Contains(err.Error(), test.errContains) {
+					t.Errorf("%s (chunks of %d): got error %v, want FixableError containing %q", test.name, size, err, test.errContains)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s (chunks of %d): %s", test.name, size, err)
+				continue
+			}
+			if output != test.output {
+				t.Errorf("%s (chunks of %d): output = %q, want %q", test.name, size, output, test.output)
+			}
+			if display.String() != test.display {
+				t.Errorf("%s (chunks of %d): display = %q, want %q", test.name, size, display.String(), test.display)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package auto
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/pkg/chat"
+)
+
+// planNotice asks the model to plan a task before acting on it.
+const planNotice = "\n# GPT: Before running any other commands, propose a numbered plan for this task with the plan command. I will approve it or ask for changes."
+
+func runPlan(cmd *Command) (string, error) {
+	if len(cmd.args) > 0 {
+		return "", &FixableError{
+			Err:  fmt.Errorf("unexpected arg %q", cmd.args[0]),
+			Hint: "The plan command takes no args. Put the numbered steps on the lines after the command.",
+		}
+	}
+	b, err := io.ReadAll(io.TeeReader(cmd.input, cmd.Chat.Display))
+	if err != nil {
+		return "", err
+	}
+	plan := strings.TrimSpace(string(b))
+	if plan == "" {
+		return "", &FixableError{
+			Err:  fmt.Errorf("empty plan"),
+			Hint: "Put the numbered steps on the lines after the plan command.",
+		}
+	}
+	ok, reply, err := cmd.confirmf("Approve this plan? Answer yes, or describe what to change.")
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", &FixableError{
+			Err:  fmt.Errorf("plan not approved"),
+			Hint: fmt.Sprintf("I asked for changes: %q. Propose a revised plan with the plan command.", reply),
+		}
+	}
+	cmd.approvedPlan = plan
+	return "Plan approved. Start with step 1.", nil
+}
+
+// pinPlan adds an approved plan to the system prompt, so that it stays in
+// context however long the task takes. It replaces any previous plan.
+func pinPlan(c *chat.Chat, opts *Options, plan string) {
+	c.Messages[0].Content = systemPrompt(opts) + "\n\nThe user approved the following plan for the current task. Work through it one step at a time, starting each comment with the step number, like \"# Step 2: ...\". If the plan needs to change, propose a new one with the plan command.\n\n" + plan + "\n"
+}
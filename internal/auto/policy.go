@@ -0,0 +1,158 @@
+package auto
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Permission controls whether the agent may use a command.
+type Permission string
+
+const (
+	// Allow runs the command without confirmation.
+	Allow Permission = "allow"
+	// Ask confirms every use of the command.
+	Ask Permission = "ask"
+	// AllowReadOnly runs read-only uses of the command without confirmation,
+	// such as GET requests with curl, and confirms any others.
+	AllowReadOnly Permission = "allow-readonly"
+	// Deny hides the command from the model.
+	Deny Permission = "deny"
+)
+
+// defaultPermissions apply to commands that a policy doesn't mention.
+// Commands missing here are allowed.
+var defaultPermissions = map[string]Permission{
+	"write": Ask,
+	"curl":  AllowReadOnly,
+}
+
+// Policy sets the permission of each command. Without confirmation from a
+// terminal, commands that need it are refused, so a policy can lock the
+// agent down for unattended use.
+type Policy struct {
+	Tools map[string]Permission `yaml:"tools"`
+}
+
+// LoadPolicy reads a policy from a YAML file like:
+//
+//	tools:
+//	  write: ask
+//	  curl: allow-readonly
+//	  search: deny
+func LoadPolicy(path string) (*Policy, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Policy{}
+	if err := yaml.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for tool, perm := range p.Tools {
+		if err := checkPermission(tool, perm); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return p, nil
+}
+
+func checkPermission(tool string, perm Permission) error {
+	if _, ok := strictness[perm]; !ok {
+		return fmt.Errorf("invalid permission %q for %s: must be allow, ask, allow-readonly, or deny", perm, tool)
+	}
+	return nil
+}
+
+// strictness orders permissions from the loosest to the strictest.
+var strictness = map[Permission]int{Allow: 0, AllowReadOnly: 1, Ask: 2, Deny: 3}
+
+// Restrict returns p with the permissions in tools applied where they're
+// stricter than p's, such as those from a project's config, which
+// shouldn't be able to loosen the user's own policy. p may be nil.
+func (p *Policy) Restrict(tools map[string]Permission) (*Policy, error) {
+	r := &Policy{Tools: map[string]Permission{}}
+	if p != nil {
+		for tool, perm := range p.Tools {
+			r.Tools[tool] = perm
+		}
+	}
+	for tool, perm := range tools {
+		if err := checkPermission(tool, perm); err != nil {
+			return nil, err
+		}
+		if strictness[perm] > strictness[p.permission(tool)] {
+			r.Tools[tool] = perm
+		}
+	}
+	return r, nil
+}
+
+// LoadPolicyIfExists is like LoadPolicy, but returns nil if the file
+// doesn't exist.
+func LoadPolicyIfExists(path string) (*Policy, error) {
+	p, err := LoadPolicy(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return p, err
+}
+
+func (p *Policy) permission(cmd string) Permission {
+	if p != nil {
+		if perm, ok := p.Tools[cmd]; ok {
+			return perm
+		}
+	}
+	if perm, ok := defaultPermissions[cmd]; ok {
+		return perm
+	}
+	return Allow
+}
+
+// authorize checks that a use of the command is permitted, asking the user
+// to confirm it if the policy requires. readOnly is whether this use can't
+// change anything.
+func (c *Command) authorize(readOnly bool, format string, args ...any) error {
+	var policy *Policy
+	if c.opts != nil {
+		policy = c.opts.Policy
+	}
+	switch policy.permission(c.Spec.Cmd) {
+	case Allow:
+		return nil
+	case AllowReadOnly:
+		if readOnly {
+			return nil
+		}
+	case Deny:
+		return c.denied()
+	}
+	ok, reply, err := c.confirmf(format, args...)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return refused(reply)
+	}
+	return nil
+}
+
+func (c *Command) denied() error {
+	return &FixableError{
+		Err:  fmt.Errorf("command %q is not allowed", c.Spec.Cmd),
+		Hint: "Use one of the other available commands.",
+	}
+}
+
+// refused is the error for a use of a command that the user declined.
+func refused(reply string) error {
+	return &FixableError{
+		Err:  fmt.Errorf("permission denied"),
+		Hint: fmt.Sprintf("I denied your request: %q", reply),
+	}
+}
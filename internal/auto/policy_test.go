@@ -0,0 +1,95 @@
+package auto_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/internal/auto"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm/llmtest"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "policy.yaml")
+	if err := os.WriteFile(path, []byte("tools:\n  write: deny\n  curl: allow\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := auto.LoadPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Tools["write"] != auto.Deny || p.Tools["curl"] != auto.Allow {
+		t.Errorf("got %v", p.Tools)
+	}
+
+	if err := os.WriteFile(path, []byte("tools:\n  write: maybe\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auto.LoadPolicy(path); err == nil || !strings.Contains(err.Error(), `invalid permission "maybe"`) {
+		t.Errorf("got error %v, want invalid permission", err)
+	}
+
+	p, err = auto.LoadPolicyIfExists(filepath.Join(dir, "missing.yaml"))
+	if p != nil || err != nil {
+		t.Errorf("got %v, %v for a missing file, want nil, nil", p, err)
+	}
+}
+
+func TestRestrictPolicy(t *testing.T) {
+	user := &auto.Policy{Tools: map[string]auto.Permission{"write": auto.Allow, "ls": auto.Deny}}
+	p, err := user.Restrict(map[string]auto.Permission{"write": auto.Ask, "ls": auto.Allow, "curl": auto.Allow, "cat": auto.Deny})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// curl stays at its default of allow-readonly.
+	want := map[string]auto.Permission{"write": auto.Ask, "ls": auto.Deny, "cat": auto.Deny}
+	if !reflect.DeepEqual(p.Tools, want) {
+		t.Errorf("got %v, want %v", p.Tools, want)
+	}
+	if _, err := (*auto.Policy)(nil).Restrict(map[string]auto.Permission{"write": "maybe"}); err == nil {
+		t.Error("got no error for an invalid permission")
+	}
+}
+
+func TestRunPolicy(t *testing.T) {
+	dir := t.TempDir()
+	client := llmtest.NewClient(
+		llmtest.Text("# Look around.\nls "+dir),
+		llmtest.Text("# Read the notes.\ncat "+filepath.Join(dir, "notes.txt")),
+		llmtest.Text("# Ask what to do.\nprompt"),
+		llmtest.Text("# Ask again.\nprompt"),
+	)
+	c, err := chat.New(client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Display = &bytes.Buffer{}
+	c.PromptReader = strings.NewReader("")
+	c.Interactive = false
+
+	policy := &auto.Policy{Tools: map[string]auto.Permission{"ls": auto.Deny, "cat": auto.Ask}}
+	if err := auto.Run(context.Background(), c, &auto.Options{Policy: policy}); err != nil {
+		t.Fatal(err)
+	}
+	reqs := client.Requests()
+	if len(reqs) != 4 {
+		t.Fatalf("got %d requests, want 4", len(reqs))
+	}
+	if system := reqs[0].Messages[0].Content; strings.Contains(system, "command: ls") || !strings.Contains(system, "command: cat") {
+		t.Errorf("system prompt should list cat but not ls:\n%s", system)
+	}
+	if got := lastMessage(reqs[1]); !strings.Contains(got, `invalid command "ls"`) {
+		t.Errorf("got %q after a denied command, want an invalid command error", got)
+	}
+	// Without a terminal to confirm on, commands that need confirmation are
+	// refused.
+	if got := lastMessage(reqs[2]); !strings.Contains(got, "permission denied") {
+		t.Errorf("got %q after an unconfirmed command, want permission denied", got)
+	}
+}
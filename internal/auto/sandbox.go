@@ -0,0 +1,170 @@
+package auto
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/internal/log"
+)
+
+const DefaultSandboxImage = "debian:stable-slim"
+
+// Sandbox runs the agent's file commands in a disposable container instead
+// of on the host. The workspace is bind-mounted read-write at the same path
+// as on the host, so paths mean the same thing in both places, except on
+// Windows, where it's mounted at /workspace. The container is removed when
+// the session ends.
+//
+// curl and search still run on the host, subject to the policy.
+type Sandbox struct {
+	// Runtime is the container CLI, such as "docker" or "podman". Empty means
+	// "docker".
+	Runtime string
+	// Image is the container image. Empty means DefaultSandboxImage.
+	Image string
+	// Workspace is the host directory mounted into the container. Empty means
+	// the working directory.
+	Workspace string
+	// Network is the container network. Empty means "none", so commands have
+	// no network access.
+	Network string
+
+	id  string
+	dir string
+}
+
+func (o *Options) sandbox() *Sandbox {
+	if o == nil {
+		return nil
+	}
+	return o.Sandbox
+}
+
+func (s *Sandbox) runtime() string {
+	if s.Runtime == "" {
+		return "docker"
+	}
+	return s.Runtime
+}
+
+// start starts the container, which idles until commands are exec'd in it.
+func (s *Sandbox) start(ctx context.Context) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	workspace := s.Workspace
+	if workspace == "" {
+		workspace = dir
+	}
+	workspace, err = filepath.Abs(workspace)
+	if err != nil {
+		return err
+	}
+	image := s.Image
+	if image == "" {
+		image = DefaultSandboxImage
+	}
+	network := s.Network
+	if network == "" {
+		network = "none"
+	}
+	rel, err := filepath.Rel(workspace, dir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel, dir = ".", workspace
+	}
+	// Windows paths like C:\src aren't valid in a Linux container, so there
+	// the workspace is mounted at /workspace instead.
+	mount := workspace
+	if filepath.Separator != '/' {
+		mount = "/workspace"
+		dir = path.Join(mount, filepath.ToSlash(rel))
+	}
+	args := []string{"run", "--detach", "--rm", "--init", "--network", network, "--volume", workspace + ":" + mount, "--workdir", dir}
+	// Run as the host user, so files written to the workspace aren't owned
+	// by root.
+	if uid, gid := os.Getuid(), os.Getgid(); uid >= 0 {
+		args = append(args, "--user", fmt.Sprintf("%d:%d", uid, gid))
+	}
+	args = append(args, image, "sleep", "infinity")
+	log.Debugf("Starting sandbox: %s %s", s.runtime(), strings.Join(args, " "))
+	out, err := exec.CommandContext(ctx, s.runtime(), args...).Output()
+	if err != nil {
+		return fmt.Errorf("start sandbox: %w", commandError(err, out))
+	}
+	s.id = strings.TrimSpace(string(out))
+	s.dir = dir
+	return nil
+}
+
+// stop removes the container, along with any changes made outside the
+// workspace.
+func (s *Sandbox) stop() {
+	if s.id == "" {
+		return
+	}
+	if out, err := exec.Command(s.runtime(), "rm", "--force", s.id).CombinedOutput(); err != nil {
+		log.Debugf("Failed to remove sandbox %s: %s", s.id, commandError(err, out))
+	}
+	s.id = ""
+}
+
+// command returns a command that runs in the container.
+func (s *Sandbox) command(name string, args ...string) *exec.Cmd {
+	return exec.Command(s.runtime(), append([]string{"exec", "--interactive", "--workdir", s.dir, s.id, name}, args...)...)
+}
+
+// commandError returns the output of a failed command as an error, falling
+// back to err if there was no output.
+func commandError(err error, out []byte) error {
+	var ee *exec.ExitError
+	if errors.As(err, &ee) && len(ee.Stderr) > 0 {
+		out = ee.Stderr
+	}
+	if msg := strings.TrimSpace(string(out)); msg != "" {
+		return errors.New(msg)
+	}
+	return err
+}
+
+// command returns a command that runs in the sandbox, if there is one, or
+// else on the host.
+func (c *Command) command(name string, args ...string) *exec.Cmd {
+	if s := c.opts.sandbox(); s != nil {
+		return s.command(name, args...)
+	}
+	return exec.Command(name, args...)
+}
+
+// open opens a file for reading, in the sandbox if there is one.
+func (c *Command) open(path string) (io.ReadCloser, error) {
+	if c.opts.sandbox() == nil {
+		return os.Open(filepath.FromSlash(path))
+	}
+	out, err := c.command("cat", "--", path).Output()
+	if err != nil {
+		return nil, commandError(err, out)
+	}
+	return io.NopCloser(bytes.NewReader(out)), nil
+}
+
+// writeFile writes a file, in the sandbox if there is one.
+func (c *Command) writeFile(path string, b []byte) error {
+	if c.opts.sandbox() == nil {
+		return os.WriteFile(filepath.FromSlash(path), b, 0644)
+	}
+	w := c.command("sh", "-c", `cat > "$1"`, "sh", path)
+	w.Stdin = bytes.NewReader(b)
+	if out, err := w.CombinedOutput(); err != nil {
+		return commandError(err, out)
+	}
+	return nil
+}
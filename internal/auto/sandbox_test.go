@@ -0,0 +1,79 @@
+package auto_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/internal/auto"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm/llmtest"
+)
+
+// fakeRuntime stands in for docker, logging each invocation and running
+// exec'd commands on the host.
+const fakeRuntime = `#!/bin/sh
+echo "$@" >> "$LOG"
+case "$1" in
+run) echo container1 ;;
+exec) while [ "$1" != container1 ]; do shift; done; shift; exec "$@" ;;
+esac
+`
+
+func TestRunSandbox(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake runtime is a shell script")
+	}
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "fake-docker")
+	if err := os.WriteFile(bin, []byte(fakeRuntime), 0755); err != nil {
+		t.Fatal(err)
+	}
+	log := filepath.Join(dir, "log")
+	t.Setenv("LOG", log)
+	path := filepath.Join(dir, "notes.txt")
+	client := llmtest.NewClient(
+		llmtest.Text("# Write notes.\nwrite "+path+"\nhello\n"),
+		llmtest.Text("# Read them back.\nlines "+path+" 1"),
+		llmtest.Text("# Ask what to do.\nprompt"),
+		llmtest.Text("# Ask again.\nprompt"),
+	)
+	c, err := chat.New(client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Display = &bytes.Buffer{}
+	c.PromptReader = strings.NewReader("")
+	c.Interactive = false
+
+	opts := &auto.Options{
+		Sandbox: &auto.Sandbox{Runtime: bin, Workspace: dir},
+		Policy:  &auto.Policy{Tools: map[string]auto.Permission{"write": auto.Allow}},
+	}
+	if err := auto.Run(context.Background(), c, opts); err != nil {
+		t.Fatal(err)
+	}
+	if got := lastMessage(client.Requests()[2]); strings.TrimSpace(got) != "hello" {
+		t.Errorf("lines returned %q, want the written contents", got)
+	}
+	b, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if run := calls[0]; !strings.HasPrefix(run, "run ") || !strings.Contains(run, "--network none") || !strings.Contains(run, "--volume "+dir+":"+dir) {
+		t.Errorf("container started with %q, want no network and the workspace mounted", run)
+	}
+	if rm := calls[len(calls)-1]; rm != "rm --force container1" {
+		t.Errorf("last call is %q, want the container removed", rm)
+	}
+	for _, call := range calls[1 : len(calls)-1] {
+		if !strings.HasPrefix(call, "exec ") {
+			t.Errorf("command %q didn't run in the container", call)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package auto
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// truncateOutput shortens command output to about limit bytes, keeping the
+// head and tail on line boundaries, and notes which lines were elided so the
+// model can ask for them with the lines command.
+func truncateOutput(s string, limit int) string {
+	if limit < 0 || len(s) <= limit {
+		return s
+	}
+	head := s[:limit*2/3]
+	if i := strings.LastIndexByte(head, '\n'); i >= 0 {
+		head = head[:i+1]
+	}
+	tail := s[len(s)-limit/3:]
+	if i := strings.IndexByte(tail, '\n'); i >= 0 && i < len(tail)-1 {
+		tail = tail[i+1:]
+	}
+	elided := s[len(head) : len(s)-len(tail)]
+	start := strings.Count(head, "\n") + 1
+	end := start + strings.Count(strings.TrimSuffix(elided, "\n"), "\n")
+	return fmt.Sprintf("%s[... lines %d-%d elided (%d of %d bytes) ...]\n%s", head, start, end, len(elided), len(s), tail)
+}
+
+func runLines(cmd *Command) (string, error) {
+	if len(cmd.args) < 2 || len(cmd.args) > 3 {
+		return "", &FixableError{
+			Err:  fmt.Errorf("expected PATH START [END] args"),
+			Hint: "Example: lines main.go 100 200",
+		}
+	}
+	start, err := strconv.Atoi(cmd.args[1])
+	if err != nil || start < 1 {
+		return "", &FixableError{Err: fmt.Errorf("invalid START %q", cmd.args[1]), Hint: "START must be a line number, starting from 1."}
+	}
+	end := -1
+	if len(cmd.args) == 3 {
+		end, err = strconv.Atoi(cmd.args[2])
+		if err != nil || end < start {
+			return "", &FixableError{Err: fmt.Errorf("invalid END %q", cmd.args[2]), Hint: "END must be a line number no less than START."}
+		}
+	}
+	f, err := cmd.open(cmd.args[0])
+	if err != nil {
+		return "", &FixableError{Err: err, Hint: "Check the path with ls."}
+	}
+	defer f.Close()
+	var b strings.Builder
+	r := bufio.NewReader(f)
+	for n := 1; end < 0 || n <= end; n++ {
+		line, err := r.ReadString('\n')
+		if n >= start {
+			b.WriteString(line)
+		}
+		if err != nil {
+			break
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,30 @@
+package auto
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTruncateOutput(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 100; i++ {
+		lines = append(lines, fmt.Sprintf("line %03d", i))
+	}
+	s := strings.Join(lines, "\n") + "\n"
+
+	if got := truncateOutput(s, len(s)); got != s {
+		t.Errorf("output within the limit was changed")
+	}
+	if got := truncateOutput(s, -1); got != s {
+		t.Errorf("output with no limit was changed")
+	}
+
+	got := truncateOutput(s, 90)
+	want := "line 001\nline 002\nline 003\nline 004\nline 005\nline 006\n" +
+		"[... lines 7-97 elided (819 of 900 bytes) ...]\n" +
+		"line 098\nline 099\nline 100\n"
+	if got != want {
+		t.Errorf("truncateOutput = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,143 @@
+package auto
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/internal/log"
+	"github.com/bduffany/gpt-cli/internal/textdiff"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+)
+
+func runWrite(cmd *Command) (string, error) {
+	if len(cmd.args) > 1 {
+		return "", &FixableError{
+			Err:  fmt.Errorf("unexpected arg %q", cmd.args[1]),
+			Hint: "The write command only accepts one filename arg. If you are trying to write this as output to the file, note that output must come on the line after the command.",
+		}
+	}
+	b, err := io.ReadAll(cmd.input)
+	if err != nil {
+		return "", err
+	}
+	path := cmd.args[0]
+	old, err := cmd.readFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Debugf("Failed to read %s for diff: %s", path, err)
+	}
+	log.Debugf("Read all input from gpt. Confirming.")
+	b, err = cmd.confirmWrite(path, old, b)
+	if err != nil {
+		return "", err
+	}
+	cmd.checkpoint(path)
+	before, _ := cmd.fileSHA256(path)
+	err = cmd.writeFile(path, b)
+	after, _ := cmd.fileSHA256(path)
+	cmd.audit(&AuditEvent{Type: "write", Path: path, SHA256Before: before, SHA256After: after, Error: errorString(err)})
+	if err != nil {
+		return "", &FixableError{
+			Err:  err,
+			Hint: "The file failed to write.",
+		}
+	}
+	return "", nil
+}
+
+// confirmWrite shows the diff of a write and asks the user to approve it,
+// edit it first, or approve all writes for the rest of the session. It
+// returns the contents to write, as edited.
+func (cmd *Command) confirmWrite(path string, old, b []byte) ([]byte, error) {
+	for {
+		textdiff.Show(cmd.Chat.Display, path, string(old), string(b))
+		switch cmd.opts.policy().permission(cmd.Spec.Cmd) {
+		case Allow:
+			return b, nil
+		case Deny:
+			return nil, cmd.denied()
+		}
+		if cmd.opts != nil && cmd.opts.writesApproved {
+			return b, nil
+		}
+		answer, err := cmd.Chat.Askf("Write these changes to %q? (yes / no / edit / all)", path)
+		if err == chat.ErrNoTerminal {
+			answer, err = "no (not running in a terminal)", nil
+			io.WriteString(cmd.Chat.Display, answer+"\n")
+		}
+		ok := answer == "y" || answer == "yes" || answer == "a" || answer == "all"
+		cmd.audit(&AuditEvent{Type: "confirm", Question: fmt.Sprintf("Write these changes to %q?", path), Answer: answer, Approved: &ok, Error: errorString(err)})
+		if err != nil {
+			return nil, err
+		}
+		switch answer {
+		case "y", "yes":
+			return b, nil
+		case "a", "all":
+			if cmd.opts != nil {
+				cmd.opts.writesApproved = true
+			}
+			return b, nil
+		case "e", "edit":
+			if b, err = edit(path, b); err != nil {
+				return nil, err
+			}
+		default:
+			if answer == "" {
+				answer = "no"
+			}
+			return nil, refused(answer)
+		}
+	}
+}
+
+// edit opens contents in the user's editor, returning the edited contents.
+func edit(path string, b []byte) ([]byte, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+	// Keep the extension, so the editor can highlight the syntax.
+	f, err := os.CreateTemp("", "gpt-write-*-"+filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	// Editors are often set with flags, like "code --wait".
+	args := append(strings.Fields(editor), f.Name())
+	c := exec.Command(args[0], args[1:]...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return nil, fmt.Errorf("edit: %w", err)
+	}
+	return os.ReadFile(f.Name())
+}
+
+// readFile reads a file, in the sandbox if there is one.
+func (c *Command) readFile(path string) ([]byte, error) {
+	f, err := c.open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
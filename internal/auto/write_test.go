@@ -0,0 +1,35 @@
+package auto
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/pkg/chat"
+)
+
+func TestConfirmWrite(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	display := &bytes.Buffer{}
+	cmd := &Command{
+		Spec: &CommandSpec{Cmd: "write"},
+		Chat: &chat.Chat{Display: display},
+		opts: &Options{Policy: &Policy{Tools: map[string]Permission{"write": Allow}}},
+	}
+	b, err := cmd.confirmWrite("a.txt", []byte("a\nb\n"), []byte("a\nc\n"))
+	if err != nil || string(b) != "a\nc\n" {
+		t.Fatalf("got %q, %v", b, err)
+	}
+	if want := "--- a.txt\n+++ a.txt\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n"; display.String() != want {
+		t.Errorf("displayed:\n%s\nwant:\n%s", display, want)
+	}
+
+	// Without a terminal, writes that need confirmation are refused.
+	cmd.opts.Policy = nil
+	_, err = cmd.confirmWrite("a.txt", nil, []byte("a\n"))
+	var fe *FixableError
+	if !errors.As(err, &fe) || !strings.Contains(fe.Hint, "not running in a terminal") {
+		t.Errorf("got %v, want the write refused", err)
+	}
+}
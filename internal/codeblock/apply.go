@@ -0,0 +1,106 @@
+package codeblock
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/internal/textdiff"
+)
+
+// Target returns the file that a block is meant to be written to, from an
+// info string like "title=main.go", "file=main.go", or "path=main.go", or a
+// language like "go:main.go". It returns "" if the block names no file.
+func (b Block) Target() string {
+	if _, path, ok := strings.Cut(b.Lang, ":"); ok && path != "" {
+		return path
+	}
+	for _, field := range strings.Fields(b.Info) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "title", "file", "filename", "path":
+			return strings.Trim(value, `"'`)
+		}
+	}
+	return ""
+}
+
+// isDiff returns whether a block is a unified diff.
+func (b Block) isDiff() bool {
+	return b.Lang == "diff" || b.Lang == "patch" || strings.HasPrefix(b.Code, "--- ")
+}
+
+// Change is a file write proposed by code blocks.
+type Change struct {
+	// Path is relative to the directory passed to Changes.
+	Path     string
+	Old, New string
+}
+
+// Changes returns the file writes proposed by blocks: the contents of each
+// block that names its file, and the changes in each diff block, in order.
+// Files are read relative to dir. Several blocks changing one file result
+// in one Change, with the blocks applied in turn.
+func Changes(dir string, blocks []Block) ([]Change, error) {
+	var changes []*Change
+	byPath := map[string]*Change{}
+	change := func(path string) (*Change, error) {
+		path = filepath.Clean(filepath.FromSlash(path))
+		if !filepath.IsLocal(path) {
+			return nil, fmt.Errorf("%s is outside the working directory", path)
+		}
+		if c, ok := byPath[path]; ok {
+			return c, nil
+		}
+		b, err := os.ReadFile(filepath.Join(dir, path))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		c := &Change{Path: path, Old: string(b), New: string(b)}
+		byPath[path] = c
+		changes = append(changes, c)
+		return c, nil
+	}
+	for _, b := range blocks {
+		switch {
+		case b.isDiff():
+			files, err := textdiff.SplitFiles(b.Code)
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range files {
+				if f.NewPath == "/dev/null" {
+					return nil, fmt.Errorf("%s: deleting files isn't supported", f.OldPath)
+				}
+				c, err := change(f.NewPath)
+				if err != nil {
+					return nil, err
+				}
+				old := c.New
+				if f.OldPath == "/dev/null" {
+					old = ""
+				}
+				if c.New, err = textdiff.Apply(old, f.Hunks); err != nil {
+					return nil, fmt.Errorf("%s: %w", c.Path, err)
+				}
+			}
+		case b.Target() != "":
+			c, err := change(b.Target())
+			if err != nil {
+				return nil, err
+			}
+			c.New = b.Code
+		}
+	}
+	out := make([]Change, len(changes))
+	for i, c := range changes {
+		out[i] = *c
+	}
+	return out, nil
+}
@@ -0,0 +1,191 @@
+// Package codeblock extracts fenced code blocks from Markdown replies.
+package codeblock
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/internal/textdiff"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+// Block is a fenced code block.
+type Block struct {
+	// Lang is the first word of the fence's info string, such as "go".
+	Lang string
+	// Info is the rest of the info string, such as "title=main.go".
+	Info string
+	// Code is the contents of the block, ending with a newline unless
+	// empty.
+	Code string
+}
+
+// Parse returns the fenced code blocks in text, fenced with ``` or ~~~. A
+// block left open, as in a truncated reply, runs to the end of text.
+func Parse(text string) []Block {
+	var blocks []Block
+	var cur *Block
+	var fence string
+	var code strings.Builder
+	for _, line := range strings.SplitAfter(text, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+		trimmed = strings.TrimRight(trimmed, "\r\n")
+		if cur == nil {
+			f := fenceOf(trimmed)
+			if f == "" || indent > 3 || (f[0] == '`' && strings.Contains(trimmed[len(f):], "`")) {
+				continue
+			}
+			fence = f
+			lang, info, _ := strings.Cut(strings.TrimSpace(trimmed[len(f):]), " ")
+			cur = &Block{Lang: lang, Info: strings.TrimSpace(info)}
+			code.Reset()
+			continue
+		}
+		if f := fenceOf(trimmed); indent <= 3 && f != "" && f[0] == fence[0] && len(f) >= len(fence) && strings.TrimSpace(trimmed[len(f):]) == "" {
+			cur.Code = code.String()
+			blocks = append(blocks, *cur)
+			cur = nil
+			continue
+		}
+		code.WriteString(line)
+	}
+	if cur != nil {
+		cur.Code = code.String()
+		if cur.Code != "" && !strings.HasSuffix(cur.Code, "\n") {
+			cur.Code += "\n"
+		}
+		blocks = append(blocks, *cur)
+	}
+	return blocks
+}
+
+// fenceOf returns the run of 3 or more backticks or tildes that starts
+// line, or "".
+func fenceOf(line string) string {
+	if line == "" || (line[0] != '`' && line[0] != '~') {
+		return ""
+	}
+	n := len(line) - len(strings.TrimLeft(line, line[:1]))
+	if n < 3 {
+		return ""
+	}
+	return line[:n]
+}
+
+// Select returns the blocks chosen by sel: all of them if sel is empty, the
+// nth if sel is a number n counting from 1, or else those whose language
+// is sel.
+func Select(blocks []Block, sel string) ([]Block, error) {
+	if sel == "" {
+		return blocks, nil
+	}
+	if n, err := strconv.Atoi(sel); err == nil {
+		if n < 1 || n > len(blocks) {
+			return nil, fmt.Errorf("no code block %d: the reply has %d", n, len(blocks))
+		}
+		return blocks[n-1 : n], nil
+	}
+	var out []Block
+	for _, b := range blocks {
+		if strings.EqualFold(b.Lang, sel) {
+			out = append(out, b)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no %s code blocks in the reply", sel)
+	}
+	return out, nil
+}
+
+// Write writes the code of each block, separated by blank lines.
+func Write(w io.Writer, blocks []Block) error {
+	for i, b := range blocks {
+		if i > 0 {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, b.Code); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Register adds commands for the code blocks of the last reply to a chat:
+// /code, which shows them, and /apply, which writes the files they name
+// after showing a diff of each one and asking for confirmation.
+func Register(c *chat.Chat) {
+	if c.Commands == nil {
+		c.Commands = map[string]chat.Command{}
+	}
+	c.Commands["apply"] = func(ctx context.Context, args string) error {
+		changes, err := Changes(".", Parse(LastReply(c.Messages)))
+		if err == nil && len(changes) == 0 {
+			err = fmt.Errorf("no diffs or code blocks naming a file, like ```go title=main.go, in the last reply")
+		}
+		if err != nil {
+			io.WriteString(c.Display, chat.Styled(chat.StyleError, "error: "+err.Error())+"\n")
+			return nil
+		}
+		for _, ch := range changes {
+			if ch.Old == ch.New {
+				continue
+			}
+			textdiff.Show(c.Display, ch.Path, ch.Old, ch.New)
+			ok, _, err := c.Confirmf("Write these changes to %q?", ch.Path)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if err := write(ch.Path, ch.New); err != nil {
+				io.WriteString(c.Display, chat.Styled(chat.StyleError, "error: "+err.Error())+"\n")
+				continue
+			}
+			io.WriteString(c.Display, chat.Styled(chat.StyleNote, "Wrote "+ch.Path)+"\n")
+		}
+		return nil
+	}
+	c.Commands["code"] = func(ctx context.Context, args string) error {
+		blocks, err := Select(Parse(LastReply(c.Messages)), strings.TrimSpace(args))
+		if err == nil && len(blocks) == 0 {
+			err = fmt.Errorf("no code blocks in the last reply")
+		}
+		if err != nil {
+			io.WriteString(c.Display, chat.Styled(chat.StyleError, "error: "+err.Error())+"\n")
+			return nil
+		}
+		return Write(c.Display, blocks)
+	}
+}
+
+// write writes a file, keeping its mode if it exists.
+func write(path, contents string) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(contents), mode)
+}
+
+// LastReply returns the content of the last assistant message, or "".
+func LastReply(messages []llm.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == llm.RoleAssistant {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
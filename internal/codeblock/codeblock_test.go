@@ -0,0 +1,76 @@
+package codeblock_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/internal/codeblock"
+)
+
+const reply = "Here's the script:\n\n```bash\necho hi\n```\n\nAnd in Go:\n\n~~~~go title=main.go\nfmt.Println(\"```\")\n~~~\n~~~~\n\nRun it with `go run`.\n\n```\nplain\n"
+
+func TestParse(t *testing.T) {
+	got := codeblock.Parse(reply)
+	want := []codeblock.Block{
+		{Lang: "bash", Code: "echo hi\n"},
+		{Lang: "go", Info: "title=main.go", Code: "fmt.Println(\"```\")\n~~~\n"},
+		{Code: "plain\n"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %q, want %q", got, want)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	blocks := codeblock.Parse(reply)
+	for _, test := range []struct {
+		sel  string
+		want []string
+	}{
+		{"", []string{"bash", "go", ""}},
+		{"2", []string{"go"}},
+		{"BASH", []string{"bash"}},
+		{"4", nil},
+		{"python", nil},
+	} {
+		got, err := codeblock.Select(blocks, test.sel)
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("Select(%q) succeeded, want error", test.sel)
+			}
+			continue
+		}
+		var langs []string
+		for _, b := range got {
+			langs = append(langs, b.Lang)
+		}
+		if err != nil || !reflect.DeepEqual(langs, test.want) {
+			t.Errorf("Select(%q) = %q, %v, want %q", test.sel, langs, err, test.want)
+		}
+	}
+}
+
+func TestChanges(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reply := "Add a helper:\n\n```go title=util/util.go\npackage util\n```\n\nThen:\n\n```diff\n--- a/main.go\n+++ b/main.go\n@@ -3,3 +3,3 @@\n func main() {\n-\tprintln(\"hi\")\n+\tprintln(\"hello\")\n }\n```\n\n```go\n// no file named\n```\n"
+	got, err := codeblock.Changes(dir, codeblock.Parse(reply))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []codeblock.Change{
+		{Path: filepath.Join("util", "util.go"), New: "package util\n"},
+		{Path: "main.go", Old: "package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n", New: "package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Changes() = %q, want %q", got, want)
+	}
+
+	if _, err := codeblock.Changes(dir, codeblock.Parse("```sh file=../x.sh\nrm -rf /\n```\n")); err == nil {
+		t.Error("Changes() outside the directory succeeded")
+	}
+}
@@ -0,0 +1,180 @@
+// Package config loads user settings from ~/.config/gpt-cli/config.yaml.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/internal/ratelimit"
+	"github.com/bduffany/gpt-cli/internal/scrub"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	// Model is the default model, used when -model is not set.
+	Model string `yaml:"model,omitempty"`
+	// BaseURL is the API server, for OpenAI-compatible providers other than
+	// OpenAI. The OPENAI_BASE_URL env var overrides it.
+	BaseURL string `yaml:"base_url,omitempty"`
+	// Theme sets the prompt labels and colors.
+	Theme *chat.Theme `yaml:"theme,omitempty"`
+	// Sessions configures how interactive sessions are saved.
+	Sessions Sessions `yaml:"sessions,omitempty"`
+	// Redact configures how secrets and personal data are masked in
+	// prompts before they're sent, unless -scrub_secrets=false.
+	Redact *scrub.Config `yaml:"redact,omitempty"`
+	// RateLimits limit the requests and tokens per minute sent to models.
+	RateLimits []ratelimit.Limit `yaml:"rate_limits,omitempty"`
+	// Paths overrides where sessions, logs, and caches are kept.
+	Paths Paths `yaml:"paths,omitempty"`
+}
+
+type Sessions struct {
+	// Backend is where sessions are saved: "files", the default, which
+	// keeps each as a JSON file in the data dir, with no database to set
+	// up, or "sqlite", which keeps them all in sessions.db in the data dir,
+	// using the sqlite3 command.
+	Backend string `yaml:"backend,omitempty"`
+	// Encrypt encrypts saved sessions, with a key derived from the
+	// GPT_SESSION_PASSPHRASE env var if it's set, or else a random key
+	// stored in session.key in the config dir.
+	Encrypt bool `yaml:"encrypt,omitempty"`
+	// MaxSessions, MaxAge, and MaxSize limit the sessions kept. The least
+	// recently updated sessions beyond the limits are deleted each time an
+	// interactive session starts. MaxAge is like "90d", and MaxSize is like
+	// "500MB".
+	MaxSessions int    `yaml:"max_sessions,omitempty"`
+	MaxAge      string `yaml:"max_age,omitempty"`
+	MaxSize     string `yaml:"max_size,omitempty"`
+	// Sync is where `gpt sessions push` and `pull` share sessions with a
+	// team.
+	Sync SessionSync `yaml:"sync,omitempty"`
+}
+
+// SessionSync configures the remote bundle of sessions shared by a team.
+// The bundle is encrypted with the GPT_SYNC_PASSPHRASE env var.
+type SessionSync struct {
+	// URL is where the bundle is read with GET and written with PUT, such
+	// as a presigned S3 or GCS URL, or any HTTP server that stores files.
+	URL string `yaml:"url,omitempty"`
+	// Headers are sent with each request, such as an Authorization header
+	// with a token from an env var: "Bearer ${SYNC_TOKEN}".
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+// Dir returns the directory containing the config file and other user
+// settings, such as prompt templates.
+func Dir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "gpt-cli"), nil
+	}
+	if runtime.GOOS == "windows" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "gpt-cli"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "gpt-cli"), nil
+}
+
+// Path returns the path of the config file.
+func Path() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.yaml"), nil
+}
+
+// Load reads the config file, with its includes and env vars, as described
+// for ReadFile. A missing file is not an error and results in an empty
+// config.
+func Load() (*Config, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	err = ReadFile(path, cfg)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Set updates a single key in the config file, creating the file if needed.
+// Nested keys are separated by dots, like "sessions.max_age". Comments and
+// other keys in the file are preserved.
+func Set(key string, value any) error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	doc := &yaml.Node{}
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := yaml.Unmarshal(b, doc); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	if doc.Kind == 0 {
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+	valueNode := &yaml.Node{}
+	if err := valueNode.Encode(value); err != nil {
+		return err
+	}
+	node := doc.Content[0]
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		if node.Kind != yaml.MappingNode {
+			if i == 0 {
+				return fmt.Errorf("%s: expected a mapping at the top level", path)
+			}
+			return fmt.Errorf("%s: %s is not a mapping", path, strings.Join(parts[:i], "."))
+		}
+		last := i == len(parts)-1
+		var next *yaml.Node
+		for j := 0; j+1 < len(node.Content); j += 2 {
+			if node.Content[j].Value == part {
+				if last {
+					node.Content[j+1] = valueNode
+				}
+				next = node.Content[j+1]
+				break
+			}
+		}
+		if next == nil {
+			next = valueNode
+			if !last {
+				next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: part}, next)
+		}
+		node = next
+	}
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, 0644)
+}
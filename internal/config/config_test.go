@@ -0,0 +1,97 @@
+package config_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/internal/config"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for path, content := range files {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TEAM_MODEL", "gpt-4.1")
+	t.Setenv("TEAM_RPM", "60")
+	writeFiles(t, dir, map[string]string{
+		"team/base.yaml": "model: gpt-4o\nsessions:\n  encrypt: true\n  max_age: 30d\nrate_limits:\n  - model: '*'\n    rpm: 10\n",
+		"config.yaml":    "include: team/base.yaml\nmodel: ${TEAM_MODEL}\nsessions:\n  max_age: ${MAX_AGE:-90d}\nrate_limits:\n  - model: gpt-*\n    rpm: ${TEAM_RPM}\ntheme:\n  prompt: '$${USER}'\n",
+	})
+	cfg := &config.Config{}
+	if err := config.ReadFile(filepath.Join(dir, "config.yaml"), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Model != "gpt-4.1" {
+		t.Errorf("Model = %q, want gpt-4.1", cfg.Model)
+	}
+	if !cfg.Sessions.Encrypt || cfg.Sessions.MaxAge != "90d" {
+		t.Errorf("Sessions = %+v, want the included encrypt setting and the default max_age", cfg.Sessions)
+	}
+	if len(cfg.RateLimits) != 1 || cfg.RateLimits[0].Model != "gpt-*" || cfg.RateLimits[0].RPM != 60 {
+		t.Errorf("RateLimits = %+v, want the file's list in place of the included one", cfg.RateLimits)
+	}
+	if cfg.Theme == nil || cfg.Theme.Prompt != "${USER}" {
+		t.Errorf("Theme = %+v, want a literal ${USER} prompt", cfg.Theme)
+	}
+
+	if err := config.ReadFile(filepath.Join(dir, "missing.yaml"), cfg); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadFile(missing.yaml) error = %v, want fs.ErrNotExist", err)
+	}
+	for content, want := range map[string]string{
+		"include: nope.yaml\n":       "include: open",
+		"include: loop.yaml\n":       "include cycle",
+		"model: ${GPT_TEST_UNSET}\n": "${GPT_TEST_UNSET} is not set",
+	} {
+		writeFiles(t, dir, map[string]string{"loop.yaml": content})
+		err := config.ReadFile(filepath.Join(dir, "loop.yaml"), &config.Config{})
+		if err == nil || !strings.Contains(err.Error(), want) || errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("ReadFile(%q) error = %v, want %q", content, err, want)
+		}
+	}
+}
+
+func TestLocate(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("XDG_STATE_HOME", filepath.Join(home, "state"))
+	writeFiles(t, home, map[string]string{".config/gpt-cli/sessions/a.json": "{}"})
+
+	cfg := &config.Config{Paths: config.Paths{Cache: "~/tmp/cache"}}
+	for _, tc := range []struct{ kind, name, want string }{
+		{config.Data, "sessions", ".local/share/gpt-cli/sessions"},
+		{config.State, "stats.jsonl", "state/gpt-cli/stats.jsonl"},
+		{config.Cache, "responses", "tmp/cache/responses"},
+	} {
+		got, err := cfg.Locate(tc.kind, tc.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Join(home, tc.want); got != want {
+			t.Errorf("Locate(%s, %s) = %s, want %s", tc.kind, tc.name, got, want)
+		}
+	}
+	// Sessions saved by older versions are moved out of the config dir.
+	if _, err := os.Stat(filepath.Join(home, ".local/share/gpt-cli/sessions/a.json")); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".config/gpt-cli/sessions")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("old sessions dir still exists: %v", err)
+	}
+}
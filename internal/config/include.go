@@ -0,0 +1,208 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ReadFile reads a YAML settings file into v. Files named by its top-level
+// include key, a path or a list of paths relative to the file, are merged
+// in first, so that the file's own settings override theirs. Then ${VAR} in
+// values is replaced with the env var VAR, so that secrets can be kept out
+// of files. ${VAR:-default} gives a default for when VAR is unset or empty,
+// and $${VAR} is a literal ${VAR}. A reference to an unset var without a
+// default is an error.
+//
+// If the file doesn't exist, the error satisfies errors.Is(err,
+// fs.ErrNotExist). Missing includes are errors that don't.
+func ReadFile(path string, v any) error {
+	n, err := readIncludes(path, nil)
+	if err != nil {
+		return err
+	}
+	if n == nil {
+		return nil
+	}
+	if err := expandEnv(n); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := n.Decode(v); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// readIncludes parses a file, merged over the files it includes. stack is
+// the files including it, to catch cycles. It returns nil for an empty
+// file.
+func readIncludes(path string, stack []string) (*yaml.Node, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(b, doc); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	n := doc.Content[0]
+	includes, err := takeIncludes(n)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(includes) == 0 {
+		return n, nil
+	}
+	stack = append(stack, path)
+	var merged *yaml.Node
+	for _, inc := range includes {
+		inc, err := expand(inc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: include: %w", path, err)
+		}
+		if rest, ok := strings.CutPrefix(inc, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("%s: include: %w", path, err)
+			}
+			inc = filepath.Join(home, rest)
+		} else if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(path), inc)
+		}
+		if slices.Contains(stack, inc) {
+			return nil, fmt.Errorf("%s: include cycle through %s", path, inc)
+		}
+		in, err := readIncludes(inc, stack)
+		if err != nil {
+			// Wrapped with %v, so that a missing include isn't mistaken for
+			// a missing file.
+			return nil, fmt.Errorf("%s: include: %v", path, err)
+		}
+		merged = merge(merged, in)
+	}
+	return merge(merged, n), nil
+}
+
+// takeIncludes removes the include key from the top-level mapping n, and
+// returns its paths.
+func takeIncludes(n *yaml.Node) ([]string, error) {
+	if n.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value != "include" {
+			continue
+		}
+		v := n.Content[i+1]
+		n.Content = slices.Delete(n.Content, i, i+2)
+		switch v.Kind {
+		case yaml.ScalarNode:
+			return []string{v.Value}, nil
+		case yaml.SequenceNode:
+			var paths []string
+			for _, p := range v.Content {
+				if p.Kind != yaml.ScalarNode {
+					return nil, fmt.Errorf("line %d: include must be a path or a list of paths", p.Line)
+				}
+				paths = append(paths, p.Value)
+			}
+			return paths, nil
+		}
+		return nil, fmt.Errorf("line %d: include must be a path or a list of paths", v.Line)
+	}
+	return nil, nil
+}
+
+// merge returns the settings of src over those of dst. Mappings are merged
+// key by key, and anything else in src, including lists, replaces what's in
+// dst.
+func merge(dst, src *yaml.Node) *yaml.Node {
+	if dst == nil {
+		return src
+	}
+	if src == nil {
+		return dst
+	}
+	if dst.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode {
+		return src
+	}
+	out := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: slices.Clone(dst.Content)}
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		k, v := src.Content[i], src.Content[i+1]
+		j := 0
+		for j < len(out.Content) && out.Content[j].Value != k.Value {
+			j += 2
+		}
+		if j < len(out.Content) {
+			out.Content[j+1] = merge(out.Content[j+1], v)
+		} else {
+			out.Content = append(out.Content, k, v)
+		}
+	}
+	return out
+}
+
+// expandEnv expands env vars in the values of n, but not in mapping keys.
+func expandEnv(n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if !strings.Contains(n.Value, "${") {
+			return nil
+		}
+		v, err := expand(n.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		n.Value = v
+		if n.Style == 0 {
+			// Resolve the type of the expanded value, so that a var can set
+			// a number or a bool.
+			n.Tag = ""
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			if err := expandEnv(n.Content[i]); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode, yaml.DocumentNode:
+		for _, c := range n.Content {
+			if err := expandEnv(c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var envRef = regexp.MustCompile(`\$(\$?)\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// expand replaces the env var references in s.
+func expand(s string) (string, error) {
+	var err error
+	s = envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		m := envRef.FindStringSubmatch(ref)
+		if m[1] != "" {
+			return ref[1:]
+		}
+		if v := os.Getenv(m[2]); v != "" {
+			return v
+		}
+		if def, ok := strings.CutPrefix(m[3], ":-"); ok {
+			return def
+		}
+		if _, ok := os.LookupEnv(m[2]); !ok && err == nil {
+			err = fmt.Errorf("${%s} is not set", m[2])
+		}
+		return ""
+	})
+	return s, err
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Paths overrides where files other than settings are kept. Empty fields
+// use the XDG base directories. Paths may start with ~/ for the home
+// directory, and relative paths are relative to the config dir.
+type Paths struct {
+	// Data is for files that are valuable but not settings, such as saved
+	// sessions. It defaults to $XDG_DATA_HOME/gpt-cli, or
+	// ~/.local/share/gpt-cli.
+	Data string `yaml:"data,omitempty"`
+	// State is for history and logs, such as the stats of replies and the
+	// -auto audit logs. It defaults to $XDG_STATE_HOME/gpt-cli, or
+	// ~/.local/state/gpt-cli.
+	State string `yaml:"state,omitempty"`
+	// Cache is for files that can be recreated, such as cached replies. It
+	// defaults to $XDG_CACHE_HOME/gpt-cli, or ~/.cache/gpt-cli.
+	Cache string `yaml:"cache,omitempty"`
+}
+
+// Kinds of files, for Locate.
+const (
+	Data  = "data"
+	State = "state"
+	Cache = "cache"
+)
+
+// KindDir returns the directory for a kind of file: Data, State, or Cache.
+func (c *Config) KindDir(kind string) (string, error) {
+	override, env, fallback := c.Paths.Data, "XDG_DATA_HOME", filepath.Join(".local", "share")
+	switch kind {
+	case State:
+		override, env, fallback = c.Paths.State, "XDG_STATE_HOME", filepath.Join(".local", "state")
+	case Cache:
+		override, env, fallback = c.Paths.Cache, "XDG_CACHE_HOME", ".cache"
+	}
+	if override != "" {
+		if rest, ok := strings.CutPrefix(override, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", err
+			}
+			return filepath.Join(home, rest), nil
+		}
+		if filepath.IsAbs(override) {
+			return override, nil
+		}
+		dir, err := Dir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, override), nil
+	}
+	if dir := os.Getenv(env); dir != "" {
+		return filepath.Join(dir, "gpt-cli"), nil
+	}
+	if runtime.GOOS == "windows" {
+		if kind == Cache {
+			dir, err := os.UserCacheDir()
+			if err != nil {
+				return "", err
+			}
+			return filepath.Join(dir, "gpt-cli"), nil
+		}
+		// There's no separate place for data on Windows.
+		return Dir()
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, fallback, "gpt-cli"), nil
+}
+
+// Locate returns the path of the named file or directory of a kind. Older
+// versions kept data and state in the config dir, so if name is there and
+// not in its new place, it's moved, or left and used where it is if it
+// can't be.
+func (c *Config) Locate(kind, name string) (string, error) {
+	dir, err := c.KindDir(kind)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	if kind == Cache {
+		return path, nil
+	}
+	configDir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	old := filepath.Join(configDir, name)
+	if old == path {
+		return path, nil
+	}
+	if _, err := os.Stat(old); err != nil {
+		return path, nil
+	}
+	if _, err := os.Lstat(path); !errors.Is(err, fs.ErrNotExist) {
+		return path, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return old, nil
+	}
+	if err := os.Rename(old, path); err != nil {
+		return old, nil
+	}
+	return path, nil
+}
@@ -0,0 +1,137 @@
+// Package council answers prompts by asking several models, then having a
+// synthesizer model critique and merge their answers into a final reply.
+package council
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/models"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+// DefaultPrompt instructs the synthesizer when Client.Prompt is empty.
+const DefaultPrompt = `Several models answered the question above independently. Their answers follow it, each in an <answer> tag. Critique them: where they agree, where they conflict, and which claims are wrong or unsupported. Then write the best final answer to the question, drawing on the strongest parts of each. Reply with only the final answer, addressed to the user as if you had answered the question directly, without mentioning the other answers.`
+
+// Answer is a council member's answer to a prompt.
+type Answer struct {
+	Model    string
+	Content  string
+	Usage    *llm.Usage
+	Duration time.Duration
+	// Err is set if the member failed to answer.
+	Err error
+}
+
+// Client is an llm.CompletionClient that sends each request to the
+// council's members concurrently, then replies with the requested model's
+// synthesis of their answers. Requests to continue a truncated reply go
+// straight to the requested model.
+type Client struct {
+	Client llm.CompletionClient
+	// Models are the council's members.
+	Models []string
+	// Prompt instructs the synthesizer. Empty means DefaultPrompt.
+	Prompt string
+	// Notef reports each member's answer as it arrives. Nil means answers
+	// aren't reported.
+	Notef func(format string, args ...any)
+	// AnswerHooks are called in order with the members' answers to each
+	// request, before the synthesizer is asked.
+	AnswerHooks []func(answers []Answer)
+}
+
+func (c *Client) GetCompletion(ctx context.Context, req *llm.Request) (llm.Stream, error) {
+	n := len(req.Messages)
+	if n == 0 || req.Messages[n-1].Role != llm.RoleUser || req.Messages[n-1].Content == chat.ContinuePrompt {
+		return c.Client.GetCompletion(ctx, req)
+	}
+	answers := c.ask(ctx, req)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for _, hook := range c.AnswerHooks {
+		hook(answers)
+	}
+	var b strings.Builder
+	b.WriteString(req.Messages[n-1].Content)
+	b.WriteString("\n\n")
+	if c.Prompt != "" {
+		b.WriteString(c.Prompt)
+	} else {
+		b.WriteString(DefaultPrompt)
+	}
+	ok := 0
+	for _, a := range answers {
+		if a.Err != nil {
+			continue
+		}
+		ok++
+		fmt.Fprintf(&b, "\n\n<answer model=%q>\n%s\n</answer>", a.Model, strings.TrimSpace(a.Content))
+	}
+	if ok == 0 {
+		return nil, fmt.Errorf("council: all members failed: %w", answers[0].Err)
+	}
+	synth := *req
+	synth.Messages = append(req.Messages[:n-1:n-1], llm.Message{Role: llm.RoleUser, Content: b.String()})
+	return c.Client.GetCompletion(ctx, &synth)
+}
+
+// ask returns each member's answer to req, in the order of Models.
+func (c *Client) ask(ctx context.Context, req *llm.Request) []Answer {
+	answers := make([]Answer, len(c.Models))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for i, model := range c.Models {
+		wg.Add(1)
+		go func(i int, model string) {
+			defer wg.Done()
+			r := *req
+			r.Model = model
+			// Drop options the member doesn't support.
+			if models.CheckEffort(model, r.ReasoningEffort) != nil {
+				r.ReasoningEffort = ""
+			}
+			if r.WebSearch && models.CheckWebSearch(model) != nil {
+				r.WebSearch = false
+			}
+			a := c.complete(ctx, &r)
+			answers[i] = a
+			mu.Lock()
+			defer mu.Unlock()
+			if a.Err != nil {
+				c.note("%s failed: %s", model, a.Err)
+			} else {
+				c.note("%s answered in %s.", model, a.Duration.Round(100*time.Millisecond))
+			}
+		}(i, model)
+	}
+	wg.Wait()
+	return answers
+}
+
+func (c *Client) complete(ctx context.Context, req *llm.Request) Answer {
+	a := Answer{Model: req.Model}
+	start := time.Now()
+	s, err := c.Client.GetCompletion(ctx, req)
+	if err != nil {
+		a.Err = err
+		return a
+	}
+	defer s.Close()
+	r := llm.NewReader(s)
+	b, err := io.ReadAll(r)
+	a.Content, a.Usage, a.Duration, a.Err = string(b), r.Usage, time.Since(start), err
+	return a
+}
+
+func (c *Client) note(format string, args ...any) {
+	if c.Notef != nil {
+		c.Notef(format, args...)
+	}
+}
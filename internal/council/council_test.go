@@ -0,0 +1,86 @@
+package council_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/internal/council"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/llm/llmtest"
+)
+
+func complete(t *testing.T, c llm.CompletionClient, req *llm.Request) string {
+	t.Helper()
+	s, err := c.GetCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	b, err := io.ReadAll(llm.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestClient(t *testing.T) {
+	// Members answer concurrently, so either may get either response.
+	lc := llmtest.NewClient(llmtest.Text("Paris."), llmtest.Error(errors.New("overloaded")), llmtest.Text("It's Paris."))
+	var got []council.Answer
+	c := &council.Client{
+		Client:      lc,
+		Models:      []string{"gpt-a", "gpt-b"},
+		AnswerHooks: []func([]council.Answer){func(a []council.Answer) { got = a }},
+	}
+	req := &llm.Request{Model: "gpt-judge", Messages: []llm.Message{
+		{Role: llm.RoleSystem, Content: "Be brief."},
+		{Role: llm.RoleUser, Content: "Capital of France?"},
+	}}
+	if reply := complete(t, c, req); reply != "It's Paris." {
+		t.Errorf("reply = %q, want the synthesis", reply)
+	}
+
+	if len(got) != 2 || got[0].Model != "gpt-a" || got[1].Model != "gpt-b" {
+		t.Fatalf("answers = %+v, want one per member in order", got)
+	}
+	var ok council.Answer
+	for _, a := range got {
+		if a.Err == nil {
+			ok = a
+		}
+	}
+	if ok.Content != "Paris." || (got[0].Err == nil) == (got[1].Err == nil) {
+		t.Errorf("answers = %+v, want one answer and one error", got)
+	}
+
+	reqs := lc.Requests()
+	synth := reqs[len(reqs)-1]
+	if synth.Model != "gpt-judge" || len(synth.Messages) != 2 || synth.Messages[0].Content != "Be brief." {
+		t.Fatalf("unexpected synthesizer request %+v", synth)
+	}
+	prompt := synth.Messages[1].Content
+	want := `<answer model="` + ok.Model + `">` + "\nParis.\n</answer>"
+	if !strings.HasPrefix(prompt, "Capital of France?\n\n"+council.DefaultPrompt) || !strings.HasSuffix(prompt, want) {
+		t.Errorf("synthesizer prompt = %q, want the question, instructions, and %q", prompt, want)
+	}
+}
+
+func TestClientContinue(t *testing.T) {
+	lc := llmtest.NewClient(llmtest.Text("more"))
+	c := &council.Client{Client: lc, Models: []string{"gpt-a", "gpt-b"}}
+	req := &llm.Request{Model: "gpt-judge", Messages: []llm.Message{
+		{Role: llm.RoleUser, Content: "Tell me a story."},
+		{Role: llm.RoleAssistant, Content: "Once"},
+		{Role: llm.RoleUser, Content: chat.ContinuePrompt},
+	}}
+	if reply := complete(t, c, req); reply != "more" {
+		t.Errorf("reply = %q, want %q", reply, "more")
+	}
+	if reqs := lc.Requests(); len(reqs) != 1 || reqs[0].Model != "gpt-judge" {
+		t.Errorf("requests = %+v, want one to the synthesizer", reqs)
+	}
+}
@@ -0,0 +1,317 @@
+// Package eval runs suites of prompts against models and checks each reply
+// against assertions, for regression testing prompts.
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+	"unicode"
+
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"gopkg.in/yaml.v3"
+)
+
+// Suite is a set of cases, loaded from YAML like:
+//
+//	models: [gpt-4.1-mini, gpt-4o]
+//	system: You are a terse assistant.
+//	cases:
+//	  - name: capital
+//	    prompt: What is the capital of France?
+//	    assert:
+//	      - contains: Paris
+//	      - regex: '^\w+\.?$'
+//	  - name: json
+//	    prompt: Describe Paris as JSON with name and population.
+//	    assert:
+//	      - json_schema:
+//	          type: object
+//	          required: [name, population]
+//	      - judge: The population is roughly correct.
+type Suite struct {
+	// Models are the models to run each case against.
+	Models []string `yaml:"models"`
+	// System is the default system prompt for cases.
+	System string `yaml:"system"`
+	// Judge is the model that checks judge assertions.
+	Judge string  `yaml:"judge"`
+	Cases []*Case `yaml:"cases"`
+}
+
+// Case is a prompt and the assertions its reply must pass.
+type Case struct {
+	Name   string       `yaml:"name"`
+	Prompt string       `yaml:"prompt"`
+	System string       `yaml:"system"`
+	Assert []*Assertion `yaml:"assert"`
+}
+
+// Assertion checks a reply. Exactly one field is set.
+type Assertion struct {
+	// Contains and NotContains check for a substring, ignoring case.
+	Contains    string `yaml:"contains"`
+	NotContains string `yaml:"not_contains"`
+	// Regex must match somewhere in the reply.
+	Regex string `yaml:"regex"`
+	// JSONSchema requires the reply to be JSON matching the schema. The
+	// type, properties, required, items, and enum keywords are supported.
+	// A reply in a ```json code block is accepted.
+	JSONSchema map[string]any `yaml:"json_schema"`
+	// Judge describes what a good reply does, for the judge model to check.
+	Judge string `yaml:"judge"`
+
+	regex *regexp.Regexp
+}
+
+// LoadSuite reads a suite from a YAML file.
+func LoadSuite(path string) (*Suite, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &Suite{}
+	if err := yaml.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for i, c := range s.Cases {
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("case %d", i+1)
+		}
+		if c.Prompt == "" {
+			return nil, fmt.Errorf("%s: %s: missing prompt", path, c.Name)
+		}
+		for _, a := range c.Assert {
+			if err := a.compile(); err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", path, c.Name, err)
+			}
+		}
+	}
+	return s, nil
+}
+
+func (a *Assertion) compile() error {
+	set := 0
+	for _, ok := range []bool{a.Contains != "", a.NotContains != "", a.Regex != "", a.JSONSchema != nil, a.Judge != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("each assertion needs exactly one of contains, not_contains, regex, json_schema, or judge")
+	}
+	if a.Regex != "" {
+		re, err := regexp.Compile(a.Regex)
+		if err != nil {
+			return err
+		}
+		a.regex = re
+	}
+	return nil
+}
+
+// Result is the outcome of one case against one model.
+type Result struct {
+	Case      string `json:"case"`
+	Model     string `json:"model"`
+	Reply     string `json:"reply"`
+	LatencyMS int64  `json:"latency_ms"`
+	// Failures describe the assertions that failed.
+	Failures []string `json:"failures,omitempty"`
+	// Err is set if the reply couldn't be generated.
+	Err string `json:"error,omitempty"`
+}
+
+func (r *Result) Passed() bool {
+	return r.Err == "" && len(r.Failures) == 0
+}
+
+// Runner runs suites.
+type Runner struct {
+	Client llm.CompletionClient
+	// Parallel is the max number of requests at once. 0 means 1.
+	Parallel int
+}
+
+// Run runs each case of the suite against each model, returning results
+// ordered by case, then model.
+func (r *Runner) Run(ctx context.Context, s *Suite) []*Result {
+	results := make([]*Result, len(s.Cases)*len(s.Models))
+	sem := make(chan struct{}, max(r.Parallel, 1))
+	var wg sync.WaitGroup
+	for i, c := range s.Cases {
+		for j, model := range s.Models {
+			i, j, c, model := i, j, c, model
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				results[i*len(s.Models)+j] = r.runCase(ctx, s, c, model)
+			}()
+		}
+	}
+	wg.Wait()
+	return results
+}
+
+func (r *Runner) runCase(ctx context.Context, s *Suite, c *Case, model string) *Result {
+	res := &Result{Case: c.Name, Model: model}
+	system := c.System
+	if system == "" {
+		system = s.System
+	}
+	var messages []llm.Message
+	if system != "" {
+		messages = append(messages, llm.Message{Role: llm.RoleSystem, Content: system})
+	}
+	messages = append(messages, llm.Message{Role: llm.RoleUser, Content: c.Prompt})
+	start := time.Now()
+	reply, err := r.complete(ctx, model, messages)
+	res.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		res.Err = err.Error()
+		return res
+	}
+	res.Reply = reply
+	for _, a := range c.Assert {
+		if msg := r.check(ctx, s, c, a, reply); msg != "" {
+			res.Failures = append(res.Failures, msg)
+		}
+	}
+	return res
+}
+
+// check returns why a reply fails an assertion, or "" if it passes.
+func (r *Runner) check(ctx context.Context, s *Suite, c *Case, a *Assertion, reply string) string {
+	switch {
+	case a.Contains != "":
+		if !strings.Contains(strings.ToLower(reply), strings.ToLower(a.Contains)) {
+			return fmt.Sprintf("does not contain %q", a.Contains)
+		}
+	case a.NotContains != "":
+		if strings.Contains(strings.ToLower(reply), strings.ToLower(a.NotContains)) {
+			return fmt.Sprintf("contains %q", a.NotContains)
+		}
+	case a.regex != nil:
+		if !a.regex.MatchString(reply) {
+			return fmt.Sprintf("does not match /%s/", a.Regex)
+		}
+	case a.JSONSchema != nil:
+		var v any
+		if err := json.Unmarshal([]byte(stripCodeFence(reply)), &v); err != nil {
+			return fmt.Sprintf("not JSON: %s", err)
+		}
+		if err := validate(a.JSONSchema, v, "$"); err != nil {
+			return fmt.Sprintf("doesn't match schema: %s", err)
+		}
+	case a.Judge != "":
+		if s.Judge == "" {
+			return "judge assertion, but the suite has no judge model"
+		}
+		return r.judge(ctx, s.Judge, c.Prompt, a.Judge, reply)
+	}
+	return ""
+}
+
+const judgePrompt = `You grade replies to prompts against a criterion. The first word of your answer is PASS or FAIL, followed by a one-sentence reason.
+
+Prompt:
+%s
+
+Criterion:
+%s
+
+Reply:
+%s`
+
+func (r *Runner) judge(ctx context.Context, model, prompt, criterion, reply string) string {
+	verdict, err := r.complete(ctx, model, []llm.Message{{Role: llm.RoleUser, Content: fmt.Sprintf(judgePrompt, prompt, criterion, reply)}})
+	if err != nil {
+		return fmt.Sprintf("judge failed: %s", err)
+	}
+	verdict = strings.TrimSpace(verdict)
+	word, reason := verdict, ""
+	if i := strings.IndexFunc(verdict, unicode.IsSpace); i >= 0 {
+		word, reason = verdict[:i], verdict[i:]
+	}
+	switch strings.ToUpper(strings.Trim(word, ":.*")) {
+	case "PASS":
+		return ""
+	case "FAIL":
+		return fmt.Sprintf("judge: %s: %s", criterion, strings.TrimSpace(reason))
+	}
+	return fmt.Sprintf("judge gave no verdict: %q", verdict)
+}
+
+func (r *Runner) complete(ctx context.Context, model string, messages []llm.Message) (string, error) {
+	s, err := r.Client.GetCompletion(ctx, &llm.Request{Model: model, Messages: messages})
+	if err != nil {
+		return "", err
+	}
+	defer s.Close()
+	b, err := io.ReadAll(llm.NewReader(s))
+	return string(b), err
+}
+
+// stripCodeFence returns the contents of a reply that is a single fenced
+// code block, or the reply itself.
+func stripCodeFence(reply string) string {
+	reply = strings.TrimSpace(reply)
+	if !strings.HasPrefix(reply, "```") || !strings.HasSuffix(reply, "```") {
+		return reply
+	}
+	body := strings.TrimSuffix(reply, "```")
+	if _, rest, ok := strings.Cut(body, "\n"); ok {
+		return rest
+	}
+	return reply
+}
+
+// Report writes each result, then a pass rate per model. It returns the
+// number of failed results.
+func Report(w io.Writer, results []*Result) int {
+	failed := 0
+	type total struct{ passed, n int }
+	totals := map[string]*total{}
+	var models []string
+	for _, r := range results {
+		t := totals[r.Model]
+		if t == nil {
+			t = &total{}
+			totals[r.Model] = t
+			models = append(models, r.Model)
+		}
+		t.n++
+		status := "PASS"
+		if r.Passed() {
+			t.passed++
+		} else {
+			failed++
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "%s  %s  %s (%s)\n", status, r.Case, r.Model, time.Duration(r.LatencyMS)*time.Millisecond)
+		if r.Err != "" {
+			fmt.Fprintf(w, "      error: %s\n", r.Err)
+		}
+		for _, f := range r.Failures {
+			fmt.Fprintf(w, "      %s\n", f)
+		}
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MODEL\tPASSED")
+	for _, m := range models {
+		t := totals[m]
+		fmt.Fprintf(tw, "%s\t%d/%d\n", m, t.passed, t.n)
+	}
+	tw.Flush()
+	return failed
+}
@@ -0,0 +1,116 @@
+package eval_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/internal/eval"
+	"github.com/bduffany/gpt-cli/pkg/llm/llmtest"
+)
+
+const suite = `
+system: Be terse.
+judge: gpt-judge
+cases:
+  - name: capital
+    prompt: What is the capital of France?
+    assert:
+      - contains: paris
+      - not_contains: London
+      - regex: '^\w+\.$'
+  - name: json
+    prompt: Describe Paris as JSON.
+    assert:
+      - json_schema:
+          type: object
+          required: [name, population]
+          properties:
+            name: {type: string}
+            population: {type: integer}
+            tags: {type: array, items: {enum: [capital, city]}}
+      - judge: The population is roughly correct.
+`
+
+func load(t *testing.T, yaml string) *eval.Suite {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "evals.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := eval.LoadSuite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestRun(t *testing.T) {
+	s := load(t, suite)
+	s.Models = []string{"gpt-test"}
+	client := llmtest.NewClient(
+		llmtest.Text("Paris."),
+		llmtest.Text("```json\n{\"name\": \"Paris\", \"population\": 2100000, \"tags\": [\"capital\"]}\n```"),
+		llmtest.Text("PASS\nIt's about 2.1 million."),
+	)
+	results := (&eval.Runner{Client: client}).Run(context.Background(), s)
+	for _, r := range results {
+		if !r.Passed() {
+			t.Errorf("%s failed: %s %q", r.Case, r.Err, r.Failures)
+		}
+	}
+	if got := client.Requests()[0].Messages[0].Content; got != "Be terse." {
+		t.Errorf("system prompt = %q", got)
+	}
+	var out bytes.Buffer
+	if failed := eval.Report(&out, results); failed != 0 || !strings.Contains(out.String(), "gpt-test  2/2") {
+		t.Errorf("report:\n%s", out.String())
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	s := load(t, suite)
+	s.Models = []string{"gpt-test"}
+	client := llmtest.NewClient(
+		llmtest.Text("I think it's London, not Paris"),
+		llmtest.Text(`{"name": "Paris", "population": 2.5, "tags": ["town"]}`),
+		llmtest.Text("FAIL: The population is far too small."),
+	)
+	results := (&eval.Runner{Client: client}).Run(context.Background(), s)
+	want := [][]string{
+		{`contains "London"`, `does not match`},
+		{`$.population: want integer, got number`, `judge: The population is roughly correct.: The population is far too small.`},
+	}
+	for i, r := range results {
+		got := strings.Join(r.Failures, "\n")
+		if len(r.Failures) != len(want[i]) {
+			t.Errorf("%s failures = %q, want %q", r.Case, r.Failures, want[i])
+			continue
+		}
+		for _, w := range want[i] {
+			if !strings.Contains(got, w) {
+				t.Errorf("%s failures = %q, want one containing %q", r.Case, r.Failures, w)
+			}
+		}
+	}
+	if failed := eval.Report(&bytes.Buffer{}, results); failed != 2 {
+		t.Errorf("Report returned %d failures, want 2", failed)
+	}
+}
+
+func TestLoadSuiteErrors(t *testing.T) {
+	for _, yaml := range []string{
+		"cases: [{name: a}]",
+		"cases: [{prompt: hi, assert: [{contains: a, regex: b}]}]",
+		"cases: [{prompt: hi, assert: [{regex: '('}]}]",
+	} {
+		path := filepath.Join(t.TempDir(), "evals.yaml")
+		os.WriteFile(path, []byte(yaml), 0600)
+		if _, err := eval.LoadSuite(path); err == nil {
+			t.Errorf("LoadSuite(%s) succeeded", yaml)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package eval
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// validate checks a decoded JSON value against a subset of JSON Schema:
+// the type, properties, required, items, and enum keywords.
+func validate(schema map[string]any, v any, path string) error {
+	if t, ok := schema["type"].(string); ok && !hasType(v, t) {
+		return fmt.Errorf("%s: want %s, got %s", path, t, typeOf(v))
+	}
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if equal(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", path, v, enum)
+		}
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		if required, ok := schema["required"].([]any); ok {
+			for _, key := range required {
+				if _, ok := v[fmt.Sprint(key)]; !ok {
+					return fmt.Errorf("%s: missing %s", path, key)
+				}
+			}
+		}
+		if props, ok := schema["properties"].(map[string]any); ok {
+			keys := make([]string, 0, len(props))
+			for key := range props {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				sub, ok := props[key].(map[string]any)
+				val, present := v[key]
+				if !ok || !present {
+					continue
+				}
+				if err := validate(sub, val, path+"."+key); err != nil {
+					return err
+				}
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, val := range v {
+				if err := validate(items, val, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func hasType(v any, t string) bool {
+	switch t {
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == float64(int64(f))
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	}
+	return typeOf(v) == t
+}
+
+func typeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// equal compares an enum value from YAML with a value decoded from JSON,
+// where numbers may be ints or floats.
+func equal(a, b any) bool {
+	switch x := a.(type) {
+	case int:
+		a = float64(x)
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,97 @@
+// Package fallback retries failed requests on other models, so that a rate
+// limited, overloaded, or refusing model doesn't end a conversation.
+package fallback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+// Client is an llm.CompletionClient that sends each request to its model,
+// and if that fails, to each of Models in turn until one succeeds.
+// Requests fail over until the reply starts: errors sending the request or
+// waiting for the first token, and replies stopped by the content filter
+// before they've started. Once a reply has started streaming, it's too late
+// to fail over.
+type Client struct {
+	Client llm.CompletionClient
+	Models []string
+	// Notef reports each switch to another model. Nil means they aren't
+	// reported.
+	Notef func(format string, args ...any)
+}
+
+// Middleware returns an llm.Middleware that fails over to models.
+func Middleware(models []string, notef func(format string, args ...any)) llm.Middleware {
+	return func(next llm.CompletionClient) llm.CompletionClient {
+		return &Client{Client: next, Models: models, Notef: notef}
+	}
+}
+
+// errContentFilter is the error for replies stopped by the content filter
+// before they started.
+var errContentFilter = errors.New("reply stopped by the content filter")
+
+func (c *Client) GetCompletion(ctx context.Context, req *llm.Request) (llm.Stream, error) {
+	models := []string{req.Model}
+	for _, m := range c.Models {
+		if m != req.Model {
+			models = append(models, m)
+		}
+	}
+	var err error
+	for i, m := range models {
+		if i > 0 && c.Notef != nil {
+			c.Notef("%s failed (%s); trying %s.", models[i-1], err, m)
+		}
+		r := *req
+		r.Model = m
+		var s llm.Stream
+		if s, err = c.start(ctx, &r); err == nil {
+			return s, nil
+		}
+		var be *llm.BlockedError
+		if ctx.Err() != nil || errors.As(err, &be) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// start sends a request and waits for the first event of its reply.
+func (c *Client) start(ctx context.Context, req *llm.Request) (llm.Stream, error) {
+	s, err := c.Client.GetCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	e, err := s.Next()
+	if err == io.EOF {
+		err = fmt.Errorf("empty reply")
+	}
+	if done, ok := e.(llm.Done); ok && done.FinishReason == llm.FinishReasonContentFilter {
+		err = errContentFilter
+	}
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return &peeked{Stream: s, first: e}, nil
+}
+
+// peeked is a stream whose first event was already read.
+type peeked struct {
+	llm.Stream
+	first llm.Event
+}
+
+func (s *peeked) Next() (llm.Event, error) {
+	if e := s.first; e != nil {
+		s.first = nil
+		return e, nil
+	}
+	return s.Stream.Next()
+}
@@ -0,0 +1,65 @@
+package fallback_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/internal/fallback"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/llm/llmtest"
+)
+
+func TestClient(t *testing.T) {
+	backend := llmtest.NewClient(
+		llmtest.Error(&llm.TimeoutError{Waiting: "the first token"}),
+		&llmtest.Response{Events: []llm.Event{llm.Done{FinishReason: llm.FinishReasonContentFilter}}},
+		llmtest.Text("Hello from the third model."),
+	)
+	var notes []string
+	c := &fallback.Client{Client: backend, Models: []string{"gpt-b", "gpt-a", "gpt-c"}, Notef: func(format string, args ...any) {
+		notes = append(notes, format)
+	}}
+	s, err := c.GetCompletion(context.Background(), &llm.Request{Model: "gpt-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(llm.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "Hello from the third model." {
+		t.Errorf("reply = %q", b)
+	}
+	var models []string
+	for _, r := range backend.Requests() {
+		models = append(models, r.Model)
+	}
+	if want := []string{"gpt-a", "gpt-b", "gpt-c"}; !reflect.DeepEqual(models, want) {
+		t.Errorf("tried %q, want %q", models, want)
+	}
+	if len(notes) != 2 {
+		t.Errorf("notes = %q, want 2", notes)
+	}
+}
+
+func TestClientGivesUp(t *testing.T) {
+	errLast := errors.New("overloaded")
+	backend := llmtest.NewClient(llmtest.Error(errors.New("rate limited")), llmtest.Error(errLast))
+	c := &fallback.Client{Client: backend, Models: []string{"gpt-b"}}
+	if _, err := c.GetCompletion(context.Background(), &llm.Request{Model: "gpt-a"}); !errors.Is(err, errLast) {
+		t.Errorf("GetCompletion() error = %v, want %v", err, errLast)
+	}
+
+	// Blocked requests aren't sent to other models.
+	backend = llmtest.NewClient(llmtest.Error(&llm.BlockedError{Reason: "policy"}), llmtest.Text("ok"))
+	c = &fallback.Client{Client: backend, Models: []string{"gpt-b"}}
+	if _, err := c.GetCompletion(context.Background(), &llm.Request{Model: "gpt-a"}); err == nil {
+		t.Error("GetCompletion() succeeded, want the request blocked")
+	}
+	if n := len(backend.Requests()); n != 1 {
+		t.Errorf("sent %d requests, want 1", n)
+	}
+}
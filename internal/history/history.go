@@ -0,0 +1,183 @@
+// Package history finds the prompts that recur in saved sessions, and
+// suggests templates for them.
+package history
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/session"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+// Prompt is a prompt sent one or more times, compared ignoring case and
+// whitespace.
+type Prompt struct {
+	// Text is the prompt as it was last sent.
+	Text string
+	// Count is the number of times it was sent, in Sessions sessions.
+	Count    int
+	Sessions int
+	// Last is when the last session it was sent in was updated.
+	Last time.Time
+}
+
+// Suggestion is a template that would replace prompts that start the same
+// way but go on differently, like "Translate to French: ...".
+type Suggestion struct {
+	// Name is a name for the template, made from the stem.
+	Name string
+	// Stem is the start that the prompts share, without trailing
+	// whitespace.
+	Stem string
+	// Count is the number of prompts that start with the stem.
+	Count int
+	// Example is the rest of the last of these prompts.
+	Example string
+}
+
+// Body returns the text of the suggested template, where the rest of the
+// prompt is {{.input}}, as with `gpt run`.
+func (s *Suggestion) Body() string {
+	return s.Stem + "\n\n{{.input}}\n"
+}
+
+// minStem is the length of the shortest stem that's suggested, so that a
+// word or two before a colon isn't taken for a template.
+const minStem = 12
+
+// Top returns the n prompts sent most often, most often first, breaking
+// ties by the latest. n <= 0 returns all of them.
+func Top(sessions []*session.Session, n int) []*Prompt {
+	byKey := map[string]*Prompt{}
+	seen := map[string]string{}
+	for _, s := range sessions {
+		for _, m := range s.Messages {
+			if m.Role != llm.RoleUser || strings.TrimSpace(m.Content) == "" {
+				continue
+			}
+			key := normalize(m.Content)
+			p := byKey[key]
+			if p == nil {
+				p = &Prompt{}
+				byKey[key] = p
+			}
+			p.Count++
+			if seen[key] != s.ID {
+				seen[key] = s.ID
+				p.Sessions++
+			}
+			if !s.Updated.Before(p.Last) {
+				p.Text, p.Last = m.Content, s.Updated
+			}
+		}
+	}
+	out := make([]*Prompt, 0, len(byKey))
+	for _, p := range byKey {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Last.After(out[j].Last)
+	})
+	if n > 0 && len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// Suggest returns templates for the stems that at least minCount prompts
+// start with, followed by at least two different texts, most used first.
+func Suggest(sessions []*session.Session, minCount int) []*Suggestion {
+	type group struct {
+		*Suggestion
+		last  time.Time
+		rests map[string]bool
+	}
+	groups := map[string]*group{}
+	for _, s := range sessions {
+		for _, m := range s.Messages {
+			if m.Role != llm.RoleUser {
+				continue
+			}
+			stem, rest, ok := splitStem(m.Content)
+			if !ok {
+				continue
+			}
+			key := normalize(stem)
+			g := groups[key]
+			if g == nil {
+				g = &group{Suggestion: &Suggestion{}, rests: map[string]bool{}}
+				groups[key] = g
+			}
+			g.Count++
+			g.rests[normalize(rest)] = true
+			if !s.Updated.Before(g.last) {
+				g.Stem, g.Example, g.last = stem, rest, s.Updated
+			}
+		}
+	}
+	var out []*Suggestion
+	names := map[string]int{}
+	for _, g := range groups {
+		if g.Count >= minCount && len(g.rests) >= 2 {
+			out = append(out, g.Suggestion)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Stem < out[j].Stem
+	})
+	for _, s := range out {
+		s.Name = slug(s.Stem)
+		if names[s.Name]++; names[s.Name] > 1 {
+			s.Name = fmt.Sprintf("%s-%d", s.Name, names[s.Name])
+		}
+	}
+	return out
+}
+
+// splitStem splits a prompt into the instruction it starts with and the
+// text it applies to: either the first line up to a colon and a space, or
+// a first line followed by more lines.
+func splitStem(prompt string) (stem, rest string, ok bool) {
+	prompt = strings.TrimSpace(prompt)
+	first, rest, multiline := strings.Cut(prompt, "\n")
+	if i := strings.Index(first, ": "); i >= 0 && strings.TrimSpace(first[i+1:]) != "" {
+		stem, rest = first[:i+1], strings.TrimSpace(prompt[i+1:])
+	} else if multiline {
+		stem, rest = strings.TrimSpace(first), strings.TrimSpace(rest)
+	} else {
+		return "", "", false
+	}
+	if len(stem) < minStem || rest == "" {
+		return "", "", false
+	}
+	return stem, rest, true
+}
+
+// normalize returns the key that prompts are compared by.
+func normalize(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+var nonWord = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slug returns a template name made from the first few words of a stem.
+func slug(stem string) string {
+	words := strings.Fields(strings.Trim(nonWord.ReplaceAllString(strings.ToLower(stem), " "), " "))
+	if len(words) > 4 {
+		words = words[:4]
+	}
+	if len(words) == 0 {
+		return "template"
+	}
+	return strings.Join(words, "-")
+}
@@ -0,0 +1,55 @@
+package history_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/history"
+	"github.com/bduffany/gpt-cli/internal/session"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+func newSession(id string, updated time.Time, prompts ...string) *session.Session {
+	s := &session.Session{ID: id, Updated: updated}
+	for _, p := range prompts {
+		s.Messages = append(s.Messages, llm.Message{Role: llm.RoleUser, Content: p}, llm.Message{Role: llm.RoleAssistant, Content: "OK"})
+	}
+	return s
+}
+
+func TestTop(t *testing.T) {
+	now := time.Now()
+	sessions := []*session.Session{
+		newSession("a", now.Add(-time.Hour), "fix the tests", "Fix the  tests", "hello"),
+		newSession("b", now, "Fix the tests", "what time is it"),
+	}
+	top := history.Top(sessions, 2)
+	if len(top) != 2 {
+		t.Fatalf("Top = %+v, want 2 prompts", top)
+	}
+	if p := top[0]; p.Text != "Fix the tests" || p.Count != 3 || p.Sessions != 2 || !p.Last.Equal(now) {
+		t.Errorf("Top[0] = %+v, want Fix the tests sent 3 times in 2 sessions", p)
+	}
+	if p := top[1]; p.Text != "what time is it" || p.Count != 1 {
+		t.Errorf("Top[1] = %+v, want the latest of the prompts sent once", p)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	now := time.Now()
+	sessions := []*session.Session{
+		newSession("a", now.Add(-time.Hour), "Translate to French: hello", "Review this Go code\nfunc f() {}", "see http://example.com"),
+		newSession("b", now, "translate to french: goodbye", "Translate to French: goodbye", "Review this Go code\nfunc g() {}"),
+		newSession("c", now, "Summarize in one line: same", "Summarize in one line: same"),
+	}
+	got := history.Suggest(sessions, 2)
+	if len(got) != 2 {
+		t.Fatalf("Suggest = %+v, want 2 suggestions", got)
+	}
+	if s := got[0]; s.Name != "translate-to-french" || s.Stem != "Translate to French:" || s.Count != 3 || s.Example != "goodbye" {
+		t.Errorf("Suggest[0] = %+v", s)
+	}
+	if s := got[1]; s.Name != "review-this-go-code" || s.Count != 2 || s.Body() != "Review this Go code\n\n{{.input}}\n" {
+		t.Errorf("Suggest[1] = %+v, body %q", s, s.Body())
+	}
+}
@@ -0,0 +1,179 @@
+// Package htmltext converts HTML pages to readable plain text, for feeding
+// web content to a model without the markup.
+package htmltext
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// skipped elements never contain readable content.
+var skipped = map[string]bool{
+	"head": true, "script": true, "style": true, "noscript": true,
+	"svg": true, "template": true, "iframe": true, "canvas": true,
+}
+
+// paragraphs are elements separated from surrounding text by a blank line.
+var paragraphs = map[string]bool{
+	"blockquote": true, "h1": true, "h2": true, "h3": true, "h4": true,
+	"h5": true, "h6": true, "ol": true, "p": true, "pre": true, "table": true,
+	"ul": true,
+}
+
+// blocks are elements that start on a new line.
+var blocks = map[string]bool{
+	"address": true, "article": true, "aside": true, "dd": true, "div": true,
+	"dl": true, "dt": true, "fieldset": true, "figcaption": true,
+	"figure": true, "footer": true, "form": true, "header": true, "hr": true,
+	"li": true, "main": true, "nav": true, "section": true, "tr": true,
+}
+
+// Convert returns the readable text of an HTML document: the title, then
+// the body text with one line per block and whitespace collapsed. Links are
+// followed by their absolute URL in angle brackets.
+func Convert(r io.Reader) (string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", err
+	}
+	w := &writer{}
+	if title := find(doc, "title"); title != nil {
+		w.text(textContent(title))
+		w.blankLine()
+	}
+	w.walk(doc)
+	return strings.TrimSpace(w.b.String()) + "\n", nil
+}
+
+type writer struct {
+	b strings.Builder
+	// space is whether a space is pending before the next text.
+	space bool
+	// pre is the depth of enclosing <pre> elements.
+	pre int
+}
+
+func (w *writer) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		if w.pre > 0 {
+			w.b.WriteString(n.Data)
+		} else {
+			w.text(n.Data)
+		}
+		return
+	case html.ElementNode:
+		if skipped[n.Data] {
+			return
+		}
+		switch n.Data {
+		case "br":
+			w.newline()
+			return
+		case "pre":
+			w.pre++
+			defer func() { w.pre-- }()
+		case "td", "th":
+			w.space = true
+		}
+		if paragraphs[n.Data] {
+			w.blankLine()
+			defer w.blankLine()
+		} else if blocks[n.Data] {
+			w.newline()
+			defer w.newline()
+		}
+		if n.Data == "li" {
+			w.b.WriteString("- ")
+		}
+		if len(n.Data) == 2 && n.Data[0] == 'h' && n.Data[1] >= '1' && n.Data[1] <= '6' {
+			w.b.WriteString(strings.Repeat("#", int(n.Data[1]-'0')) + " ")
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.walk(c)
+	}
+	if n.Type == html.ElementNode && n.Data == "a" {
+		if href := attr(n, "href"); strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "https://") {
+			w.space = true
+			w.text("<" + href + ">")
+		}
+	}
+}
+
+// text writes s with whitespace collapsed.
+func (w *writer) text(s string) {
+	if len(s) > 0 && isSpace(s[0]) {
+		w.space = true
+	}
+	fields := strings.Fields(s)
+	for i, f := range fields {
+		if i > 0 || (w.space && !w.atLineStart() && !strings.HasSuffix(w.b.String(), " ")) {
+			w.b.WriteByte(' ')
+		}
+		w.b.WriteString(f)
+		w.space = false
+	}
+	if len(s) > 0 && isSpace(s[len(s)-1]) {
+		w.space = true
+	}
+}
+
+// newline ends the current line, if it isn't empty.
+func (w *writer) newline() {
+	w.space = false
+	if !w.atLineStart() {
+		w.b.WriteByte('\n')
+	}
+}
+
+// blankLine ends the current line and leaves one blank line after it.
+func (w *writer) blankLine() {
+	w.newline()
+	if s := w.b.String(); s != "" && !strings.HasSuffix(s, "\n\n") {
+		w.b.WriteByte('\n')
+	}
+}
+
+func (w *writer) atLineStart() bool {
+	s := w.b.String()
+	return s == "" || strings.HasSuffix(s, "\n")
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func find(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := find(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
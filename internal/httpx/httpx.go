@@ -0,0 +1,69 @@
+// Package httpx provides HTTP clients tuned for talking to model APIs: many
+// quick, successive requests to the same few hosts, some of which stream
+// for minutes.
+package httpx
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Default is shared by everything that doesn't need its own connection
+// pool, so that connections opened by one request are reused by the next.
+// It has no overall timeout, since replies may stream for a long time; use
+// a context deadline instead.
+var Default = New()
+
+// New returns a client with its own connection pool, such as for a
+// provider whose connections shouldn't compete with others.
+func New() *http.Client {
+	return &http.Client{Transport: NewTransport()}
+}
+
+// NewTransport returns a transport that keeps more idle connections per
+// host than the default, keeps them alive longer, prefers HTTP/2, and
+// resumes TLS sessions, so that a request after the first usually skips
+// both the TCP and TLS handshakes.
+func NewTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	return &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dialer.DialContext,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 16,
+		IdleConnTimeout:     5 * time.Minute,
+		TLSHandshakeTimeout: 10 * time.Second,
+		TLSClientConfig: &tls.Config{
+			ClientSessionCache: tls.NewLRUClientSessionCache(64),
+		},
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// Preconnect opens a connection to the host of url in the background, so
+// that the first real request doesn't pay for the handshakes. The
+// response, whatever it is, is discarded.
+func Preconnect(client *http.Client, url string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+		if err != nil {
+			return
+		}
+		rsp, err := client.Do(req)
+		if err != nil {
+			return
+		}
+		io.Copy(io.Discard, rsp.Body)
+		rsp.Body.Close()
+	}()
+}
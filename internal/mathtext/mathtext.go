@@ -0,0 +1,388 @@
+// Package mathtext renders LaTeX math as plain text, using unicode symbols,
+// superscripts, and subscripts where they exist, so that math in replies
+// is readable in a terminal. It's an approximation: x^{2} becomes x², but
+// fractions become a/b, and matrices [a b; c d].
+package mathtext
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Render returns the plain text approximation of the LaTeX math in tex,
+// such as "α² ≤ √(x+1)" for `\alpha^2 \leq \sqrt{x+1}`. Unknown commands
+// are written as their names.
+func Render(tex string) string {
+	p := &parser{s: tex}
+	return strings.TrimSpace(p.until(0))
+}
+
+type parser struct {
+	s string
+	i int
+}
+
+// until renders up to the byte end, which is consumed, or the end of the
+// input if end is 0.
+func (p *parser) until(end byte) string {
+	var b strings.Builder
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		if end != 0 && c == end {
+			p.i++
+			break
+		}
+		switch c {
+		case '{':
+			p.i++
+			b.WriteString(p.until('}'))
+		case '}':
+			p.i++
+		case '^', '_':
+			p.i++
+			b.WriteString(script(p.arg(), c == '^'))
+		case '\\':
+			b.WriteString(p.command())
+		case '~':
+			p.i++
+			b.WriteByte(' ')
+		case '\'':
+			p.i++
+			b.WriteString("′")
+		case ' ', '\t', '\n', '\r':
+			for p.i < len(p.s) && strings.IndexByte(" \t\n\r", p.s[p.i]) >= 0 {
+				p.i++
+			}
+			b.WriteByte(' ')
+		default:
+			_, size := utf8.DecodeRuneInString(p.s[p.i:])
+			b.WriteString(p.s[p.i : p.i+size])
+			p.i += size
+		}
+	}
+	return b.String()
+}
+
+// arg renders the argument of a command or script: a group, a command, or
+// a single character.
+func (p *parser) arg() string {
+	p.skipSpace()
+	if p.i >= len(p.s) {
+		return ""
+	}
+	switch p.s[p.i] {
+	case '{':
+		p.i++
+		return p.until('}')
+	case '\\':
+		return p.command()
+	}
+	_, size := utf8.DecodeRuneInString(p.s[p.i:])
+	p.i += size
+	return p.s[p.i-size : p.i]
+}
+
+// rawArg returns the text of a group argument without rendering it, such
+// as the name of an environment.
+func (p *parser) rawArg(open, close byte) string {
+	p.skipSpace()
+	if p.i >= len(p.s) || p.s[p.i] != open {
+		return ""
+	}
+	start := p.i + 1
+	end := strings.IndexByte(p.s[start:], close)
+	if end < 0 {
+		p.i = len(p.s)
+		return p.s[start:]
+	}
+	p.i = start + end + 1
+	return p.s[start : start+end]
+}
+
+func (p *parser) skipSpace() {
+	for p.i < len(p.s) && p.s[p.i] == ' ' {
+		p.i++
+	}
+}
+
+// command renders the command starting with the backslash at p.i, and its
+// arguments.
+func (p *parser) command() string {
+	p.i++
+	start := p.i
+	for p.i < len(p.s) && isLetter(p.s[p.i]) {
+		p.i++
+	}
+	if p.i == start && p.i < len(p.s) {
+		p.i++
+	}
+	name := p.s[start:p.i]
+	if s, ok := symbols[name]; ok {
+		return s
+	}
+	switch name {
+	case "frac", "dfrac", "tfrac", "cfrac":
+		num, den := p.arg(), p.arg()
+		return group(num) + "/" + group(den)
+	case "binom":
+		n, k := p.arg(), p.arg()
+		return "C(" + n + ", " + k + ")"
+	case "sqrt":
+		index := p.rawArg('[', ']')
+		root := "√"
+		if index != "" {
+			root = script(Render(index), true) + root
+		}
+		return root + group(p.arg())
+	case "text", "textrm", "textit", "textbf", "textsf", "texttt", "mathrm", "mathit", "mathbf",
+		"mathsf", "mathtt", "mathcal", "mathscr", "mathfrak", "boldsymbol", "bm", "operatorname",
+		"emph", "mbox":
+		return p.arg()
+	case "mathbb":
+		return mapRunes(p.arg(), doubleStruck)
+	case "left", "right", "bigl", "bigr", "Bigl", "Bigr", "biggl", "biggr", "big", "Big", "bigg", "Bigg":
+		// The delimiter that follows is rendered as usual, except for the
+		// blank one.
+		if p.i < len(p.s) && p.s[p.i] == '.' {
+			p.i++
+		}
+		return ""
+	case "displaystyle", "textstyle", "scriptstyle", "limits", "nolimits":
+		return ""
+	case "not":
+		return p.arg() + "\u0338"
+	case "begin":
+		return p.environment(p.rawArg('{', '}'))
+	case "end":
+		p.rawArg('{', '}')
+		return ""
+	}
+	if mark, ok := accents[name]; ok {
+		return combine(p.arg(), mark, name == "overline" || name == "underline")
+	}
+	return name
+}
+
+// environment renders the body of \begin{name}, up to its \end{name}:
+// matrices like [a b; c d], and the rows of others, like align, on their
+// own lines with the & column separators dropped.
+func (p *parser) environment(name string) string {
+	begin, end := `\begin{`+name+`}`, `\end{`+name+`}`
+	body := p.s[p.i:]
+	depth, i := 1, 0
+	for depth > 0 {
+		nb, ne := strings.Index(body[i:], begin), strings.Index(body[i:], end)
+		if ne < 0 {
+			i = len(body)
+			break
+		}
+		if nb >= 0 && nb < ne {
+			depth++
+			i += nb + len(begin)
+			continue
+		}
+		depth--
+		i += ne
+		if depth > 0 {
+			i += len(end)
+		}
+	}
+	p.i += min(i+len(end), len(body))
+	body = body[:i]
+
+	open, close, sep := "", "", ""
+	switch strings.TrimSuffix(name, "*") {
+	case "matrix", "smallmatrix":
+	case "pmatrix":
+		open, close = "(", ")"
+	case "bmatrix":
+		open, close = "[", "]"
+	case "Bmatrix":
+		open, close = "{", "}"
+	case "vmatrix":
+		open, close = "|", "|"
+	case "Vmatrix":
+		open, close = "‖", "‖"
+	case "cases":
+		open, sep = "{ ", " "
+	default:
+		var rows []string
+		for _, row := range strings.Split(body, `\\`) {
+			if row := Render(strings.ReplaceAll(row, "&", "")); row != "" {
+				rows = append(rows, row)
+			}
+		}
+		return strings.Join(rows, "\n")
+	}
+	if sep == "" {
+		sep = " "
+	}
+	var rows []string
+	for _, row := range strings.Split(body, `\\`) {
+		var cells []string
+		for _, cell := range strings.Split(row, "&") {
+			cells = append(cells, Render(cell))
+		}
+		if row := strings.Join(cells, sep); strings.TrimSpace(row) != "" {
+			rows = append(rows, row)
+		}
+	}
+	return open + strings.Join(rows, "; ") + close
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// group returns s in parentheses unless it's a single character, a number,
+// or a word, such as the numerator of a fraction.
+func group(s string) string {
+	s = strings.TrimSpace(s)
+	if utf8.RuneCountInString(s) <= 1 {
+		return s
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' {
+			return "(" + s + ")"
+		}
+	}
+	return s
+}
+
+// script returns s as a superscript or subscript, using the unicode
+// characters for them if s has only characters that have them, and
+// otherwise like ^(s) or _(s).
+func script(s string, sup bool) string {
+	s = strings.TrimSpace(s)
+	if sup && s == "∘" {
+		return "°"
+	}
+	table, mark := subscripts, "_"
+	if sup {
+		table, mark = superscripts, "^"
+	}
+	if mapped, ok := mapAll(strings.ReplaceAll(s, " ", ""), table); ok && s != "" {
+		return mapped
+	}
+	if sup && strings.Trim(s, "′") == "" {
+		return s
+	}
+	return mark + group(s)
+}
+
+func mapAll(s string, table map[rune]rune) (string, bool) {
+	var b strings.Builder
+	for _, r := range s {
+		m, ok := table[r]
+		if !ok {
+			return "", false
+		}
+		b.WriteRune(m)
+	}
+	return b.String(), true
+}
+
+// mapRunes replaces the runes of s that are in table.
+func mapRunes(s string, table map[rune]rune) string {
+	return strings.Map(func(r rune) rune {
+		if m, ok := table[r]; ok {
+			return m
+		}
+		return r
+	}, s)
+}
+
+// combine adds the combining mark to the last rune of s, or to every rune
+// if all is set, as for \overline.
+func combine(s, mark string, all bool) string {
+	if s == "" {
+		return ""
+	}
+	if all {
+		var b strings.Builder
+		for _, r := range s {
+			b.WriteRune(r)
+			b.WriteString(mark)
+		}
+		return b.String()
+	}
+	return s + mark
+}
+
+var accents = map[string]string{
+	"hat":       "\u0302",
+	"widehat":   "\u0302",
+	"bar":       "\u0304",
+	"vec":       "\u20d7",
+	"dot":       "\u0307",
+	"ddot":      "\u0308",
+	"tilde":     "\u0303",
+	"widetilde": "\u0303",
+	"overline":  "\u0305",
+	"underline": "\u0332",
+}
+
+var symbols = map[string]string{
+	// Greek letters.
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ε", "varepsilon": "ε",
+	"zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ", "iota": "ι", "kappa": "κ",
+	"lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "pi": "π", "varpi": "ϖ", "rho": "ρ",
+	"varrho": "ϱ", "sigma": "σ", "varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "ϕ",
+	"varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω",
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π", "Sigma": "Σ",
+	"Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+
+	// Operators and relations.
+	"times": "×", "cdot": "·", "cdotp": "·", "div": "÷", "pm": "±", "mp": "∓", "ast": "∗",
+	"star": "⋆", "circ": "∘", "bullet": "•", "oplus": "⊕", "otimes": "⊗", "setminus": "∖",
+	"leq": "≤", "le": "≤", "leqslant": "≤", "geq": "≥", "ge": "≥", "geqslant": "≥",
+	"neq": "≠", "ne": "≠", "approx": "≈", "equiv": "≡", "sim": "∼", "simeq": "≃",
+	"cong": "≅", "propto": "∝", "ll": "≪", "gg": "≫", "prec": "≺", "succ": "≻",
+	"perp": "⊥", "parallel": "∥", "mid": "∣", "nmid": "∤",
+	"in": "∈", "notin": "∉", "ni": "∋", "subset": "⊂", "subseteq": "⊆", "supset": "⊃",
+	"supseteq": "⊇", "cup": "∪", "cap": "∩", "emptyset": "∅", "varnothing": "∅",
+	"forall": "∀", "exists": "∃", "nexists": "∄", "neg": "¬", "lnot": "¬", "land": "∧",
+	"wedge": "∧", "lor": "∨", "vee": "∨",
+	"sum": "∑", "prod": "∏", "coprod": "∐", "int": "∫", "iint": "∬", "iiint": "∭",
+	"oint": "∮", "bigcup": "⋃", "bigcap": "⋂", "bigoplus": "⨁", "bigotimes": "⨂",
+	"partial": "∂", "nabla": "∇", "infty": "∞", "angle": "∠", "triangle": "△",
+	"hbar": "ℏ", "ell": "ℓ", "Re": "ℜ", "Im": "ℑ", "aleph": "ℵ", "wp": "℘",
+	"prime": "′", "degree": "°",
+
+	// Arrows.
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "gets": "←", "leftrightarrow": "↔",
+	"Rightarrow": "⇒", "implies": "⇒", "Leftarrow": "⇐", "Leftrightarrow": "⇔", "iff": "⇔",
+	"mapsto": "↦", "longrightarrow": "⟶", "longmapsto": "⟼", "uparrow": "↑",
+	"downarrow": "↓", "hookrightarrow": "↪",
+
+	// Delimiters and dots.
+	"langle": "⟨", "rangle": "⟩", "lfloor": "⌊", "rfloor": "⌋", "lceil": "⌈", "rceil": "⌉",
+	"lvert": "|", "rvert": "|", "vert": "|", "lVert": "‖", "rVert": "‖", "Vert": "‖",
+	"{": "{", "}": "}", "|": "‖", "ldots": "…", "dots": "…", "cdots": "⋯", "vdots": "⋮",
+	"ddots": "⋱",
+
+	// Spacing and escaped characters.
+	",": " ", ";": " ", ":": " ", ">": " ", "!": "", " ": " ", "quad": "  ", "qquad": "    ",
+	"%": "%", "$": "$", "&": "&", "_": "_", "#": "#", "\\": "\n",
+}
+
+var superscripts = map[rune]rune{
+	'0': '⁰', '1': '¹', '2': '²', '3': '³', '4': '⁴', '5': '⁵', '6': '⁶', '7': '⁷', '8': '⁸',
+	'9': '⁹', '+': '⁺', '-': '⁻', '−': '⁻', '=': '⁼', '(': '⁽', ')': '⁾',
+	'a': 'ᵃ', 'b': 'ᵇ', 'c': 'ᶜ', 'd': 'ᵈ', 'e': 'ᵉ', 'f': 'ᶠ', 'g': 'ᵍ', 'h': 'ʰ', 'i': 'ⁱ',
+	'j': 'ʲ', 'k': 'ᵏ', 'l': 'ˡ', 'm': 'ᵐ', 'n': 'ⁿ', 'o': 'ᵒ', 'p': 'ᵖ', 'r': 'ʳ', 's': 'ˢ',
+	't': 'ᵗ', 'u': 'ᵘ', 'v': 'ᵛ', 'w': 'ʷ', 'x': 'ˣ', 'y': 'ʸ', 'z': 'ᶻ', 'T': 'ᵀ',
+	'′': '′',
+}
+
+var subscripts = map[rune]rune{
+	'0': '₀', '1': '₁', '2': '₂', '3': '₃', '4': '₄', '5': '₅', '6': '₆', '7': '₇', '8': '₈',
+	'9': '₉', '+': '₊', '-': '₋', '−': '₋', '=': '₌', '(': '₍', ')': '₎',
+	'a': 'ₐ', 'e': 'ₑ', 'h': 'ₕ', 'i': 'ᵢ', 'j': 'ⱼ', 'k': 'ₖ', 'l': 'ₗ', 'm': 'ₘ', 'n': 'ₙ',
+	'o': 'ₒ', 'p': 'ₚ', 'r': 'ᵣ', 's': 'ₛ', 't': 'ₜ', 'u': 'ᵤ', 'v': 'ᵥ', 'x': 'ₓ',
+}
+
+var doubleStruck = map[rune]rune{
+	'C': 'ℂ', 'H': 'ℍ', 'N': 'ℕ', 'P': 'ℙ', 'Q': 'ℚ', 'R': 'ℝ', 'Z': 'ℤ',
+}
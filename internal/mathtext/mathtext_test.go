@@ -0,0 +1,33 @@
+package mathtext_test
+
+import (
+	"testing"
+
+	"github.com/bduffany/gpt-cli/internal/mathtext"
+)
+
+func TestRender(t *testing.T) {
+	for _, tc := range []struct {
+		tex, want string
+	}{
+		{`E = mc^2`, "E = mc²"},
+		{`\alpha^2 \leq \sqrt{x+1}`, "α² ≤ √(x+1)"},
+		{`x_{n+1} = x_n - \frac{f(x_n)}{f'(x_n)}`, "xₙ₊₁ = xₙ - (f(xₙ))/(f′(xₙ))"},
+		{`\sum_{i=1}^{n} i = \frac{n(n+1)}{2}`, "∑ᵢ₌₁ⁿ i = (n(n+1))/2"},
+		{`\int_0^\infty e^{-x^2} dx`, "∫₀^∞ e^(-x²) dx"},
+		{`\forall x \in \mathbb{R}, x^2 \geq 0`, "∀ x ∈ ℝ, x² ≥ 0"},
+		{`\left( \frac{a}{b} \right)`, "( a/b )"},
+		{`90^\circ`, "90°"},
+		{`\sqrt[3]{8} = 2`, "³√8 = 2"},
+		{`\hat{x} \neq \not\in`, "x\u0302 ≠ ∈\u0338"},
+		{`\text{if } x > 0`, "if  x > 0"},
+		{`\begin{pmatrix} a & b \\ c & d \end{pmatrix}`, "(a b; c d)"},
+		{`\begin{aligned} x &= 1 \\ y &= 2 \end{aligned}`, "x = 1\ny = 2"},
+		{`\operatorname{argmax}_\theta L(\theta)`, "argmax_θ L(θ)"},
+		{`\lim_{x \to 0} \frac{\sin x}{x} = 1`, "lim_(x → 0) (sin x)/x = 1"},
+	} {
+		if got := mathtext.Render(tc.tex); got != tc.want {
+			t.Errorf("Render(%q) = %q, want %q", tc.tex, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Package models is a catalog of metadata for models from each provider,
+// such as context window sizes, capabilities, and pricing.
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// The default models for each job are set here, rather than where they're
+// used, so that they're updated together.
+const (
+	// Default is the model used when none is configured.
+	Default = "gpt-4o-2024-08-06"
+	// Small is a fast and cheap model for side jobs, such as titling
+	// sessions and searching the web for the agent.
+	Small = "gpt-4.1-mini"
+	// Speech reads text aloud, and Transcription turns speech into text.
+	Speech        = "gpt-4o-mini-tts"
+	Transcription = "gpt-4o-transcribe"
+)
+
+type Provider string
+
+const (
+	OpenAI    Provider = "openai"
+	Google    Provider = "google"
+	Anthropic Provider = "anthropic"
+)
+
+type Model struct {
+	ID       string
+	Provider Provider
+
+	ContextWindow   int
+	MaxOutputTokens int
+
+	// Vision is whether the model accepts image inputs.
+	Vision bool
+	// ToolCalls is whether the model supports function calling.
+	ToolCalls bool
+	// WebSearch is whether the model can search the web while replying.
+	WebSearch bool
+	// Reasoning is whether the model thinks before replying.
+	Reasoning bool
+	// ReasoningEfforts are the supported values of the reasoning effort
+	// parameter, from least to most effort. Empty if the parameter is not
+	// supported.
+	ReasoningEfforts []string
+
+	// Prices are in USD per million tokens. Zero means unknown.
+	InputPrice       float64
+	CachedInputPrice float64
+	OutputPrice      float64
+}
+
+// Cost returns the price in USD of a request with the given token counts,
+// where cachedInputTokens is the subset of inputTokens read from the
+// provider's prompt cache.
+func (m *Model) Cost(inputTokens, cachedInputTokens, outputTokens int) float64 {
+	cachedPrice := m.CachedInputPrice
+	if cachedPrice == 0 {
+		cachedPrice = m.InputPrice
+	}
+	uncached := inputTokens - cachedInputTokens
+	return (float64(uncached)*m.InputPrice +
+		float64(cachedInputTokens)*cachedPrice +
+		float64(outputTokens)*m.OutputPrice) / 1e6
+}
+
+var (
+	// Efforts lists every known reasoning effort value.
+	Efforts = []string{"minimal", "low", "medium", "high"}
+
+	gpt5Efforts    = Efforts
+	oSeriesEfforts = []string{"low", "medium", "high"}
+)
+
+// catalog is compiled from each provider's published model documentation.
+var catalog = []*Model{
+	// OpenAI
+	{ID: "gpt-5", Provider: OpenAI, ContextWindow: 400_000, MaxOutputTokens: 128_000, Vision: true, ToolCalls: true, Reasoning: true, ReasoningEfforts: gpt5Efforts, InputPrice: 1.25, CachedInputPrice: 0.125, OutputPrice: 10},
+	{ID: "gpt-5-mini", Provider: OpenAI, ContextWindow: 400_000, MaxOutputTokens: 128_000, Vision: true, ToolCalls: true, Reasoning: true, ReasoningEfforts: gpt5Efforts, InputPrice: 0.25, CachedInputPrice: 0.025, OutputPrice: 2},
+	// The chat model behind ChatGPT doesn't reason, unlike the gpt-5 it
+	// would otherwise resolve to.
+	{ID: "gpt-5-chat-latest", Provider: OpenAI, ContextWindow: 128_000, MaxOutputTokens: 16_384, Vision: true, InputPrice: 1.25, CachedInputPrice: 0.125, OutputPrice: 10},
+	{ID: "gpt-5-nano", Provider: OpenAI, ContextWindow: 400_000, MaxOutputTokens: 128_000, Vision: true, ToolCalls: true, Reasoning: true, ReasoningEfforts: gpt5Efforts, InputPrice: 0.05, CachedInputPrice: 0.005, OutputPrice: 0.40},
+	{ID: "gpt-4.1", Provider: OpenAI, ContextWindow: 1_047_576, MaxOutputTokens: 32_768, Vision: true, ToolCalls: true, InputPrice: 2, CachedInputPrice: 0.50, OutputPrice: 8},
+	{ID: "gpt-4.1-mini", Provider: OpenAI, ContextWindow: 1_047_576, MaxOutputTokens: 32_768, Vision: true, ToolCalls: true, InputPrice: 0.40, CachedInputPrice: 0.10, OutputPrice: 1.60},
+	{ID: "gpt-4.1-nano", Provider: OpenAI, ContextWindow: 1_047_576, MaxOutputTokens: 32_768, Vision: true, ToolCalls: true, InputPrice: 0.10, CachedInputPrice: 0.025, OutputPrice: 0.40},
+	{ID: "gpt-4o", Provider: OpenAI, ContextWindow: 128_000, MaxOutputTokens: 16_384, Vision: true, ToolCalls: true, InputPrice: 2.50, CachedInputPrice: 1.25, OutputPrice: 10},
+	{ID: "gpt-4o-mini", Provider: OpenAI, ContextWindow: 128_000, MaxOutputTokens: 16_384, Vision: true, ToolCalls: true, InputPrice: 0.15, CachedInputPrice: 0.075, OutputPrice: 0.60},
+	{ID: "gpt-4o-search-preview", Provider: OpenAI, ContextWindow: 128_000, MaxOutputTokens: 16_384, WebSearch: true, InputPrice: 2.50, OutputPrice: 10},
+	{ID: "gpt-4o-mini-search-preview", Provider: OpenAI, ContextWindow: 128_000, MaxOutputTokens: 16_384, WebSearch: true, InputPrice: 0.15, OutputPrice: 0.60},
+	{ID: "gpt-4-turbo", Provider: OpenAI, ContextWindow: 128_000, MaxOutputTokens: 4_096, Vision: true, ToolCalls: true, InputPrice: 10, OutputPrice: 30},
+	{ID: "gpt-4", Provider: OpenAI, ContextWindow: 8_192, MaxOutputTokens: 8_192, ToolCalls: true, InputPrice: 30, OutputPrice: 60},
+	{ID: "gpt-3.5-turbo", Provider: OpenAI, ContextWindow: 16_385, MaxOutputTokens: 4_096, ToolCalls: true, InputPrice: 0.50, OutputPrice: 1.50},
+	{ID: "o1", Provider: OpenAI, ContextWindow: 200_000, MaxOutputTokens: 100_000, Vision: true, ToolCalls: true, Reasoning: true, ReasoningEfforts: oSeriesEfforts, InputPrice: 15, CachedInputPrice: 7.50, OutputPrice: 60},
+	{ID: "o1-mini", Provider: OpenAI, ContextWindow: 128_000, MaxOutputTokens: 65_536, Reasoning: true, InputPrice: 1.10, CachedInputPrice: 0.55, OutputPrice: 4.40},
+	{ID: "o3", Provider: OpenAI, ContextWindow: 200_000, MaxOutputTokens: 100_000, Vision: true, ToolCalls: true, Reasoning: true, ReasoningEfforts: oSeriesEfforts, InputPrice: 2, CachedInputPrice: 0.50, OutputPrice: 8},
+	{ID: "o3-mini", Provider: OpenAI, ContextWindow: 200_000, MaxOutputTokens: 100_000, ToolCalls: true, Reasoning: true, ReasoningEfforts: oSeriesEfforts, InputPrice: 1.10, CachedInputPrice: 0.55, OutputPrice: 4.40},
+	{ID: "o4-mini", Provider: OpenAI, ContextWindow: 200_000, MaxOutputTokens: 100_000, Vision: true, ToolCalls: true, Reasoning: true, ReasoningEfforts: oSeriesEfforts, InputPrice: 1.10, CachedInputPrice: 0.275, OutputPrice: 4.40},
+
+	// Google
+	{ID: "gemini-2.5-pro", Provider: Google, ContextWindow: 1_048_576, MaxOutputTokens: 65_536, Vision: true, ToolCalls: true, Reasoning: true, InputPrice: 1.25, CachedInputPrice: 0.31, OutputPrice: 10},
+	{ID: "gemini-2.5-flash", Provider: Google, ContextWindow: 1_048_576, MaxOutputTokens: 65_536, Vision: true, ToolCalls: true, Reasoning: true, InputPrice: 0.30, CachedInputPrice: 0.075, OutputPrice: 2.50},
+	{ID: "gemini-2.0-flash", Provider: Google, ContextWindow: 1_048_576, MaxOutputTokens: 8_192, Vision: true, ToolCalls: true, InputPrice: 0.10, CachedInputPrice: 0.025, OutputPrice: 0.40},
+
+	// Anthropic
+	{ID: "claude-opus-4", Provider: Anthropic, ContextWindow: 200_000, MaxOutputTokens: 32_000, Vision: true, ToolCalls: true, Reasoning: true, InputPrice: 15, CachedInputPrice: 1.50, OutputPrice: 75},
+	{ID: "claude-sonnet-4", Provider: Anthropic, ContextWindow: 200_000, MaxOutputTokens: 64_000, Vision: true, ToolCalls: true, Reasoning: true, InputPrice: 3, CachedInputPrice: 0.30, OutputPrice: 15},
+	{ID: "claude-3-5-haiku", Provider: Anthropic, ContextWindow: 200_000, MaxOutputTokens: 8_192, Vision: true, ToolCalls: true, InputPrice: 0.80, CachedInputPrice: 0.08, OutputPrice: 4},
+}
+
+// dateSuffix matches the snapshot date at the end of model IDs like
+// "gpt-4o-2024-08-06" or "claude-sonnet-4-20250514".
+var dateSuffix = regexp.MustCompile(`-(\d{4}-\d{2}-\d{2}|\d{8})$`)
+
+// Lookup returns the catalog entry for a model ID. Snapshot IDs and other
+// variants resolve to the longest catalog ID they extend, so
+// "gpt-4o-mini-2024-07-18" resolves to "gpt-4o-mini".
+func Lookup(id string) (*Model, bool) {
+	id = dateSuffix.ReplaceAllString(id, "")
+	var best *Model
+	for _, m := range catalog {
+		if m.ID == id {
+			return m, true
+		}
+		if strings.HasPrefix(id, m.ID+"-") && (best == nil || len(m.ID) > len(best.ID)) {
+			best = m
+		}
+	}
+	return best, best != nil
+}
+
+// ProviderOf returns the provider serving a model. Models missing from the
+// catalog are assumed to be served by OpenAI.
+func ProviderOf(id string) Provider {
+	if m, ok := Lookup(id); ok {
+		return m.Provider
+	}
+	return OpenAI
+}
+
+// Merge returns models for the IDs listed by a provider, using catalog
+// metadata where it is known. The result is sorted by ID.
+func Merge(provider Provider, ids []string) []*Model {
+	out := make([]*Model, 0, len(ids))
+	for _, id := range ids {
+		m := &Model{ID: id, Provider: provider}
+		if known, ok := Lookup(id); ok && known.Provider == provider {
+			*m = *known
+			m.ID = id
+		}
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// CheckSupported returns an error if the model is served by a provider that
+// this CLI can't talk to.
+func CheckSupported(id string) error {
+	if p := ProviderOf(id); p != OpenAI {
+		return fmt.Errorf("model %q is served by %s, which is not supported", id, p)
+	}
+	return nil
+}
+
+// CheckEffort returns an error if the model doesn't accept the given
+// reasoning effort. Models missing from the catalog accept any known effort.
+func CheckEffort(id, effort string) error {
+	if effort == "" {
+		return nil
+	}
+	supported := Efforts
+	if m, ok := Lookup(id); ok {
+		if len(m.ReasoningEfforts) == 0 {
+			return fmt.Errorf("model %q does not support setting reasoning effort", id)
+		}
+		supported = m.ReasoningEfforts
+	}
+	if !slices.Contains(supported, effort) {
+		return fmt.Errorf("invalid reasoning effort %q for model %q: supported values are %s", effort, id, strings.Join(supported, ", "))
+	}
+	return nil
+}
+
+// CheckWebSearch returns an error if the model can't search the web.
+func CheckWebSearch(id string) error {
+	if m, ok := Lookup(id); ok && !m.WebSearch {
+		return fmt.Errorf("model %q can't search the web: use a search model such as gpt-4o-search-preview", id)
+	}
+	return nil
+}
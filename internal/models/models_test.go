@@ -0,0 +1,89 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/bduffany/gpt-cli/internal/models"
+)
+
+func TestLookup(t *testing.T) {
+	for _, tc := range []struct {
+		id, want string
+	}{
+		{"gpt-4o", "gpt-4o"},
+		{"gpt-4o-2024-08-06", "gpt-4o"},
+		{"gpt-4o-mini-2024-07-18", "gpt-4o-mini"},
+		{"gpt-4o-audio-preview", "gpt-4o"},
+		{"gpt-4o-search-preview", "gpt-4o-search-preview"},
+		{"gpt-4o-search-preview-2025-03-11", "gpt-4o-search-preview"},
+		{"gpt-5-chat-latest", "gpt-5-chat-latest"},
+		{"o3-mini-2025-01-31", "o3-mini"},
+		{"claude-sonnet-4-20250514", "claude-sonnet-4"},
+		{"gpt-4oo", ""},
+		{"my-finetune", ""},
+	} {
+		m, ok := models.Lookup(tc.id)
+		got := ""
+		if ok {
+			got = m.ID
+		}
+		if got != tc.want {
+			t.Errorf("Lookup(%q) = %q, want %q", tc.id, got, tc.want)
+		}
+	}
+
+	// Variants take on the capabilities of the model they resolve to,
+	// unless they're in the catalog themselves.
+	if m, _ := models.Lookup("gpt-5-chat-latest"); m.Reasoning {
+		t.Error("gpt-5-chat-latest reasons")
+	}
+	if m, _ := models.Lookup("gpt-4o-search-preview-2025-03-11"); !m.WebSearch || m.ToolCalls {
+		t.Errorf("gpt-4o-search-preview-2025-03-11: WebSearch = %v, ToolCalls = %v", m.WebSearch, m.ToolCalls)
+	}
+}
+
+func TestCheckSupported(t *testing.T) {
+	for id, ok := range map[string]bool{
+		"gpt-4o":                   true,
+		"o3-2025-04-16":            true,
+		"my-finetune":              true,
+		"claude-sonnet-4-20250514": false,
+		"gemini-2.5-pro":           false,
+	} {
+		if err := models.CheckSupported(id); (err == nil) != ok {
+			t.Errorf("CheckSupported(%q) = %v", id, err)
+		}
+	}
+}
+
+func TestCheckEffort(t *testing.T) {
+	for _, tc := range []struct {
+		id, effort, err string
+	}{
+		{"gpt-4o", "", ""},
+		{"gpt-5", "minimal", ""},
+		{"gpt-5-chat-latest", "high", `model "gpt-5-chat-latest" does not support setting reasoning effort`},
+		{"o3", "low", ""},
+		{"o3", "minimal", `invalid reasoning effort "minimal" for model "o3": supported values are low, medium, high`},
+		{"gpt-4o", "low", `model "gpt-4o" does not support setting reasoning effort`},
+		{"my-finetune", "minimal", ""},
+		{"my-finetune", "extreme", `invalid reasoning effort "extreme" for model "my-finetune": supported values are minimal, low, medium, high`},
+	} {
+		err := models.CheckEffort(tc.id, tc.effort)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tc.err {
+			t.Errorf("CheckEffort(%q, %q) = %q, want %q", tc.id, tc.effort, got, tc.err)
+		}
+	}
+}
+
+func TestDefaultsInCatalog(t *testing.T) {
+	for _, id := range []string{models.Default, models.Small} {
+		if _, ok := models.Lookup(id); !ok {
+			t.Errorf("default model %s is missing from the catalog", id)
+		}
+	}
+}
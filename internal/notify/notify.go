@@ -0,0 +1,50 @@
+// Package notify shows desktop notifications using the command that the OS
+// provides: notify-send on Linux and BSD, osascript on macOS, and
+// PowerShell on Windows.
+package notify
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// windowsToast shows a toast notification with the title and body in the
+// GPT_NOTIFY_TITLE and GPT_NOTIFY_BODY env vars, which need no quoting.
+const windowsToast = `
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $xml.GetElementsByTagName('text')
+$text.Item(0).AppendChild($xml.CreateTextNode($env:GPT_NOTIFY_TITLE)) > $null
+$text.Item(1).AppendChild($xml.CreateTextNode($env:GPT_NOTIFY_BODY)) > $null
+$toast = [Windows.UI.Notifications.ToastNotification]::new($xml)
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('gpt').Show($toast)
+`
+
+// Send shows a notification, returning once it's been handed to the OS.
+func Send(title, body string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		// The title and body are passed as args, so that they needn't be
+		// quoted for AppleScript.
+		cmd = exec.Command("osascript",
+			"-e", "on run argv",
+			"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+			"-e", "end run",
+			title, body)
+	case "windows":
+		cmd = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", windowsToast)
+		cmd.Env = append(os.Environ(), "GPT_NOTIFY_TITLE="+title, "GPT_NOTIFY_BODY="+body)
+	default:
+		if _, err := exec.LookPath("notify-send"); err != nil {
+			return fmt.Errorf("notify-send not found; install libnotify to get notifications")
+		}
+		cmd = exec.Command("notify-send", "--app-name=gpt", "--", title, body)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %w: %s", cmd.Args[0], err, out)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package otlp
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+// Client is an llm.CompletionClient that traces each request, from sending
+// it until its stream ends, following the OpenTelemetry semantic conventions
+// for generative AI.
+type Client struct {
+	Client   llm.CompletionClient
+	Exporter *Exporter
+}
+
+// Middleware returns an llm.Middleware that traces requests to exp.
+func Middleware(exp *Exporter) llm.Middleware {
+	return func(next llm.CompletionClient) llm.CompletionClient {
+		return &Client{Client: next, Exporter: exp}
+	}
+}
+
+func (c *Client) GetCompletion(ctx context.Context, req *llm.Request) (llm.Stream, error) {
+	ctx, span := c.Exporter.Start(ctx, "chat "+req.Model, KindClient,
+		String("gen_ai.operation.name", "chat"),
+		String("gen_ai.request.model", req.Model),
+		Int("gpt_cli.request.messages", len(req.Messages)),
+	)
+	s, err := c.Client.GetCompletion(ctx, req)
+	if err != nil {
+		span.End(err)
+		return nil, err
+	}
+	return &stream{Stream: s, span: span, start: time.Now()}, nil
+}
+
+type stream struct {
+	llm.Stream
+	span  *Span
+	start time.Time
+	// first is set once the first token is read.
+	first bool
+}
+
+func (s *stream) Next() (llm.Event, error) {
+	e, err := s.Stream.Next()
+	switch e := e.(type) {
+	case llm.TextDelta, llm.ReasoningDelta:
+		if !s.first {
+			s.first = true
+			s.span.Set(Float("gpt_cli.time_to_first_token", time.Since(s.start).Seconds()))
+		}
+	case *llm.Usage:
+		s.span.Set(
+			Int("gen_ai.usage.input_tokens", e.InputTokens),
+			Int("gen_ai.usage.output_tokens", e.OutputTokens),
+			Int("gpt_cli.usage.cached_input_tokens", e.CachedInputTokens),
+		)
+	case llm.Done:
+		s.span.Set(String("gen_ai.response.finish_reasons", e.FinishReason))
+	}
+	if err == io.EOF {
+		s.span.End(nil)
+	} else if err != nil {
+		s.span.End(err)
+	}
+	return e, err
+}
+
+// Close ends the span, if the stream was closed before it was read to the
+// end.
+func (s *stream) Close() error {
+	s.span.End(nil)
+	return s.Stream.Close()
+}
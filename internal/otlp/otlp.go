@@ -0,0 +1,247 @@
+// Package otlp exports trace spans to an OpenTelemetry collector, using the
+// OTLP/HTTP JSON encoding. It implements only what gpt-cli needs: spans with
+// attributes, parents, and error status.
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/httpx"
+	"github.com/bduffany/gpt-cli/internal/log"
+)
+
+// maxBatch is the number of ended spans buffered before they're exported in
+// the background. The rest are exported by Flush.
+const maxBatch = 64
+
+// Exporter records spans and sends them to a collector. A nil *Exporter
+// records nothing, so callers needn't check whether tracing is enabled.
+type Exporter struct {
+	// Endpoint is the collector's base URL, such as http://localhost:4318.
+	// Spans are posted to its /v1/traces path.
+	Endpoint string
+	// Service is reported as the service.name resource attribute.
+	Service string
+	// Headers are sent with each export, such as for authentication.
+	Headers map[string]string
+	// Client defaults to httpx.Default.
+	Client *http.Client
+
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// NewExporter returns an exporter for endpoint, with headers from the
+// standard OTEL_EXPORTER_OTLP_HEADERS env var, like "key1=value1,key2=value2".
+func NewExporter(endpoint, service string) *Exporter {
+	e := &Exporter{Endpoint: endpoint, Service: service, Headers: map[string]string{}}
+	for _, kv := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			e.Headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return e
+}
+
+// Attr is a span attribute. Values are strings, ints, floats, or bools.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+func String(key, value string) Attr        { return Attr{key, value} }
+func Int(key string, value int) Attr       { return Attr{key, value} }
+func Float(key string, value float64) Attr { return Attr{key, value} }
+func Bool(key string, value bool) Attr     { return Attr{key, value} }
+
+// Span kinds.
+const (
+	KindInternal = 1
+	KindClient   = 3
+)
+
+// Span is an operation being traced. All methods are safe to call on a nil
+// *Span.
+type Span struct {
+	e        *Exporter
+	traceID  [16]byte
+	id       [8]byte
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+
+	mu    sync.Mutex
+	end   time.Time
+	attrs []Attr
+	err   string
+}
+
+type spanKey struct{}
+
+// Start begins a span, as a child of the span in ctx if there is one. The
+// returned context carries the new span, for its children.
+func (e *Exporter) Start(ctx context.Context, name string, kind int, attrs ...Attr) (context.Context, *Span) {
+	if e == nil {
+		return ctx, nil
+	}
+	s := &Span{e: e, name: name, kind: kind, start: time.Now(), attrs: attrs}
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok && parent != nil {
+		s.traceID, s.parentID = parent.traceID, parent.id
+	} else {
+		rand.Read(s.traceID[:])
+	}
+	rand.Read(s.id[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Set adds attributes to the span.
+func (s *Span) Set(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// End ends the span, marking it failed if err is non-nil. Only the first
+// call has any effect.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+	s.mu.Unlock()
+
+	e := s.e
+	e.mu.Lock()
+	e.spans = append(e.spans, s)
+	full := len(e.spans) >= maxBatch
+	e.mu.Unlock()
+	if full {
+		go func() {
+			if err := e.Flush(context.Background()); err != nil {
+				log.Debugf("Failed to export spans: %s", err)
+			}
+		}()
+	}
+}
+
+// Flush exports the spans ended so far.
+func (e *Exporter) Flush(ctx context.Context) error {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	spans := e.spans
+	e.spans = nil
+	e.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(e.encode(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(e.Endpoint, "/")+"/v1/traces", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+	client := e.Client
+	if client == nil {
+		client = httpx.Default
+	}
+	rsp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(rsp.Body, 1024))
+		return fmt.Errorf("export spans: %s: %s", rsp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// encode returns an ExportTraceServiceRequest in the OTLP JSON encoding,
+// where IDs are hex and 64-bit ints are strings.
+func (e *Exporter) encode(spans []*Span) map[string]any {
+	var out []map[string]any
+	for _, s := range spans {
+		s.mu.Lock()
+		span := map[string]any{
+			"traceId":           hex.EncodeToString(s.traceID[:]),
+			"spanId":            hex.EncodeToString(s.id[:]),
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        encodeAttrs(s.attrs),
+		}
+		if s.parentID != [8]byte{} {
+			span["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+		}
+		if s.err != "" {
+			span["status"] = map[string]any{"code": 2, "message": s.err}
+		}
+		s.mu.Unlock()
+		out = append(out, span)
+	}
+	return map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": encodeAttrs([]Attr{String("service.name", e.Service)}),
+			},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "github.com/bduffany/gpt-cli"},
+				"spans": out,
+			}},
+		}},
+	}
+}
+
+func encodeAttrs(attrs []Attr) []any {
+	out := []any{}
+	for _, a := range attrs {
+		var v map[string]any
+		switch x := a.Value.(type) {
+		case string:
+			v = map[string]any{"stringValue": x}
+		case int:
+			v = map[string]any{"intValue": strconv.Itoa(x)}
+		case float64:
+			v = map[string]any{"doubleValue": x}
+		case bool:
+			v = map[string]any{"boolValue": x}
+		default:
+			v = map[string]any{"stringValue": fmt.Sprint(x)}
+		}
+		out = append(out, map[string]any{"key": a.Key, "value": v})
+	}
+	return out
+}
@@ -0,0 +1,153 @@
+package otlp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/internal/otlp"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/llm/llmtest"
+)
+
+type span struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+	Attributes   []struct {
+		Key   string         `json:"key"`
+		Value map[string]any `json:"value"`
+	} `json:"attributes"`
+	Status *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+func (s *span) attr(key string) any {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			for _, v := range a.Value {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+// collect starts a collector, returning its URL and the spans it received,
+// by name.
+func collect(t *testing.T) (string, map[string]*span) {
+	spans := map[string]*span{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Authorization") != "Bearer test" {
+			t.Errorf("got request to %s with Authorization %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []*span `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		b, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &req); err != nil {
+			t.Errorf("unmarshal %s: %s", b, err)
+		}
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					spans[s.Name] = s
+				}
+			}
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s.URL, spans
+}
+
+func TestExport(t *testing.T) {
+	url, spans := collect(t)
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer test")
+	e := otlp.NewExporter(url, "gpt-cli")
+
+	ctx, parent := e.Start(context.Background(), "parent", otlp.KindInternal, otlp.Int("n", 1))
+	_, child := e.Start(ctx, "child", otlp.KindInternal)
+	child.End(errors.New("failed"))
+	parent.End(nil)
+	parent.End(errors.New("ignored"))
+	if err := e.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	p, c := spans["parent"], spans["child"]
+	if p == nil || c == nil {
+		t.Fatalf("got spans %v, want parent and child", spans)
+	}
+	if c.TraceID != p.TraceID || c.ParentSpanID != p.SpanID || p.ParentSpanID != "" {
+		t.Errorf("child = %+v, want child of parent %+v", c, p)
+	}
+	if c.Status == nil || c.Status.Code != 2 || c.Status.Message != "failed" {
+		t.Errorf("child status = %+v, want error", c.Status)
+	}
+	if p.Status != nil {
+		t.Errorf("parent status = %+v, want ok", p.Status)
+	}
+	if got := p.attr("n"); got != "1" {
+		t.Errorf("parent attribute n = %v, want \"1\"", got)
+	}
+}
+
+func TestClient(t *testing.T) {
+	url, spans := collect(t)
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer test")
+	e := otlp.NewExporter(url, "gpt-cli")
+	rsp := llmtest.Text("Hello")
+	rsp.Events = append(rsp.Events, &llm.Usage{InputTokens: 12, OutputTokens: 3})
+	client := &otlp.Client{Client: llmtest.NewClient(rsp), Exporter: e}
+
+	s, err := client.GetCompletion(context.Background(), &llm.Request{Model: "gpt-test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(llm.NewReader(s)); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if err := e.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	span := spans["chat gpt-test"]
+	if span == nil {
+		t.Fatalf("got spans %v, want chat gpt-test", spans)
+	}
+	for key, want := range map[string]any{
+		"gen_ai.request.model":           "gpt-test",
+		"gen_ai.usage.input_tokens":      "12",
+		"gen_ai.usage.output_tokens":     "3",
+		"gen_ai.response.finish_reasons": "stop",
+	} {
+		if got := span.attr(key); got != want {
+			t.Errorf("attribute %s = %v, want %v", key, got, want)
+		}
+	}
+	if span.attr("gpt_cli.time_to_first_token") == nil {
+		t.Errorf("missing time to first token")
+	}
+}
+
+func TestNilExporter(t *testing.T) {
+	var e *otlp.Exporter
+	_, s := e.Start(context.Background(), "span", otlp.KindInternal)
+	s.Set(otlp.String("k", "v"))
+	s.End(nil)
+	if err := e.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,238 @@
+package pager
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/chzyer/readline"
+)
+
+// pageBuiltin shows text a screen at a time on the alternate screen, for
+// when there's no pager to run. Space and b page down and up, j and k
+// scroll a line, g and G go to the top and bottom, / searches, n and N go
+// to the next and previous match, and q, Esc, or Ctrl+C quits.
+func pageBuiltin(text string) error {
+	in := int(os.Stdin.Fd())
+	state, err := readline.MakeRaw(in)
+	if err != nil {
+		return err
+	}
+	defer readline.Restore(in, state)
+
+	out := os.Stdout
+	io.WriteString(out, "\x1b[?1049h")
+	defer io.WriteString(out, "\x1b[?1049l")
+	v := &view{text: text}
+	buf := make([]byte, 16)
+	for {
+		width, height, err := readline.GetSize(int(out.Fd()))
+		if err != nil || height <= 0 {
+			width, height = 80, 24
+		}
+		v.resize(width, height-1)
+		io.WriteString(out, v.render())
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return err
+		}
+		key := string(buf[:n])
+		if v.searching {
+			v.typeSearch(key)
+			continue
+		}
+		switch key {
+		case "q", "\x1b", "\x03":
+			return nil
+		case " ", "f", "\x1b[6~", "\x06": // Space, PgDn, Ctrl+F
+			v.scroll(v.height)
+		case "b", "\x1b[5~", "\x02": // PgUp, Ctrl+B
+			v.scroll(-v.height)
+		case "j", "\r", "\x1b[B", "\x0e": // Enter, Down, Ctrl+N
+			v.scroll(1)
+		case "k", "\x1b[A", "\x10": // Up, Ctrl+P
+			v.scroll(-1)
+		case "g", "\x1b[H":
+			v.top = 0
+		case "G", "\x1b[F":
+			v.scroll(len(v.lines))
+		case "/":
+			v.searching, v.query = true, ""
+		case "n":
+			v.next(true)
+		case "N":
+			v.next(false)
+		}
+	}
+}
+
+// view is the part of the text on the screen.
+type view struct {
+	text  string
+	width int
+	// lines are the text's lines wrapped at width.
+	lines  []string
+	top    int
+	height int
+
+	// searching is whether the query is being typed.
+	searching bool
+	query     string
+	// status is shown in place of the position, such as when there are no
+	// matches.
+	status string
+}
+
+// resize wraps the text for a screen of the given size, keeping the top
+// line in view.
+func (v *view) resize(width, height int) {
+	v.height = max(height, 1)
+	if width != v.width {
+		first := ""
+		if v.top < len(v.lines) {
+			first = v.lines[v.top]
+		}
+		v.width = width
+		v.lines = wrap(v.text, width)
+		v.top = 0
+		for i, line := range v.lines {
+			if line == first {
+				v.top = i
+				break
+			}
+		}
+	}
+	v.scroll(0)
+}
+
+// scroll moves down n lines, or up if n is negative, keeping the screen
+// full.
+func (v *view) scroll(n int) {
+	v.top = max(0, min(v.top+n, len(v.lines)-v.height))
+}
+
+// typeSearch handles a key typed into the search query.
+func (v *view) typeSearch(key string) {
+	switch key {
+	case "\r", "\n":
+		v.searching = false
+		v.next(true)
+	case "\x1b", "\x03":
+		v.searching = false
+	case "\x7f", "\x08":
+		if q := []rune(v.query); len(q) > 0 {
+			v.query = string(q[:len(q)-1])
+		}
+	default:
+		for _, r := range key {
+			if unicode.IsPrint(r) {
+				v.query += string(r)
+			}
+		}
+	}
+}
+
+// next scrolls to the next line after the top one matching the query,
+// ignoring case, or the previous line if forward is false.
+func (v *view) next(forward bool) {
+	i, ok := search(v.lines, v.query, v.top, forward)
+	if !ok {
+		v.status = fmt.Sprintf("Pattern not found: %s", v.query)
+		return
+	}
+	v.top = i
+	v.scroll(0)
+}
+
+// search returns the index of the first line after from that contains
+// query, ignoring case, or before from if forward is false, wrapping
+// around at the ends.
+func search(lines []string, query string, from int, forward bool) (int, bool) {
+	if query == "" || len(lines) == 0 {
+		return 0, false
+	}
+	query = strings.ToLower(query)
+	step := 1
+	if !forward {
+		step = -1
+	}
+	for n := 1; n <= len(lines); n++ {
+		i := ((from+step*n)%len(lines) + len(lines)) % len(lines)
+		if strings.Contains(strings.ToLower(lines[i]), query) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// render returns the escape sequences that draw the screen, with matches
+// of the query highlighted, and a status line.
+func (v *view) render() string {
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	for i := v.top; i < len(v.lines) && i < v.top+v.height; i++ {
+		b.WriteString(highlight(v.lines[i], v.query) + "\r\n")
+	}
+	b.WriteString(fmt.Sprintf("\x1b[%dH", v.height+1))
+	switch {
+	case v.searching:
+		b.WriteString("/" + v.query)
+		return b.String()
+	case v.status != "":
+		b.WriteString("\x1b[7m" + v.status + "\x1b[m")
+		v.status = ""
+	default:
+		last := min(v.top+v.height, len(v.lines))
+		percent := 100 * last / max(len(v.lines), 1)
+		fmt.Fprintf(&b, "\x1b[7m lines %d-%d/%d (%d%%)  / search  q quit \x1b[m", v.top+1, last, len(v.lines), percent)
+	}
+	return b.String()
+}
+
+// highlight shows the matches of query in line in reverse video.
+func highlight(line, query string) string {
+	if query == "" {
+		return line
+	}
+	lower, q := strings.ToLower(line), strings.ToLower(query)
+	if len(lower) != len(line) {
+		// Changing case changed the length, so indexes don't carry over.
+		return line
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(lower, q)
+		if i < 0 {
+			b.WriteString(line)
+			return b.String()
+		}
+		b.WriteString(line[:i] + "\x1b[7m" + line[i:i+len(q)] + "\x1b[m")
+		line, lower = line[i+len(q):], lower[i+len(q):]
+	}
+}
+
+// wrap splits text into lines no wider than width, breaking long lines at
+// the last space that fits, or mid-word if there is none.
+func wrap(text string, width int) []string {
+	width = max(width, 1)
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		line = strings.ReplaceAll(line, "\t", "    ")
+		for {
+			r := []rune(line)
+			if len(r) <= width {
+				lines = append(lines, line)
+				break
+			}
+			cut := width
+			if i := strings.LastIndex(string(r[:width]), " "); i > 0 {
+				cut = len([]rune(string(r[:width])[:i])) + 1
+			}
+			lines = append(lines, strings.TrimRight(string(r[:cut]), " "))
+			line = string(r[cut:])
+		}
+	}
+	return lines
+}
@@ -0,0 +1,88 @@
+// Package pager shows text too long for the terminal a screen at a time,
+// in $PAGER, or less, or else a built-in pager with search.
+package pager
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bduffany/gpt-cli/internal/codeblock"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/chzyer/readline"
+	"github.com/mattn/go-isatty"
+)
+
+// Page shows text in $PAGER, or in less if $PAGER isn't set, or in the
+// built-in pager if less isn't installed either. It returns once the user
+// quits the pager.
+func Page(text string) error {
+	args := strings.Fields(os.Getenv("PAGER"))
+	if len(args) == 0 {
+		if _, err := exec.LookPath("less"); err == nil {
+			// -R shows colors, and -F exits at once if the text fits.
+			args = []string{"less", "-RF"}
+		}
+	}
+	if len(args) == 0 {
+		return pageBuiltin(text)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Rows returns the number of rows that text takes up on a terminal of the
+// given width, counting lines that wrap once per row.
+func Rows(text string, width int) int {
+	width = max(width, 1)
+	rows := 0
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		rows += max(1, (utf8.RuneCountInString(line)+width-1)/width)
+	}
+	return rows
+}
+
+// TooLong reports whether stdout is a terminal that text doesn't fit on.
+func TooLong(text string) bool {
+	if !isatty.IsTerminal(os.Stdout.Fd()) {
+		return false
+	}
+	width, height, err := readline.GetSize(int(os.Stdout.Fd()))
+	if err != nil || height <= 0 {
+		return false
+	}
+	// Leave a row for the prompt after the text.
+	return Rows(text, width) > height-1
+}
+
+// Register adds /last to a chat, which shows the last reply in a pager,
+// and notes after each interactive reply too long for the terminal that
+// /last can show it.
+func Register(c *chat.Chat) {
+	if c.Commands == nil {
+		c.Commands = map[string]chat.Command{}
+	}
+	c.Commands["last"] = func(ctx context.Context, args string) error {
+		reply := codeblock.LastReply(c.Messages)
+		if reply == "" {
+			io.WriteString(c.Display, chat.Styled(chat.StyleError, "error: no reply to show")+"\n")
+			return nil
+		}
+		if err := Page(reply); err != nil {
+			io.WriteString(c.Display, chat.Styled(chat.StyleError, "error: "+err.Error())+"\n")
+		}
+		return nil
+	}
+	c.ReplyHooks = append(c.ReplyHooks, func(ctx context.Context, reply string) error {
+		if c.Interactive && TooLong(reply) {
+			c.Notef(chat.StyleNote, "That reply is longer than the screen; /last shows it in a pager.")
+		}
+		return nil
+	})
+}
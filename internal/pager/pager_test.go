@@ -0,0 +1,66 @@
+package pager
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRows(t *testing.T) {
+	for _, tc := range []struct {
+		text  string
+		width int
+		want  int
+	}{
+		{"", 80, 1},
+		{"one\ntwo\n", 80, 2},
+		{"one\n\nthree", 80, 3},
+		{"0123456789", 4, 3},
+		{"日本語のテキスト", 4, 2},
+	} {
+		if got := Rows(tc.text, tc.width); got != tc.want {
+			t.Errorf("Rows(%q, %d) = %d, want %d", tc.text, tc.width, got, tc.want)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	got := wrap("the quick brown fox\nabcdefghij\n", 10)
+	want := []string{"the quick", "brown fox", "abcdefghij"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrap = %q, want %q", got, want)
+	}
+	got = wrap("abcdefghijkl", 5)
+	want = []string{"abcde", "fghij", "kl"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrap = %q, want %q", got, want)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	lines := []string{"alpha", "Beta", "gamma", "beta"}
+	for _, tc := range []struct {
+		from    int
+		forward bool
+		want    int
+	}{
+		{0, true, 1},
+		{1, true, 3},
+		{3, true, 1},
+		{3, false, 1},
+		{1, false, 3},
+	} {
+		got, ok := search(lines, "beta", tc.from, tc.forward)
+		if !ok || got != tc.want {
+			t.Errorf("search from %d, forward %t = %d, %t, want %d", tc.from, tc.forward, got, ok, tc.want)
+		}
+	}
+	if _, ok := search(lines, "delta", 0, true); ok {
+		t.Errorf("search found a line without the query")
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	if got, want := highlight("Go go GO", "go"), "\x1b[7mGo\x1b[m \x1b[7mgo\x1b[m \x1b[7mGO\x1b[m"; got != want {
+		t.Errorf("highlight = %q, want %q", got, want)
+	}
+}
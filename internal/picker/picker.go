@@ -0,0 +1,184 @@
+// Package picker implements a minimal full-width terminal list picker with
+// fuzzy filtering.
+package picker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/chzyer/readline"
+)
+
+// ErrCanceled is returned when the user exits the picker without choosing.
+var ErrCanceled = errors.New("canceled")
+
+type Item struct {
+	// Key is the text matched against the filter query.
+	Key string
+	// Label is the text displayed for the item.
+	Label string
+}
+
+// Pick shows the items on the terminal and returns the index of the item the
+// user chooses. Typing filters the list, arrow keys move the selection, Enter
+// chooses, and Esc or Ctrl+C cancels.
+func Pick(prompt, header string, items []Item) (int, error) {
+	in := int(os.Stdin.Fd())
+	state, err := readline.MakeRaw(in)
+	if err != nil {
+		return -1, err
+	}
+	defer readline.Restore(in, state)
+
+	p := &picker{out: os.Stdout, prompt: prompt, header: header, items: items}
+	p.filter()
+	defer p.clear()
+	buf := make([]byte, 16)
+	for {
+		p.render()
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return -1, err
+		}
+		key := string(buf[:n])
+		switch key {
+		case "\r", "\n":
+			if len(p.matches) == 0 {
+				continue
+			}
+			return p.matches[p.selected], nil
+		case "\x03", "\x1b":
+			return -1, ErrCanceled
+		case "\x1b[A", "\x10": // Up, Ctrl+P
+			p.selected = max(p.selected-1, 0)
+		case "\x1b[B", "\x0e": // Down, Ctrl+N
+			p.selected = min(p.selected+1, max(len(p.matches)-1, 0))
+		case "\x7f", "\x08": // Backspace
+			if q := []rune(p.query); len(q) > 0 {
+				p.query = string(q[:len(q)-1])
+				p.filter()
+			}
+		case "\x15": // Ctrl+U
+			p.query = ""
+			p.filter()
+		default:
+			if strings.HasPrefix(key, "\x1b") {
+				continue
+			}
+			for _, r := range key {
+				if unicode.IsPrint(r) {
+					p.query += string(r)
+				}
+			}
+			p.filter()
+		}
+	}
+}
+
+type picker struct {
+	out    io.Writer
+	prompt string
+	header string
+	items  []Item
+	query  string
+	// matches are indexes into items, best match first.
+	matches  []int
+	selected int
+}
+
+func (p *picker) filter() {
+	type match struct {
+		index int
+		score int
+	}
+	var ms []match
+	for i, item := range p.items {
+		if score, ok := fuzzyScore(strings.ToLower(item.Key), strings.ToLower(p.query)); ok {
+			ms = append(ms, match{i, score})
+		}
+	}
+	sort.SliceStable(ms, func(i, j int) bool { return ms[i].score > ms[j].score })
+	p.matches = p.matches[:0]
+	for _, m := range ms {
+		p.matches = append(p.matches, m.index)
+	}
+	p.selected = 0
+}
+
+// fuzzyScore reports whether all runes of query appear in s in order, and
+// scores the match higher when matched runes are adjacent or near the start.
+func fuzzyScore(s, query string) (int, bool) {
+	score := 0
+	pos := 0
+	prev := -2
+	rs := []rune(s)
+	for _, q := range query {
+		found := false
+		for ; pos < len(rs); pos++ {
+			if rs[pos] == q {
+				if pos == prev+1 {
+					score += 3
+				}
+				if pos == 0 {
+					score += 2
+				}
+				score -= pos / 8
+				prev = pos
+				pos++
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return score, true
+}
+
+// clear erases the picker. The cursor is always left on the prompt line
+// after rendering, so everything from there down is cleared.
+func (p *picker) clear() {
+	io.WriteString(p.out, "\r\x1b[J")
+}
+
+func (p *picker) render() {
+	width, height, err := readline.GetSize(int(os.Stdout.Fd()))
+	if err != nil || height <= 0 {
+		width, height = 80, 24
+	}
+	visible := max(height-3, 1)
+	p.clear()
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s\r\n", p.prompt, p.query)
+	fmt.Fprintf(&b, "\x1b[90m%s\x1b[m\r\n", truncate(p.header, width))
+	start := 0
+	if p.selected >= visible {
+		start = p.selected - visible + 1
+	}
+	lines := 2
+	for i := start; i < len(p.matches) && i < start+visible; i++ {
+		label := truncate(p.items[p.matches[i]].Label, width)
+		if i == p.selected {
+			label = "\x1b[7m" + label + "\x1b[m"
+		}
+		b.WriteString(label + "\r\n")
+		lines++
+	}
+	// Move the cursor back to the end of the query.
+	fmt.Fprintf(&b, "\x1b[%dA\r\x1b[%dC", lines, len([]rune(p.prompt+" "+p.query)))
+	io.WriteString(p.out, b.String())
+}
+
+func truncate(s string, width int) string {
+	rs := []rune(s)
+	if len(rs) <= width-1 {
+		return s
+	}
+	return string(rs[:width-1])
+}
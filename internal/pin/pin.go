@@ -0,0 +1,207 @@
+// Package pin keeps files pinned into a chat's context. Pinned files are
+// re-read before each request, so the model always sees their current
+// contents, without piling up old copies in the history.
+package pin
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/internal/models"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+// Set is the files pinned into a chat.
+type Set struct {
+	files []*file
+}
+
+type file struct {
+	path string
+	// sent is the hash of the contents last sent to the model, if any.
+	sent *[sha256.Size]byte
+	// tokens is an estimate of the tokens last sent.
+	tokens int
+	// missing is set once the file can't be read.
+	missing bool
+}
+
+// Register adds the /add, /drop, and /context commands to a chat, and
+// sends the pinned files with each request.
+func (s *Set) Register(c *chat.Chat) {
+	if c.Commands == nil {
+		c.Commands = map[string]chat.Command{}
+	}
+	c.Commands["add"] = func(ctx context.Context, args string) error {
+		return s.report(c.Display, s.Add(strings.Fields(args)...))
+	}
+	c.Commands["drop"] = func(ctx context.Context, args string) error {
+		return s.report(c.Display, s.Drop(strings.Fields(args)...))
+	}
+	c.Commands["context"] = func(ctx context.Context, args string) error {
+		if args != "" && args != "list" {
+			return s.report(c.Display, fmt.Errorf("usage: /context [list]"))
+		}
+		s.List(c.Display, c.Messages, c.Model)
+		return nil
+	}
+	c.MessageHooks = append(c.MessageHooks, func(ctx context.Context, messages []llm.Message) ([]llm.Message, error) {
+		return s.Insert(c.Display, messages), nil
+	})
+}
+
+// report shows a command's error, rather than ending the chat.
+func (s *Set) report(w io.Writer, err error) error {
+	if err != nil {
+		io.WriteString(w, chat.Styled(chat.StyleError, "error: "+err.Error())+"\n")
+	}
+	return nil
+}
+
+// Add pins files, expanding globs.
+func (s *Set) Add(patterns ...string) error {
+	if len(patterns) == 0 {
+		return fmt.Errorf("usage: /add FILE ...")
+	}
+	for _, pattern := range patterns {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		if len(paths) == 0 {
+			return fmt.Errorf("no files match %q", pattern)
+		}
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return fmt.Errorf("%s is a directory", path)
+			}
+			if s.find(path) < 0 {
+				s.files = append(s.files, &file{path: filepath.Clean(path)})
+			}
+		}
+	}
+	return nil
+}
+
+// Drop unpins files, or all files if none are given.
+func (s *Set) Drop(paths ...string) error {
+	if len(paths) == 0 {
+		s.files = nil
+		return nil
+	}
+	for _, path := range paths {
+		i := s.find(path)
+		if i < 0 {
+			return fmt.Errorf("%s is not pinned", path)
+		}
+		s.files = append(s.files[:i], s.files[i+1:]...)
+	}
+	return nil
+}
+
+func (s *Set) find(path string) int {
+	for i, f := range s.files {
+		if f.path == filepath.Clean(path) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Insert returns messages with the current contents of the pinned files
+// added after the leading system messages. Files that changed since the
+// model last saw them are reported to w.
+func (s *Set) Insert(w io.Writer, messages []llm.Message) []llm.Message {
+	if len(s.files) == 0 {
+		return messages
+	}
+	var b strings.Builder
+	b.WriteString("The user pinned these files to the conversation. They are re-read before each message, so this is their current content, which takes precedence over any earlier version.\n")
+	for _, f := range s.files {
+		content, err := os.ReadFile(f.path)
+		if err != nil {
+			if !f.missing {
+				io.WriteString(w, chat.Styled(chat.StyleWarning, "warning: pinned file "+f.path+" can't be read: "+err.Error())+"\n")
+			}
+			f.missing = true
+			fmt.Fprintf(&b, "\n%s: (missing)\n", f.path)
+			continue
+		}
+		f.missing = false
+		sum := sha256.Sum256(content)
+		if f.sent != nil && *f.sent != sum {
+			io.WriteString(w, chat.Styled(chat.StyleNote, "Pinned file "+f.path+" changed; sending the new version.")+"\n")
+		}
+		f.sent = &sum
+		section := fmt.Sprintf("\n%s:\n```\n%s\n```\n", f.path, strings.TrimSuffix(string(content), "\n"))
+		f.tokens = estimateTokens(section)
+		b.WriteString(section)
+	}
+	n := 0
+	for n < len(messages) && messages[n].Role == llm.RoleSystem {
+		n++
+	}
+	out := append([]llm.Message{}, messages[:n]...)
+	out = append(out, llm.Message{Role: llm.RoleSystem, Content: b.String()})
+	return append(out, messages[n:]...)
+}
+
+// List shows the estimated tokens used by each part of the context.
+func (s *Set) List(w io.Writer, messages []llm.Message, model string) {
+	var system, history int
+	for _, m := range messages {
+		if m.Role == llm.RoleSystem {
+			system += estimateTokens(m.Content)
+		} else {
+			history += estimateTokens(m.Content)
+		}
+	}
+	total := system + history
+	fmt.Fprintf(w, "%8d  system prompt\n", system)
+	fmt.Fprintf(w, "%8d  conversation (%d messages)\n", history, len(messages))
+	for _, f := range s.files {
+		tokens, note := f.tokens, ""
+		if f.sent == nil {
+			// Not sent yet; estimate from the file as it is now.
+			if info, err := os.Stat(f.path); err == nil {
+				tokens = int(info.Size()) / bytesPerToken
+			}
+			note = " (not sent yet)"
+		} else if stale(f) {
+			note = " (changed on disk; will be re-sent)"
+		}
+		if f.missing {
+			note = " (missing)"
+		}
+		total += tokens
+		fmt.Fprintf(w, "%8d  %s%s\n", tokens, f.path, note)
+	}
+	fmt.Fprintf(w, "%8d  total (estimated)", total)
+	if m, ok := models.Lookup(model); ok && m.ContextWindow > 0 {
+		fmt.Fprintf(w, ", %.1f%% of %d", 100*float64(total)/float64(m.ContextWindow), m.ContextWindow)
+	}
+	io.WriteString(w, "\n")
+}
+
+// stale reports whether a file changed since it was last sent.
+func stale(f *file) bool {
+	content, err := os.ReadFile(f.path)
+	return err != nil || sha256.Sum256(content) != *f.sent
+}
+
+// bytesPerToken is a rough average for English text and code.
+const bytesPerToken = 4
+
+func estimateTokens(s string) int {
+	return (len(s) + bytesPerToken - 1) / bytesPerToken
+}
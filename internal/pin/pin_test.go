@@ -0,0 +1,56 @@
+package pin
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+func TestInsert(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("v1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Set{}
+	if err := s.Add(path); err != nil {
+		t.Fatal(err)
+	}
+	messages := []llm.Message{
+		{Role: llm.RoleSystem, Content: "Be brief."},
+		{Role: llm.RoleUser, Content: "Hi"},
+	}
+	display := &bytes.Buffer{}
+	got := s.Insert(display, messages)
+	if len(got) != 3 || got[1].Role != llm.RoleSystem || !strings.Contains(got[1].Content, "```\nv1\n```") {
+		t.Fatalf("got %q, want the file after the system prompt", got)
+	}
+
+	// Files are re-read on each request, noting changes.
+	if err := os.WriteFile(path, []byte("v2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	list := &bytes.Buffer{}
+	s.List(list, messages, "")
+	if !strings.Contains(list.String(), "changed on disk") {
+		t.Errorf("list doesn't show the file as changed:\n%s", list)
+	}
+	got = s.Insert(display, messages)
+	if !strings.Contains(got[1].Content, "```\nv2\n```") {
+		t.Errorf("got %q, want the new version", got[1].Content)
+	}
+	if !strings.Contains(display.String(), "changed; sending the new version") {
+		t.Errorf("display = %q, want a note about the change", display)
+	}
+
+	if err := s.Drop(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Insert(display, messages); len(got) != 2 {
+		t.Errorf("got %d messages after dropping the file, want 2", len(got))
+	}
+}
@@ -0,0 +1,98 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/bduffany/gpt-cli/internal/auto"
+	"github.com/bduffany/gpt-cli/internal/config"
+)
+
+// ConfigFile is the name of the project config file, usually checked into
+// the repo root.
+const ConfigFile = ".gpt.yaml"
+
+// Config is a project's settings, which apply when gpt runs anywhere in
+// the project, over those in the user's config file. Paths are relative to
+// the directory containing the file.
+type Config struct {
+	// Path is the path of the file the config was read from.
+	Path string `yaml:"-"`
+
+	// Model is the default model, used when -model is not set.
+	Model string `yaml:"model,omitempty"`
+	// System is the system prompt, used when -system is not set.
+	System string `yaml:"system,omitempty"`
+	// Pin are files or globs pinned into chat sessions, as with /add. They
+	// must be inside the project.
+	Pin []string `yaml:"pin,omitempty"`
+	// Tools sets the permissions of -auto tools, like the tools of a policy
+	// file. They only apply where they're stricter than the user's policy.
+	Tools map[string]auto.Permission `yaml:"tools,omitempty"`
+	// RAG is the path of an index built with `gpt index`, used when -rag
+	// is not set.
+	RAG string `yaml:"rag,omitempty"`
+}
+
+// LoadConfig reads the project config that applies to dir: the nearest
+// .gpt.yaml in dir or its parents, up to the git root. Outside a repo, only
+// dir is checked. It returns nil if there is none. Includes and env vars
+// are handled as by config.ReadFile.
+func LoadConfig(dir string) (*Config, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	root := Root(dir)
+	for {
+		path := filepath.Join(dir, ConfigFile)
+		cfg := &Config{}
+		err := config.ReadFile(path, cfg)
+		if err == nil {
+			cfg.Path = path
+			if err := cfg.check(); err != nil {
+				return nil, err
+			}
+			return cfg, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if root == "" || dir == root {
+			return nil, nil
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func (c *Config) check() error {
+	for _, p := range c.Pin {
+		if !filepath.IsLocal(p) {
+			return fmt.Errorf("%s: pinned file %q is outside the project", c.Path, p)
+		}
+	}
+	// Check the permissions now, rather than when -auto starts.
+	if _, err := (*auto.Policy)(nil).Restrict(c.Tools); err != nil {
+		return fmt.Errorf("%s: %w", c.Path, err)
+	}
+	return nil
+}
+
+// Resolve returns the path of a file named in the config, which is relative
+// to the directory containing the config file, as a path relative to the
+// working directory.
+func (c *Config) Resolve(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	path = filepath.Join(filepath.Dir(c.Path), path)
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil {
+			return rel
+		}
+	}
+	return path
+}
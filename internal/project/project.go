@@ -0,0 +1,69 @@
+// Package project finds settings that apply to the project containing a
+// directory, such as instructions for the model checked into the repo.
+package project
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// InstructionFiles are the names of project instruction files, in order of
+// precedence. Only the first found in each directory is used.
+var InstructionFiles = []string{"AGENTS.md", "CLAUDE.md", filepath.Join(".gpt", "instructions.md")}
+
+// Root returns the root of the git repo containing dir, or "" if there is
+// none.
+func Root(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Instructions returns the project instructions that apply to dir. They're
+// read from each directory from the repo root down to dir, so that more
+// specific instructions come last. Outside a repo, only dir is checked.
+func Instructions(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	dirs := []string{dir}
+	if root := Root(dir); root != "" {
+		for d := dir; d != root; {
+			d = filepath.Dir(d)
+			dirs = append([]string{d}, dirs...)
+		}
+	}
+	var parts []string
+	for _, d := range dirs {
+		for _, name := range InstructionFiles {
+			path := filepath.Join(d, name)
+			b, err := os.ReadFile(path)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+			if s := strings.TrimSpace(string(b)); s != "" {
+				rel, _ := filepath.Rel(dir, path)
+				parts = append(parts, fmt.Sprintf("Project instructions from %s:\n\n%s", filepath.ToSlash(rel), s))
+			}
+			break
+		}
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
@@ -0,0 +1,74 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInstructions(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "repo")
+	for path, content := range map[string]string{
+		"../AGENTS.md":             "Outside the repo.",
+		".git/HEAD":                "ref: refs/heads/main\n",
+		"AGENTS.md":                "Root instructions.\n",
+		"CLAUDE.md":                "Shadowed by AGENTS.md.",
+		"a/b/.gpt/instructions.md": "Sub instructions.",
+	} {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sub := filepath.Join(root, "a", "b")
+	if got := Root(sub); got != root {
+		t.Errorf("Root = %q, want %q", got, root)
+	}
+	got, err := Instructions(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Project instructions from ../../AGENTS.md:\n\nRoot instructions.\n\nProject instructions from .gpt/instructions.md:\n\nSub instructions."
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "repo")
+	sub := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(filepath.Join(root, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(sub)
+	if cfg != nil || err != nil {
+		t.Fatalf("got %v, %v without a config, want nil, nil", cfg, err)
+	}
+
+	path := filepath.Join(root, ConfigFile)
+	if err := os.WriteFile(path, []byte("model: gpt-4.1\nsystem: Answer in Go.\npin: [docs/*.md]\ntools:\n  write: ask\nrag: .gpt/index\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = LoadConfig(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Path != path || cfg.Model != "gpt-4.1" || cfg.System != "Answer in Go." || len(cfg.Pin) != 1 || cfg.Tools["write"] != "ask" {
+		t.Errorf("got %+v", cfg)
+	}
+
+	for _, content := range []string{"pin: [../secrets.txt]\n", "tools:\n  write: maybe\n"} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadConfig(sub); err == nil {
+			t.Errorf("got no error for %q", content)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+// Package rag indexes local files as embedded chunks, and retrieves the most
+// relevant chunks for a prompt.
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/internal/log"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+const (
+	// DefaultFilename is the name of the index file written to the root of an
+	// indexed directory, unless another path is given.
+	DefaultFilename = ".gpt-index.json"
+
+	DefaultModel = "text-embedding-3-small"
+
+	// Files larger than this are assumed not to be source or docs.
+	maxFileSize = 1 << 20
+	batchSize   = 100
+)
+
+type Index struct {
+	// Root is the absolute path of the indexed directory.
+	Root   string   `json:"root"`
+	Model  string   `json:"model"`
+	Chunks []*Chunk `json:"chunks"`
+}
+
+type Chunk struct {
+	// Path is relative to the index root.
+	Path      string    `json:"path"`
+	StartLine int       `json:"start_line"`
+	EndLine   int       `json:"end_line"`
+	Text      string    `json:"text"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// Source returns the chunk location as path:start-end.
+func (c *Chunk) Source() string {
+	return fmt.Sprintf("%s:%d-%d", c.Path, c.StartLine, c.EndLine)
+}
+
+type BuildOptions struct {
+	Model string
+	// ChunkLines is the max number of lines per chunk.
+	ChunkLines int
+}
+
+// Build chunks and embeds all text files under dir. Hidden files and
+// directories are skipped.
+func Build(ctx context.Context, client *openai.Client, dir string, opts BuildOptions) (*Index, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Model == "" {
+		opts.Model = DefaultModel
+	}
+	if opts.ChunkLines <= 0 {
+		opts.ChunkLines = 60
+	}
+	ix := &Index{Root: root, Model: opts.Model}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && (strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > maxFileSize {
+			log.Debugf("Skipping large file %s", path)
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.IndexByte(b, 0) >= 0 {
+			log.Debugf("Skipping binary file %s", path)
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		ix.Chunks = append(ix.Chunks, chunkLines(filepath.ToSlash(rel), string(b), opts.ChunkLines)...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for start := 0; start < len(ix.Chunks); start += batchSize {
+		batch := ix.Chunks[start:min(start+batchSize, len(ix.Chunks))]
+		inputs := make([]string, len(batch))
+		for i, c := range batch {
+			inputs[i] = c.Path + "\n" + c.Text
+		}
+		vectors, err := client.CreateEmbeddings(ctx, &openai.EmbeddingRequest{Model: ix.Model, Input: inputs})
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range vectors {
+			batch[i].Embedding = toFloat32(v)
+		}
+		log.Debugf("Embedded %d/%d chunks", start+len(batch), len(ix.Chunks))
+	}
+	return ix, nil
+}
+
+// chunkLines splits text into chunks of at most n lines. Consecutive chunks
+// overlap slightly so that context spanning a boundary isn't lost.
+func chunkLines(path, text string, n int) []*Chunk {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	overlap := n / 6
+	var chunks []*Chunk
+	for start := 0; start < len(lines); start += n - overlap {
+		end := min(start+n, len(lines))
+		chunkText := strings.Join(lines[start:end], "\n")
+		if strings.TrimSpace(chunkText) != "" {
+			chunks = append(chunks, &Chunk{
+				Path:      path,
+				StartLine: start + 1,
+				EndLine:   end,
+				Text:      chunkText,
+			})
+		}
+		if end == len(lines) {
+			break
+		}
+	}
+	return chunks
+}
+
+// Load reads an index from path. If path is a directory, the index is read
+// from the default index file in that directory.
+func Load(path string) (*Index, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, DefaultFilename)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ix := &Index{}
+	if err := json.Unmarshal(b, ix); err != nil {
+		return nil, fmt.Errorf("parse index %s: %w", path, err)
+	}
+	return ix, nil
+}
+
+func (ix *Index) Save(path string) error {
+	b, err := json.Marshal(ix)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// Search returns the k chunks most similar to the query.
+func (ix *Index) Search(ctx context.Context, client *openai.Client, query string, k int) ([]*Chunk, error) {
+	vectors, err := client.CreateEmbeddings(ctx, &openai.EmbeddingRequest{Model: ix.Model, Input: []string{query}})
+	if err != nil {
+		return nil, err
+	}
+	q := toFloat32(vectors[0])
+	type scored struct {
+		chunk *Chunk
+		score float64
+	}
+	results := make([]scored, len(ix.Chunks))
+	for i, c := range ix.Chunks {
+		results[i] = scored{c, cosine(q, c.Embedding)}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].score > results[j].score })
+	var top []*Chunk
+	for i := 0; i < k && i < len(results); i++ {
+		top = append(top, results[i].chunk)
+	}
+	return top, nil
+}
+
+// Register adds the excerpts of the index most relevant to the latest
+// prompt of a chat to each of its requests, leaving them out of the
+// history, so that they aren't sent again with later prompts or saved with
+// the session. The excerpts are looked up once per prompt, rather than
+// again for each continuation or retry.
+func (ix *Index) Register(c *chat.Chat, client *openai.Client, k int) {
+	var prompt, augmented string
+	c.MessageHooks = append(c.MessageHooks, func(ctx context.Context, messages []llm.Message) ([]llm.Message, error) {
+		i := len(messages) - 1
+		for i >= 0 && (messages[i].Role != llm.RoleUser || messages[i].Content == chat.ContinuePrompt) {
+			i--
+		}
+		if i < 0 {
+			return messages, nil
+		}
+		if messages[i].Content != prompt {
+			chunks, err := ix.Search(ctx, client, messages[i].Content, k)
+			if err != nil {
+				return nil, fmt.Errorf("rag: %w", err)
+			}
+			prompt, augmented = messages[i].Content, Augment(messages[i].Content, chunks)
+		}
+		messages = append([]llm.Message{}, messages...)
+		messages[i].Content = augmented
+		return messages, nil
+	})
+}
+
+// Augment returns the prompt prefixed with the given chunks, along with
+// instructions to cite them.
+func Augment(prompt string, chunks []*Chunk) string {
+	if len(chunks) == 0 {
+		return prompt
+	}
+	var b strings.Builder
+	b.WriteString("Answer using the following excerpts from local files where relevant. When you use an excerpt, cite it inline by its source, like [path:10-20].\n\n")
+	for _, c := range chunks {
+		fmt.Fprintf(&b, "<excerpt source=%q>\n%s\n</excerpt>\n\n", c.Source(), c.Text)
+	}
+	b.WriteString("Question: ")
+	b.WriteString(prompt)
+	return b.String()
+}
+
+func toFloat32(v []float64) []float32 {
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = float32(x)
+	}
+	return out
+}
+
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := 0; i < len(a) && i < len(b); i++ {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
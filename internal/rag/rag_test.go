@@ -0,0 +1,137 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/llm/llmtest"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+// numberedLines returns lines "1" to "n", each ending with a newline.
+func numberedLines(n int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "%d\n", i)
+	}
+	return b.String()
+}
+
+func TestChunkLines(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		text string
+		n    int
+		want []string
+	}{
+		// 12-line chunks overlap by 2 lines, so each starts 10 lines after
+		// the last.
+		{"overlap", numberedLines(30), 12, []string{"1-12", "11-22", "21-30"}},
+		{"last chunk ends at the end", numberedLines(22), 12, []string{"1-12", "11-22"}},
+		{"shorter than a chunk", numberedLines(5), 60, []string{"1-5"}},
+		{"no trailing newline", "a\nb\nc", 60, []string{"1-3"}},
+		{"blank", "\n\n  \n", 60, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, c := range chunkLines("f.go", tc.text, tc.n) {
+				got = append(got, fmt.Sprintf("%d-%d", c.StartLine, c.EndLine))
+				lines := strings.Split(strings.TrimSuffix(tc.text, "\n"), "\n")
+				if want := strings.Join(lines[c.StartLine-1:c.EndLine], "\n"); c.Text != want {
+					t.Errorf("chunk %s text = %q, want %q", c.Source(), c.Text, want)
+				}
+			}
+			if strings.Join(got, " ") != strings.Join(tc.want, " ") {
+				t.Errorf("chunks = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&openai.EmbeddingResponse{Data: []*openai.Embedding{{Embedding: []float64{1, 0}}}})
+	}))
+	defer srv.Close()
+	client := &openai.Client{BaseURL: srv.URL}
+	ix := &Index{Chunks: []*Chunk{
+		{Path: "unrelated", Embedding: []float32{0, 1}},
+		{Path: "close", Embedding: []float32{1, 1}},
+		{Path: "closest", Embedding: []float32{2, 0.1}},
+		{Path: "opposite", Embedding: []float32{-1, 0}},
+	}}
+	for k, want := range map[int]string{
+		1:  "closest",
+		2:  "closest close",
+		10: "closest close unrelated opposite",
+	} {
+		chunks, err := ix.Search(context.Background(), client, "query", k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, c := range chunks {
+			got = append(got, c.Path)
+		}
+		if strings.Join(got, " ") != want {
+			t.Errorf("Search with k=%d = %v, want %s", k, got, want)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	searches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		searches++
+		json.NewEncoder(w).Encode(&openai.EmbeddingResponse{Data: []*openai.Embedding{{Embedding: []float64{1, 0}}}})
+	}))
+	defer srv.Close()
+	ix := &Index{Chunks: []*Chunk{{Path: "notes.md", StartLine: 1, EndLine: 1, Text: "x is 42", Embedding: []float32{1, 0}}}}
+	client := llmtest.NewClient(llmtest.Truncated("x is"), llmtest.Text(" 42"), llmtest.Text("y is 7"))
+	c, err := chat.New(client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Display = io.Discard
+	ix.Register(c, &openai.Client{BaseURL: srv.URL}, 1)
+
+	read := func(reply *chat.Reply, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.ReadAll(reply)
+		reply.Close()
+	}
+	ctx := context.Background()
+	read(c.Send(ctx, "What is x?"))
+	read(c.Continue(ctx))
+	read(c.Send(ctx, "And y?"))
+
+	reqs := client.Requests()
+	augmented := func(req *llm.Request, i int) bool {
+		return strings.Contains(req.Messages[i].Content, "<excerpt source=\"notes.md:1-1\">")
+	}
+	if !augmented(reqs[0], 0) || !augmented(reqs[1], 0) {
+		t.Errorf("the first prompt wasn't sent with excerpts, or lost them when continued")
+	}
+	if augmented(reqs[2], 0) || !augmented(reqs[2], 2) {
+		t.Errorf("the excerpts weren't moved to the second prompt")
+	}
+	if searches != 2 {
+		t.Errorf("searched %d times, want once per prompt", searches)
+	}
+	for _, m := range c.Messages {
+		if strings.Contains(m.Content, "<excerpt") {
+			t.Errorf("excerpts were kept in the history: %q", m.Content)
+		}
+	}
+}
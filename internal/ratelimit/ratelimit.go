@@ -0,0 +1,225 @@
+// Package ratelimit limits the requests and tokens sent to models each
+// minute, so that batches and agent loops wait their turn instead of
+// failing with rate limit errors from the provider.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+// Limit limits the requests to the models matching a pattern.
+type Limit struct {
+	// Model is a glob matching model names, like "gpt-5*", or "*" for all
+	// models.
+	Model string `yaml:"model"`
+	// RPM is the max requests per minute, and TPM the max input and output
+	// tokens per minute. 0 means no limit.
+	RPM int `yaml:"rpm,omitempty"`
+	TPM int `yaml:"tpm,omitempty"`
+}
+
+// DefaultCooldown is how long requests wait after the provider refuses one
+// for its rate limit, if the provider doesn't say how long.
+const DefaultCooldown = 10 * time.Second
+
+// bytesPerToken is a rough average for English text and code, for
+// estimating the tokens of a request before it's sent.
+const bytesPerToken = 4
+
+// Limiter holds requests until they're within their limits. The first
+// Limit matching a request's model applies, and requests to all the models
+// it matches share its budget.
+type Limiter struct {
+	// Notef reports waits of a second or more. Nil means they aren't
+	// reported.
+	Notef func(format string, args ...any)
+
+	windows []*window
+	// now and sleep are the clock, replaced in tests.
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// New returns a limiter enforcing limits.
+func New(limits []Limit) (*Limiter, error) {
+	l := &Limiter{now: time.Now, sleep: sleep}
+	for _, lim := range limits {
+		if _, err := path.Match(lim.Model, ""); err != nil || lim.Model == "" {
+			return nil, fmt.Errorf("rate limit: invalid model pattern %q", lim.Model)
+		}
+		if lim.RPM < 0 || lim.TPM < 0 || lim.RPM+lim.TPM == 0 {
+			return nil, fmt.Errorf("rate limit for %s: set rpm or tpm to a positive number", lim.Model)
+		}
+		l.windows = append(l.windows, &window{limit: lim})
+	}
+	return l, nil
+}
+
+// Middleware makes requests through next wait for their limits.
+func (l *Limiter) Middleware(next llm.CompletionClient) llm.CompletionClient {
+	return llm.ClientFunc(func(ctx context.Context, req *llm.Request) (llm.Stream, error) {
+		w := l.window(req.Model)
+		if w == nil {
+			return next.GetCompletion(ctx, req)
+		}
+		e, err := l.acquire(ctx, w, estimateTokens(req))
+		if err != nil {
+			return nil, err
+		}
+		s, err := next.GetCompletion(ctx, req)
+		if wait, ok := llm.IsRateLimited(err); ok {
+			if wait <= 0 {
+				wait = DefaultCooldown
+			}
+			w.pause(l.now().Add(wait))
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &stream{Stream: s, w: w, e: e}, nil
+	})
+}
+
+func (l *Limiter) window(model string) *window {
+	for _, w := range l.windows {
+		if ok, _ := path.Match(w.limit.Model, model); ok {
+			return w
+		}
+	}
+	return nil
+}
+
+// acquire waits until a request of the given tokens fits in w, then
+// records it.
+func (l *Limiter) acquire(ctx context.Context, w *window, tokens int) (*entry, error) {
+	for {
+		now := l.now()
+		e, wait := w.reserve(now, tokens)
+		if e != nil {
+			return e, nil
+		}
+		if wait >= time.Second && l.Notef != nil {
+			l.Notef("Waiting %s for the rate limit on %s.", wait.Round(time.Second), w.limit.Model)
+		}
+		if err := l.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// window tracks the requests sent under a Limit in the last minute.
+type window struct {
+	limit Limit
+
+	mu sync.Mutex
+	// entries are the requests sent in the last minute, oldest first.
+	entries []*entry
+	// until is when requests may be sent again after the provider refused
+	// one for its rate limit.
+	until time.Time
+}
+
+type entry struct {
+	at     time.Time
+	tokens int
+}
+
+// reserve records a request sent now if it's within the limits, or else
+// returns how long to wait before trying again. A request with more tokens
+// than the whole TPM limit is sent once nothing else is in the window.
+func (w *window) reserve(now time.Time, tokens int) (*entry, time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if now.Before(w.until) {
+		return nil, w.until.Sub(now)
+	}
+	i := 0
+	for i < len(w.entries) && now.Sub(w.entries[i].at) >= time.Minute {
+		i++
+	}
+	w.entries = w.entries[i:]
+	expire := func(e *entry) time.Duration {
+		return e.at.Add(time.Minute).Sub(now)
+	}
+	if w.limit.RPM > 0 && len(w.entries) >= w.limit.RPM {
+		return nil, expire(w.entries[len(w.entries)-w.limit.RPM])
+	}
+	if w.limit.TPM > 0 && len(w.entries) > 0 {
+		used := 0
+		for _, e := range w.entries {
+			used += e.tokens
+		}
+		// Wait for enough of the oldest requests to leave the window.
+		for _, e := range w.entries {
+			if used+tokens <= w.limit.TPM {
+				break
+			}
+			used -= e.tokens
+			if used+tokens <= w.limit.TPM || used == 0 {
+				return nil, expire(e)
+			}
+		}
+	}
+	e := &entry{at: now, tokens: tokens}
+	w.entries = append(w.entries, e)
+	return e, 0
+}
+
+// used corrects the tokens of a request to those it used.
+func (w *window) used(e *entry, tokens int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	e.tokens = tokens
+}
+
+func (w *window) pause(until time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if until.After(w.until) {
+		w.until = until
+	}
+}
+
+// stream records the tokens a request used once its usage is reported.
+type stream struct {
+	llm.Stream
+	w *window
+	e *entry
+}
+
+func (s *stream) Next() (llm.Event, error) {
+	e, err := s.Stream.Next()
+	if u, ok := e.(*llm.Usage); ok {
+		s.w.used(s.e, u.TotalTokens())
+	}
+	return e, err
+}
+
+// estimateTokens estimates the input tokens of a request from its length.
+func estimateTokens(req *llm.Request) int {
+	n := 0
+	for _, m := range req.Messages {
+		n += len(m.Content)
+		for _, tc := range m.ToolCalls {
+			n += len(tc.Arguments)
+		}
+	}
+	return (n + bytesPerToken - 1) / bytesPerToken
+}
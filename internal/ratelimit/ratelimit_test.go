@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/llm/llmtest"
+)
+
+// fakeClock advances only when slept on, and records the sleeps.
+type fakeClock struct {
+	t      time.Time
+	sleeps []time.Duration
+}
+
+func newLimiter(t *testing.T, limits ...Limit) (*Limiter, *fakeClock) {
+	t.Helper()
+	l, err := New(limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{t: time.Unix(0, 0)}
+	l.now = func() time.Time { return clock.t }
+	l.sleep = func(ctx context.Context, d time.Duration) error {
+		clock.sleeps = append(clock.sleeps, d)
+		clock.t = clock.t.Add(d)
+		return nil
+	}
+	return l, clock
+}
+
+func send(t *testing.T, c llm.CompletionClient, model, prompt string) error {
+	t.Helper()
+	s, err := c.GetCompletion(context.Background(), &llm.Request{Model: model, Messages: []llm.Message{{Role: llm.RoleUser, Content: prompt}}})
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	for {
+		if _, err := s.Next(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func TestRPM(t *testing.T) {
+	l, clock := newLimiter(t, Limit{Model: "gpt-5*", RPM: 2})
+	backend := llmtest.NewClient(llmtest.Text("a"), llmtest.Text("b"), llmtest.Text("c"), llmtest.Text("d"), llmtest.Text("e"))
+	c := l.Middleware(backend)
+	for _, model := range []string{"gpt-5", "gpt-5-mini", "gpt-5", "gpt-4.1", "gpt-4.1"} {
+		if err := send(t, c, model, "Hi"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The third gpt-5* request waits for the first to leave the window, and
+	// other models aren't limited.
+	if want := []time.Duration{time.Minute}; !reflect.DeepEqual(clock.sleeps, want) {
+		t.Errorf("slept %v, want %v", clock.sleeps, want)
+	}
+}
+
+func TestTPM(t *testing.T) {
+	l, clock := newLimiter(t, Limit{Model: "*", TPM: 100})
+	usage := func(n int) *llmtest.Response {
+		return &llmtest.Response{Events: []llm.Event{llm.TextDelta{Text: "ok"}, &llm.Usage{InputTokens: n - 10, OutputTokens: 10}}}
+	}
+	backend := llmtest.NewClient(usage(60), usage(30), usage(50), usage(500))
+	c := l.Middleware(backend)
+	send(t, c, "m", strings.Repeat("x", 200)) // estimated 50, used 60
+	clock.t = clock.t.Add(10 * time.Second)
+	send(t, c, "m", strings.Repeat("x", 120)) // 30 fits with 60
+	// 50 more doesn't fit until the first request leaves the window.
+	send(t, c, "m", strings.Repeat("x", 200))
+	// A request over the whole limit waits for an empty window.
+	send(t, c, "m", strings.Repeat("x", 2000))
+	want := []time.Duration{50 * time.Second, time.Minute}
+	if !reflect.DeepEqual(clock.sleeps, want) {
+		t.Errorf("slept %v, want %v", clock.sleeps, want)
+	}
+}
+
+type rateLimitError struct{ wait time.Duration }
+
+func (e *rateLimitError) Error() string                      { return "429" }
+func (e *rateLimitError) RateLimited() (time.Duration, bool) { return e.wait, true }
+
+func TestCooldown(t *testing.T) {
+	l, clock := newLimiter(t, Limit{Model: "*", RPM: 100})
+	var notes []string
+	l.Notef = func(format string, args ...any) { notes = append(notes, format) }
+	backend := llmtest.NewClient(llmtest.Error(&rateLimitError{wait: 30 * time.Second}), llmtest.Text("ok"), llmtest.Error(&rateLimitError{}), llmtest.Text("ok"))
+	c := l.Middleware(backend)
+	for i := 0; i < 4; i++ {
+		send(t, c, "m", "Hi")
+	}
+	if want := []time.Duration{30 * time.Second, DefaultCooldown}; !reflect.DeepEqual(clock.sleeps, want) {
+		t.Errorf("slept %v, want %v", clock.sleeps, want)
+	}
+	if len(notes) != 2 {
+		t.Errorf("notes = %q, want 2", notes)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	for _, lim := range []Limit{{Model: "[", RPM: 1}, {Model: "", RPM: 1}, {Model: "*"}, {Model: "*", RPM: -1, TPM: 5}} {
+		if _, err := New([]Limit{lim}); err == nil {
+			t.Errorf("New(%+v) succeeded, want error", lim)
+		}
+	}
+}
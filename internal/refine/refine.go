@@ -0,0 +1,102 @@
+// Package refine improves replies by having the model critique and revise
+// its own answer before it's shown.
+package refine
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+// DefaultPrompt asks for a critique when Client.Prompt is empty.
+const DefaultPrompt = "Critique your answer above. List any mistakes, gaps, unclear parts, or ways it doesn't fully address the question. Be specific and concise. Don't rewrite the answer yet."
+
+// revisePrompt asks for the revised answer, after the critique.
+const revisePrompt = "Now rewrite your answer, addressing the critique. Reply with only the revised answer, addressed to the user as if it were your first, without mentioning the critique or earlier drafts."
+
+// Client is an llm.CompletionClient that drafts a reply, then runs Rounds
+// of critique and revision, streaming back only the final revision.
+// Requests to continue a truncated reply go straight through.
+type Client struct {
+	Client llm.CompletionClient
+	// Rounds is the number of critique and revision rounds.
+	Rounds int
+	// Prompt asks for a critique of the previous draft. Empty means
+	// DefaultPrompt.
+	Prompt string
+	// Notef reports progress through the rounds. Nil means it isn't
+	// reported.
+	Notef func(format string, args ...any)
+	// UsageHooks are called after each request for a draft or critique,
+	// which isn't shown as a reply.
+	UsageHooks []chat.UsageHook
+}
+
+func (c *Client) GetCompletion(ctx context.Context, req *llm.Request) (llm.Stream, error) {
+	n := len(req.Messages)
+	if c.Rounds <= 0 || n == 0 || req.Messages[n-1].Role != llm.RoleUser || req.Messages[n-1].Content == chat.ContinuePrompt {
+		return c.Client.GetCompletion(ctx, req)
+	}
+	prompt := c.Prompt
+	if prompt == "" {
+		prompt = DefaultPrompt
+	}
+	c.note("Drafting...")
+	draft, err := c.complete(ctx, req, req.Messages)
+	if err != nil {
+		return nil, err
+	}
+	for round := 1; ; round++ {
+		messages := append(req.Messages[:n:n],
+			llm.Message{Role: llm.RoleAssistant, Content: draft},
+			llm.Message{Role: llm.RoleUser, Content: prompt},
+		)
+		c.note("Critiquing (round %d of %d)...", round, c.Rounds)
+		critique, err := c.complete(ctx, req, messages)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages,
+			llm.Message{Role: llm.RoleAssistant, Content: critique},
+			llm.Message{Role: llm.RoleUser, Content: revisePrompt},
+		)
+		r := *req
+		r.Messages = messages
+		if round == c.Rounds {
+			return c.Client.GetCompletion(ctx, &r)
+		}
+		c.note("Revising (round %d of %d)...", round, c.Rounds)
+		if draft, err = c.complete(ctx, req, messages); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// complete returns the reply to req with the given messages.
+func (c *Client) complete(ctx context.Context, req *llm.Request, messages []llm.Message) (string, error) {
+	r := *req
+	r.Messages = messages
+	s, err := c.Client.GetCompletion(ctx, &r)
+	if err != nil {
+		return "", err
+	}
+	defer s.Close()
+	reader := llm.NewReader(s)
+	b, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	for _, hook := range c.UsageHooks {
+		hook(req.Model, reader.Usage, &reader.Metrics)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func (c *Client) note(format string, args ...any) {
+	if c.Notef != nil {
+		c.Notef(format, args...)
+	}
+}
@@ -0,0 +1,58 @@
+package refine_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/internal/refine"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/llm/llmtest"
+)
+
+func TestClient(t *testing.T) {
+	lc := llmtest.NewClient(
+		llmtest.Text("Draft 1"), llmtest.Text("Critique 1"), llmtest.Text("Draft 2"),
+		llmtest.Text("Critique 2"), llmtest.Text("Final"),
+	)
+	usages := 0
+	c := &refine.Client{
+		Client: lc,
+		Rounds: 2,
+		Prompt: "What's wrong?",
+		UsageHooks: []chat.UsageHook{func(model string, u *llm.Usage, m *llm.Metrics) {
+			usages++
+		}},
+	}
+	req := &llm.Request{Model: "gpt-test", Messages: []llm.Message{{Role: llm.RoleUser, Content: "Explain CRDTs."}}}
+	s, err := c.GetCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	b, err := io.ReadAll(llm.NewReader(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "Final" {
+		t.Errorf("reply = %q, want the final revision", b)
+	}
+	if usages != 4 {
+		t.Errorf("usage hooks called %d times, want 4", usages)
+	}
+
+	reqs := lc.Requests()
+	if len(reqs) != 5 {
+		t.Fatalf("got %d requests, want 5", len(reqs))
+	}
+	// The last critique is of the second draft.
+	critique := reqs[3].Messages
+	if len(critique) != 3 || critique[1].Content != "Draft 2" || critique[2].Content != "What's wrong?" {
+		t.Errorf("second critique request = %q", critique)
+	}
+	final := reqs[4].Messages
+	if len(final) != 5 || final[3].Content != "Critique 2" || final[4].Role != llm.RoleUser {
+		t.Errorf("final request = %q", final)
+	}
+}
@@ -0,0 +1,213 @@
+// Package repomap builds a condensed map of a repo: its files, and the
+// exported symbols declared in each. It gives the model enough of an
+// outline to navigate a codebase it hasn't read.
+package repomap
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultMaxBytes is roughly 4k tokens.
+const DefaultMaxBytes = 16_000
+
+// maxFileSize skips symbols for files too large to be hand-written source.
+const maxFileSize = 1 << 20
+
+// patterns match declarations in languages other than Go, by extension.
+// The first group is the declaration, without any body.
+var patterns = map[string]*regexp.Regexp{}
+
+func init() {
+	for exts, re := range map[string]string{
+		".py":                         `^((?:async\s+)?def\s+\w+\s*\([^)]*\)|class\s+\w+)`,
+		".js .jsx .mjs .cjs .ts .tsx": `^(export\s+(?:default\s+)?(?:async\s+)?(?:function\*?|class|const|let|var|interface|type|enum)\s+\w+)`,
+		".rs":                         `^\s*(pub(?:\([\w:]+\))?\s+(?:async\s+)?(?:fn|struct|enum|trait|type|mod|const|static)\s+\w+)`,
+		".java .kt .cs .scala":        `^\s*(public\s+(?:[\w<>]+\s+)*?(?:class|interface|enum|record|object)\s+\w+)`,
+		".rb":                         `^\s*((?:class|module|def)\s+[\w.:?!]+)`,
+	} {
+		for _, ext := range strings.Fields(exts) {
+			patterns[ext] = regexp.MustCompile(re)
+		}
+	}
+}
+
+// Build returns the map of the repo at dir, keeping it within maxBytes.
+// Files are listed with git when dir is in a repo, so ignored files are
+// left out. Files past the budget are listed without symbols, and past
+// that, only counted.
+func Build(dir string, maxBytes int) (string, error) {
+	files, err := listFiles(dir)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for i, path := range files {
+		entry := path + "\n"
+		for _, sym := range symbols(filepath.Join(dir, filepath.FromSlash(path))) {
+			entry += "  " + sym + "\n"
+		}
+		if b.Len()+len(entry) > maxBytes {
+			entry = path + "\n"
+		}
+		if b.Len()+len(entry) > maxBytes {
+			fmt.Fprintf(&b, "... and %d more files\n", len(files)-i)
+			break
+		}
+		b.WriteString(entry)
+	}
+	return b.String(), nil
+}
+
+// listFiles returns the slash-separated paths of the files in dir, sorted.
+func listFiles(dir string) ([]string, error) {
+	c := exec.Command("git", "ls-files", "--cached", "--others", "--exclude-standard")
+	c.Dir = dir
+	if out, err := c.Output(); err == nil {
+		files := strings.Split(strings.TrimSpace(string(out)), "\n")
+		if len(files) == 1 && files[0] == "" {
+			files = nil
+		}
+		sort.Strings(files)
+		return files, nil
+	}
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != dir && (strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// symbols returns the exported declarations in a file, one per line.
+func symbols(path string) []string {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > maxFileSize {
+		return nil
+	}
+	ext := filepath.Ext(path)
+	if ext == ".go" {
+		if strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		return goSymbols(path)
+	}
+	re, ok := patterns[ext]
+	if !ok {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var syms []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if m := re.FindStringSubmatch(s.Text()); m != nil {
+			syms = append(syms, strings.Join(strings.Fields(m[1]), " "))
+		}
+	}
+	return syms
+}
+
+func goSymbols(path string) []string {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return nil
+	}
+	var syms []string
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if !d.Name.IsExported() || (d.Recv != nil && !exportedRecv(d.Recv)) {
+				continue
+			}
+			syms = append(syms, format(fset, &ast.FuncDecl{Recv: d.Recv, Name: d.Name, Type: d.Type}))
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if !s.Name.IsExported() {
+						continue
+					}
+					switch s.Type.(type) {
+					case *ast.StructType:
+						syms = append(syms, "type "+s.Name.Name+" struct")
+					case *ast.InterfaceType:
+						syms = append(syms, "type "+s.Name.Name+" interface")
+					default:
+						syms = append(syms, "type "+s.Name.Name+" "+format(fset, s.Type))
+					}
+				case *ast.ValueSpec:
+					var names []string
+					for _, n := range s.Names {
+						if n.IsExported() {
+							names = append(names, n.Name)
+						}
+					}
+					if len(names) > 0 {
+						syms = append(syms, d.Tok.String()+" "+strings.Join(names, ", "))
+					}
+				}
+			}
+		}
+	}
+	return syms
+}
+
+func exportedRecv(recv *ast.FieldList) bool {
+	if len(recv.List) == 0 {
+		return false
+	}
+	t := recv.List[0].Type
+	for {
+		switch x := t.(type) {
+		case *ast.StarExpr:
+			t = x.X
+		case *ast.IndexExpr:
+			t = x.X
+		case *ast.IndexListExpr:
+			t = x.X
+		case *ast.Ident:
+			return x.IsExported()
+		default:
+			return false
+		}
+	}
+}
+
+func format(fset *token.FileSet, node any) string {
+	var b bytes.Buffer
+	if err := printer.Fprint(&b, fset, node); err != nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,74 @@
+package repomap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuild(t *testing.T) {
+	dir := t.TempDir()
+	for path, content := range map[string]string{
+		"lib/lib.go": `package lib
+
+type Client struct{ token string }
+
+type Option func(*Client)
+
+const Version, internal = "1", 2
+
+func New(token string, opts ...Option) *Client { return nil }
+
+func (c *Client) Get(path string) (string, error) { return "", nil }
+
+func (c *Client) get() {}
+
+func helper() {}
+`,
+		"lib/lib_test.go":   "package lib\n\nfunc TestX() {}\n",
+		"tool.py":           "import os\n\nclass Tool:\n    def run(self):\n        pass\n\ndef main(argv):\n    pass\n",
+		"README.md":         "# Hi\n",
+		".hidden/secret.go": "package hidden\n\nfunc Secret() {}\n",
+	} {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := Build(dir, DefaultMaxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `README.md
+lib/lib.go
+  type Client struct
+  type Option func(*Client)
+  const Version
+  func New(token string, opts ...Option) *Client
+  func (c *Client) Get(path string) (string, error)
+lib/lib_test.go
+tool.py
+  class Tool
+  def main(argv)
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Over budget, files are listed without symbols, then counted.
+	got, err = Build(dir, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "README.md\nlib/lib.go\n... and 2 more files\n"; got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if strings.Contains(got, "hidden") {
+		t.Errorf("map includes hidden files")
+	}
+}
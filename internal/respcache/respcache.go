@@ -0,0 +1,158 @@
+// Package respcache caches complete replies on disk, keyed by the request,
+// so that repeating an identical request returns instantly without using
+// any tokens.
+package respcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/log"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+const DefaultTTL = 24 * time.Hour
+
+// Client is an llm.CompletionClient that serves cached replies when it can,
+// and caches replies from the underlying client otherwise. Only replies
+// that finish normally are cached; errors, tool calls, and interrupted
+// streams are not.
+type Client struct {
+	Client llm.CompletionClient
+	// Dir holds one file per cached reply.
+	Dir string
+	// TTL is how long a reply stays cached. Zero means DefaultTTL.
+	TTL time.Duration
+}
+
+// Middleware returns an llm.Middleware that caches replies in dir for ttl.
+func Middleware(dir string, ttl time.Duration) llm.Middleware {
+	return func(next llm.CompletionClient) llm.CompletionClient {
+		return &Client{Client: next, Dir: dir, TTL: ttl}
+	}
+}
+
+// entry is a cached reply.
+type entry struct {
+	Text         string `json:"text"`
+	Reasoning    string `json:"reasoning,omitempty"`
+	FinishReason string `json:"finish_reason"`
+}
+
+func (c *Client) GetCompletion(ctx context.Context, req *llm.Request) (llm.Stream, error) {
+	path := filepath.Join(c.Dir, key(req)+".json")
+	if e := c.load(path); e != nil {
+		log.Debugf("Serving reply from cache: %s", path)
+		var events []llm.Event
+		if e.Reasoning != "" {
+			events = append(events, llm.ReasoningDelta{Text: e.Reasoning})
+		}
+		events = append(events, llm.TextDelta{Text: e.Text}, llm.Done{FinishReason: e.FinishReason})
+		return &replay{events: events}, nil
+	}
+	s, err := c.Client.GetCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &recorder{Stream: s, path: path}, nil
+}
+
+// key hashes everything in the request that affects the reply.
+func key(req *llm.Request) string {
+	b, _ := json.Marshal(struct {
+		Model           string
+		Messages        []llm.Message
+		ReasoningEffort string
+		ResponseFormat  string
+		WebSearch       bool
+	}{req.Model, req.Messages, req.ReasoningEffort, req.ResponseFormat, req.WebSearch})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// load returns the cached entry at path, or nil if there is none or it
+// expired.
+func (c *Client) load(path string) *entry {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	ttl := c.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+	if time.Since(info.ModTime()) > ttl {
+		os.Remove(path)
+		return nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	e := &entry{}
+	if err := json.Unmarshal(b, e); err != nil {
+		return nil
+	}
+	return e
+}
+
+type replay struct {
+	events []llm.Event
+}
+
+func (r *replay) Next() (llm.Event, error) {
+	if len(r.events) == 0 {
+		return nil, io.EOF
+	}
+	e := r.events[0]
+	r.events = r.events[1:]
+	return e, nil
+}
+
+func (r *replay) Close() error { return nil }
+
+// recorder passes through a stream, saving the reply once it's done.
+type recorder struct {
+	llm.Stream
+	path      string
+	text      strings.Builder
+	reasoning strings.Builder
+	toolCalls bool
+}
+
+func (r *recorder) Next() (llm.Event, error) {
+	e, err := r.Stream.Next()
+	switch e := e.(type) {
+	case llm.TextDelta:
+		r.text.WriteString(e.Text)
+	case llm.ReasoningDelta:
+		r.reasoning.WriteString(e.Text)
+	case llm.ToolCallDelta:
+		r.toolCalls = true
+	case llm.Done:
+		if !r.toolCalls && (e.FinishReason == llm.FinishReasonStop || e.FinishReason == llm.FinishReasonLength) {
+			r.save(&entry{Text: r.text.String(), Reasoning: r.reasoning.String(), FinishReason: e.FinishReason})
+		}
+	}
+	return e, err
+}
+
+func (r *recorder) save(e *entry) {
+	b, err := json.Marshal(e)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(r.path), 0700)
+	}
+	if err == nil {
+		err = os.WriteFile(r.path, b, 0600)
+	}
+	if err != nil {
+		log.Debugf("Failed to cache reply: %s", err)
+	}
+}
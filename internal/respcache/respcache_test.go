@@ -0,0 +1,75 @@
+package respcache
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/llm/llmtest"
+)
+
+func complete(t *testing.T, c llm.CompletionClient, req *llm.Request) string {
+	t.Helper()
+	s, err := c.GetCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := llm.NewReader(s)
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestClient(t *testing.T) {
+	backend := llmtest.NewClient(llmtest.Text("first"), llmtest.Text("second"), llmtest.Text("third"))
+	c := &Client{Client: backend, Dir: t.TempDir()}
+	req := &llm.Request{Model: "gpt-test", Messages: []llm.Message{{Role: llm.RoleUser, Content: "Hi"}}}
+
+	if got := complete(t, c, req); got != "first" {
+		t.Errorf("got %q, want first", got)
+	}
+	if got := complete(t, c, req); got != "first" {
+		t.Errorf("got %q for an identical request, want the cached reply", got)
+	}
+	other := *req
+	other.Model = "gpt-other"
+	if got := complete(t, c, &other); got != "second" {
+		t.Errorf("got %q for another model, want a fresh reply", got)
+	}
+	if n := len(backend.Requests()); n != 2 {
+		t.Errorf("backend got %d requests, want 2", n)
+	}
+
+	// Expired replies are fetched again.
+	old := time.Now().Add(-2 * DefaultTTL)
+	if err := os.Chtimes(filepath.Join(c.Dir, key(req)+".json"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if got := complete(t, c, req); got != "third" {
+		t.Errorf("got %q after the TTL, want a fresh reply", got)
+	}
+}
+
+func TestClientSkipsFailedReplies(t *testing.T) {
+	backend := llmtest.NewClient(
+		&llmtest.Response{Events: []llm.Event{llm.TextDelta{Text: "par"}}, StreamErr: io.ErrUnexpectedEOF},
+		llmtest.Text("whole"),
+	)
+	c := &Client{Client: backend, Dir: t.TempDir()}
+	req := &llm.Request{Model: "gpt-test", Messages: []llm.Message{{Role: llm.RoleUser, Content: "Hi"}}}
+	s, err := c.GetCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(llm.NewReader(s))
+	if got := complete(t, c, req); got != "whole" {
+		t.Errorf("got %q, want a fresh reply after a failed one", got)
+	}
+}
@@ -0,0 +1,325 @@
+// Package scrub finds secrets and personal data in text, such as API keys,
+// private keys, and email addresses, and masks them, so that they aren't
+// sent to a model provider.
+package scrub
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+// Action is what a Filter does with text that a detector or rule matches.
+type Action string
+
+const (
+	// Mask replaces the match with a placeholder, and warns about it.
+	Mask Action = "mask"
+	// Warn sends the match unchanged, but warns about it.
+	Warn Action = "warn"
+	// Block refuses to send the request.
+	Block Action = "block"
+	// Off disables a built-in detector.
+	Off Action = "off"
+)
+
+// detector finds one kind of text. If the pattern has a group, only the
+// group is matched, and the rest is context, such as the name of a
+// variable.
+type detector struct {
+	kind string
+	re   *regexp.Regexp
+	// valid, if set, filters out matches that look right but aren't, such
+	// as "999.0.0.1" for an IP address.
+	valid  func(s string) bool
+	action Action
+}
+
+// secrets detect credentials. The "secrets" detector setting applies to
+// all of them.
+var secrets = []detector{
+	{kind: "private-key", re: regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)},
+	{kind: "aws-access-key", re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{kind: "aws-secret-key", re: regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`)},
+	{kind: "github-token", re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{kind: "api-key", re: regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`)},
+	{kind: "slack-token", re: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{kind: "google-api-key", re: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{kind: "stripe-key", re: regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{24,}\b`)},
+}
+
+// personal detect personal data. They're off unless enabled, since they
+// match often in ordinary code and logs.
+var personal = []detector{
+	{kind: "email", re: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}\b`)},
+	{kind: "ip", re: regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`), valid: isIP},
+	{kind: "ip", re: regexp.MustCompile(`(?i)(?:\b[0-9a-f]{1,4})?(?::[0-9a-f]{0,4}){2,7}\b`), valid: isIPv6},
+}
+
+func isIP(s string) bool {
+	return net.ParseIP(s) != nil
+}
+
+// isIPv6 is like isIP, but rejects "::", which is more often a separator
+// in code, as in std::string.
+func isIPv6(s string) bool {
+	return s != "::" && isIP(s)
+}
+
+// Config configures a Filter. It's the redact section of the config file:
+//
+//	redact:
+//	  detectors:
+//	    email: mask
+//	    ip: warn
+//	  rules:
+//	    - name: employee-id
+//	      pattern: 'EMP-\d{6}'
+//	      action: block
+type Config struct {
+	// Detectors sets the actions of built-in detectors by kind: "email",
+	// "ip", or a kind of secret such as "aws-access-key", or "secrets" for
+	// all kinds of secrets. Secrets are masked by default, and personal
+	// data isn't looked for.
+	Detectors map[string]Action `yaml:"detectors,omitempty"`
+	// Rules look for more patterns.
+	Rules []Rule `yaml:"rules,omitempty"`
+}
+
+// Rule is a pattern to look for, besides the built-in detectors.
+type Rule struct {
+	// Name names matches in placeholders and warnings.
+	Name string `yaml:"name"`
+	// Pattern is a regular expression in Go syntax. If it has a group,
+	// only the group is matched.
+	Pattern string `yaml:"pattern"`
+	// Action defaults to Mask.
+	Action Action `yaml:"action,omitempty"`
+}
+
+// Filter applies the actions of a Config to text.
+type Filter struct {
+	detectors []detector
+}
+
+// NewFilter returns a filter for cfg. A nil cfg masks secrets only.
+func NewFilter(cfg *Config) (*Filter, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	kinds := map[string]bool{"secrets": true}
+	for _, d := range append(secrets, personal...) {
+		kinds[d.kind] = true
+	}
+	for kind, action := range cfg.Detectors {
+		if !kinds[kind] {
+			known := make([]string, 0, len(kinds))
+			for k := range kinds {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("redact: unknown detector %q: must be one of %s", kind, strings.Join(known, ", "))
+		}
+		if err := checkAction(action, true); err != nil {
+			return nil, fmt.Errorf("redact: detector %s: %w", kind, err)
+		}
+	}
+	action := func(d detector, group string, def Action) Action {
+		if a, ok := cfg.Detectors[d.kind]; ok {
+			return a
+		}
+		if a, ok := cfg.Detectors[group]; ok {
+			return a
+		}
+		return def
+	}
+	f := &Filter{}
+	for _, d := range secrets {
+		d.action = action(d, "secrets", Mask)
+		f.add(d)
+	}
+	for _, d := range personal {
+		d.action = action(d, "", Off)
+		f.add(d)
+	}
+	for i, r := range cfg.Rules {
+		if r.Name == "" || r.Pattern == "" {
+			return nil, fmt.Errorf("redact: rule %d: name and pattern are required", i+1)
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redact: rule %s: %w", r.Name, err)
+		}
+		if r.Action == "" {
+			r.Action = Mask
+		}
+		if err := checkAction(r.Action, false); err != nil {
+			return nil, fmt.Errorf("redact: rule %s: %w", r.Name, err)
+		}
+		f.add(detector{kind: r.Name, re: re, action: r.Action})
+	}
+	return f, nil
+}
+
+func checkAction(a Action, offOK bool) error {
+	switch a {
+	case Mask, Warn, Block:
+		return nil
+	case Off:
+		if offOK {
+			return nil
+		}
+	}
+	if offOK {
+		return fmt.Errorf("invalid action %q: must be mask, warn, block, or off", a)
+	}
+	return fmt.Errorf("invalid action %q: must be mask, warn, or block", a)
+}
+
+func (f *Filter) add(d detector) {
+	if d.action != Off {
+		f.detectors = append(f.detectors, d)
+	}
+}
+
+// Finding is a match found in text.
+type Finding struct {
+	// Kind is the kind of secret or data, such as "aws-access-key", or the
+	// name of a rule.
+	Kind   string
+	Value  string
+	Action Action
+}
+
+// Placeholder returns the text that replaces a masked match.
+func Placeholder(kind string) string {
+	return "[REDACTED:" + kind + "]"
+}
+
+// Text returns text with the matches to be masked replaced by
+// placeholders, and all the matches found.
+func (f *Filter) Text(text string) (string, []Finding) {
+	var findings []Finding
+	for _, d := range f.detectors {
+		matches := d.re.FindAllStringSubmatchIndex(text, -1)
+		if matches == nil {
+			continue
+		}
+		var out []byte
+		last := 0
+		for _, m := range matches {
+			start, end := m[0], m[1]
+			if len(m) > 2 && m[2] >= 0 {
+				start, end = m[2], m[3]
+			}
+			value := text[start:end]
+			if d.valid != nil && !d.valid(value) {
+				continue
+			}
+			findings = append(findings, Finding{Kind: d.kind, Value: value, Action: d.action})
+			if d.action != Mask {
+				continue
+			}
+			out = append(out, text[last:start]...)
+			out = append(out, Placeholder(d.kind)...)
+			last = end
+		}
+		text = string(append(out, text[last:]...))
+	}
+	return text, findings
+}
+
+// Client is an llm.CompletionClient that applies a Filter to the messages
+// of each request before sending it. The chat history isn't changed.
+// Requests with a match to be blocked fail with an *llm.BlockedError.
+type Client struct {
+	Client llm.CompletionClient
+	// Filter nil means NewFilter(nil), which masks secrets only.
+	Filter *Filter
+	// Warnf is called for each match that's masked or warned about when
+	// it's first seen, but not when it's seen again in a later request
+	// with the same history. Nil means matches are masked silently.
+	Warnf func(format string, args ...any)
+
+	mu sync.Mutex
+	// warned holds hashes of the matches already warned about.
+	warned map[[sha256.Size]byte]bool
+}
+
+var defaultFilter, _ = NewFilter(nil)
+
+// Middleware returns an llm.Middleware that applies f to requests, and
+// warns about matches with warnf, as a Client does.
+func Middleware(f *Filter, warnf func(format string, args ...any)) llm.Middleware {
+	return func(next llm.CompletionClient) llm.CompletionClient {
+		return &Client{Client: next, Filter: f, Warnf: warnf}
+	}
+}
+
+func (c *Client) GetCompletion(ctx context.Context, req *llm.Request) (llm.Stream, error) {
+	f := c.Filter
+	if f == nil {
+		f = defaultFilter
+	}
+	r := *req
+	r.Messages = make([]llm.Message, len(req.Messages))
+	var findings []Finding
+	for i, m := range req.Messages {
+		var more []Finding
+		m.Content, more = f.Text(m.Content)
+		findings = append(findings, more...)
+		if len(m.ToolCalls) > 0 {
+			m.ToolCalls = append([]llm.ToolCall{}, m.ToolCalls...)
+			for j := range m.ToolCalls {
+				m.ToolCalls[j].Arguments, more = f.Text(m.ToolCalls[j].Arguments)
+				findings = append(findings, more...)
+			}
+		}
+		r.Messages[i] = m
+	}
+	for _, f := range findings {
+		if f.Action == Block {
+			return nil, &llm.BlockedError{Reason: fmt.Sprintf("it contains %s (%s), which the redact settings block", f.Kind, preview(f.Value))}
+		}
+	}
+	c.warn(findings)
+	return c.Client.GetCompletion(ctx, &r)
+}
+
+func (c *Client) warn(findings []Finding) {
+	if c.Warnf == nil || len(findings) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.warned == nil {
+		c.warned = map[[sha256.Size]byte]bool{}
+	}
+	for _, f := range findings {
+		h := sha256.Sum256([]byte(f.Value))
+		if c.warned[h] {
+			continue
+		}
+		c.warned[h] = true
+		if f.Action == Mask {
+			c.Warnf("Masked %s before sending it: %s", f.Kind, preview(f.Value))
+		} else {
+			c.Warnf("Sending what looks like %s: %s", f.Kind, preview(f.Value))
+		}
+	}
+}
+
+// preview shows the start of a match, enough to recognize it.
+func preview(s string) string {
+	if len(s) <= 8 {
+		return "****"
+	}
+	return s[:4] + "****"
+}
@@ -0,0 +1,190 @@
+// Package search runs web searches through one of several engines.
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/internal/httpx"
+	"github.com/bduffany/gpt-cli/internal/models"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+type Result struct {
+	Title   string
+	URL     string
+	Snippet string
+}
+
+type Engine interface {
+	// Search returns up to n results for the query.
+	Search(ctx context.Context, query string, n int) ([]Result, error)
+}
+
+// Format renders results as a numbered list, for feeding to a model.
+func Format(results []Result) string {
+	if len(results) == 0 {
+		return "No results.\n"
+	}
+	var b strings.Builder
+	for i, r := range results {
+		fmt.Fprintf(&b, "%d. %s\n   %s\n", i+1, r.Title, r.URL)
+		if r.Snippet != "" {
+			fmt.Fprintf(&b, "   %s\n", strings.Join(strings.Fields(r.Snippet), " "))
+		}
+	}
+	return b.String()
+}
+
+// OpenAI searches with the web search tool of the Responses API, returning
+// the pages the model cited.
+type OpenAI struct {
+	Client *openai.Client
+	Model  string
+}
+
+func (e *OpenAI) Search(ctx context.Context, query string, n int) ([]Result, error) {
+	model := e.Model
+	if model == "" {
+		model = models.Small
+	}
+	req := map[string]any{
+		"model":       model,
+		"tools":       []any{map[string]any{"type": "web_search_preview"}},
+		"tool_choice": "required",
+		"input":       fmt.Sprintf("Search the web for: %s\n\nCite up to %d of the most relevant pages.", query, n),
+	}
+	rsp := &struct {
+		Output []struct {
+			Type    string `json:"type"`
+			Content []struct {
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				Annotations []struct {
+					Type       string `json:"type"`
+					URL        string `json:"url"`
+					Title      string `json:"title"`
+					StartIndex int    `json:"start_index"`
+					EndIndex   int    `json:"end_index"`
+				} `json:"annotations"`
+			} `json:"content"`
+		} `json:"output"`
+	}{}
+	if err := e.Client.PostJSON(ctx, "/v1/responses", req, rsp); err != nil {
+		return nil, err
+	}
+	var results []Result
+	seen := map[string]bool{}
+	for _, out := range rsp.Output {
+		for _, c := range out.Content {
+			for _, a := range c.Annotations {
+				if a.Type != "url_citation" || seen[a.URL] || len(results) >= n {
+					continue
+				}
+				seen[a.URL] = true
+				results = append(results, Result{
+					Title:   a.Title,
+					URL:     a.URL,
+					Snippet: citedSentence(c.Text, a.StartIndex),
+				})
+			}
+		}
+	}
+	return results, nil
+}
+
+// citedSentence returns the line of text ending at a citation, which is the
+// claim the citation supports.
+func citedSentence(text string, citation int) string {
+	if citation <= 0 || citation > len(text) {
+		return ""
+	}
+	start := strings.LastIndexAny(text[:citation], "\n") + 1
+	return strings.TrimSpace(strings.TrimRight(text[start:citation], " ("))
+}
+
+// SearXNG searches a SearXNG instance, which must have the JSON format
+// enabled.
+type SearXNG struct {
+	BaseURL string
+}
+
+func (e *SearXNG) Search(ctx context.Context, query string, n int) ([]Result, error) {
+	u := strings.TrimSuffix(e.BaseURL, "/") + "/search?" + url.Values{"q": {query}, "format": {"json"}}.Encode()
+	rsp := &struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}{}
+	if err := getJSON(ctx, u, nil, rsp); err != nil {
+		return nil, err
+	}
+	var results []Result
+	for _, r := range rsp.Results {
+		if len(results) >= n {
+			break
+		}
+		results = append(results, Result{Title: r.Title, URL: r.URL, Snippet: r.Content})
+	}
+	return results, nil
+}
+
+// Brave searches with the Brave Search API.
+type Brave struct {
+	Token string
+}
+
+func (e *Brave) Search(ctx context.Context, query string, n int) ([]Result, error) {
+	u := "https://api.search.brave.com/res/v1/web/search?" + url.Values{"q": {query}, "count": {fmt.Sprint(n)}}.Encode()
+	rsp := &struct {
+		Web struct {
+			Results []struct {
+				Title       string `json:"title"`
+				URL         string `json:"url"`
+				Description string `json:"description"`
+			} `json:"results"`
+		} `json:"web"`
+	}{}
+	header := http.Header{"X-Subscription-Token": {e.Token}, "Accept": {"application/json"}}
+	if err := getJSON(ctx, u, header, rsp); err != nil {
+		return nil, err
+	}
+	var results []Result
+	for _, r := range rsp.Web.Results {
+		results = append(results, Result{Title: r.Title, URL: r.URL, Snippet: stripTags(r.Description)})
+	}
+	return results, nil
+}
+
+func getJSON(ctx context.Context, u string, header http.Header, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	rsp, err := httpx.Default.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("search failed: %s", rsp.Status)
+	}
+	return json.NewDecoder(rsp.Body).Decode(v)
+}
+
+// stripTags removes the <strong> highlighting that Brave adds to snippets.
+func stripTags(s string) string {
+	for _, tag := range []string{"<strong>", "</strong>"} {
+		s = strings.ReplaceAll(s, tag, "")
+	}
+	return s
+}
@@ -0,0 +1,70 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+func TestOpenAI(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/responses" {
+			http.NotFound(w, r)
+			return
+		}
+		text := "Go 1.21 added min and max builtins ([go.dev](https://go.dev/doc/go1.21)).\nGenerics arrived in 1.18 ([blog](https://go.dev/blog/intro-generics))."
+		first, second := strings.Index(text, "(["), strings.LastIndex(text, "([")
+		fmt.Fprintf(w, `{"output": [
+			{"type": "web_search_call"},
+			{"type": "message", "content": [{"type": "output_text", "text": %q, "annotations": [
+				{"type": "url_citation", "url": "https://go.dev/doc/go1.21", "title": "Go 1.21 Release Notes", "start_index": %d},
+				{"type": "url_citation", "url": "https://go.dev/doc/go1.21", "title": "Go 1.21 Release Notes", "start_index": %d},
+				{"type": "url_citation", "url": "https://go.dev/blog/intro-generics", "title": "An Introduction To Generics", "start_index": %d}
+			]}]}
+		]}`, text, first, first, second)
+	}))
+	defer srv.Close()
+
+	e := &OpenAI{Client: &openai.Client{BaseURL: srv.URL}}
+	results, err := e.Search(context.Background(), "go release history", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Result{
+		{Title: "Go 1.21 Release Notes", URL: "https://go.dev/doc/go1.21", Snippet: "Go 1.21 added min and max builtins"},
+		{Title: "An Introduction To Generics", URL: "https://go.dev/blog/intro-generics", Snippet: "Generics arrived in 1.18"},
+	}
+	if fmt.Sprint(results) != fmt.Sprint(want) {
+		t.Errorf("Search = %+v, want %+v", results, want)
+	}
+}
+
+func TestSearXNG(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") != "json" || r.URL.Query().Get("q") != "searxng" {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"results": [
+			{"title": "SearXNG", "url": "https://docs.searxng.org", "content": "A privacy-respecting metasearch engine."},
+			{"title": "GitHub", "url": "https://github.com/searxng/searxng", "content": "Source code."}
+		]}`)
+	}))
+	defer srv.Close()
+
+	results, err := (&SearXNG{BaseURL: srv.URL + "/"}).Search(context.Background(), "searxng", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].URL != "https://docs.searxng.org" {
+		t.Errorf("Search = %+v, want only the first result", results)
+	}
+	if got, want := Format(results), "1. SearXNG\n   https://docs.searxng.org\n   A privacy-respecting metasearch engine.\n"; got != want {
+		t.Errorf("Format = %q, want %q", got, want)
+	}
+}
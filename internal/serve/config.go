@@ -0,0 +1,83 @@
+package serve
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+
+	"github.com/bduffany/gpt-cli/internal/config"
+)
+
+// Config sets who may use the server, and where each model is served.
+type Config struct {
+	// Keys are the API keys that clients must send as bearer tokens. With no
+	// keys, any client may use the server.
+	Keys []Key `yaml:"keys"`
+	// Routes are tried in order for each requested model. Models that match
+	// no route are sent to the default client.
+	Routes []Route `yaml:"routes"`
+}
+
+// Key is an API key issued to a client. Name identifies the client in the
+// request log.
+type Key struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+}
+
+// Route sends requests for matching models to an upstream server.
+type Route struct {
+	// Model is the requested model name, or a glob like "llama*".
+	Model string `yaml:"model"`
+	// Target, if set, replaces the requested model name, so that clients
+	// can use aliases like "fast".
+	Target string `yaml:"target"`
+	// BaseURL is an OpenAI-compatible server, such as a local Ollama. Empty
+	// uses the default client.
+	BaseURL string `yaml:"base_url"`
+	// APIKeyEnv names the env var holding the key for BaseURL, if it needs
+	// one.
+	APIKeyEnv string `yaml:"api_key_env"`
+}
+
+// LoadConfig reads a config from a YAML file like:
+//
+//	keys:
+//	  - name: editor
+//	    key: local-3f9a...
+//	routes:
+//	  - model: fast
+//	    target: gpt-4.1-mini
+//	  - model: llama*
+//	    base_url: http://localhost:11434
+//
+// Includes and env vars, like key: ${EDITOR_KEY}, are handled as by
+// config.ReadFile.
+func LoadConfig(p string) (*Config, error) {
+	cfg := &Config{}
+	if err := config.ReadFile(p, cfg); err != nil {
+		return nil, err
+	}
+	for _, k := range cfg.Keys {
+		if k.Key == "" {
+			return nil, fmt.Errorf("%s: key %q is empty", p, k.Name)
+		}
+	}
+	for _, r := range cfg.Routes {
+		if _, err := path.Match(r.Model, ""); err != nil || r.Model == "" {
+			return nil, fmt.Errorf("%s: invalid route model %q", p, r.Model)
+		}
+	}
+	return cfg, nil
+}
+
+// LoadConfigIfExists is like LoadConfig, but returns an empty config if the
+// file doesn't exist.
+func LoadConfigIfExists(p string) (*Config, error) {
+	cfg, err := LoadConfig(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Config{}, nil
+	}
+	return cfg, err
+}
@@ -0,0 +1,478 @@
+// Package serve runs a local HTTP server exposing an OpenAI-compatible chat
+// completions API in front of the configured providers, so that other tools
+// can share gpt-cli's keys, routing, and logging.
+package serve
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+// Server serves the API. Its zero value is not usable: Client must be set.
+type Server struct {
+	// Client serves models that match no route, and routes without a
+	// BaseURL.
+	Client llm.CompletionClient
+	// Config may be nil, which allows any client and has no routes.
+	Config *Config
+	// Log, if set, receives a JSON line for each request.
+	Log io.Writer
+	// Middleware wraps every client that requests are sent to, outermost
+	// first as with llm.Chain, including those of routes and sessions.
+	Middleware []llm.Middleware
+	// NewChat returns the chat for a new session, which sends its requests
+	// to client, given the upstream model and system prompt requested,
+	// either of which may be empty for the default. Nil disables the
+	// session API.
+	NewChat func(client llm.CompletionClient, model, system string) (*chat.Chat, error)
+
+	mu sync.Mutex
+	// upstreams are the clients requests are sent to, wrapped in
+	// Middleware, by route index for routes with a BaseURL, or -1 for
+	// Client.
+	upstreams map[int]llm.CompletionClient
+	sessions  map[string]*session
+}
+
+// Handler returns the HTTP handler for the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/completions", s.authorized(s.chatCompletions))
+	mux.HandleFunc("/v1/models", s.authorized(s.listModels))
+	if s.NewChat != nil {
+		mux.HandleFunc("/v1/sessions", s.authorized(s.createSession))
+		mux.HandleFunc("/v1/sessions/", s.authorized(s.sessionRequest))
+	}
+	return mux
+}
+
+// logEntry is a line of the request log.
+type logEntry struct {
+	Time          time.Time `json:"time"`
+	Key           string    `json:"key,omitempty"`
+	Path          string    `json:"path"`
+	Model         string    `json:"model,omitempty"`
+	UpstreamModel string    `json:"upstream_model,omitempty"`
+	Stream        bool      `json:"stream,omitempty"`
+	Status        int       `json:"status"`
+	LatencyMillis int64     `json:"latency_ms"`
+	InputTokens   int       `json:"input_tokens,omitempty"`
+	OutputTokens  int       `json:"output_tokens,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+func (s *Server) log(e *logEntry) {
+	if s.Log == nil {
+		return
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Log.Write(append(b, '\n'))
+}
+
+// authorized checks the request's API key, then calls h with a log entry
+// to fill in. The entry is logged once h returns. Errors from h are written
+// to the client, so h must only return them before writing a response.
+func (s *Server) authorized(h func(w http.ResponseWriter, r *http.Request, e *logEntry) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		e := &logEntry{Time: time.Now(), Path: r.URL.Path, Status: http.StatusOK}
+		defer func() {
+			e.LatencyMillis = time.Since(e.Time).Milliseconds()
+			s.log(e)
+		}()
+		name, ok := s.authenticate(r)
+		e.Key = name
+		var err error
+		if !ok {
+			err = &apiError{http.StatusUnauthorized, "invalid_api_key", "invalid or missing API key"}
+		} else {
+			err = h(w, r, e)
+		}
+		if err == nil {
+			return
+		}
+		e.Error = err.Error()
+		var ae *apiError
+		if !errors.As(err, &ae) {
+			ae = &apiError{http.StatusBadGateway, "upstream_error", err.Error()}
+			var he *openai.HTTPError
+			if errors.As(err, &he) {
+				ae.status = he.StatusCode
+			}
+		}
+		e.Status = ae.status
+		writeError(w, ae)
+	}
+}
+
+// authenticate returns the name of the key sent with r, and whether it's
+// valid.
+func (s *Server) authenticate(r *http.Request) (string, bool) {
+	if s.Config == nil || len(s.Config.Keys) == 0 {
+		return "", true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", false
+	}
+	for _, k := range s.Config.Keys {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(k.Key)) == 1 {
+			return k.Name, true
+		}
+	}
+	return "", false
+}
+
+// apiError is an error reported to the client in the OpenAI format.
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *apiError) Error() string { return e.message }
+
+func writeError(w http.ResponseWriter, e *apiError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.status)
+	json.NewEncoder(w).Encode(&openai.ErrorResponse{Error: &openai.Error{
+		Message: e.message,
+		Type:    "invalid_request_error",
+		Code:    e.code,
+	}})
+}
+
+// checkJSON returns an error unless r has a JSON body and wasn't sent by a
+// web page. Browsers send the Origin header with cross-origin requests, and
+// can't send JSON without it, so this keeps pages from spending the
+// server's keys with form posts.
+func checkJSON(r *http.Request) error {
+	if r.Header.Get("Origin") != "" {
+		return &apiError{http.StatusForbidden, "cross_origin", "requests from web pages are not allowed"}
+	}
+	if t, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); t != "application/json" {
+		return &apiError{http.StatusUnsupportedMediaType, "unsupported_media_type", "Content-Type must be application/json"}
+	}
+	return nil
+}
+
+func badRequest(format string, args ...any) error {
+	return &apiError{http.StatusBadRequest, "invalid_request", fmt.Sprintf(format, args...)}
+}
+
+// route returns the client and upstream model name for a requested model.
+func (s *Server) route(model string) (llm.CompletionClient, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.upstreams == nil {
+		s.upstreams = map[int]llm.CompletionClient{-1: llm.Chain(s.Client, s.Middleware...)}
+	}
+	if s.Config == nil {
+		return s.upstreams[-1], model
+	}
+	for i, r := range s.Config.Routes {
+		if ok, _ := path.Match(r.Model, model); !ok {
+			continue
+		}
+		target := model
+		if r.Target != "" {
+			target = r.Target
+		}
+		if r.BaseURL == "" {
+			return s.upstreams[-1], target
+		}
+		if s.upstreams[i] == nil {
+			s.upstreams[i] = llm.Chain(&openai.Client{Token: os.Getenv(r.APIKeyEnv), BaseURL: r.BaseURL}, s.Middleware...)
+		}
+		return s.upstreams[i], target
+	}
+	return s.upstreams[-1], model
+}
+
+// chatRequest is the subset of the chat completions request that is
+// supported.
+type chatRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+	Stream        bool `json:"stream"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+	ReasoningEffort string `json:"reasoning_effort"`
+	ResponseFormat  *struct {
+		Type string `json:"type"`
+	} `json:"response_format"`
+	PromptCacheKey string          `json:"prompt_cache_key"`
+	Tools          json.RawMessage `json:"tools"`
+}
+
+// parse converts the request to an llm.Request.
+func (c *chatRequest) parse() (*llm.Request, error) {
+	if c.Model == "" {
+		return nil, badRequest("model is required")
+	}
+	if len(c.Tools) > 0 && string(c.Tools) != "null" {
+		return nil, badRequest("tools are not supported")
+	}
+	req := &llm.Request{Model: c.Model, ReasoningEffort: c.ReasoningEffort, CacheKey: c.PromptCacheKey}
+	if c.ResponseFormat != nil && c.ResponseFormat.Type != "text" {
+		req.ResponseFormat = c.ResponseFormat.Type
+	}
+	for i, m := range c.Messages {
+		role := m.Role
+		if role == "developer" {
+			role = llm.RoleSystem
+		}
+		switch role {
+		case llm.RoleSystem, llm.RoleUser, llm.RoleAssistant:
+		default:
+			return nil, badRequest("messages[%d]: unsupported role %q", i, m.Role)
+		}
+		content, err := textContent(m.Content)
+		if err != nil {
+			return nil, badRequest("messages[%d]: %s", i, err)
+		}
+		req.Messages = append(req.Messages, llm.Message{Role: role, Content: content})
+	}
+	if len(req.Messages) == 0 {
+		return nil, badRequest("messages are required")
+	}
+	return req, nil
+}
+
+// textContent returns message content given either as a string or as an
+// array of text parts.
+func textContent(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", fmt.Errorf("invalid content")
+	}
+	var b strings.Builder
+	for _, p := range parts {
+		if p.Type != "text" {
+			return "", fmt.Errorf("unsupported content type %q", p.Type)
+		}
+		b.WriteString(p.Text)
+	}
+	return b.String(), nil
+}
+
+func (s *Server) chatCompletions(w http.ResponseWriter, r *http.Request, e *logEntry) error {
+	if r.Method != "POST" {
+		return &apiError{http.StatusMethodNotAllowed, "method_not_allowed", "use POST"}
+	}
+	if err := checkJSON(r); err != nil {
+		return err
+	}
+	cr := &chatRequest{}
+	if err := json.NewDecoder(r.Body).Decode(cr); err != nil {
+		return badRequest("invalid request body: %s", err)
+	}
+	e.Model, e.Stream = cr.Model, cr.Stream
+	req, err := cr.parse()
+	if err != nil {
+		return err
+	}
+	client, target := s.route(cr.Model)
+	req.Model, e.UpstreamModel = target, target
+
+	stream, err := client.GetCompletion(r.Context(), req)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	c := &completion{
+		ID:      newID("chatcmpl-"),
+		Created: time.Now().Unix(),
+		Model:   cr.Model,
+	}
+	if cr.Stream {
+		return c.stream(w, stream, e, cr.StreamOptions != nil && cr.StreamOptions.IncludeUsage)
+	}
+	return c.write(w, stream, e)
+}
+
+// completion holds the fields shared by each chunk of a reply.
+type completion struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	Model   string `json:"model"`
+	Choices []any  `json:"choices"`
+	Usage   *usage `json:"usage,omitempty"`
+}
+
+type usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func toUsage(u *llm.Usage) *usage {
+	return &usage{u.InputTokens, u.OutputTokens, u.TotalTokens()}
+}
+
+// write sends the complete reply as a single response.
+func (c *completion) write(w http.ResponseWriter, stream llm.Stream, e *logEntry) error {
+	var text strings.Builder
+	finish := ""
+	for {
+		event, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch ev := event.(type) {
+		case llm.TextDelta:
+			text.WriteString(ev.Text)
+		case *llm.Usage:
+			c.Usage = toUsage(ev)
+			e.InputTokens, e.OutputTokens = ev.InputTokens, ev.OutputTokens
+		case llm.Done:
+			finish = ev.FinishReason
+		}
+	}
+	c.Object = "chat.completion"
+	c.Choices = []any{map[string]any{
+		"index":         0,
+		"message":       map[string]any{"role": llm.RoleAssistant, "content": text.String()},
+		"finish_reason": finish,
+	}}
+	return writeJSON(w, http.StatusOK, c)
+}
+
+// stream sends the reply as server-sent events, as it's received.
+func (c *completion) stream(w http.ResponseWriter, stream llm.Stream, e *logEntry, includeUsage bool) error {
+	c.Object = "chat.completion.chunk"
+	flusher, _ := w.(http.Flusher)
+	started := false
+	send := func(v any) error {
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			started = true
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", b); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+	chunk := func(delta map[string]any, finish any) error {
+		c.Choices = []any{map[string]any{"index": 0, "delta": delta, "finish_reason": finish}}
+		return send(c)
+	}
+	first := true
+	var u *llm.Usage
+	for {
+		event, err := stream.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if started {
+				// Headers are sent, so the error can't change the status.
+				e.Status = http.StatusBadGateway
+				e.Error = err.Error()
+				return nil
+			}
+			return err
+		}
+		switch ev := event.(type) {
+		case llm.TextDelta:
+			delta := map[string]any{"content": ev.Text}
+			if first {
+				delta["role"] = llm.RoleAssistant
+				first = false
+			}
+			if err := chunk(delta, nil); err != nil {
+				return nil
+			}
+		case *llm.Usage:
+			u = ev
+			e.InputTokens, e.OutputTokens = ev.InputTokens, ev.OutputTokens
+		case llm.Done:
+			if err := chunk(map[string]any{}, ev.FinishReason); err != nil {
+				return nil
+			}
+		}
+	}
+	if includeUsage && u != nil {
+		c.Choices = []any{}
+		c.Usage = toUsage(u)
+		if err := send(c); err != nil {
+			return nil
+		}
+	}
+	io.WriteString(w, "data: [DONE]\n\n")
+	return nil
+}
+
+// listModels lists the models named by routes. Any other model name is
+// passed through to the default client, so this list is not exhaustive.
+func (s *Server) listModels(w http.ResponseWriter, r *http.Request, e *logEntry) error {
+	list := &openai.GenericObject{Object: "list", Data: []openai.GenericObject{}}
+	if s.Config != nil {
+		for _, route := range s.Config.Routes {
+			if strings.ContainsAny(route.Model, `*?[\`) {
+				continue
+			}
+			list.Data = append(list.Data, openai.GenericObject{Object: "model", ID: route.Model, OwnedBy: "gpt-cli"})
+		}
+	}
+	return writeJSON(w, http.StatusOK, list)
+}
+
+func newID(prefix string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+// NewKey returns a random API key for Config.Keys.
+func NewKey() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return "gpt-cli-" + hex.EncodeToString(b)
+}
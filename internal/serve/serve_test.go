@@ -0,0 +1,449 @@
+package serve_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/internal/ratelimit"
+	"github.com/bduffany/gpt-cli/internal/serve"
+	"github.com/bduffany/gpt-cli/internal/sse"
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/llm/llmtest"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+func reply(text string) *llmtest.Response {
+	rsp := llmtest.Text(text)
+	rsp.Events = append(rsp.Events, &llm.Usage{InputTokens: 7, OutputTokens: 2})
+	return rsp
+}
+
+func start(t *testing.T, s *serve.Server) string {
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func post(t *testing.T, url, key, body string) (int, string) {
+	req, err := http.NewRequest("POST", url+"/v1/chat/completions", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+	b, _ := io.ReadAll(rsp.Body)
+	return rsp.StatusCode, string(b)
+}
+
+func TestChatCompletion(t *testing.T) {
+	client := llmtest.NewClient(reply("Hello world"))
+	var log bytes.Buffer
+	url := start(t, &serve.Server{
+		Client: client,
+		Config: &serve.Config{
+			Keys:   []serve.Key{{Name: "editor", Key: "secret"}},
+			Routes: []serve.Route{{Model: "fast", Target: "gpt-4.1-mini"}},
+		},
+		Log: &log,
+	})
+
+	status, body := post(t, url, "secret", `{"model": "fast", "messages": [{"role": "developer", "content": "Be brief."}, {"role": "user", "content": [{"type": "text", "text": "Hi"}]}]}`)
+	if status != http.StatusOK {
+		t.Fatalf("status %d: %s", status, body)
+	}
+	var rsp struct {
+		Model   string
+		Choices []struct {
+			Message      llm.Message
+			FinishReason string `json:"finish_reason"`
+		}
+		Usage struct {
+			TotalTokens int `json:"total_tokens"`
+		}
+	}
+	if err := json.Unmarshal([]byte(body), &rsp); err != nil {
+		t.Fatal(err)
+	}
+	if rsp.Model != "fast" || len(rsp.Choices) != 1 || rsp.Choices[0].Message.Content != "Hello world" || rsp.Choices[0].FinishReason != "stop" || rsp.Usage.TotalTokens != 9 {
+		t.Errorf("response = %s", body)
+	}
+	req := client.Requests()[0]
+	if req.Model != "gpt-4.1-mini" || req.Messages[0].Role != llm.RoleSystem || req.Messages[1].Content != "Hi" {
+		t.Errorf("upstream request = %+v", req)
+	}
+	for _, want := range []string{`"key":"editor"`, `"model":"fast"`, `"upstream_model":"gpt-4.1-mini"`, `"status":200`, `"input_tokens":7`} {
+		if !strings.Contains(log.String(), want) {
+			t.Errorf("log %q is missing %s", log.String(), want)
+		}
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	url := start(t, &serve.Server{
+		Client: llmtest.NewClient(),
+		Config: &serve.Config{Keys: []serve.Key{{Name: "editor", Key: "secret"}}},
+	})
+	for _, key := range []string{"", "wrong"} {
+		if status, body := post(t, url, key, `{"model": "gpt-4o", "messages": [{"role": "user", "content": "Hi"}]}`); status != http.StatusUnauthorized {
+			t.Errorf("with key %q: status %d: %s", key, status, body)
+		}
+	}
+}
+
+func TestBadRequest(t *testing.T) {
+	url := start(t, &serve.Server{Client: llmtest.NewClient()})
+	for _, body := range []string{
+		`{"messages": [{"role": "user", "content": "Hi"}]}`,
+		`{"model": "gpt-4o", "messages": []}`,
+		`{"model": "gpt-4o", "messages": [{"role": "tool", "content": "Hi"}]}`,
+		`{"model": "gpt-4o", "messages": [{"role": "user", "content": "Hi"}], "tools": [{}]}`,
+	} {
+		if status, rsp := post(t, url, "", body); status != http.StatusBadRequest || !strings.Contains(rsp, `"error"`) {
+			t.Errorf("%s: status %d: %s", body, status, rsp)
+		}
+	}
+}
+
+// TestRejectsWebPages checks that a web page can't make requests, such as
+// with a form post, which browsers send as text/plain without preflight.
+func TestRejectsWebPages(t *testing.T) {
+	client := llmtest.NewClient()
+	url := start(t, &serve.Server{Client: client, NewChat: newChat})
+	body := `{"model": "gpt-4o", "messages": [{"role": "user", "content": "Hi"}]}`
+	for _, tc := range []struct {
+		path, contentType, origin string
+		status                    int
+	}{
+		{"/v1/chat/completions", "text/plain", "", http.StatusUnsupportedMediaType},
+		{"/v1/chat/completions", "", "", http.StatusUnsupportedMediaType},
+		{"/v1/chat/completions", "application/json", "https://example.com", http.StatusForbidden},
+		{"/v1/sessions", "text/plain;charset=UTF-8", "", http.StatusUnsupportedMediaType},
+		{"/v1/sessions", "application/json", "https://example.com", http.StatusForbidden},
+	} {
+		req, err := http.NewRequest("POST", url+tc.path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != tc.status {
+			t.Errorf("%s with Content-Type %q and Origin %q: status %d, want %d", tc.path, tc.contentType, tc.origin, rsp.StatusCode, tc.status)
+		}
+	}
+	if n := len(client.Requests()); n != 0 {
+		t.Errorf("%d requests were sent upstream, want none", n)
+	}
+}
+
+// TestStreamThroughRoute streams a reply from one server routed through
+// another, read with this repo's own OpenAI client.
+func TestStreamThroughRoute(t *testing.T) {
+	upstream := llmtest.NewClient(reply("Hello from upstream"))
+	upstreamURL := start(t, &serve.Server{
+		Client: upstream,
+		Config: &serve.Config{Keys: []serve.Key{{Key: "upstream-key"}}},
+	})
+	t.Setenv("UPSTREAM_KEY", "upstream-key")
+	url := start(t, &serve.Server{
+		Client: llmtest.NewClient(),
+		Config: &serve.Config{Routes: []serve.Route{{Model: "llama*", BaseURL: upstreamURL, APIKeyEnv: "UPSTREAM_KEY"}}},
+	})
+
+	client := &openai.Client{BaseURL: url}
+	s, err := client.GetCompletion(context.Background(), &llm.Request{
+		Model:    "llama3",
+		Messages: []llm.Message{{Role: llm.RoleUser, Content: "Hi"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := llm.NewReader(s)
+	text, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if string(text) != "Hello from upstream" || r.FinishReason != "stop" || r.Usage == nil || r.Usage.OutputTokens != 2 {
+		t.Errorf("got %q, finish reason %q, usage %+v", text, r.FinishReason, r.Usage)
+	}
+	if got := upstream.Requests()[0].Model; got != "llama3" {
+		t.Errorf("upstream model = %q, want llama3", got)
+	}
+}
+
+// TestMiddleware checks that middleware wraps requests to the default
+// client, to routes with a BaseURL, and from sessions.
+func TestMiddleware(t *testing.T) {
+	upstream := llmtest.NewClient(reply("Routed"), reply("Routed session"))
+	upstreamURL := start(t, &serve.Server{Client: upstream})
+	var mu sync.Mutex
+	var seen []string
+	record := func(next llm.CompletionClient) llm.CompletionClient {
+		return llm.ClientFunc(func(ctx context.Context, req *llm.Request) (llm.Stream, error) {
+			mu.Lock()
+			seen = append(seen, req.Model)
+			mu.Unlock()
+			return next.GetCompletion(ctx, req)
+		})
+	}
+	url := start(t, &serve.Server{
+		Client:     llmtest.NewClient(reply("Default")),
+		Config:     &serve.Config{Routes: []serve.Route{{Model: "llama*", BaseURL: upstreamURL}}},
+		Middleware: []llm.Middleware{record},
+		NewChat:    newChat,
+	})
+
+	for _, model := range []string{"gpt-4o", "llama3"} {
+		if status, body := post(t, url, "", `{"model": "`+model+`", "messages": [{"role": "user", "content": "Hi"}]}`); status != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", model, status, body)
+		}
+	}
+	var sess struct{ ID string }
+	if err := json.NewDecoder(do(t, "POST", url+"/v1/sessions", `{"model": "llama3"}`).Body).Decode(&sess); err != nil {
+		t.Fatal(err)
+	}
+	if got := events(t, do(t, "POST", url+"/v1/sessions/"+sess.ID+"/messages", `{"content": "Hi"}`)); got["delta"] != "Routed session" {
+		t.Errorf("session events = %q", got)
+	}
+	if got := strings.Join(seen, " "); got != "gpt-4o llama3 llama3" {
+		t.Errorf("middleware saw %q, want gpt-4o llama3 llama3", got)
+	}
+}
+
+// TestRateLimit checks that the rate limits in the middleware hold back
+// requests from all of the server's clients.
+func TestRateLimit(t *testing.T) {
+	client := llmtest.NewClient(reply("First"), reply("Second"))
+	limiter, err := ratelimit.New([]ratelimit.Limit{{Model: "gpt-*", RPM: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiting := make(chan string, 1)
+	limiter.Notef = func(format string, args ...any) {
+		waiting <- fmt.Sprintf(format, args...)
+	}
+	url := start(t, &serve.Server{Client: client, Middleware: []llm.Middleware{limiter.Middleware}})
+
+	body := `{"model": "gpt-4o", "messages": [{"role": "user", "content": "Hi"}]}`
+	if status, rsp := post(t, url, "", body); status != http.StatusOK {
+		t.Fatalf("first request: status %d: %s", status, rsp)
+	}
+	// The second request waits for the limit, until its client gives up.
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, "POST", url+"/v1/chat/completions", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	done := make(chan error, 1)
+	go func() {
+		rsp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			rsp.Body.Close()
+		}
+		done <- err
+	}()
+	if note := <-waiting; !strings.Contains(note, "rate limit on gpt-*") {
+		t.Errorf("note = %q", note)
+	}
+	cancel()
+	<-done
+	if n := len(client.Requests()); n != 1 {
+		t.Errorf("%d requests were sent upstream, want 1", n)
+	}
+}
+
+func TestListModels(t *testing.T) {
+	url := start(t, &serve.Server{
+		Client: llmtest.NewClient(),
+		Config: &serve.Config{Routes: []serve.Route{{Model: "fast", Target: "gpt-4.1-mini"}, {Model: "llama*"}}},
+	})
+	var list openai.GenericObject
+	if err := (&openai.Client{BaseURL: url}).GetJSON(context.Background(), "/v1/models", &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Data) != 1 || list.Data[0].ID != "fast" {
+		t.Errorf("models = %+v, want only fast", list.Data)
+	}
+}
+
+func newChat(client llm.CompletionClient, model, system string) (*chat.Chat, error) {
+	c, err := chat.New(client, []llm.Message{{Role: llm.RoleSystem, Content: "You are helpful."}})
+	if err != nil {
+		return nil, err
+	}
+	if model != "" {
+		c.Model = model
+	}
+	return c, nil
+}
+
+func do(t *testing.T, method, url, body string) *http.Response {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { rsp.Body.Close() })
+	return rsp
+}
+
+// events reads the server-sent events of a reply, joining the text of
+// each type.
+func events(t *testing.T, rsp *http.Response) map[string]string {
+	got := map[string]string{}
+	r := sse.NewReader(rsp.Body)
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return got
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var data struct {
+			Text    string `json:"text"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal([]byte(e.Data), &data)
+		if e.Type == "done" {
+			got[e.Type] = e.Data
+		} else {
+			got[e.Type] += data.Text + data.Message
+		}
+	}
+}
+
+func TestSessions(t *testing.T) {
+	client := llmtest.NewClient(reply("Hello"), llmtest.Error(errors.New("upstream down")), reply("Still here"))
+	url := start(t, &serve.Server{Client: client, NewChat: newChat})
+
+	rsp := do(t, "POST", url+"/v1/sessions", `{"model": "gpt-test"}`)
+	var sess struct {
+		ID       string
+		Model    string
+		Messages []llm.Message
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(&sess); err != nil || rsp.StatusCode != http.StatusCreated {
+		t.Fatalf("create: status %d, err %v", rsp.StatusCode, err)
+	}
+	if sess.Model != "gpt-test" {
+		t.Errorf("model = %q, want gpt-test", sess.Model)
+	}
+	messages := url + "/v1/sessions/" + sess.ID + "/messages"
+
+	got := events(t, do(t, "POST", messages, `{"content": "Hi"}`))
+	if got["delta"] != "Hello" || !strings.Contains(got["done"], `"finish_reason":"stop"`) || !strings.Contains(got["done"], `"total_tokens":9`) {
+		t.Errorf("events = %q", got)
+	}
+
+	// A failed reply leaves the history as it was.
+	if rsp := do(t, "POST", messages, `{"content": "Again"}`); rsp.StatusCode != http.StatusBadGateway {
+		t.Errorf("failed reply: status %d, want 502", rsp.StatusCode)
+	}
+	if got := events(t, do(t, "POST", messages, `{"content": "Still there?"}`)); got["delta"] != "Still here" {
+		t.Errorf("events = %q", got)
+	}
+	if got := client.Requests()[2].Messages; len(got) != 4 || got[3].Content != "Still there?" {
+		t.Errorf("third request messages = %q, want the failed prompt left out", got)
+	}
+
+	// Resuming returns the conversation so far.
+	rsp = do(t, "GET", url+"/v1/sessions/"+sess.ID, "")
+	if err := json.NewDecoder(rsp.Body).Decode(&sess); err != nil {
+		t.Fatal(err)
+	}
+	var contents []string
+	for _, m := range sess.Messages {
+		contents = append(contents, m.Content)
+	}
+	if got, want := strings.Join(contents, "|"), "You are helpful.|Hi|Hello|Still there?|Still here"; got != want {
+		t.Errorf("messages = %q, want %q", got, want)
+	}
+
+	if rsp := do(t, "DELETE", url+"/v1/sessions/"+sess.ID, ""); rsp.StatusCode != http.StatusNoContent {
+		t.Errorf("delete: status %d", rsp.StatusCode)
+	}
+	if rsp := do(t, "GET", url+"/v1/sessions/"+sess.ID, ""); rsp.StatusCode != http.StatusNotFound {
+		t.Errorf("get deleted session: status %d, want 404", rsp.StatusCode)
+	}
+}
+
+func TestSessionOwner(t *testing.T) {
+	client := llmtest.NewClient()
+	url := start(t, &serve.Server{
+		Client:  client,
+		Config:  &serve.Config{Keys: []serve.Key{{Name: "editor", Key: "secret"}, {Name: "other", Key: "other-secret"}}},
+		NewChat: newChat,
+	})
+	send := func(method, path, key, body string) *http.Response {
+		req, err := http.NewRequest(method, url+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+key)
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { rsp.Body.Close() })
+		return rsp
+	}
+
+	var sess struct{ ID string }
+	rsp := send("POST", "/v1/sessions", "secret", `{}`)
+	if err := json.NewDecoder(rsp.Body).Decode(&sess); err != nil || rsp.StatusCode != http.StatusCreated {
+		t.Fatalf("create: status %d, err %v", rsp.StatusCode, err)
+	}
+	if rsp := send("GET", "/v1/sessions/"+sess.ID, "other-secret", ""); rsp.StatusCode != http.StatusNotFound {
+		t.Errorf("get with another key: status %d, want 404", rsp.StatusCode)
+	}
+	if rsp := send("DELETE", "/v1/sessions/"+sess.ID, "other-secret", ""); rsp.StatusCode != http.StatusNotFound {
+		t.Errorf("delete with another key: status %d, want 404", rsp.StatusCode)
+	}
+	if rsp := send("GET", "/v1/sessions/"+sess.ID, "secret", ""); rsp.StatusCode != http.StatusOK {
+		t.Errorf("get with the creating key: status %d, want 200", rsp.StatusCode)
+	}
+
+	// The number of sessions is capped.
+	status := 0
+	for i := 0; i < 200 && status != http.StatusTooManyRequests; i++ {
+		status = send("POST", "/v1/sessions", "other-secret", `{}`).StatusCode
+	}
+	if status != http.StatusTooManyRequests {
+		t.Errorf("creating 200 sessions: last status %d, want 429", status)
+	}
+}
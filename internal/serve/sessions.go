@@ -0,0 +1,275 @@
+package serve
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+// The session API lets editor integrations drive a chat held by the
+// server, the same as an interactive session, without implementing a
+// provider client:
+//
+//	POST   /v1/sessions               {"model", "system", "messages"} -> session
+//	GET    /v1/sessions/ID            -> session, to resume after reconnecting
+//	POST   /v1/sessions/ID/messages   {"content"} -> reply as server-sent events
+//	DELETE /v1/sessions/ID
+//
+// Replies stream as "delta" and "reasoning" events with {"text"}, then end
+// with a "done" event with {"finish_reason", "usage"}, or an "error" event
+// with {"message"}.
+
+// Sessions idle for sessionIdleTimeout are dropped, and no more than
+// maxSessions are held at once, so that clients that never delete theirs
+// don't grow the server without bound.
+const (
+	sessionIdleTimeout = time.Hour
+	maxSessions        = 100
+)
+
+// session is a chat held by the server.
+type session struct {
+	id      string
+	created time.Time
+	// owner is the name of the key that created the session, which is the
+	// only one that can use it.
+	owner string
+	// used is when the session was last requested, guarded by Server.mu.
+	used time.Time
+	// mu is held while a reply is streaming, so each session handles one
+	// prompt at a time.
+	mu   sync.Mutex
+	chat *chat.Chat
+}
+
+// sessionJSON is a session as returned by the API.
+type sessionJSON struct {
+	ID       string        `json:"id"`
+	Model    string        `json:"model"`
+	Created  int64         `json:"created"`
+	Messages []llm.Message `json:"messages"`
+}
+
+func (s *session) json() *sessionJSON {
+	return &sessionJSON{ID: s.id, Model: s.chat.Model, Created: s.created.Unix(), Messages: s.chat.Messages}
+}
+
+// createSession handles /v1/sessions.
+func (s *Server) createSession(w http.ResponseWriter, r *http.Request, e *logEntry) error {
+	if r.Method != "POST" {
+		return &apiError{http.StatusMethodNotAllowed, "method_not_allowed", "use POST"}
+	}
+	if err := checkJSON(r); err != nil {
+		return err
+	}
+	var req struct {
+		Model    string        `json:"model"`
+		System   string        `json:"system"`
+		Messages []llm.Message `json:"messages"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		return badRequest("invalid request body: %s", err)
+	}
+	for i, m := range req.Messages {
+		if m.Role != llm.RoleUser && m.Role != llm.RoleAssistant && m.Role != llm.RoleSystem {
+			return badRequest("messages[%d]: unsupported role %q", i, m.Role)
+		}
+	}
+	client, target := s.route(req.Model)
+	c, err := s.NewChat(client, target, req.System)
+	if err != nil {
+		return badRequest("%s", err)
+	}
+	c.Display = io.Discard
+	c.Interactive = false
+	c.Messages = append(c.Messages, req.Messages...)
+	e.Model, e.UpstreamModel = req.Model, c.Model
+
+	now := time.Now()
+	sess := &session{id: newID("sess-"), created: now, owner: e.Key, used: now, chat: c}
+	s.mu.Lock()
+	if s.sessions == nil {
+		s.sessions = map[string]*session{}
+	}
+	for id, old := range s.sessions {
+		if now.Sub(old.used) > sessionIdleTimeout {
+			delete(s.sessions, id)
+		}
+	}
+	if len(s.sessions) >= maxSessions {
+		s.mu.Unlock()
+		return &apiError{http.StatusTooManyRequests, "too_many_sessions", fmt.Sprintf("there are already %d sessions; delete one first", maxSessions)}
+	}
+	s.sessions[sess.id] = sess
+	s.mu.Unlock()
+	e.Status = http.StatusCreated
+	return writeJSON(w, http.StatusCreated, sess.json())
+}
+
+// sessionRequest handles /v1/sessions/ID and /v1/sessions/ID/messages.
+func (s *Server) sessionRequest(w http.ResponseWriter, r *http.Request, e *logEntry) error {
+	id, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/sessions/"), "/")
+	s.mu.Lock()
+	sess := s.sessions[id]
+	switch {
+	case sess == nil:
+	case sess.owner != e.Key, time.Since(sess.used) > sessionIdleTimeout:
+		// Other keys' sessions are reported as missing, so that their IDs
+		// aren't revealed.
+		sess = nil
+	default:
+		sess.used = time.Now()
+	}
+	s.mu.Unlock()
+	if sess == nil {
+		return &apiError{http.StatusNotFound, "session_not_found", fmt.Sprintf("no session %q", id)}
+	}
+	switch {
+	case rest == "" && r.Method == "GET":
+		if !sess.mu.TryLock() {
+			return busy()
+		}
+		defer sess.mu.Unlock()
+		return writeJSON(w, http.StatusOK, sess.json())
+	case rest == "" && r.Method == "DELETE":
+		s.mu.Lock()
+		delete(s.sessions, id)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		e.Status = http.StatusNoContent
+		return nil
+	case rest == "messages" && r.Method == "POST":
+		return s.sendMessage(w, r, e, sess)
+	}
+	return &apiError{http.StatusNotFound, "not_found", "unknown session endpoint"}
+}
+
+func busy() error {
+	return &apiError{http.StatusConflict, "session_busy", "the session is replying to another message"}
+}
+
+// sendMessage sends a prompt to the session's chat and streams the reply.
+func (s *Server) sendMessage(w http.ResponseWriter, r *http.Request, e *logEntry, sess *session) error {
+	if err := checkJSON(r); err != nil {
+		return err
+	}
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return badRequest("invalid request body: %s", err)
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		return badRequest("content is required")
+	}
+	if !sess.mu.TryLock() {
+		return busy()
+	}
+	defer sess.mu.Unlock()
+	c := sess.chat
+	e.Model, e.Stream = c.Model, true
+
+	// Undo the prompt if there's no complete reply, so the history stays a
+	// valid conversation to resume.
+	n := len(c.Messages)
+	complete := false
+	defer func() {
+		if !complete {
+			c.Messages = c.Messages[:n]
+		}
+	}()
+
+	ctx := r.Context()
+	prompt := req.Content
+	for _, hook := range c.PromptHooks {
+		var err error
+		if prompt, err = hook(ctx, prompt); err != nil {
+			return err
+		}
+	}
+	reply, err := c.Send(ctx, prompt)
+	if err != nil {
+		return err
+	}
+	defer reply.Close()
+	reply.Raw = true
+
+	ev := &eventWriter{w: w}
+	ev.flusher, _ = w.(http.Flusher)
+	reply.Reasoning = ev.text("reasoning")
+	if _, err := io.Copy(ev.text("delta"), reply); err != nil {
+		if !ev.started {
+			return err
+		}
+		e.Status, e.Error = http.StatusBadGateway, err.Error()
+		ev.send("error", map[string]any{"message": err.Error()})
+		return nil
+	}
+	complete = true
+	done := map[string]any{"finish_reason": reply.FinishReason}
+	if u := reply.Usage; u != nil {
+		done["usage"] = toUsage(u)
+		e.InputTokens, e.OutputTokens = u.InputTokens, u.OutputTokens
+	}
+	ev.send("done", done)
+	return nil
+}
+
+// eventWriter writes server-sent events.
+type eventWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	started bool
+}
+
+func (ev *eventWriter) send(event string, data any) error {
+	if !ev.started {
+		ev.w.Header().Set("Content-Type", "text/event-stream")
+		ev.w.Header().Set("Cache-Control", "no-cache")
+		ev.started = true
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(ev.w, "event: %s\ndata: %s\n\n", event, b); err != nil {
+		return err
+	}
+	if ev.flusher != nil {
+		ev.flusher.Flush()
+	}
+	return nil
+}
+
+// text returns a writer that sends each write as an event with {"text"}.
+func (ev *eventWriter) text(event string) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		if err := ev.send(event, map[string]any{"text": string(p)}); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
+// writeJSON writes a response. Errors can't be reported once the status is
+// written, so they're ignored.
+func writeJSON(w http.ResponseWriter, status int, v any) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+	return nil
+}
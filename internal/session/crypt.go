@@ -0,0 +1,162 @@
+package session
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// sealedMagic starts each encrypted session file, followed by a 24-byte
+// nonce and the secretbox of the session's JSON.
+var sealedMagic = []byte("gpt-cli sealed v1\n")
+
+// Key is a secretbox key for encrypting sessions.
+type Key [32]byte
+
+// NewKeyFile returns the key stored in a file as hex, creating the file
+// with a random key if it doesn't exist. Anyone who can read the file can
+// read the sessions, so it should be kept out of backups and synced dirs
+// that hold the sessions themselves.
+func NewKeyFile(path string) (*Key, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		key := &Key{}
+		rand.Read(key[:])
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return nil, err
+		}
+		_, err = f.WriteString(hex.EncodeToString(key[:]) + "\n")
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return key, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	key := &Key{}
+	if n, err := hex.Decode(key[:], bytes.TrimSpace(b)); err != nil || n != len(key) {
+		return nil, fmt.Errorf("%s: invalid key", path)
+	}
+	return key, nil
+}
+
+// NewPassphraseKey derives a key from a passphrase with scrypt. The salt is
+// stored in saltPath, which is created if it doesn't exist.
+func NewPassphraseKey(passphrase, saltPath string) (*Key, error) {
+	salt, err := os.ReadFile(saltPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		salt = make([]byte, 16)
+		rand.Read(salt)
+		if err := os.MkdirAll(filepath.Dir(saltPath), 0700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(saltPath, salt, 0600); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	return passphraseKey(passphrase, salt)
+}
+
+func passphraseKey(passphrase string, salt []byte) (*Key, error) {
+	b, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, len(Key{}))
+	if err != nil {
+		return nil, err
+	}
+	key := &Key{}
+	copy(key[:], b)
+	return key, nil
+}
+
+var (
+	// ErrEncrypted is returned when reading an encrypted session without a
+	// key.
+	ErrEncrypted = errors.New("session is encrypted, but no key is configured")
+	// ErrNoKey is returned when saving with encryption but without a key.
+	ErrNoKey = errors.New("no key to encrypt sessions with")
+)
+
+func seal(key *Key, plaintext []byte) []byte {
+	var nonce [24]byte
+	rand.Read(nonce[:])
+	out := append(append([]byte{}, sealedMagic...), nonce[:]...)
+	return secretbox.Seal(out, plaintext, &nonce, (*[32]byte)(key))
+}
+
+// unseal decrypts a sealed session. Sessions saved before encryption was
+// turned on are returned as is.
+func unseal(key *Key, b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, sealedMagic) {
+		return b, nil
+	}
+	if key == nil {
+		return nil, ErrEncrypted
+	}
+	b = b[len(sealedMagic):]
+	if len(b) < 24 {
+		return nil, fmt.Errorf("sealed session is truncated")
+	}
+	var nonce [24]byte
+	copy(nonce[:], b)
+	out, ok := secretbox.Open(nil, b[24:], &nonce, (*[32]byte)(key))
+	if !ok {
+		return nil, fmt.Errorf("decrypt session: wrong key or corrupt data")
+	}
+	return out, nil
+}
+
+// sealedBundleMagic starts each encrypted bundle, followed by a 16-byte
+// scrypt salt, and then a sealed bundle as for sessions. The salt travels
+// with the bundle, so that anyone with the passphrase can open it.
+var sealedBundleMagic = []byte("gpt-cli sealed bundle v1\n")
+
+// SealBundle encrypts a bundle with a key derived from a passphrase.
+func SealBundle(passphrase string, bundle []byte) ([]byte, error) {
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	key, err := passphraseKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	out := append(append([]byte{}, sealedBundleMagic...), salt...)
+	return append(out, seal(key, bundle)...), nil
+}
+
+// OpenBundle decrypts a bundle sealed by SealBundle.
+func OpenBundle(passphrase string, b []byte) ([]byte, error) {
+	if !bytes.HasPrefix(b, sealedBundleMagic) {
+		return nil, fmt.Errorf("not a sealed bundle")
+	}
+	b = b[len(sealedBundleMagic):]
+	if len(b) < 16 {
+		return nil, fmt.Errorf("sealed bundle is truncated")
+	}
+	// Unlike session files, a bundle is never plaintext, so that the
+	// server holding it can't swap in sessions of its own.
+	if !bytes.HasPrefix(b[16:], sealedMagic) {
+		return nil, fmt.Errorf("sealed bundle isn't encrypted")
+	}
+	key, err := passphraseKey(passphrase, b[:16])
+	if err != nil {
+		return nil, err
+	}
+	out, err := unseal(key, b[16:])
+	if err != nil {
+		return nil, fmt.Errorf("decrypt bundle: wrong passphrase or corrupt data")
+	}
+	return out, nil
+}
@@ -0,0 +1,172 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/internal/httpx"
+)
+
+// pushAttempts is how many times Push retries when another push changes
+// the remote bundle between reading and writing it.
+const pushAttempts = 5
+
+// Remote is a bundle of sessions kept at a URL, shared by a team. The
+// bundle is encrypted with a passphrase before it's uploaded, so that the
+// server only ever sees ciphertext. Any server that stores the body of a
+// PUT and returns it from a GET works, such as an S3 or GCS bucket through
+// a presigned URL or a bearer token. If the server returns ETags and checks
+// If-Match, concurrent pushes don't lose sessions.
+type Remote struct {
+	URL string
+	// Headers are sent with each request, such as for authentication.
+	Headers map[string]string
+	// Passphrase encrypts the bundle, and must be the same for everyone
+	// sharing it.
+	Passphrase string
+	// Client defaults to httpx.Default.
+	Client *http.Client
+}
+
+// Pull returns the sessions in the remote bundle, which is empty if it
+// hasn't been pushed yet.
+func (r *Remote) Pull(ctx context.Context) (*Bundle, error) {
+	b, _, err := r.fetch(ctx)
+	return b, err
+}
+
+// Push merges sessions into the remote bundle, replacing those with the
+// same ID that were updated earlier. It returns the number of sessions
+// added or replaced.
+func (r *Remote) Push(ctx context.Context, sessions []*Session) (int, error) {
+	for attempt := 0; ; attempt++ {
+		b, etag, err := r.fetch(ctx)
+		if err != nil {
+			return 0, err
+		}
+		merged, n := mergeSessions(b.Sessions, sessions)
+		if n == 0 {
+			return 0, nil
+		}
+		err = r.store(ctx, merged, etag)
+		if err == errPreconditionFailed && attempt+1 < pushAttempts {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		return n, nil
+	}
+}
+
+// mergeSessions returns the sessions of remote with those of local added or
+// replacing older ones, and the number added or replaced.
+func mergeSessions(remote, local []*Session) ([]*Session, int) {
+	out := append([]*Session(nil), remote...)
+	index := map[string]int{}
+	for i, s := range out {
+		index[s.ID] = i
+	}
+	n := 0
+	for _, s := range local {
+		i, ok := index[s.ID]
+		if !ok {
+			index[s.ID] = len(out)
+			out = append(out, s)
+			n++
+			continue
+		}
+		if s.Updated.After(out[i].Updated) {
+			out[i] = s
+			n++
+		}
+	}
+	return out, n
+}
+
+var errPreconditionFailed = errors.New("remote bundle changed while pushing")
+
+// fetch returns the remote bundle and its ETag, if the server sent one.
+func (r *Remote) fetch(ctx context.Context) (*Bundle, string, error) {
+	rsp, err := r.do(ctx, "GET", nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode == http.StatusNotFound {
+		return &Bundle{Version: BundleVersion}, "", nil
+	}
+	if rsp.StatusCode/100 != 2 {
+		return nil, "", httpError("pull sessions", rsp)
+	}
+	sealed, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	plain, err := OpenBundle(r.Passphrase, sealed)
+	if err != nil {
+		return nil, "", err
+	}
+	b, err := ReadBundle(bytes.NewReader(plain))
+	if err != nil {
+		return nil, "", err
+	}
+	return b, rsp.Header.Get("ETag"), nil
+}
+
+// store uploads sessions as the remote bundle, if it's still at etag, or
+// doesn't exist yet if etag is "".
+func (r *Remote) store(ctx context.Context, sessions []*Session, etag string) error {
+	buf := &bytes.Buffer{}
+	if err := WriteBundle(buf, sessions); err != nil {
+		return err
+	}
+	sealed, err := SealBundle(r.Passphrase, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	header := http.Header{"Content-Type": {"application/octet-stream"}}
+	if etag != "" {
+		header.Set("If-Match", etag)
+	}
+	rsp, err := r.do(ctx, "PUT", header, sealed)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode == http.StatusPreconditionFailed {
+		return errPreconditionFailed
+	}
+	if rsp.StatusCode/100 != 2 {
+		return httpError("push sessions", rsp)
+	}
+	return nil
+}
+
+func (r *Remote) do(ctx context.Context, method string, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, r.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	for k, v := range r.Headers {
+		req.Header.Set(k, v)
+	}
+	client := r.Client
+	if client == nil {
+		client = httpx.Default
+	}
+	return client.Do(req)
+}
+
+func httpError(op string, rsp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(rsp.Body, 1024))
+	return fmt.Errorf("%s: %s: %s", op, rsp.Status, strings.TrimSpace(string(body)))
+}
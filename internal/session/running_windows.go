@@ -0,0 +1,16 @@
+//go:build windows
+
+package session
+
+import "os"
+
+// running reports whether a process is running. On Windows, finding a
+// process fails if it has exited.
+func running(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -0,0 +1,636 @@
+// Package session saves chats to disk after each turn, so they can be
+// listed and resumed later, including after a crash.
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+// Session is a saved chat.
+type Session struct {
+	ID       string        `json:"id"`
+	Name     string        `json:"name,omitempty"`
+	Model    string        `json:"model"`
+	Created  time.Time     `json:"created"`
+	Updated  time.Time     `json:"updated"`
+	Messages []llm.Message `json:"messages"`
+	// Drafts are the answers of the council members that replies were
+	// synthesized from, with -council.
+	Drafts []Draft `json:"drafts,omitempty"`
+	// Tags organize sessions, such as by project. They're kept sorted.
+	Tags []string `json:"tags,omitempty"`
+	// PID is the process that has the session open, or 0 once the session
+	// is closed. A session left open by a process that's no longer running
+	// was interrupted by a crash.
+	PID int `json:"pid,omitempty"`
+	// Revision counts the saves of the session, so that a save doesn't
+	// overwrite changes saved by another process since it was loaded.
+	Revision int `json:"revision,omitempty"`
+}
+
+// Draft is a council member's answer, which a reply was synthesized from.
+type Draft struct {
+	// Message is the index of the reply in Messages.
+	Message int    `json:"message"`
+	Model   string `json:"model"`
+	Content string `json:"content,omitempty"`
+	// Error is why the member failed to answer, if it did.
+	Error string `json:"error,omitempty"`
+}
+
+// New returns a session opened by this process.
+func New(model string) *Session {
+	now := time.Now()
+	b := make([]byte, 3)
+	rand.Read(b)
+	return &Session{
+		ID:      now.Format("20060102-150405") + "-" + hex.EncodeToString(b),
+		Model:   model,
+		Created: now,
+		Updated: now,
+		PID:     os.Getpid(),
+	}
+}
+
+// Fork gives the session a new ID, so that it's saved apart from the one
+// it was loaded from.
+func (s *Session) Fork() {
+	s.ID = New("").ID
+	s.Revision = 0
+}
+
+// Prompts returns the number of user prompts in the session.
+func (s *Session) Prompts() int {
+	n := 0
+	for _, m := range s.Messages {
+		if m.Role == llm.RoleUser {
+			n++
+		}
+	}
+	return n
+}
+
+// Tag adds tags to the session.
+func (s *Session) Tag(tags ...string) {
+	for _, tag := range tags {
+		if !s.HasTag(tag) {
+			s.Tags = append(s.Tags, tag)
+		}
+	}
+	sort.Strings(s.Tags)
+}
+
+// Untag removes tags from the session.
+func (s *Session) Untag(tags ...string) {
+	s.Tags = slices.DeleteFunc(s.Tags, func(tag string) bool {
+		return slices.Contains(tags, tag)
+	})
+}
+
+func (s *Session) HasTag(tag string) bool {
+	return slices.Contains(s.Tags, tag)
+}
+
+// ParseAge parses a duration like time.ParseDuration, but also accepts
+// days and weeks, like "7d" or "2w", which suit the ages of sessions.
+func ParseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			v, err := strconv.ParseFloat(n, 64)
+			if err != nil || v < 0 {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return time.Duration(v * float64(unit)), nil
+		}
+	}
+	return time.ParseDuration(s)
+}
+
+// ParseSize parses a size in bytes, like "500MB" or "2GiB".
+func ParseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		n      int64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"B", 1},
+	}
+	num, unit := strings.TrimSpace(s), int64(1)
+	for _, u := range units {
+		if n, ok := strings.CutSuffix(num, u.suffix); ok {
+			num, unit = strings.TrimSpace(n), u.n
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(v * float64(unit)), nil
+}
+
+// maxTitleLen bounds the length of titles, in runes.
+const maxTitleLen = 60
+
+// Title returns a title for a session from its first prompt, for when a
+// model can't write one.
+func Title(messages []llm.Message) string {
+	for _, m := range messages {
+		if m.Role == llm.RoleUser {
+			return shorten(strings.Join(strings.Fields(m.Content), " "))
+		}
+	}
+	return ""
+}
+
+// shorten cuts a title to maxTitleLen at a word boundary.
+func shorten(title string) string {
+	r := []rune(title)
+	if len(r) <= maxTitleLen {
+		return title
+	}
+	cut := string(r[:maxTitleLen])
+	if i := strings.LastIndex(cut, " "); i > maxTitleLen/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
+
+const titlePrompt = "Write a title of at most six words for a conversation that starts with the exchange below. Reply with only the title, without quotes or a trailing period."
+
+// GenerateTitle asks a model for a short title summarizing the first
+// exchange of a session.
+func GenerateTitle(ctx context.Context, client llm.CompletionClient, model string, messages []llm.Message) (string, error) {
+	var exchange strings.Builder
+	for _, m := range messages {
+		if m.Role != llm.RoleUser && m.Role != llm.RoleAssistant {
+			continue
+		}
+		content := m.Content
+		if len(content) > 2000 {
+			content = content[:2000]
+		}
+		fmt.Fprintf(&exchange, "%s: %s\n\n", m.Role, content)
+		if m.Role == llm.RoleAssistant {
+			break
+		}
+	}
+	s, err := client.GetCompletion(ctx, &llm.Request{
+		Model: model,
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: titlePrompt},
+			{Role: llm.RoleUser, Content: exchange.String()},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer s.Close()
+	b, err := io.ReadAll(llm.NewReader(s))
+	if err != nil {
+		return "", err
+	}
+	title, _, _ := strings.Cut(strings.TrimSpace(string(b)), "\n")
+	title = strings.TrimRight(strings.Trim(title, "\"'` *#"), ".")
+	if title == "" {
+		return "", fmt.Errorf("empty title")
+	}
+	return shorten(title), nil
+}
+
+const summaryPrompt = "Summarize the conversation below so that it could be continued from your summary alone. Cover the user's goals, what was decided or done, key facts, names of files, functions, and commands, and any open questions. Be concise, and use bullet points."
+
+// SummaryPrefix starts the system message that replaces a conversation
+// compacted to a summary.
+const SummaryPrefix = "Summary of the conversation so far:\n\n"
+
+// Summarize asks a model for a summary of a session's conversation,
+// detailed enough to continue it from.
+func Summarize(ctx context.Context, client llm.CompletionClient, model string, messages []llm.Message) (string, error) {
+	var transcript strings.Builder
+	for _, m := range messages {
+		switch {
+		case m.Role == llm.RoleSystem && strings.HasPrefix(m.Content, SummaryPrefix):
+			// Include summaries of earlier compactions.
+			fmt.Fprintf(&transcript, "%s\n\n", m.Content)
+		case m.Role == llm.RoleUser || m.Role == llm.RoleAssistant:
+			fmt.Fprintf(&transcript, "%s: %s\n\n", m.Role, m.Content)
+		}
+	}
+	if transcript.Len() == 0 {
+		return "", fmt.Errorf("nothing to summarize")
+	}
+	s, err := client.GetCompletion(ctx, &llm.Request{
+		Model: model,
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: summaryPrompt},
+			{Role: llm.RoleUser, Content: transcript.String()},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer s.Close()
+	b, err := io.ReadAll(llm.NewReader(s))
+	if err != nil {
+		return "", err
+	}
+	summary := strings.TrimSpace(string(b))
+	if summary == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return summary, nil
+}
+
+// Compact returns messages with the conversation replaced by a summary of
+// it, keeping the system prompt, to save tokens in long sessions.
+func Compact(messages []llm.Message, summary string) []llm.Message {
+	var out []llm.Message
+	for _, m := range messages {
+		if m.Role == llm.RoleSystem && !strings.HasPrefix(m.Content, SummaryPrefix) {
+			out = append(out, m)
+		}
+	}
+	return append(out, llm.Message{Role: llm.RoleSystem, Content: SummaryPrefix + summary})
+}
+
+// Store saves sessions. FileStore and SQLiteStore are the built-in
+// implementations; others, such as a database shared by a team, only need
+// these methods. Import, Prune, and Interrupted work with any Store.
+type Store interface {
+	// Load reads a session by ID, or by a prefix of its ID that matches
+	// only one session. It returns ErrNotFound if there is none.
+	Load(id string) (*Session, error)
+	// List returns all sessions, most recently updated first.
+	List() ([]*Session, error)
+	// Save writes a session and increments its Revision, or returns
+	// ErrConflict if the saved session's Revision has changed since it was
+	// loaded.
+	Save(sess *Session) error
+	// Delete removes a session by ID, or by a prefix of its ID.
+	Delete(id string) error
+}
+
+// FileStore keeps sessions as JSON files in a directory, one per session.
+// Any number of processes may share a store: files are replaced atomically,
+// and saves are serialized by a lock file.
+type FileStore struct {
+	Dir string
+	// Key decrypts encrypted sessions, and if Encrypt is set, encrypts
+	// sessions as they're saved. Unencrypted sessions can always be read.
+	Key     *Key
+	Encrypt bool
+}
+
+// ErrNotFound is returned when loading a session that doesn't exist.
+var ErrNotFound = errors.New("session not found")
+
+// ErrConflict is returned when saving a session that another process has
+// saved since it was loaded.
+var ErrConflict = errors.New("session was changed by another process")
+
+// LockTimeout is how long to wait for another process to finish saving
+// before giving up.
+const LockTimeout = 5 * time.Second
+
+// errLocked is returned by tryLock when another process holds the lock.
+var errLocked = errors.New("locked")
+
+// lock takes the store's lock, waiting up to LockTimeout for other
+// processes to release it, and returns a func that releases it.
+func (s *FileStore) lock() (unlockFunc func(), err error) {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(s.Dir, ".lock"), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(LockTimeout)
+	for {
+		err = tryLock(f)
+		if err != errLocked || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err == errLocked {
+		err = fmt.Errorf("the session store %s is locked by another process", s.Dir)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		unlock(f)
+		f.Close()
+	}, nil
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.Dir, id+".json")
+}
+
+// Save writes a session, replacing any previous save, and increments its
+// Revision. If another process saved the session since it was loaded, it
+// returns ErrConflict instead. The file is replaced atomically, so a crash
+// while saving leaves the previous save intact.
+func (s *FileStore) Save(sess *Session) error {
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	// A missing or corrupt save is replaced.
+	rev := sess.Revision
+	saved, err := s.read(s.path(sess.ID))
+	if errors.Is(err, ErrEncrypted) {
+		return err
+	}
+	if err == nil {
+		rev = saved.Revision
+	}
+	if rev != sess.Revision {
+		return fmt.Errorf("%w: %s", ErrConflict, sess.ID)
+	}
+	sess.Revision = rev + 1
+	if err := s.write(sess); err != nil {
+		sess.Revision = rev
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) write(sess *Session) error {
+	b, err := encode(sess, s.Key, s.Encrypt)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.Dir, "."+sess.ID+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(sess.ID))
+}
+
+// Load reads a session by ID, or by a prefix of its ID that matches only
+// one session.
+func (s *FileStore) Load(id string) (*Session, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("invalid session ID %q", id)
+	}
+	sess, err := s.read(s.path(id))
+	if !errors.Is(err, ErrNotFound) {
+		return sess, err
+	}
+	matches, _ := filepath.Glob(filepath.Join(s.Dir, id+"*.json"))
+	if len(matches) > 1 {
+		return nil, fmt.Errorf("session ID %q is ambiguous", id)
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return s.read(matches[0])
+}
+
+func (s *FileStore) read(path string) (*Session, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decode(b, s.Key, path)
+}
+
+// encode returns a session as saved, encrypted with key if encrypt is set.
+func encode(sess *Session, key *Key, encrypt bool) ([]byte, error) {
+	b, err := json.MarshalIndent(sess, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if encrypt {
+		if key == nil {
+			return nil, ErrNoKey
+		}
+		b = seal(key, b)
+	}
+	return b, nil
+}
+
+// decode parses a saved session, decrypting it with key if it's encrypted.
+// Name identifies the session in errors.
+func decode(b []byte, key *Key, name string) (*Session, error) {
+	b, err := unseal(key, b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	sess := &Session{}
+	if err := json.Unmarshal(b, sess); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", name, err)
+	}
+	if err := llm.CheckMessages(sess.Messages); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return sess, nil
+}
+
+// List returns all sessions, most recently updated first. Corrupt sessions
+// are skipped, but encrypted sessions without a key are an error.
+func (s *FileStore) List() ([]*Session, error) {
+	matches, err := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var sessions []*Session
+	for _, path := range matches {
+		sess, err := s.read(path)
+		if errors.Is(err, ErrEncrypted) {
+			return nil, err
+		}
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, sess)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Updated.After(sessions[j].Updated)
+	})
+	return sessions, nil
+}
+
+// Delete removes a session.
+func (s *FileStore) Delete(id string) error {
+	sess, err := s.Load(id)
+	if err != nil {
+		return err
+	}
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return os.Remove(s.path(sess.ID))
+}
+
+// BundleVersion is the version of the bundle format written by Export.
+const BundleVersion = 1
+
+// Bundle is a portable set of sessions, for moving them between machines.
+type Bundle struct {
+	Version  int        `json:"version"`
+	Exported time.Time  `json:"exported"`
+	Sessions []*Session `json:"sessions"`
+}
+
+// ReadBundle reads a bundle written by WriteBundle, checking that its
+// sessions are valid.
+func ReadBundle(r io.Reader) (*Bundle, error) {
+	b := &Bundle{}
+	if err := json.NewDecoder(r).Decode(b); err != nil {
+		return nil, fmt.Errorf("parse bundle: %w", err)
+	}
+	if b.Version < 1 || b.Version > BundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", b.Version)
+	}
+	for _, sess := range b.Sessions {
+		if sess.ID == "" || strings.ContainsAny(sess.ID, `/\`) {
+			return nil, fmt.Errorf("invalid session ID %q", sess.ID)
+		}
+		if err := llm.CheckMessages(sess.Messages); err != nil {
+			return nil, fmt.Errorf("session %s: %w", sess.ID, err)
+		}
+	}
+	return b, nil
+}
+
+// WriteBundle writes sessions as a bundle.
+func WriteBundle(w io.Writer, sessions []*Session) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(&Bundle{Version: BundleVersion, Exported: time.Now(), Sessions: sessions})
+}
+
+// Import saves the sessions in a bundle to s, skipping those already in
+// the store unless replace is set. It returns the number of sessions saved.
+func Import(s Store, b *Bundle, replace bool) (int, error) {
+	n := 0
+	for _, sess := range b.Sessions {
+		saved, err := s.Load(sess.ID)
+		if err == nil && saved.ID == sess.ID {
+			if !replace {
+				continue
+			}
+			sess.Revision = saved.Revision
+		} else {
+			sess.Revision = 0
+		}
+		// The process that had it open was on another machine.
+		sess.PID = 0
+		if err := s.Save(sess); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Retention limits the sessions kept by Prune. Zero values are unlimited.
+type Retention struct {
+	MaxSessions int
+	MaxAge      time.Duration
+	// MaxBytes bounds the total size of the session files.
+	MaxBytes int64
+}
+
+// Prune deletes the least recently updated sessions in s beyond the limits
+// of r, returning them. Sessions open in a running process are kept. With
+// dryRun, it only returns the sessions it would delete.
+func Prune(s Store, r Retention, dryRun bool) ([]*Session, error) {
+	sessions, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	var pruned []*Session
+	kept, size := 0, int64(0)
+	for _, sess := range sessions {
+		n, err := sessionSize(s, sess)
+		if err != nil {
+			return nil, err
+		}
+		open := sess.PID != 0 && (sess.PID == os.Getpid() || running(sess.PID))
+		expired := (r.MaxSessions > 0 && kept >= r.MaxSessions) ||
+			(r.MaxAge > 0 && time.Since(sess.Updated) > r.MaxAge) ||
+			(r.MaxBytes > 0 && size+n > r.MaxBytes)
+		if expired && !open {
+			pruned = append(pruned, sess)
+			continue
+		}
+		kept++
+		size += n
+	}
+	if dryRun {
+		return pruned, nil
+	}
+	for _, sess := range pruned {
+		if err := s.Delete(sess.ID); err != nil {
+			return nil, err
+		}
+	}
+	return pruned, nil
+}
+
+// sessionSize returns the size of a saved session: the size of its file in
+// a FileStore, or else of its JSON.
+func sessionSize(s Store, sess *Session) (int64, error) {
+	if f, ok := s.(*FileStore); ok {
+		info, err := os.Stat(f.path(sess.ID))
+		if err != nil {
+			return 0, err
+		}
+		return info.Size(), nil
+	}
+	b, err := json.Marshal(sess)
+	return int64(len(b)), err
+}
+
+// Interrupted returns the sessions in s left open by processes that are no
+// longer running, most recently updated first.
+func Interrupted(s Store) ([]*Session, error) {
+	sessions, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	var out []*Session
+	for _, sess := range sessions {
+		if sess.PID != 0 && sess.PID != os.Getpid() && !running(sess.PID) {
+			out = append(out, sess)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,566 @@
+package session_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/session"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/llm/llmtest"
+)
+
+// stores returns an empty store of each kind, by backend name. SQLite is
+// left out if sqlite3 isn't installed.
+func stores(t *testing.T) map[string]session.Store {
+	m := map[string]session.Store{"files": &session.FileStore{Dir: t.TempDir()}}
+	if _, err := exec.LookPath("sqlite3"); err == nil {
+		m["sqlite"] = &session.SQLiteStore{Path: filepath.Join(t.TempDir(), "sessions.db")}
+	}
+	return m
+}
+
+func TestStore(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			older := session.New("gpt-test")
+			older.ID = "20260101-120000-aaaaaa"
+			older.Updated = time.Now().Add(-time.Hour)
+			older.PID = 0
+			newer := session.New("gpt-test")
+			newer.ID = "20260102-120000-bbbbbb"
+			newer.Messages = []llm.Message{{Role: llm.RoleUser, Content: "Hi"}, {Role: llm.RoleAssistant, Content: "Hello"}}
+			for _, s := range []*session.Session{older, newer} {
+				if err := store.Save(s); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := store.Load("20260102")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.ID != newer.ID || got.Prompts() != 1 || got.Messages[1].Content != "Hello" {
+				t.Errorf("Load by prefix = %+v", got)
+			}
+			if _, err := store.Load("2026"); err == nil {
+				t.Error("Load of an ambiguous prefix succeeded")
+			}
+			if _, err := store.Load("2027"); !errors.Is(err, session.ErrNotFound) {
+				t.Errorf("Load of a missing session: err = %v, want ErrNotFound", err)
+			}
+
+			list, err := store.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(list) != 2 || list[0].ID != newer.ID || list[1].ID != older.ID {
+				t.Errorf("List = %+v, want newest first", list)
+			}
+
+			if err := store.Delete(older.ID); err != nil {
+				t.Fatal(err)
+			}
+			if list, _ := store.List(); len(list) != 1 {
+				t.Errorf("List after Delete = %+v", list)
+			}
+		})
+	}
+}
+
+func TestSaveConflict(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			sess := session.New("gpt-test")
+			if err := store.Save(sess); err != nil {
+				t.Fatal(err)
+			}
+			a, err := store.Load(sess.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := store.Load(sess.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a.Tag("a")
+			if err := store.Save(a); err != nil {
+				t.Fatal(err)
+			}
+			b.Tag("b")
+			if err := store.Save(b); !errors.Is(err, session.ErrConflict) {
+				t.Fatalf("Save of a stale session: err = %v, want ErrConflict", err)
+			}
+			b.Fork()
+			if err := store.Save(b); err != nil {
+				t.Fatal(err)
+			}
+			if list, _ := store.List(); len(list) != 2 {
+				t.Errorf("List after Fork = %+v, want the original and the fork", list)
+			}
+
+			// Concurrent changes that retry on conflicts are all kept.
+			var wg sync.WaitGroup
+			errs := make(chan error, 10)
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(tag string) {
+					defer wg.Done()
+					for {
+						s, err := store.Load(sess.ID)
+						if err != nil {
+							errs <- err
+							return
+						}
+						s.Tag(tag)
+						if err := store.Save(s); !errors.Is(err, session.ErrConflict) {
+							errs <- err
+							return
+						}
+					}
+				}(fmt.Sprint(i))
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := store.Load(sess.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Tags) != 11 || got.Revision != 12 {
+				t.Errorf("got tags %q at revision %d, want 11 tags at revision 12", got.Tags, got.Revision)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsCorruptSessions(t *testing.T) {
+	dir := t.TempDir()
+	store := &session.FileStore{Dir: dir}
+	if err := os.WriteFile(filepath.Join(dir, "bad.json"), []byte(`{"id": "bad", "messages": [{"role": "robot"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load("bad"); err == nil {
+		t.Error("Load of a session with an unknown role succeeded")
+	}
+	if list, err := store.List(); err != nil || len(list) != 0 {
+		t.Errorf("List = %+v, %v, want the corrupt session skipped", list, err)
+	}
+}
+
+func TestInterrupted(t *testing.T) {
+	store := &session.FileStore{Dir: t.TempDir()}
+	open := session.New("gpt-test")
+	open.ID = "open"
+	closed := session.New("gpt-test")
+	closed.ID, closed.PID = "closed", 0
+	crashed := session.New("gpt-test")
+	// No process has this ID, as it's beyond the max PID.
+	crashed.ID, crashed.PID = "crashed", 1<<30
+	for _, s := range []*session.Session{open, closed, crashed} {
+		if err := store.Save(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := session.Interrupted(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != "crashed" {
+		t.Errorf("Interrupted = %+v, want only the crashed session", got)
+	}
+}
+
+func TestTitle(t *testing.T) {
+	messages := []llm.Message{
+		{Role: llm.RoleSystem, Content: "Be brief."},
+		{Role: llm.RoleUser, Content: "How do I   trim a video\nwith ffmpeg, from 10 seconds to 30 seconds, keeping the original codecs?"},
+		{Role: llm.RoleAssistant, Content: "Use -ss and -to with -c copy."},
+	}
+	if got, want := session.Title(messages), "How do I trim a video with ffmpeg, from 10 seconds to 30…"; got != want {
+		t.Errorf("Title = %q, want %q", got, want)
+	}
+
+	client := llmtest.NewClient(llmtest.Text("\"Trimming Video With ffmpeg.\"\n"))
+	got, err := session.GenerateTitle(context.Background(), client, "gpt-test", messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "Trimming Video With ffmpeg" {
+		t.Errorf("GenerateTitle = %q", got)
+	}
+	req := client.Requests()[0]
+	if req.Model != "gpt-test" || !strings.Contains(req.Messages[1].Content, "user: How do I") || !strings.Contains(req.Messages[1].Content, "assistant: Use -ss") {
+		t.Errorf("unexpected request %+v", req)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	messages := []llm.Message{
+		{Role: llm.RoleSystem, Content: "Be brief."},
+		{Role: llm.RoleSystem, Content: session.SummaryPrefix + "- Wants to trim videos."},
+		{Role: llm.RoleUser, Content: "Keep the codecs?"},
+		{Role: llm.RoleAssistant, Content: "Use -c copy."},
+	}
+	client := llmtest.NewClient(llmtest.Text("- Trimming with -c copy.\n"))
+	summary, err := session.Summarize(context.Background(), client, "gpt-test", messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary != "- Trimming with -c copy." {
+		t.Errorf("Summarize = %q", summary)
+	}
+	req := client.Requests()[0]
+	want := session.SummaryPrefix + "- Wants to trim videos.\n\nuser: Keep the codecs?\n\nassistant: Use -c copy.\n\n"
+	if req.Model != "gpt-test" || req.Messages[1].Content != want {
+		t.Errorf("unexpected request %+v", req)
+	}
+
+	got := session.Compact(messages, summary)
+	wantMessages := []llm.Message{
+		{Role: llm.RoleSystem, Content: "Be brief."},
+		{Role: llm.RoleSystem, Content: session.SummaryPrefix + "- Trimming with -c copy."},
+	}
+	if !reflect.DeepEqual(got, wantMessages) {
+		t.Errorf("Compact = %q, want %q", got, wantMessages)
+	}
+}
+
+func TestTags(t *testing.T) {
+	s := session.New("gpt-test")
+	s.Tag("work", "go", "work")
+	if got := strings.Join(s.Tags, ","); got != "go,work" {
+		t.Errorf("Tags = %q, want go,work", got)
+	}
+	s.Untag("go")
+	if !s.HasTag("work") || s.HasTag("go") {
+		t.Errorf("Tags after Untag = %q", s.Tags)
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"7d":   7 * 24 * time.Hour,
+		"2w":   14 * 24 * time.Hour,
+		"12h":  12 * time.Hour,
+		"0.5d": 12 * time.Hour,
+	} {
+		if got, err := session.ParseAge(in); err != nil || got != want {
+			t.Errorf("ParseAge(%q) = %s, %v, want %s", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "d", "-1d", "7y"} {
+		if _, err := session.ParseAge(in); err == nil {
+			t.Errorf("ParseAge(%q) succeeded", in)
+		}
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	from := &session.FileStore{Dir: t.TempDir()}
+	sess := session.New("gpt-test")
+	sess.Messages = []llm.Message{{Role: llm.RoleUser, Content: "Hi"}}
+	if err := from.Save(sess); err != nil {
+		t.Fatal(err)
+	}
+	sessions, _ := from.List()
+	var bundle bytes.Buffer
+	if err := session.WriteBundle(&bundle, sessions); err != nil {
+		t.Fatal(err)
+	}
+
+	to := &session.FileStore{Dir: t.TempDir()}
+	for i, want := range []int{1, 0} {
+		b, err := session.ReadBundle(bytes.NewReader(bundle.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := session.Import(to, b, false); err != nil || n != want {
+			t.Errorf("import %d: got %d, %v, want %d", i, n, err, want)
+		}
+	}
+	got, err := to.Load(sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.PID != 0 || got.Messages[0].Content != "Hi" {
+		t.Errorf("imported session = %+v, want it closed with its messages", got)
+	}
+
+	if _, err := session.ReadBundle(strings.NewReader(`{"version": 2, "sessions": []}`)); err == nil {
+		t.Error("ReadBundle of a newer version succeeded")
+	}
+	if _, err := session.ReadBundle(strings.NewReader(`{"version": 1, "sessions": [{"id": "../x"}]}`)); err == nil {
+		t.Error("ReadBundle with a path in a session ID succeeded")
+	}
+}
+
+func TestEncryption(t *testing.T) {
+	dir := t.TempDir()
+	key, err := session.NewKeyFile(filepath.Join(dir, "session.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := session.NewKeyFile(filepath.Join(dir, "session.key")); err != nil || *again != *key {
+		t.Fatalf("reloaded key = %x, %v, want %x", again, err, key)
+	}
+	store := &session.FileStore{Dir: filepath.Join(dir, "sessions"), Key: key, Encrypt: true}
+	sess := session.New("gpt-test")
+	sess.Messages = []llm.Message{{Role: llm.RoleUser, Content: "my secret code"}}
+	if err := store.Save(sess); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(store.Dir, sess.ID+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "secret") {
+		t.Error("saved session is in plaintext")
+	}
+	if got, err := store.Load(sess.ID); err != nil || got.Messages[0].Content != "my secret code" {
+		t.Errorf("Load = %+v, %v", got, err)
+	}
+
+	if _, err := (&session.FileStore{Dir: store.Dir}).Load(sess.ID); !errors.Is(err, session.ErrEncrypted) {
+		t.Errorf("Load without a key: err = %v, want ErrEncrypted", err)
+	}
+	other, err := session.NewPassphraseKey("hunter2", filepath.Join(dir, "salt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&session.FileStore{Dir: store.Dir, Key: other}).Load(sess.ID); err == nil {
+		t.Error("Load with the wrong key succeeded")
+	}
+}
+
+func TestSQLiteEncryption(t *testing.T) {
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		t.Skip("sqlite3 not installed")
+	}
+	dir := t.TempDir()
+	key, err := session.NewKeyFile(filepath.Join(dir, "session.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &session.SQLiteStore{Path: filepath.Join(dir, "sessions.db"), Key: key, Encrypt: true}
+	sess := session.New("gpt-test")
+	sess.Messages = []llm.Message{{Role: llm.RoleUser, Content: "my secret code"}}
+	if err := store.Save(sess); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(store.Path); len(b) == 0 || strings.Contains(string(b), "secret") {
+		t.Error("saved session is in plaintext")
+	}
+	if got, err := store.Load(sess.ID); err != nil || got.Messages[0].Content != "my secret code" {
+		t.Errorf("Load = %+v, %v", got, err)
+	}
+	if _, err := (&session.SQLiteStore{Path: store.Path}).List(); !errors.Is(err, session.ErrEncrypted) {
+		t.Errorf("List without a key: err = %v, want ErrEncrypted", err)
+	}
+}
+
+// memStore is a minimal Store, to check that the functions taking a Store
+// work with backends other than FileStore.
+type memStore map[string]session.Session
+
+func (m memStore) Load(id string) (*session.Session, error) {
+	sess, ok := m[id]
+	if !ok {
+		return nil, session.ErrNotFound
+	}
+	return &sess, nil
+}
+
+func (m memStore) List() ([]*session.Session, error) {
+	var list []*session.Session
+	for id := range m {
+		sess, _ := m.Load(id)
+		list = append(list, sess)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Updated.After(list[j].Updated) })
+	return list, nil
+}
+
+func (m memStore) Save(sess *session.Session) error {
+	if saved, ok := m[sess.ID]; ok && saved.Revision != sess.Revision {
+		return session.ErrConflict
+	}
+	sess.Revision++
+	m[sess.ID] = *sess
+	return nil
+}
+
+func (m memStore) Delete(id string) error {
+	delete(m, id)
+	return nil
+}
+
+func TestPrune(t *testing.T) {
+	for name, store := range map[string]session.Store{
+		"files":  &session.FileStore{Dir: t.TempDir()},
+		"memory": memStore{},
+	} {
+		t.Run(name, func(t *testing.T) {
+			testPrune(t, store)
+		})
+	}
+}
+
+func testPrune(t *testing.T, store session.Store) {
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		sess := session.New("gpt-test")
+		sess.ID = fmt.Sprintf("s%d", i)
+		sess.Updated = now.Add(-time.Duration(i) * 24 * time.Hour)
+		sess.PID = 0
+		if i == 3 {
+			// Open in this process, so it's kept.
+			sess.PID = os.Getpid()
+		}
+		if err := store.Save(sess); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pruned, err := session.Prune(store, session.Retention{MaxAge: 36 * time.Hour}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || pruned[0].ID != "s2" {
+		t.Errorf("dry run pruned %+v, want s2", pruned)
+	}
+	if list, _ := store.List(); len(list) != 4 {
+		t.Errorf("dry run deleted sessions")
+	}
+
+	if _, err := session.Prune(store, session.Retention{MaxSessions: 1}, false); err != nil {
+		t.Fatal(err)
+	}
+	list, _ := store.List()
+	var kept []string
+	for _, s := range list {
+		kept = append(kept, s.ID)
+	}
+	if got := strings.Join(kept, ","); got != "s0,s3" {
+		t.Errorf("kept %s, want s0,s3", got)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for in, want := range map[string]int64{"500MB": 500e6, "2 GiB": 2 << 30, "1024": 1024, "1.5KB": 1500} {
+		if got, err := session.ParseSize(in); err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+	if _, err := session.ParseSize("lots"); err == nil {
+		t.Error("ParseSize(lots) succeeded")
+	}
+}
+
+func TestRemote(t *testing.T) {
+	var mu sync.Mutex
+	var stored []byte
+	etag := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case "GET":
+			if stored == nil {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("ETag", fmt.Sprintf(`"%d"`, etag))
+			w.Write(stored)
+		case "PUT":
+			if m := r.Header.Get("If-Match"); m != "" && m != fmt.Sprintf(`"%d"`, etag) {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			stored, _ = io.ReadAll(r.Body)
+			etag++
+		}
+	}))
+	defer srv.Close()
+	remote := &session.Remote{URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer secret"}, Passphrase: "team"}
+	ctx := context.Background()
+
+	b, err := remote.Pull(ctx)
+	if err != nil || len(b.Sessions) != 0 {
+		t.Fatalf("Pull before any push = %+v, %v, want an empty bundle", b, err)
+	}
+	a := session.New("gpt-test")
+	a.ID = "20260101-120000-aaaaaa"
+	a.Messages = []llm.Message{{Role: llm.RoleUser, Content: "Hi"}}
+	if n, err := remote.Push(ctx, []*session.Session{a}); n != 1 || err != nil {
+		t.Fatalf("Push = %d, %v", n, err)
+	}
+	if bytes.Contains(stored, []byte("Hi")) {
+		t.Error("the remote bundle is not encrypted")
+	}
+
+	// Another machine pushes a new session, and an older copy of a, which
+	// doesn't replace the newer one.
+	b2 := session.New("gpt-test")
+	b2.ID = "20260102-120000-bbbbbb"
+	old := *a
+	old.Updated = a.Updated.Add(-time.Hour)
+	old.Messages = nil
+	if n, err := remote.Push(ctx, []*session.Session{&old, b2}); n != 1 || err != nil {
+		t.Fatalf("second Push = %d, %v, want 1", n, err)
+	}
+	b, err = remote.Pull(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Sessions) != 2 || b.Sessions[0].ID != a.ID || len(b.Sessions[0].Messages) != 1 || b.Sessions[1].ID != b2.ID {
+		t.Errorf("Pull = %+v, want a and b", b.Sessions)
+	}
+
+	remote.Passphrase = "wrong"
+	if _, err := remote.Pull(ctx); err == nil {
+		t.Error("Pull with the wrong passphrase succeeded")
+	}
+}
+
+func TestOpenBundleRejectsUnsealed(t *testing.T) {
+	bundle := []byte(`{"version":1,"sessions":[]}`)
+	plain := append([]byte("gpt-cli sealed bundle v1\n"), make([]byte, 16)...)
+	plain = append(plain, bundle...)
+	if _, err := session.OpenBundle("team", plain); err == nil {
+		t.Error("OpenBundle of a plaintext bundle succeeded")
+	}
+
+	sealed, err := session.SealBundle("team", bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := session.OpenBundle("team", sealed); err != nil || !bytes.Equal(out, bundle) {
+		t.Fatalf("OpenBundle = %q, %v, want %q", out, err, bundle)
+	}
+	sealed[len(sealed)-1] ^= 1
+	if _, err := session.OpenBundle("team", sealed); err == nil {
+		t.Error("OpenBundle of a tampered bundle succeeded")
+	}
+}
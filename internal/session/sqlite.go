@@ -0,0 +1,175 @@
+package session
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// SQLiteStore keeps sessions in a SQLite database, one row per session,
+// for those who'd rather have a single file to back up or query. It runs
+// the sqlite3 command, so there's no database driver to build in, but
+// sqlite3 must be installed. Sessions are saved as FileStore saves them,
+// including encryption, and saves are serialized by SQLite's own locking.
+type SQLiteStore struct {
+	Path string
+	// Key and Encrypt are as for FileStore.
+	Key     *Key
+	Encrypt bool
+}
+
+// sqliteSchema creates the sessions table. Updated is in Unix nanoseconds,
+// so that List can sort without decoding every session.
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS sessions (
+	id TEXT PRIMARY KEY,
+	revision INTEGER NOT NULL,
+	updated INTEGER NOT NULL,
+	data BLOB NOT NULL
+);
+`
+
+// sqliteRow is a row of query results, with data as hex, which survives
+// sqlite3's JSON output whether or not the session is encrypted.
+type sqliteRow struct {
+	ID   string `json:"id"`
+	Data string `json:"data"`
+	N    int    `json:"n"`
+}
+
+// query runs a SQL script after creating the table if needed, waiting up
+// to LockTimeout for other processes' writes, and returns the rows of its
+// results.
+func (s *SQLiteStore) query(script string) ([]sqliteRow, error) {
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0700); err != nil {
+		return nil, err
+	}
+	c := exec.Command("sqlite3", "-bail", "-json", s.Path)
+	c.Stdin = strings.NewReader(fmt.Sprintf(".timeout %d\n", LockTimeout.Milliseconds()) + sqliteSchema + script)
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	out, err := c.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, fmt.Errorf("the sqlite session backend needs the sqlite3 command: %w", err)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("sqlite3: %s", msg)
+		}
+		return nil, fmt.Errorf("sqlite3: %w", err)
+	}
+	// Each statement with results prints its own JSON array.
+	var rows []sqliteRow
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for dec.More() {
+		var r []sqliteRow
+		if err := dec.Decode(&r); err != nil {
+			return nil, fmt.Errorf("sqlite3: %w", err)
+		}
+		rows = append(rows, r...)
+	}
+	return rows, nil
+}
+
+// sqlString quotes s as a SQL string literal.
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// Save writes a session, replacing any previous save, and increments its
+// Revision. If another process saved the session since it was loaded, it
+// returns ErrConflict instead.
+func (s *SQLiteStore) Save(sess *Session) error {
+	rev := sess.Revision
+	sess.Revision = rev + 1
+	b, err := encode(sess, s.Key, s.Encrypt)
+	if err != nil {
+		sess.Revision = rev
+		return err
+	}
+	// The upsert only replaces the saved session if it's the revision this
+	// one was loaded from.
+	rows, err := s.query(fmt.Sprintf(`BEGIN IMMEDIATE;
+INSERT INTO sessions (id, revision, updated, data) VALUES (%s, %d, %d, X'%x')
+	ON CONFLICT (id) DO UPDATE SET revision = excluded.revision, updated = excluded.updated, data = excluded.data
+	WHERE sessions.revision = %d;
+SELECT changes() AS n;
+COMMIT;
+`, sqlString(sess.ID), sess.Revision, sess.Updated.UnixNano(), b, rev))
+	if err == nil && (len(rows) != 1 || rows[0].N != 1) {
+		err = fmt.Errorf("%w: %s", ErrConflict, sess.ID)
+	}
+	if err != nil {
+		sess.Revision = rev
+		return err
+	}
+	return nil
+}
+
+// Load reads a session by ID, or by a prefix of its ID that matches only
+// one session.
+func (s *SQLiteStore) Load(id string) (*Session, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("invalid session ID %q", id)
+	}
+	rows, err := s.query(fmt.Sprintf("SELECT id, hex(data) AS data FROM sessions WHERE substr(id, 1, %d) = %s;\n", len(id), sqlString(id)))
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		if r.ID == id {
+			return s.decode(r)
+		}
+	}
+	if len(rows) > 1 {
+		return nil, fmt.Errorf("session ID %q is ambiguous", id)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return s.decode(rows[0])
+}
+
+func (s *SQLiteStore) decode(r sqliteRow) (*Session, error) {
+	b, err := hex.DecodeString(r.Data)
+	if err != nil {
+		return nil, fmt.Errorf("session %s: %w", r.ID, err)
+	}
+	return decode(b, s.Key, "session "+r.ID)
+}
+
+// List returns all sessions, most recently updated first. Corrupt sessions
+// are skipped, but encrypted sessions without a key are an error.
+func (s *SQLiteStore) List() ([]*Session, error) {
+	rows, err := s.query("SELECT id, hex(data) AS data FROM sessions ORDER BY updated DESC;\n")
+	if err != nil {
+		return nil, err
+	}
+	var sessions []*Session
+	for _, r := range rows {
+		sess, err := s.decode(r)
+		if errors.Is(err, ErrEncrypted) {
+			return nil, err
+		}
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, nil
+}
+
+// Delete removes a session.
+func (s *SQLiteStore) Delete(id string) error {
+	sess, err := s.Load(id)
+	if err != nil {
+		return err
+	}
+	_, err = s.query(fmt.Sprintf("DELETE FROM sessions WHERE id = %s;\n", sqlString(sess.ID)))
+	return err
+}
@@ -0,0 +1,121 @@
+// Package speech turns text of any length into speech, splitting it into
+// as many requests to the speech endpoint as it takes.
+package speech
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+// MaxInput is the most characters the speech endpoint reads at once.
+const MaxInput = 4096
+
+// Each requests speech for req.Input a part at a time, calling fn with the
+// audio of each part in order before requesting the next, so that playback
+// can start before the whole input has been spoken.
+func Each(ctx context.Context, client *openai.Client, req openai.SpeechRequest, fn func(r io.Reader) error) error {
+	for _, part := range Split(req.Input, MaxInput) {
+		req.Input = part
+		r, err := client.Speech(ctx, &req)
+		if err != nil {
+			return err
+		}
+		err = fn(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write writes the speech for req.Input to w as a single audio file in
+// req.ResponseFormat. The parts of mp3, opus, aac, and raw pcm audio play
+// back to back when concatenated; for wav, the parts are requested as pcm
+// and given one header. Flac can only be written for input that fits in a
+// single request.
+func Write(ctx context.Context, client *openai.Client, req openai.SpeechRequest, w io.Writer) error {
+	switch req.ResponseFormat {
+	case "wav":
+		req.ResponseFormat = "pcm"
+		var pcm bytes.Buffer
+		err := Each(ctx, client, req, func(r io.Reader) error {
+			_, err := io.Copy(&pcm, r)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if err := writeWAVHeader(w, pcm.Len()); err != nil {
+			return err
+		}
+		_, err = pcm.WriteTo(w)
+		return err
+	case "flac":
+		if len(Split(req.Input, MaxInput)) > 1 {
+			return fmt.Errorf("input is too long for flac, which can't be split into parts; use another format")
+		}
+	}
+	return Each(ctx, client, req, func(r io.Reader) error {
+		_, err := io.Copy(w, r)
+		return err
+	})
+}
+
+// The speech endpoint's pcm audio is 24kHz 16-bit mono.
+const (
+	sampleRate    = 24000
+	bitsPerSample = 16
+	channels      = 1
+)
+
+// writeWAVHeader writes the header of a WAV file holding n bytes of pcm
+// audio.
+func writeWAVHeader(w io.Writer, n int) error {
+	blockAlign := channels * bitsPerSample / 8
+	h := []any{
+		[4]byte{'R', 'I', 'F', 'F'}, uint32(36 + n), [4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '}, uint32(16), uint16(1), uint16(channels),
+		uint32(sampleRate), uint32(sampleRate * blockAlign), uint16(blockAlign), uint16(bitsPerSample),
+		[4]byte{'d', 'a', 't', 'a'}, uint32(n),
+	}
+	for _, v := range h {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Split splits text into parts of at most n characters, breaking at the
+// last paragraph, line, sentence, or word that fits, so that long text is
+// read in full.
+func Split(text string, n int) []string {
+	var parts []string
+	for {
+		text = strings.TrimSpace(text)
+		r := []rune(text)
+		if len(r) <= n {
+			if text != "" {
+				parts = append(parts, text)
+			}
+			return parts
+		}
+		head := string(r[:n])
+		cut := len(head)
+		for _, sep := range []string{"\n\n", "\n", ". ", " "} {
+			if i := strings.LastIndex(head, sep); i > 0 {
+				cut = i + len(sep)
+				break
+			}
+		}
+		parts = append(parts, head[:cut])
+		text = text[cut:]
+	}
+}
@@ -0,0 +1,122 @@
+package speech_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/internal/speech"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+// server fakes the speech endpoint, answering each request with "<format>:"
+// followed by the length of its input, and records the requests.
+func server(t *testing.T) (*openai.Client, *[]openai.SpeechRequest) {
+	var reqs []openai.SpeechRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.SpeechRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len([]rune(req.Input)) > speech.MaxInput {
+			http.Error(w, "input too long", http.StatusBadRequest)
+			return
+		}
+		reqs = append(reqs, req)
+		w.Write([]byte(req.ResponseFormat + ":" + strings.Repeat("x", len(req.Input)%7)))
+	}))
+	t.Cleanup(srv.Close)
+	return &openai.Client{BaseURL: srv.URL}, &reqs
+}
+
+// longInput is more than twice what one request can take.
+var longInput = strings.Repeat("All work and no play makes Jack a dull boy. ", 200)
+
+func TestWriteSplitsLongInput(t *testing.T) {
+	client, reqs := server(t)
+	var buf bytes.Buffer
+	req := openai.SpeechRequest{Model: "tts", Input: longInput, Voice: "alloy", ResponseFormat: "mp3"}
+	if err := speech.Write(context.Background(), client, req, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if len(*reqs) != 3 {
+		t.Fatalf("got %d requests, want 3", len(*reqs))
+	}
+	var want, input strings.Builder
+	for _, r := range *reqs {
+		if r.Voice != "alloy" || r.ResponseFormat != "mp3" {
+			t.Errorf("request lost its options: %+v", r)
+		}
+		want.WriteString("mp3:" + strings.Repeat("x", len(r.Input)%7))
+		input.WriteString(r.Input + " ")
+	}
+	if buf.String() != want.String() {
+		t.Errorf("got audio %q, want the parts concatenated, %q", buf.String(), want.String())
+	}
+	if strings.Join(strings.Fields(input.String()), " ") != strings.Join(strings.Fields(longInput), " ") {
+		t.Errorf("parts don't add up to the input")
+	}
+}
+
+func TestWriteWAV(t *testing.T) {
+	client, reqs := server(t)
+	var buf bytes.Buffer
+	req := openai.SpeechRequest{Input: longInput, ResponseFormat: "wav"}
+	if err := speech.Write(context.Background(), client, req, &buf); err != nil {
+		t.Fatal(err)
+	}
+	var pcm strings.Builder
+	for _, r := range *reqs {
+		if r.ResponseFormat != "pcm" {
+			t.Errorf("requested %q, want pcm", r.ResponseFormat)
+		}
+		pcm.WriteString("pcm:" + strings.Repeat("x", len(r.Input)%7))
+	}
+	b := buf.Bytes()
+	if len(b) < 44 || string(b[:4]) != "RIFF" || string(b[8:12]) != "WAVE" || string(b[36:40]) != "data" {
+		t.Fatalf("missing WAV header: %q", b)
+	}
+	if n := binary.LittleEndian.Uint32(b[40:44]); int(n) != pcm.Len() {
+		t.Errorf("header has %d bytes of data, want %d", n, pcm.Len())
+	}
+	if string(b[44:]) != pcm.String() {
+		t.Errorf("got data %q, want %q", b[44:], pcm.String())
+	}
+}
+
+func TestWriteLongFLAC(t *testing.T) {
+	client, reqs := server(t)
+	req := openai.SpeechRequest{Input: longInput, ResponseFormat: "flac"}
+	if err := speech.Write(context.Background(), client, req, &bytes.Buffer{}); err == nil {
+		t.Error("long flac succeeded, want an error")
+	}
+	if len(*reqs) != 0 {
+		t.Errorf("sent %d requests, want none", len(*reqs))
+	}
+}
+
+func TestSplit(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		n    int
+		want []string
+	}{
+		{"", 10, nil},
+		{"short", 10, []string{"short"}},
+		{"one two three", 8, []string{"one two ", "three"}},
+		{"First. Second one.", 12, []string{"First. ", "Second one."}},
+		{"para one\n\npara two", 15, []string{"para one\n\n", "para two"}},
+		{"abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+	} {
+		got := speech.Split(tc.text, tc.n)
+		if strings.Join(got, "|") != strings.Join(tc.want, "|") || len(got) != len(tc.want) {
+			t.Errorf("Split(%q, %d) = %q, want %q", tc.text, tc.n, got, tc.want)
+		}
+	}
+}
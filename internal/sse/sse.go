@@ -0,0 +1,107 @@
+// Package sse parses server-sent event streams, as described in
+// https://html.spec.whatwg.org/multipage/server-sent-events.html
+package sse
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+type Event struct {
+	// Type is the value of the "event" field, if set.
+	Type string
+	// Data is the value of all "data" fields in the event, joined by newlines.
+	Data string
+	// ID is the value of the "id" field, if set.
+	ID string
+}
+
+// Reader reads events from a server-sent event stream. Unlike
+// bufio.Scanner, lines are not limited in length, so large events are read
+// in full.
+type Reader struct {
+	r *bufio.Reader
+	// skipLF is whether the last line ended with a CR, so that a LF right
+	// after it is part of the same line ending.
+	skipLF bool
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next event in the stream. It returns io.EOF when the
+// stream ends.
+func (r *Reader) Next() (*Event, error) {
+	ev := &Event{}
+	var data strings.Builder
+	hasData := false
+	for {
+		line, err := r.readLine()
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if err == io.EOF && line == "" {
+			// Be lenient with streams that end without a trailing blank line:
+			// dispatch whatever data was buffered.
+			if hasData {
+				ev.Data = strings.TrimSuffix(data.String(), "\n")
+				return ev, nil
+			}
+			return nil, io.EOF
+		}
+
+		// A blank line dispatches the event. Events without data are skipped.
+		if line == "" {
+			if !hasData {
+				ev = &Event{}
+				continue
+			}
+			ev.Data = strings.TrimSuffix(data.String(), "\n")
+			return ev, nil
+		}
+		// Lines starting with a colon are comments, often used as keepalives.
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "data":
+			data.WriteString(value)
+			data.WriteString("\n")
+			hasData = true
+		case "event":
+			ev.Type = value
+		case "id":
+			ev.ID = value
+		}
+	}
+}
+
+// readLine reads a line ending with CRLF, LF, or CR, as the spec allows,
+// and returns it without the line ending.
+func (r *Reader) readLine() (string, error) {
+	var line []byte
+	for {
+		c, err := r.r.ReadByte()
+		if err != nil {
+			return string(line), err
+		}
+		if r.skipLF {
+			r.skipLF = false
+			if c == '\n' {
+				continue
+			}
+		}
+		switch c {
+		case '\n':
+			return string(line), nil
+		case '\r':
+			r.skipLF = true
+			return string(line), nil
+		}
+		line = append(line, c)
+	}
+}
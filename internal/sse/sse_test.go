@@ -0,0 +1,80 @@
+package sse_test
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/internal/sse"
+)
+
+func readAll(t *testing.T, stream string) []sse.Event {
+	var events []sse.Event
+	r := sse.NewReader(strings.NewReader(stream))
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return events
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, *e)
+	}
+}
+
+func TestReader(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		stream string
+		want   []sse.Event
+	}{
+		{
+			name:   "fields",
+			stream: "event: delta\nid: 7\ndata: {\"text\":\"Hi\"}\n\ndata:no space\n\n",
+			want:   []sse.Event{{Type: "delta", ID: "7", Data: `{"text":"Hi"}`}, {Data: "no space"}},
+		},
+		{
+			name:   "multi-line data",
+			stream: "data: one\ndata:\ndata: three\n\n",
+			want:   []sse.Event{{Data: "one\n\nthree"}},
+		},
+		{
+			name:   "comments and events without data",
+			stream: ": keepalive\n\nevent: ping\n\n:\ndata: a\n: between\ndata: b\n\n",
+			want:   []sse.Event{{Data: "a\nb"}},
+		},
+		{
+			name:   "CRLF",
+			stream: "event: x\r\ndata: a\r\ndata: b\r\n\r\ndata: c\r\n\r\n",
+			want:   []sse.Event{{Type: "x", Data: "a\nb"}, {Data: "c"}},
+		},
+		{
+			name:   "CR",
+			stream: "event: x\rdata: a\rdata: b\r\rdata: c\r\r",
+			want:   []sse.Event{{Type: "x", Data: "a\nb"}, {Data: "c"}},
+		},
+		{
+			name:   "no trailing blank line",
+			stream: "data: a\n\ndata: b",
+			want:   []sse.Event{{Data: "a"}, {Data: "b"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := readAll(t, tc.stream); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("events = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestLargeEvent checks that lines longer than bufio.Scanner's 64KB limit
+// are read in full.
+func TestLargeEvent(t *testing.T) {
+	big := strings.Repeat("x", 200<<10)
+	got := readAll(t, "data: "+big+"\n\ndata: after\n\n")
+	if len(got) != 2 || got[0].Data != big || got[1].Data != "after" {
+		t.Errorf("got %d events, want the 200KB one and then one more", len(got))
+	}
+}
@@ -0,0 +1,166 @@
+// Package stats records the usage and latency of each reply, and reports on
+// them across sessions.
+package stats
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/models"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+// Record is one reply. Times are in milliseconds.
+type Record struct {
+	Time              time.Time `json:"time"`
+	Model             string    `json:"model"`
+	InputTokens       int       `json:"input_tokens"`
+	CachedInputTokens int       `json:"cached_input_tokens,omitempty"`
+	OutputTokens      int       `json:"output_tokens"`
+	FirstTokenMillis  int64     `json:"first_token_ms"`
+	DurationMillis    int64     `json:"duration_ms"`
+}
+
+// Log appends records to a JSONL file.
+type Log struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// Record appends a reply to the log. Errors are returned, but since stats
+// are never essential, callers may ignore them.
+func (l *Log) Record(model string, u *llm.Usage, m *llm.Metrics) error {
+	r := &Record{
+		Time:             time.Now(),
+		Model:            model,
+		FirstTokenMillis: m.TimeToFirstToken.Milliseconds(),
+		DurationMillis:   m.Duration.Milliseconds(),
+	}
+	if u != nil {
+		r.InputTokens, r.CachedInputTokens, r.OutputTokens = u.InputTokens, u.CachedInputTokens, u.OutputTokens
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Load reads the records in the log made since the given time. A missing
+// log has no records.
+func (l *Log) Load(since time.Time) ([]*Record, error) {
+	f, err := os.Open(l.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var records []*Record
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		r := &Record{}
+		// Skip lines cut short by a crash, rather than failing the report.
+		if err := json.Unmarshal(s.Bytes(), r); err != nil {
+			continue
+		}
+		if !r.Time.Before(since) {
+			records = append(records, r)
+		}
+	}
+	return records, s.Err()
+}
+
+// Report writes a table of stats per model: the number of replies, the
+// median and 90th percentile time to first token, the median generation
+// speed, tokens used, and cost.
+func Report(w io.Writer, records []*Record) error {
+	byModel := map[string][]*Record{}
+	var ids []string
+	for _, r := range records {
+		if byModel[r.Model] == nil {
+			ids = append(ids, r.Model)
+		}
+		byModel[r.Model] = append(byModel[r.Model], r)
+	}
+	sort.Strings(ids)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "MODEL\tREPLIES\tTTFT p50\tTTFT p90\tTOKENS/S p50\tINPUT\tCACHED\tOUTPUT\tCOST\t")
+	for _, id := range ids {
+		rs := byModel[id]
+		var ttft, tps []float64
+		var input, cached, output int
+		for _, r := range rs {
+			input += r.InputTokens
+			cached += r.CachedInputTokens
+			output += r.OutputTokens
+			if r.FirstTokenMillis > 0 {
+				ttft = append(ttft, float64(r.FirstTokenMillis)/1000)
+			}
+			m := &llm.Metrics{
+				TimeToFirstToken: time.Duration(r.FirstTokenMillis) * time.Millisecond,
+				Duration:         time.Duration(r.DurationMillis) * time.Millisecond,
+			}
+			if v := m.TokensPerSecond(r.OutputTokens); v > 0 {
+				tps = append(tps, v)
+			}
+		}
+		cost := "-"
+		if m, ok := models.Lookup(id); ok && m.InputPrice > 0 {
+			cost = fmt.Sprintf("$%.4f", m.Cost(input, cached, output))
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%d\t%d\t%d\t%s\t\n", id, len(rs),
+			seconds(percentile(ttft, 50)), seconds(percentile(ttft, 90)), rate(percentile(tps, 50)),
+			input, cached, output, cost)
+	}
+	return tw.Flush()
+}
+
+// percentile returns the pth percentile of values by nearest rank, or -1 if
+// there are none.
+func percentile(values []float64, p int) float64 {
+	if len(values) == 0 {
+		return -1
+	}
+	sort.Float64s(values)
+	rank := (len(values)*p + 99) / 100
+	return values[max(rank, 1)-1]
+}
+
+func seconds(v float64) string {
+	if v < 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2fs", v)
+}
+
+func rate(v float64) string {
+	if v < 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f", v)
+}
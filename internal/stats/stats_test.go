@@ -0,0 +1,111 @@
+package stats_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/stats"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+func TestRecordAndReport(t *testing.T) {
+	l := &stats.Log{Path: filepath.Join(t.TempDir(), "stats.jsonl")}
+	for _, ttft := range []time.Duration{100, 200, 900} {
+		m := &llm.Metrics{TimeToFirstToken: ttft * time.Millisecond, Duration: ttft*time.Millisecond + time.Second}
+		if err := l.Record("gpt-4o", &llm.Usage{InputTokens: 1000, OutputTokens: 101}, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Record("other-model", nil, &llm.Metrics{}); err != nil {
+		t.Fatal(err)
+	}
+	// A partial line, as left by a crash, is skipped.
+	f, err := os.OpenFile(l.Path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"time":`)
+	f.Close()
+
+	records, err := l.Load(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("loaded %d records, want 4", len(records))
+	}
+	var b bytes.Buffer
+	if err := stats.Report(&b, records); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("report has %d lines, want a header and 2 models:\n%s", len(lines), b.String())
+	}
+	if got := strings.Fields(lines[1]); strings.Join(got[:5], " ") != "gpt-4o 3 0.20s 0.90s 100" {
+		t.Errorf("gpt-4o row = %q, want 3 replies, TTFT p50 0.20s and p90 0.90s, 100 tokens/s", lines[1])
+	}
+	if got := strings.Fields(lines[2]); got[0] != "other-model" || got[2] != "-" {
+		t.Errorf("other-model row = %q, want no TTFT", lines[2])
+	}
+
+	records, err = l.Load(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Errorf("loaded %d records from the future, want 0", len(records))
+	}
+}
+
+func TestUsage(t *testing.T) {
+	day1 := time.Date(2025, 3, 1, 12, 0, 0, 0, time.Local)
+	day3 := day1.AddDate(0, 0, 2)
+	records := []*stats.Record{
+		{Time: day1, Model: "gpt-4o", InputTokens: 1000000},
+		{Time: day1, Model: "other-model", InputTokens: 10, OutputTokens: 5},
+		{Time: day3, Model: "gpt-4o", OutputTokens: 1000000},
+	}
+	usage, err := stats.GroupUsage(records, "day")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) != 2 || usage[0].Key != "2025-03-01" || usage[0].Replies != 2 || usage[0].Unpriced != 1 || usage[1].Key != "2025-03-03" {
+		t.Errorf("GroupUsage(day) = %+v", usage)
+	}
+	if usage[1].Cost <= usage[0].Cost {
+		t.Errorf("output cost %v <= input cost %v, want output tokens to cost more", usage[1].Cost, usage[0].Cost)
+	}
+
+	var b bytes.Buffer
+	if err := stats.WriteUsage(&b, "day", usage, records, day1, day3); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{"DAY", "total", "* 1 replies from models without known prices", "2025-03-01 to 2025-03-03: ▂▁█\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("WriteUsage() = %q, want %q in it", out, want)
+		}
+	}
+
+	byModel, err := stats.GroupUsage(records, "model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Reset()
+	if err := stats.WriteUsageCSV(&b, "model", byModel); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 || lines[0] != "model,replies,input_tokens,cached_input_tokens,output_tokens,cost_usd,unpriced_replies" || !strings.HasPrefix(lines[1], "gpt-4o,2,1000000,0,1000000,") || !strings.HasSuffix(lines[2], ",0.000000,1") {
+		t.Errorf("WriteUsageCSV() =\n%s", b.String())
+	}
+
+	if _, err := stats.GroupUsage(records, "week"); err == nil {
+		t.Error("GroupUsage(week) succeeded, want error")
+	}
+}
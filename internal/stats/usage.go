@@ -0,0 +1,179 @@
+package stats
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/models"
+)
+
+// Usage is the tokens used and cost of a group of replies.
+type Usage struct {
+	// Key names the group: a day like "2025-01-31", a model, or a provider.
+	Key               string
+	Replies           int
+	InputTokens       int
+	CachedInputTokens int
+	OutputTokens      int
+	// Cost is the cost of the replies whose models have known prices, and
+	// Unpriced counts the rest.
+	Cost     float64
+	Unpriced int
+}
+
+func (u *Usage) add(r *Record) {
+	u.Replies++
+	u.InputTokens += r.InputTokens
+	u.CachedInputTokens += r.CachedInputTokens
+	u.OutputTokens += r.OutputTokens
+	if c, ok := cost(r); ok {
+		u.Cost += c
+	} else {
+		u.Unpriced++
+	}
+}
+
+// cost returns the cost of a reply, if its model's prices are known.
+func cost(r *Record) (float64, bool) {
+	m, ok := models.Lookup(r.Model)
+	if !ok || m.InputPrice == 0 {
+		return 0, false
+	}
+	return m.Cost(r.InputTokens, r.CachedInputTokens, r.OutputTokens), true
+}
+
+// day returns the local day of a record, like "2025-01-31".
+func day(r *Record) string {
+	return r.Time.Local().Format(time.DateOnly)
+}
+
+// dayNumber numbers the local day of t, counting from the Unix epoch.
+func dayNumber(t time.Time) int {
+	y, m, d := t.Local().Date()
+	return int(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / (24 * 60 * 60))
+}
+
+// GroupUsage totals the usage of records by "day", "model", or "provider".
+// Days are in order, and models and providers are by cost, highest first.
+func GroupUsage(records []*Record, by string) ([]*Usage, error) {
+	var key func(r *Record) string
+	switch by {
+	case "day":
+		key = day
+	case "model":
+		key = func(r *Record) string { return r.Model }
+	case "provider":
+		key = func(r *Record) string { return string(models.ProviderOf(r.Model)) }
+	default:
+		return nil, fmt.Errorf("invalid grouping %q: must be day, model, or provider", by)
+	}
+	groups := map[string]*Usage{}
+	var usage []*Usage
+	for _, r := range records {
+		k := key(r)
+		u := groups[k]
+		if u == nil {
+			u = &Usage{Key: k}
+			groups[k] = u
+			usage = append(usage, u)
+		}
+		u.add(r)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if by == "day" || usage[i].Cost == usage[j].Cost {
+			return usage[i].Key < usage[j].Key
+		}
+		return usage[i].Cost > usage[j].Cost
+	})
+	return usage, nil
+}
+
+// WriteUsage writes a table of usage grouped by, with a total row, and a
+// sparkline of the daily cost of records from start to end.
+func WriteUsage(w io.Writer, by string, usage []*Usage, records []*Record, start, end time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "%s\tREPLIES\tINPUT\tCACHED\tOUTPUT\tCOST\t\n", strings.ToUpper(by))
+	total := &Usage{Key: "total"}
+	for _, u := range usage {
+		writeUsageRow(tw, u)
+		total.Replies += u.Replies
+		total.InputTokens += u.InputTokens
+		total.CachedInputTokens += u.CachedInputTokens
+		total.OutputTokens += u.OutputTokens
+		total.Cost += u.Cost
+		total.Unpriced += u.Unpriced
+	}
+	if len(usage) > 1 {
+		writeUsageRow(tw, total)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if total.Unpriced > 0 {
+		fmt.Fprintf(w, "* %d replies from models without known prices aren't in the cost.\n", total.Unpriced)
+	}
+	first := dayNumber(start)
+	daily := make([]float64, max(dayNumber(end)-first+1, 1))
+	for _, r := range records {
+		if i := dayNumber(r.Time) - first; i >= 0 && i < len(daily) {
+			c, _ := cost(r)
+			daily[i] += c
+		}
+	}
+	_, err := fmt.Fprintf(w, "\nDaily cost, %s to %s: %s\n", start.Local().Format(time.DateOnly), end.Local().Format(time.DateOnly), Sparkline(daily))
+	return err
+}
+
+func writeUsageRow(w io.Writer, u *Usage) {
+	cost := fmt.Sprintf("$%.4f", u.Cost)
+	if u.Unpriced > 0 {
+		cost += "*"
+	}
+	fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\t\n", u.Key, u.Replies, u.InputTokens, u.CachedInputTokens, u.OutputTokens, cost)
+}
+
+// WriteUsageCSV writes usage as CSV with a header row, for spreadsheets
+// and expense reports. Costs are in US dollars.
+func WriteUsageCSV(w io.Writer, by string, usage []*Usage) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{by, "replies", "input_tokens", "cached_input_tokens", "output_tokens", "cost_usd", "unpriced_replies"})
+	for _, u := range usage {
+		cw.Write([]string{
+			u.Key,
+			strconv.Itoa(u.Replies),
+			strconv.Itoa(u.InputTokens),
+			strconv.Itoa(u.CachedInputTokens),
+			strconv.Itoa(u.OutputTokens),
+			strconv.FormatFloat(u.Cost, 'f', 6, 64),
+			strconv.Itoa(u.Unpriced),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// Sparkline draws values as a row of bars, scaled to the largest. Zeros
+// are the lowest bar.
+func Sparkline(values []float64) string {
+	top := 0.0
+	for _, v := range values {
+		top = max(top, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if top > 0 {
+			i = int(v / top * float64(len(sparks)-1))
+		}
+		b.WriteRune(sparks[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,169 @@
+// Package status reports what a session is doing, for status bars such as
+// tmux's: the model, the cost of the session so far, and whether it's
+// waiting on the model.
+package status
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bduffany/gpt-cli/internal/models"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+// Reporter writes the status each time it changes, as a line like
+// "gpt-4.1 $0.0123 thinking…". The cost is left out until a reply from a
+// model with known pricing.
+type Reporter struct {
+	// File, if set, is replaced with the status line on each change, for a
+	// status bar to read, like #(cat FILE) in tmux's status-right.
+	File string
+	// Title, if set, receives an escape sequence setting the terminal title
+	// to the status on each change, which tmux shows as #{pane_title}, and
+	// screen as the window title.
+	Title io.Writer
+
+	mu    sync.Mutex
+	model string
+	cost  float64
+	// priced is whether cost includes any reply.
+	priced bool
+	// busy is the number of requests in flight.
+	busy int
+	last string
+}
+
+// New returns a reporter for a session with model, and reports it idle.
+func New(model, file string, title io.Writer) *Reporter {
+	r := &Reporter{File: file, Title: title, model: model}
+	if file != "" {
+		os.MkdirAll(filepath.Dir(file), 0755)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.report()
+	return r
+}
+
+// Middleware reports each request as thinking until its stream ends, and
+// adds the cost of its reply.
+func (r *Reporter) Middleware(next llm.CompletionClient) llm.CompletionClient {
+	return llm.ClientFunc(func(ctx context.Context, req *llm.Request) (llm.Stream, error) {
+		r.update(func() {
+			r.model = req.Model
+			r.busy++
+		})
+		s, err := next.GetCompletion(ctx, req)
+		if err != nil {
+			r.update(func() { r.busy-- })
+			return nil, err
+		}
+		return &stream{Stream: s, r: r, model: req.Model}, nil
+	})
+}
+
+// Close clears the status: it removes the file and resets the title.
+func (r *Reporter) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Title != nil {
+		io.WriteString(r.Title, titleSequence(""))
+	}
+	if r.File == "" {
+		return nil
+	}
+	if err := os.Remove(r.File); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (r *Reporter) line() string {
+	parts := []string{r.model}
+	if r.priced {
+		parts = append(parts, fmt.Sprintf("$%.4f", r.cost))
+	}
+	state := "idle"
+	if r.busy > 0 {
+		state = "thinking…"
+	}
+	return strings.Join(append(parts, state), " ")
+}
+
+func (r *Reporter) update(f func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f()
+	r.report()
+}
+
+// report writes the status if it changed. Errors are ignored, since the
+// status is only informational.
+func (r *Reporter) report() {
+	line := r.line()
+	if line == r.last {
+		return
+	}
+	r.last = line
+	if r.Title != nil {
+		io.WriteString(r.Title, titleSequence(line))
+	}
+	if r.File != "" {
+		// Replace the file, so that readers never see it half written.
+		tmp := r.File + ".tmp"
+		if err := os.WriteFile(tmp, []byte(line+"\n"), 0644); err == nil {
+			os.Rename(tmp, r.File)
+		}
+	}
+}
+
+// titleSequence returns the escape sequence that sets the title: the
+// window title in screen, and otherwise the terminal or tmux pane title.
+func titleSequence(title string) string {
+	if os.Getenv("STY") != "" && os.Getenv("TMUX") == "" {
+		return "\033k" + title + "\033\\"
+	}
+	return "\033]2;" + title + "\033\\"
+}
+
+type stream struct {
+	llm.Stream
+	r     *Reporter
+	model string
+	ended bool
+}
+
+func (s *stream) Next() (llm.Event, error) {
+	e, err := s.Stream.Next()
+	if u, ok := e.(*llm.Usage); ok {
+		if m, ok := models.Lookup(s.model); ok {
+			s.r.update(func() {
+				s.r.cost += m.Cost(u.InputTokens, u.CachedInputTokens, u.OutputTokens)
+				s.r.priced = true
+			})
+		}
+	}
+	if err != nil {
+		s.end()
+	}
+	return e, err
+}
+
+// Close ends the request, if the stream was closed before it was read to
+// the end.
+func (s *stream) Close() error {
+	s.end()
+	return s.Stream.Close()
+}
+
+func (s *stream) end() {
+	if !s.ended {
+		s.ended = true
+		s.r.update(func() { s.r.busy-- })
+	}
+}
@@ -0,0 +1,66 @@
+package status_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/internal/status"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/llm/llmtest"
+)
+
+func TestReporter(t *testing.T) {
+	t.Setenv("STY", "")
+	path := filepath.Join(t.TempDir(), "status", "gpt")
+	title := &bytes.Buffer{}
+	r := status.New("gpt-4.1", path, title)
+	readFile := func() string {
+		t.Helper()
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(b))
+	}
+	if got := readFile(); got != "gpt-4.1 idle" {
+		t.Errorf("status at start = %q", got)
+	}
+
+	fake := llmtest.NewClient(&llmtest.Response{Events: []llm.Event{
+		llm.TextDelta{Text: "Hi"},
+		&llm.Usage{InputTokens: 1000000, OutputTokens: 0},
+	}})
+	client := llm.Chain(fake, r.Middleware)
+	s, err := client.GetCompletion(context.Background(), &llm.Request{Model: "gpt-4.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(); got != "gpt-4.1 thinking…" {
+		t.Errorf("status while streaming = %q", got)
+	}
+	for {
+		if _, err := s.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := readFile(), "gpt-4.1 $2.0000 idle"; got != want {
+		t.Errorf("status after the reply = %q, want %q", got, want)
+	}
+	if !strings.HasSuffix(title.String(), "\033]2;gpt-4.1 $2.0000 idle\033\\") {
+		t.Errorf("title = %q", title.String())
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("status file not removed: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+// Package templates loads named prompt templates from the prompts directory
+// in the config dir.
+//
+// A template is a text/template file with optional YAML front matter:
+//
+//	---
+//	model: gpt-4.1-mini
+//	system: You are a senior Go reviewer.
+//	format: text
+//	---
+//	Review this {{.lang}} code:
+//
+//	{{.input}}
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/bduffany/gpt-cli/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// extensions are tried in order when looking up a template by name.
+var extensions = []string{".md", ".txt", ""}
+
+type Template struct {
+	Name string `yaml:"-"`
+	// Model overrides the default model, unless -model is set.
+	Model string `yaml:"model"`
+	// System overrides the default system prompt.
+	System string `yaml:"system"`
+	// Format is the reply format: "text" (default) or "json".
+	Format string `yaml:"format"`
+	// Description is shown when listing templates.
+	Description string `yaml:"description"`
+
+	body string
+}
+
+// Dir returns the directory containing templates.
+func Dir() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "prompts"), nil
+}
+
+// Load reads the template with the given name.
+func Load(name string) (*Template, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	for _, ext := range extensions {
+		b, err := os.ReadFile(filepath.Join(dir, name+ext))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		t, err := Parse(name, string(b))
+		if err != nil {
+			return nil, fmt.Errorf("template %q: %w", name, err)
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("template %q not found in %s", name, dir)
+}
+
+// Exists reports whether there's a template with the given name, whether
+// or not it parses.
+func Exists(name string) bool {
+	dir, err := Dir()
+	if err != nil {
+		return false
+	}
+	for _, ext := range extensions {
+		if _, err := os.Stat(filepath.Join(dir, name+ext)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse parses a template file's contents.
+func Parse(name, text string) (*Template, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	t := &Template{Name: name, body: text}
+	if rest, ok := strings.CutPrefix(text, "---\n"); ok {
+		// The newline lets the front matter be empty.
+		front, body, ok := strings.Cut("\n"+rest, "\n---\n")
+		if !ok {
+			// The closing --- may end the file.
+			if front, ok = strings.CutSuffix("\n"+rest, "\n---"); !ok {
+				return nil, fmt.Errorf("unterminated front matter")
+			}
+		}
+		if err := yaml.Unmarshal([]byte(front), t); err != nil {
+			return nil, fmt.Errorf("parse front matter: %w", err)
+		}
+		t.body = body
+	}
+	if t.Format != "" && t.Format != "text" && t.Format != "json" {
+		return nil, fmt.Errorf("invalid format %q: must be text or json", t.Format)
+	}
+	return t, nil
+}
+
+// Render executes the template body with the given vars. Referencing a var
+// that isn't set is an error.
+func (t *Template) Render(vars map[string]string) (string, error) {
+	tmpl, err := template.New(t.Name).Option("missingkey=error").Parse(t.body)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, vars); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// List returns all templates, sorted by name.
+func List() ([]*Template, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []*Template
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+		t, err := Load(name)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
@@ -0,0 +1,54 @@
+package templates_test
+
+import (
+	"testing"
+
+	"github.com/bduffany/gpt-cli/internal/templates"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		text   string
+		model  string
+		format string
+		body   string
+		err    bool
+	}{
+		{name: "no front matter", text: "Review {{.input}}\n", body: "Review x\n"},
+		{name: "front matter", text: "---\nmodel: m\nformat: json\n---\nReview {{.input}}\n", model: "m", format: "json", body: "Review x\n"},
+		{name: "CRLF", text: "---\r\nmodel: m\r\n---\r\nReview\r\n{{.input}}\r\n", model: "m", body: "Review\nx\n"},
+		{name: "CRLF without front matter", text: "Review\r\n{{.input}}\r\n", body: "Review\nx\n"},
+		{name: "closed at EOF", text: "---\nmodel: m\n---", model: "m", body: ""},
+		{name: "closed at EOF with CRLF", text: "---\r\nmodel: m\r\n---", model: "m", body: ""},
+		{name: "empty front matter", text: "---\n---\n{{.input}}", body: "x"},
+		{name: "--- in body", text: "---\nmodel: m\n---\nA\n---\nB\n", model: "m", body: "A\n---\nB\n"},
+		{name: "--- not on its own line", text: "---\nmodel: m\n---x\n", err: true},
+		{name: "unterminated", text: "---\nmodel: m\nReview\n", err: true},
+		{name: "bad YAML", text: "---\nmodel: [\n---\n", err: true},
+		{name: "bad format", text: "---\nformat: xml\n---\n", err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := templates.Parse("t", tc.text)
+			if tc.err {
+				if err == nil {
+					t.Fatal("got no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tmpl.Model != tc.model || tmpl.Format != tc.format {
+				t.Errorf("got model %q and format %q, want %q and %q", tmpl.Model, tmpl.Format, tc.model, tc.format)
+			}
+			body, err := tmpl.Render(map[string]string{"input": "x"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body != tc.body {
+				t.Errorf("got body %q, want %q", body, tc.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Chunk is a part of a diff small enough to send to a model: the changes to
+// one or more whole files, or some of the hunks of one large file, under
+// its header.
+type Chunk struct {
+	// Paths are the files changed in the chunk.
+	Paths []string
+	Diff  string
+}
+
+// fileSection is the part of a git diff that changes one file.
+type fileSection struct {
+	path   string
+	header string
+	hunks  []string
+}
+
+// SplitChunks splits a git diff into chunks of at most maxBytes, keeping
+// the changes to each file together when they fit. A larger file's hunks
+// are split between chunks, each starting with the file's header, and a
+// single hunk larger than maxBytes is cut short.
+func SplitChunks(diff string, maxBytes int) []Chunk {
+	var chunks []Chunk
+	var cur Chunk
+	flush := func() {
+		if cur.Diff != "" {
+			chunks = append(chunks, cur)
+		}
+		cur = Chunk{}
+	}
+	for _, f := range splitSections(diff) {
+		text := f.header + strings.Join(f.hunks, "")
+		if len(text) <= maxBytes {
+			if len(cur.Diff)+len(text) > maxBytes {
+				flush()
+			}
+			cur.Paths = append(cur.Paths, f.path)
+			cur.Diff += text
+			continue
+		}
+		flush()
+		for _, h := range f.hunks {
+			if cur.Diff != "" && len(cur.Diff)+len(h) > maxBytes {
+				flush()
+			}
+			if cur.Diff == "" {
+				cur = Chunk{Paths: []string{f.path}, Diff: f.header}
+			}
+			if room := maxBytes - len(cur.Diff); len(h) > room {
+				h = cutHunk(h, room)
+			}
+			cur.Diff += h
+		}
+		flush()
+	}
+	flush()
+	return chunks
+}
+
+// cutHunk cuts a hunk to about n bytes at a line break, noting how much was
+// left out.
+func cutHunk(h string, n int) string {
+	cut := h[:max(n, 0)]
+	if i := strings.LastIndexByte(cut, '\n'); i >= 0 {
+		cut = cut[:i+1]
+	} else {
+		cut = ""
+	}
+	return cut + fmt.Sprintf("[hunk truncated: %d more bytes omitted]\n", len(h)-len(cut))
+}
+
+// splitSections splits a git diff at each "diff --git" line into the
+// changes to each file, and each file's changes into hunks.
+func splitSections(diff string) []fileSection {
+	var files []fileSection
+	var f *fileSection
+	for _, line := range lines(diff) {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			files = append(files, fileSection{path: gitPath(line), header: line})
+			f = &files[len(files)-1]
+		case f == nil:
+			// Text before the first file, such as a commit message.
+		case strings.HasPrefix(line, "@@"):
+			f.hunks = append(f.hunks, line)
+		case len(f.hunks) > 0:
+			f.hunks[len(f.hunks)-1] += line
+		default:
+			if strings.HasPrefix(line, "+++ ") && !strings.HasSuffix(strings.TrimSpace(line), "/dev/null") {
+				f.path = diffPath(line[4:], "b/")
+			}
+			f.header += line
+		}
+	}
+	return files
+}
+
+// gitPath returns the new path in a "diff --git a/old b/new" line.
+func gitPath(line string) string {
+	line = strings.TrimSpace(strings.TrimPrefix(line, "diff --git "))
+	if i := strings.LastIndex(line, " b/"); i >= 0 {
+		return line[i+3:]
+	}
+	return line
+}
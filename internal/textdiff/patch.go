@@ -0,0 +1,162 @@
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FileDiff is the part of a unified diff that changes one file.
+type FileDiff struct {
+	// OldPath and NewPath are the paths in the --- and +++ lines, without
+	// the a/ and b/ prefixes of git diffs. A created file's OldPath and a
+	// deleted file's NewPath are "/dev/null".
+	OldPath, NewPath string
+	// Hunks is the rest of the diff, starting with the first @@ line.
+	Hunks string
+}
+
+// SplitFiles splits a unified diff into the changes to each file.
+func SplitFiles(diff string) ([]FileDiff, error) {
+	var files []FileDiff
+	var hunks *strings.Builder
+	l := lines(diff)
+	for i := 0; i < len(l); i++ {
+		line := l[i]
+		if strings.HasPrefix(line, "--- ") && i+1 < len(l) && strings.HasPrefix(l[i+1], "+++ ") {
+			if hunks != nil {
+				files[len(files)-1].Hunks = hunks.String()
+			}
+			files = append(files, FileDiff{OldPath: diffPath(line[4:], "a/"), NewPath: diffPath(l[i+1][4:], "b/")})
+			hunks = &strings.Builder{}
+			i++
+			continue
+		}
+		if hunks != nil && (hunks.Len() > 0 || strings.HasPrefix(line, "@@")) {
+			hunks.WriteString(line)
+		}
+	}
+	if hunks == nil {
+		return nil, fmt.Errorf("no --- and +++ file headers in diff")
+	}
+	files[len(files)-1].Hunks = hunks.String()
+	return files, nil
+}
+
+// diffPath returns the path in a --- or +++ line, without a timestamp or
+// the given git prefix.
+func diffPath(s, prefix string) string {
+	s = strings.TrimSpace(s)
+	if path, _, ok := strings.Cut(s, "\t"); ok {
+		s = path
+	}
+	if s == "/dev/null" {
+		return s
+	}
+	return strings.TrimPrefix(s, prefix)
+}
+
+// Apply applies the hunks of a unified diff for one file to old. Each hunk
+// is found by its context and removed lines, searching forward from the
+// previous hunk, rather than by its line numbers, which hand-written and
+// generated diffs often get wrong. Lines that differ only in trailing
+// whitespace match.
+func Apply(old, hunks string) (string, error) {
+	text := lines(old)
+	if old == "" {
+		text = nil
+	}
+	pos := 0
+	n := 0
+	l := lines(hunks)
+	for i := 0; i < len(l); {
+		if !strings.HasPrefix(l[i], "@@") {
+			i++
+			continue
+		}
+		n++
+		i++
+		var ops []op
+		var from []string
+		for ; i < len(l) && !strings.HasPrefix(l[i], "@@"); i++ {
+			line := l[i]
+			if strings.HasPrefix(line, "\\") {
+				// "\ No newline at end of file" applies to the line before.
+				continue
+			}
+			o := op{kind: ' ', line: line}
+			if line != "\n" {
+				o = op{kind: line[0], line: line[1:]}
+			}
+			if o.kind != ' ' && o.kind != '-' && o.kind != '+' {
+				return "", fmt.Errorf("hunk %d: unexpected line %q", n, strings.TrimSuffix(line, "\n"))
+			}
+			if !strings.HasSuffix(o.line, "\n") {
+				o.line += "\n"
+			}
+			if o.kind != '+' {
+				from = append(from, o.line)
+			}
+			ops = append(ops, o)
+		}
+		at := len(text)
+		if len(from) > 0 {
+			if at = find(text, from, pos); at < 0 {
+				return "", fmt.Errorf("hunk %d doesn't match the file", n)
+			}
+		}
+		// Keep the file's own unchanged lines, which may differ in trailing
+		// whitespace.
+		var to []string
+		k := at
+		for _, o := range ops {
+			switch o.kind {
+			case ' ':
+				to = append(to, text[k])
+				k++
+			case '-':
+				k++
+			case '+':
+				to = append(to, o.line)
+			}
+		}
+		for j, line := range to {
+			if !strings.HasSuffix(line, "\n") {
+				to[j] += "\n"
+			}
+		}
+		// Keep the lack of a newline at the end of the file.
+		if k == len(text) && k > 0 && !strings.HasSuffix(text[k-1], "\n") && len(to) > 0 {
+			to[len(to)-1] = strings.TrimSuffix(to[len(to)-1], "\n")
+		}
+		text = append(text[:at:at], append(to, text[k:]...)...)
+		pos = at + len(to)
+	}
+	if n == 0 {
+		return "", fmt.Errorf("no hunks in diff")
+	}
+	return strings.Join(text, ""), nil
+}
+
+// find returns the index of the first run of lines in text matching want,
+// at or after start, or else before start, or -1.
+func find(text, want []string, start int) int {
+	match := func(i int) bool {
+		for j, w := range want {
+			if strings.TrimRight(text[i+j], " \t\r\n") != strings.TrimRight(w, " \t\r\n") {
+				return false
+			}
+		}
+		return true
+	}
+	for i := start; i+len(want) <= len(text); i++ {
+		if match(i) {
+			return i
+		}
+	}
+	for i := min(start, len(text)-len(want)); i >= 0; i-- {
+		if match(i) {
+			return i
+		}
+	}
+	return -1
+}
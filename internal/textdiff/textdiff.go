@@ -0,0 +1,204 @@
+// Package textdiff computes line diffs of text, for showing changes to the
+// user.
+package textdiff
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bduffany/gpt-cli/pkg/chat"
+)
+
+// maxEdits bounds the work done to find a minimal diff. Past it, the old
+// text is shown as deleted and the new text as inserted.
+const maxEdits = 2000
+
+// context is the number of unchanged lines shown around each change.
+const context = 3
+
+type op struct {
+	// kind is ' ', '-', or '+'.
+	kind byte
+	line string
+}
+
+// Unified returns a unified diff from old to new, or "" if they're equal.
+func Unified(oldName, newName, old, new string) string {
+	if old == new {
+		return ""
+	}
+	ops := diff(lines(old), lines(new))
+	// oldLine and newLine are the number of lines before each op.
+	oldLine, newLine := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	for i, o := range ops {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if o.kind != '+' {
+			oldLine[i+1]++
+		}
+		if o.kind != '-' {
+			newLine[i+1]++
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	for i := 0; i < len(ops); {
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+		start := max(i-context, 0)
+		end := i
+		// Extend the hunk over changes separated by little enough context
+		// that separate hunks would overlap.
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			j := end
+			for j < len(ops) && ops[j].kind == ' ' {
+				j++
+			}
+			if j == len(ops) || j-end > 2*context {
+				break
+			}
+			end = j
+		}
+		end = min(end+context, len(ops))
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(oldLine[start], oldLine[end]), hunkRange(newLine[start], newLine[end]))
+		for _, o := range ops[start:end] {
+			b.WriteByte(o.kind)
+			b.WriteString(strings.TrimSuffix(o.line, "\n"))
+			b.WriteByte('\n')
+			if !strings.HasSuffix(o.line, "\n") {
+				b.WriteString("\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return b.String()
+}
+
+// Show displays a colorized diff of a change to a file.
+func Show(w io.Writer, path, old, new string) {
+	diff := Unified(path, path, old, new)
+	if diff == "" {
+		io.WriteString(w, chat.Styled(chat.StyleNote, "(no changes to "+path+")")+"\n")
+		return
+	}
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(diff, "\n"), "\n") {
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"):
+			line = chat.Styled(chat.StyleHeading, line)
+		case strings.HasPrefix(line, "@@"):
+			line = chat.Styled(chat.StyleDiffHunk, line)
+		case strings.HasPrefix(line, "-"):
+			line = chat.Styled(chat.StyleDiffRemove, line)
+		case strings.HasPrefix(line, "+"):
+			line = chat.Styled(chat.StyleDiffAdd, line)
+		}
+		io.WriteString(w, line+"\n")
+	}
+}
+
+func hunkRange(start, end int) string {
+	n := end - start
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if n == 1 {
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+// lines splits s into lines, keeping each line's newline.
+func lines(s string) []string {
+	l := strings.SplitAfter(s, "\n")
+	if l[len(l)-1] == "" {
+		l = l[:len(l)-1]
+	}
+	return l
+}
+
+// diff returns a shortest edit script from a to b, using Myers' algorithm.
+func diff(a, b []string) []op {
+	n, m := len(a), len(b)
+	off := n + m + 1
+	v := make([]int, 2*off+1)
+	// trace[d] holds v for diagonals -d through d, before step d.
+	var trace [][]int
+	found := -1
+	for d := 0; d <= min(n+m, maxEdits) && found < 0; d++ {
+		trace = append(trace, append([]int{}, v[off-d:off+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				found = d
+				break
+			}
+		}
+	}
+	if found < 0 {
+		var ops []op
+		for _, l := range a {
+			ops = append(ops, op{'-', l})
+		}
+		for _, l := range b {
+			ops = append(ops, op{'+', l})
+		}
+		return ops
+	}
+
+	var ops []op
+	x, y := n, m
+	for d := found; d > 0; d-- {
+		prev := func(k int) int { return trace[d][k+d] }
+		k := x - y
+		var pk int
+		if k == -d || (k != d && prev(k-1) < prev(k+1)) {
+			pk = k + 1
+		} else {
+			pk = k - 1
+		}
+		px := prev(pk)
+		py := px - pk
+		for x > px && y > py {
+			ops = append(ops, op{' ', a[x-1]})
+			x--
+			y--
+		}
+		if x == px {
+			ops = append(ops, op{'+', b[y-1]})
+			y--
+		} else {
+			ops = append(ops, op{'-', a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, op{' ', a[x-1]})
+		x--
+		y--
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
@@ -0,0 +1,122 @@
+package textdiff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	for _, test := range []struct {
+		name, old, new, want string
+	}{
+		{"equal", "a\n", "a\n", ""},
+		{"new file", "", "a\nb\n", "@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{"change", "a\nb\nc\n", "a\nB\nc\n", "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+		{"no newline", "a\n", "a", "@@ -1 +1 @@\n-a\n+a\n\\ No newline at end of file\n"},
+		{
+			"context",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"1\nX\n3\n4\n5\n6\n7\n8\n9\n10\n11\nY\n",
+			"@@ -1,5 +1,5 @@\n 1\n-2\n+X\n 3\n 4\n 5\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+Y\n",
+		},
+		{
+			"merged hunks",
+			"1\n2\n3\n4\n5\n6\n",
+			"X\n2\n3\n4\n5\nY\n",
+			"@@ -1,6 +1,6 @@\n-1\n+X\n 2\n 3\n 4\n 5\n-6\n+Y\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			got := Unified("old", "new", test.old, test.new)
+			if test.want != "" {
+				test.want = "--- old\n+++ new\n" + test.want
+			}
+			if got != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDiffIsMinimal(t *testing.T) {
+	a := lines(strings.Repeat("x\ny\nz\n", 50))
+	b := append(append([]string{}, a[:75]...), a[76:]...)
+	changes := 0
+	for _, o := range diff(a, b) {
+		if o.kind != ' ' {
+			changes++
+		}
+	}
+	if changes != 1 {
+		t.Errorf("got %d changes for a single deleted line, want 1", changes)
+	}
+}
+
+func TestApply(t *testing.T) {
+	old := "package main\n\nimport \"fmt\"\n\nfunc main() {  \n\tfmt.Println(\"hi\")\n}"
+	diff := `--- a/main.go
++++ b/main.go
+@@ -1,3 +1,3 @@
+ package main
+ 
+-import "fmt"
++import "log"
+@@ -10,3 +10,3 @@
+ func main() {
+-	fmt.Println("hi")
++	log.Print("hi")
+ }
+`
+	files, err := SplitFiles("Some prose.\n\n" + diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].OldPath != "main.go" || files[0].NewPath != "main.go" {
+		t.Fatalf("SplitFiles() = %+v", files)
+	}
+	got, err := Apply(old, files[0].Hunks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "package main\n\nimport \"log\"\n\nfunc main() {  \n\tlog.Print(\"hi\")\n}"
+	if got != want {
+		t.Errorf("Apply() = %q, want %q", got, want)
+	}
+
+	if _, err := Apply(old, "@@ -1 +1 @@\n-package lib\n+package main\n"); err == nil {
+		t.Error("Apply() of a mismatched hunk succeeded")
+	}
+	got, err = Apply("", "@@ -0,0 +1,2 @@\n+a\n+b\n")
+	if err != nil || got != "a\nb\n" {
+		t.Errorf("Apply() to a new file = %q, %v", got, err)
+	}
+}
+
+func TestSplitChunks(t *testing.T) {
+	file := func(path string, hunks ...string) string {
+		s := "diff --git a/" + path + " b/" + path + "\nindex 1111111..2222222 100644\n--- a/" + path + "\n+++ b/" + path + "\n"
+		for _, h := range hunks {
+			s += "@@ -1 +1 @@\n-" + h + "\n+" + h + "!\n"
+		}
+		return s
+	}
+	a, b := file("a.go", "x"), file("b.go", "y")
+	big := file("big.go", strings.Repeat("1", 40), strings.Repeat("2", 40), strings.Repeat("3", 400))
+	diff := "commit message\n\n" + a + b + big
+	chunks := SplitChunks(diff, 300)
+
+	header := "diff --git a/big.go b/big.go\nindex 1111111..2222222 100644\n--- a/big.go\n+++ b/big.go\n"
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, want 3: %q", len(chunks), chunks)
+	}
+	if got := chunks[0]; !reflect.DeepEqual(got.Paths, []string{"a.go", "b.go"}) || got.Diff != a+b {
+		t.Errorf("chunk 0 = %q, want the small files together", got)
+	}
+	if got := chunks[1]; !reflect.DeepEqual(got.Paths, []string{"big.go"}) || !strings.HasPrefix(got.Diff, header) || strings.Count(got.Diff, "@@ -1") != 2 {
+		t.Errorf("chunk 1 = %q, want the first two hunks of big.go", got)
+	}
+	if got := chunks[2]; !strings.HasPrefix(got.Diff, header) || !strings.HasSuffix(got.Diff, "more bytes omitted]\n") || len(got.Diff) > 300+50 {
+		t.Errorf("chunk 2 = %q, want the cut third hunk of big.go", got)
+	}
+}
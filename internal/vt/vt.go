@@ -0,0 +1,3 @@
+// Package vt enables the terminal's handling of ANSI escape sequences, such
+// as colors, where it's off by default.
+package vt
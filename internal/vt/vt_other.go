@@ -0,0 +1,9 @@
+//go:build !windows
+
+package vt
+
+// Enable reports whether escape sequences are supported, which they always
+// are outside of Windows.
+func Enable() bool {
+	return true
+}
@@ -0,0 +1,32 @@
+//go:build windows
+
+package vt
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// Enable turns on virtual terminal processing for stdout and stderr, so
+// that Windows consoles interpret escape sequences instead of printing them.
+// It reports whether escape sequences are supported, which they aren't on
+// consoles older than Windows 10. Output that isn't a console, such as a
+// pipe, is left alone.
+func Enable() bool {
+	ok := true
+	for _, f := range []*os.File{os.Stdout, os.Stderr} {
+		h := windows.Handle(f.Fd())
+		var mode uint32
+		if err := windows.GetConsoleMode(h, &mode); err != nil {
+			continue
+		}
+		if mode&windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING != 0 {
+			continue
+		}
+		if err := windows.SetConsoleMode(h, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING); err != nil {
+			ok = false
+		}
+	}
+	return ok
+}
@@ -0,0 +1,693 @@
+// Package chat runs a conversation with a model, either interactively or
+// from a prompt source.
+package chat
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/models"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/chzyer/readline"
+	"github.com/mattn/go-isatty"
+)
+
+// ContinuePrompt asks the model to continue a truncated reply. See
+// Chat.Continue.
+const ContinuePrompt = "Continue exactly where your last message left off. Do not repeat any of it, and do not add any preamble."
+
+// PromptHook rewrites a prompt read from the user before it is sent, such as
+// to add context.
+type PromptHook func(ctx context.Context, prompt string) (string, error)
+
+// MessageHook rewrites the messages sent with each request, without
+// changing the chat history, such as to add context that should always be
+// current.
+type MessageHook func(ctx context.Context, messages []llm.Message) ([]llm.Message, error)
+
+// UsageHook is called after each complete reply from the model, including
+// continuations and replies read outside of Run, with its usage and timings.
+// u is nil if the provider doesn't report usage.
+type UsageHook func(model string, u *llm.Usage, m *llm.Metrics)
+
+// Command handles a prompt like "/name args" in Run, in place of sending it.
+type Command func(ctx context.Context, args string) error
+
+// ReplyHook is called with the full content of each reply once it has been
+// displayed.
+type ReplyHook func(ctx context.Context, reply string) error
+
+type Chat struct {
+	// Client sends each request. It may be wrapped, such as to add caching.
+	Client       llm.CompletionClient
+	Model        string
+	PromptReader io.Reader
+	Interactive  bool
+	Messages     []llm.Message
+	// Terminal is read for prompts in interactive mode, when stdin isn't a
+	// terminal, such as after a prompt piped to stdin. See OpenTerminal.
+	Terminal *os.File
+
+	// ReasoningEffort is passed to reasoning models, such as "low" or "high".
+	// Empty uses the model's default.
+	ReasoningEffort string
+	// ResponseFormat is the type of reply to request, such as "json_object".
+	// Empty means plain text.
+	ResponseFormat string
+	// WebSearch lets the model search the web before replying.
+	WebSearch bool
+	// CacheKey is sent with each request, so that the provider can reuse
+	// its prompt cache across turns. See llm.Request.
+	CacheKey       string
+	RequestOptions llm.RequestOptions
+	// AutoContinue is the number of times a reply truncated by max tokens is
+	// continued automatically, before asking the user whether to continue.
+	AutoContinue int
+	// PromptHooks are applied in order to each prompt read in Run.
+	PromptHooks []PromptHook
+	// ReplyHooks are called in order after each reply displayed in Run.
+	ReplyHooks []ReplyHook
+	// MessageHooks are applied in order to the messages of each request.
+	MessageHooks []MessageHook
+	// Commands are run by name for prompts starting with "/". Prompts naming
+	// no command are sent as usual.
+	Commands map[string]Command
+	// UsageHooks are called in order after each complete reply.
+	UsageHooks []UsageHook
+	// ShowThinking displays the model's reasoning dimmed before each reply,
+	// for providers that expose it.
+	ShowThinking bool
+	// ShowUsage displays the tokens used by each reply, including how many
+	// input tokens were read from the prompt cache, and the cost.
+	ShowUsage bool
+	// Spinner draws an animated indicator with the elapsed time on Notes,
+	// from sending each request until its reply starts. Notes must be a
+	// terminal.
+	Spinner bool
+	// ReasoningProgress shows the latest line of the model's reasoning after
+	// the spinner as it streams, for providers that expose it, unless
+	// ShowThinking displays it in full.
+	ReasoningProgress bool
+	// Wrap breaks lines written to Display between words to fit the
+	// terminal, at its new width after it's resized, rather than leaving the
+	// terminal to break them mid-word. Display must be a terminal.
+	Wrap bool
+	// RenderMath displays the LaTeX math in replies, like $x^2$ or \[x^2\],
+	// as unicode approximations, like x². Out receives the LaTeX as it is.
+	RenderMath bool
+	// RenderTables draws the markdown tables in replies with box drawing
+	// characters, with columns aligned and fit to the terminal. Out
+	// receives the markdown as it is.
+	RenderTables bool
+
+	// Display receives the text of each reply.
+	Display io.Writer
+	// Notes receives everything else that's displayed: reasoning, usage,
+	// warnings, and questions for the user. Nil means Display.
+	Notes io.Writer
+	// Out, if set, receives a copy of the text of each reply as it streams,
+	// such as to save replies to a file.
+	Out io.Writer
+	// OutPrompts also writes each prompt to Out under a heading, followed by
+	// a heading for the reply, so that Out has the full exchange.
+	OutPrompts bool
+
+	readline *readline.Instance
+	eof      bool
+	wrapper  *wrapper
+	// nextModel, if set, is the model for the next prompt only, as set by
+	// /model-once.
+	nextModel string
+}
+
+func New(client llm.CompletionClient, messages []llm.Message) (*Chat, error) {
+	var rl *readline.Instance
+	interactive := isatty.IsTerminal(os.Stdin.Fd())
+	var pr io.Reader
+	if !interactive {
+		pr = os.Stdin
+	}
+	return &Chat{
+		Client:       client,
+		readline:     rl,
+		Display:      os.Stdout,
+		Messages:     append([]llm.Message{}, messages...),
+		Model:        models.Default,
+		Interactive:  interactive,
+		PromptReader: pr,
+	}, nil
+}
+
+func (c *Chat) GetPrompt() (string, error) {
+	if c.eof {
+		return "", io.EOF
+	}
+
+	if c.PromptReader != nil {
+		b, err := io.ReadAll(c.PromptReader)
+		if !c.Interactive {
+			c.eof = true
+		}
+		// Read the following prompts from the terminal.
+		c.PromptReader = nil
+		return string(b), err
+	}
+
+	if err := c.initReadline(); err != nil {
+		return "", err
+	}
+
+	if c.readline != nil {
+		// Refresh the label, which may show the time.
+		c.readline.SetPrompt(UserPrompt(c.Model))
+		return c.readline.Readline()
+	}
+
+	b, err := io.ReadAll(os.Stdin)
+	return string(b), err
+}
+
+// initReadline starts reading prompts from the terminal, in interactive
+// mode.
+func (c *Chat) initReadline() error {
+	if !c.Interactive || c.readline != nil {
+		return nil
+	}
+	cfg := &readline.Config{Prompt: UserPrompt(c.Model)}
+	if tty := c.Terminal; tty != nil {
+		fd := int(tty.Fd())
+		var state *readline.State
+		cfg.Stdin = tty
+		cfg.FuncIsTerminal = func() bool { return readline.IsTerminal(fd) }
+		cfg.FuncMakeRaw = func() (err error) {
+			state, err = readline.MakeRaw(fd)
+			return err
+		}
+		cfg.FuncExitRaw = func() error {
+			if state == nil {
+				return nil
+			}
+			return readline.Restore(fd, state)
+		}
+	}
+	r, err := readline.NewEx(cfg)
+	if err != nil {
+		return err
+	}
+	c.readline = r
+	return nil
+}
+
+// OpenTerminal opens the controlling terminal, for reading prompts when
+// stdin is a pipe.
+func OpenTerminal() (*os.File, error) {
+	name := "/dev/tty"
+	if runtime.GOOS == "windows" {
+		name = "CONIN$"
+	}
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open terminal: %w", err)
+	}
+	if !isatty.IsTerminal(f.Fd()) {
+		f.Close()
+		return nil, fmt.Errorf("open terminal: %s is not a terminal", name)
+	}
+	return f, nil
+}
+
+// ErrNoTerminal is returned by Askf when there's no terminal to ask on.
+var ErrNoTerminal = errors.New("not running in a terminal")
+
+// Askf asks the user a question, returning their answer with surrounding
+// whitespace trimmed.
+func (c *Chat) Askf(format string, args ...any) (string, error) {
+	io.WriteString(c.notes(), Styled(StyleWarning, fmt.Sprintf(format, args...))+"\n")
+	if err := c.initReadline(); err != nil {
+		return "", err
+	}
+	if c.readline == nil {
+		return "", ErrNoTerminal
+	}
+	res, err := c.readline.Readline()
+	return strings.TrimSpace(res), err
+}
+
+// Confirmf asks the user a yes or no question, returning whether they said
+// yes and their full answer. Without a terminal to ask on, the answer is no.
+func (c *Chat) Confirmf(format string, args ...any) (bool, string, error) {
+	res, err := c.Askf(format+" (yes / no)", args...)
+	if err == ErrNoTerminal {
+		const answer = "no (not running in a terminal)"
+		io.WriteString(c.notes(), answer+"\n")
+		return false, answer, nil
+	}
+	if err != nil {
+		return false, "no", err
+	}
+	if res == "" {
+		return false, "no", nil
+	}
+	if res == "y" || res == "yes" || res == "ok" {
+		return true, res, nil
+	}
+	return false, res, nil
+}
+
+// Reply is a reply streamed from the model. The displayed text ends with a
+// newline, unless the reply was truncated by max tokens, in which case it may
+// be continued seamlessly.
+type Reply struct {
+	*llm.Reader
+	// Raw reads exactly the reply text, without the newline that otherwise
+	// ends each complete reply for display.
+	Raw bool
+
+	content  bytes.Buffer
+	done     func(content string)
+	eof      bool
+	newline  bool
+	thinking *thinking
+	spinner  *spinner
+}
+
+func (r *Reply) Read(p []byte) (int, error) {
+	if r.eof {
+		if r.newline && len(p) > 0 {
+			r.newline = false
+			p[0] = '\n'
+			return 1, nil
+		}
+		return 0, io.EOF
+	}
+	n, err := r.Reader.Read(p)
+	if n > 0 || err != nil {
+		r.spinner.stop()
+		if r.thinking != nil {
+			r.thinking.end()
+		}
+	}
+	r.content.Write(p[:n])
+	if err != io.EOF {
+		return n, err
+	}
+	r.eof = true
+	r.newline = !r.Raw && r.FinishReason != llm.FinishReasonLength
+	r.done(r.content.String())
+	return n, nil
+}
+
+// Close stops reading the reply.
+func (r *Reply) Close() error {
+	r.spinner.stop()
+	return r.Reader.Close()
+}
+
+func (c *Chat) Send(ctx context.Context, prompt string) (*Reply, error) {
+	c.Messages = append(c.Messages, llm.Message{Role: llm.RoleUser, Content: prompt})
+	reply, err := c.stream(ctx, c.Messages, func(content string) {
+		c.Messages = append(c.Messages, llm.Message{
+			Role:    llm.RoleAssistant,
+			Content: content,
+		})
+	})
+	var be *llm.BlockedError
+	if errors.As(err, &be) {
+		// Keep the prompt out of the history, so that it doesn't block the
+		// requests after it too.
+		c.Messages = c.Messages[:len(c.Messages)-1]
+	}
+	return reply, err
+}
+
+// Continue asks the model to pick up where its last reply left off, such as
+// when the reply was truncated by max tokens. The continuation is appended to
+// the last assistant message, so the history reads as a single reply.
+func (c *Chat) Continue(ctx context.Context) (*Reply, error) {
+	if len(c.Messages) == 0 || c.Messages[len(c.Messages)-1].Role != llm.RoleAssistant {
+		return nil, fmt.Errorf("no reply to continue")
+	}
+	messages := append(c.Messages[:len(c.Messages):len(c.Messages)], llm.Message{
+		Role:    llm.RoleUser,
+		Content: ContinuePrompt,
+	})
+	return c.stream(ctx, messages, func(content string) {
+		c.Messages[len(c.Messages)-1].Content += content
+	})
+}
+
+// stream requests a completion for the given messages and streams back the
+// reply. Once the reply is complete, its full content is passed to done.
+func (c *Chat) stream(ctx context.Context, messages []llm.Message, done func(content string)) (*Reply, error) {
+	for _, hook := range c.MessageHooks {
+		var err error
+		messages, err = hook(ctx, messages[:len(messages):len(messages)])
+		if err != nil {
+			return nil, err
+		}
+	}
+	start := time.Now()
+	var sp *spinner
+	if c.Spinner {
+		sp = startSpinner(c.notes())
+	}
+	stream, err := c.Client.GetCompletion(ctx, &llm.Request{
+		Model:           c.Model,
+		Messages:        messages,
+		ReasoningEffort: c.ReasoningEffort,
+		ResponseFormat:  c.ResponseFormat,
+		WebSearch:       c.WebSearch,
+		CacheKey:        c.CacheKey,
+		Options:         c.RequestOptions,
+	})
+	if err != nil {
+		sp.stop()
+		return nil, err
+	}
+	reply := &Reply{Reader: llm.NewReader(stream), spinner: sp}
+	reply.Start = start
+	reply.done = func(content string) {
+		done(content)
+		for _, hook := range c.UsageHooks {
+			hook(c.Model, reply.Usage, &reply.Metrics)
+		}
+	}
+	if c.ShowThinking {
+		reply.thinking = &thinking{w: c.notes(), spinner: sp}
+		reply.Reasoning = reply.thinking
+	} else if c.ReasoningProgress && sp != nil {
+		reply.Reasoning = &progress{spinner: sp}
+	}
+	return reply, nil
+}
+
+// thinking displays reasoning dimmed, ahead of the reply text.
+type thinking struct {
+	w       io.Writer
+	started bool
+	// spinner is cleared before the reasoning is displayed.
+	spinner *spinner
+}
+
+func (t *thinking) Write(p []byte) (int, error) {
+	if !t.started {
+		t.spinner.stop()
+		t.started = true
+		io.WriteString(t.w, Color(StyleThinking))
+	}
+	return t.w.Write(p)
+}
+
+// end resets the style once reasoning is done, separating it from the reply.
+func (t *thinking) end() {
+	if t.started {
+		t.started = false
+		io.WriteString(t.w, Esc()+"\n\n")
+	}
+}
+
+// Run starts the prompting loop for the chat, reading from the prompt source
+// until inputs are exhausted.
+func (c *Chat) Run(ctx context.Context) error {
+	for {
+		if err := c.readAndExecutePrompt(ctx); err != nil {
+			if err == io.EOF || err == readline.ErrInterrupt {
+				return nil
+			}
+			// A timed out or blocked request shouldn't end an interactive
+			// session; report it and let the user try again.
+			var te *llm.TimeoutError
+			var be *llm.BlockedError
+			if c.Interactive && (errors.As(err, &te) || errors.As(err, &be)) {
+				io.WriteString(c.notes(), Styled(StyleError, "error: "+err.Error())+"\n")
+				continue
+			}
+			return err
+		}
+		if !c.Interactive {
+			break
+		}
+	}
+	return nil
+}
+
+func (c *Chat) readAndExecutePrompt(ctx context.Context) (err error) {
+	prompt, err := c.GetPrompt()
+	if err != nil {
+		return err
+	}
+	// When pressing Ctrl+C during a reply, stop the current request but don't
+	// return an error during program execution. This allows long replies to be
+	// interrupted without terminating the session completely. While the reply
+	// streams, Esc and Ctrl+R also control it; see streamControlled.
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT)
+	defer stop()
+	defer func() {
+		if err == errStopped {
+			// The partial reply was kept, and a newline already printed.
+			err = nil
+		} else if errors.Is(err, context.Canceled) {
+			// Context was canceled due to Ctrl+C; treat this as a non-error.
+			err = nil
+			// Print a blank line since otherwise the readline lib overwrites any
+			// partial output on the last line.
+			io.WriteString(c.screen(), "\n")
+		}
+	}()
+
+	model, rest, override := turnModel(prompt)
+	if override && rest == "" {
+		c.nextModel = model
+		c.Notef(StyleNote, "The next prompt goes to %s.", model)
+		return nil
+	}
+	if name, args, ok := commandName(prompt); ok {
+		if cmd, ok := c.Commands[name]; ok {
+			return cmd(ctx, args)
+		}
+	}
+	if override {
+		prompt = rest
+	} else if c.nextModel != "" {
+		model = c.nextModel
+	}
+	c.nextModel = ""
+	if model != "" && model != c.Model {
+		defer func(model string) { c.Model = model }(c.Model)
+		c.Model = model
+	}
+
+	for _, hook := range c.PromptHooks {
+		prompt, err = hook(ctx, prompt)
+		if err != nil {
+			return err
+		}
+	}
+
+	n, headed := len(c.Messages), false
+	reply, err := c.streamControlled(ctx, func(ctx context.Context) (*Reply, error) {
+		// Drop the prompt sent before, if the reply is being regenerated.
+		c.Messages = c.Messages[:n]
+		reply, err := c.Send(ctx, prompt)
+		if err == nil && c.Out != nil && c.OutPrompts && !headed {
+			headed = true
+			fmt.Fprintf(c.Out, "### you\n\n%s\n\n### %s\n\n", strings.TrimSpace(prompt), c.Model)
+		}
+		return reply, err
+	}, func(partial string) {
+		c.Messages = append(c.Messages, llm.Message{Role: llm.RoleAssistant, Content: partial})
+	})
+	if err != nil {
+		return err
+	}
+	usage, metrics := &llm.Usage{}, reply.Metrics
+	defer func() {
+		if c.ShowUsage && err == nil {
+			io.WriteString(c.notes(), Styled(StyleNote, UsageLine(c.Model, usage, &metrics))+"\n")
+		}
+	}()
+	addUsage(usage, reply.Usage)
+	for i := 0; reply.FinishReason == llm.FinishReasonLength; i++ {
+		if i >= c.AutoContinue {
+			io.WriteString(c.screen(), "\n")
+			c.warnFinishReason(reply.FinishReason)
+			if !c.Interactive {
+				return nil
+			}
+			ok, _, err := c.Confirmf("Continue the reply?")
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return nil
+			}
+		}
+		reply, err = c.streamControlled(ctx, c.Continue, func(partial string) {
+			c.Messages[len(c.Messages)-1].Content += partial
+		})
+		if err != nil {
+			return err
+		}
+		addUsage(usage, reply.Usage)
+		metrics.Duration += reply.Metrics.Duration
+	}
+	c.warnFinishReason(reply.FinishReason)
+	if c.Out != nil && c.OutPrompts {
+		io.WriteString(c.Out, "\n")
+	}
+	for _, hook := range c.ReplyHooks {
+		if err := hook(ctx, c.Messages[len(c.Messages)-1].Content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// modelPrefix matches a prompt prefix like "@@gpt-5:".
+var modelPrefix = regexp.MustCompile(`^\s*@@([^\s:]+):\s*`)
+
+// turnModel parses a prompt that goes to another model than the chat's,
+// either like "@@gpt-5: prompt" or "/model-once gpt-5 prompt", returning
+// the model and the rest of the prompt. The rest is empty if the model is
+// for the next prompt.
+func turnModel(prompt string) (model, rest string, ok bool) {
+	if m := modelPrefix.FindStringSubmatch(prompt); m != nil {
+		return m[1], strings.TrimSpace(prompt[len(m[0]):]), true
+	}
+	if name, args, ok := commandName(prompt); ok && name == "model-once" && args != "" {
+		model, rest, _ := strings.Cut(args, " ")
+		return model, strings.TrimSpace(rest), true
+	}
+	return "", "", false
+}
+
+// commandName parses a prompt like "/name args".
+func commandName(prompt string) (name, args string, ok bool) {
+	prompt = strings.TrimSpace(prompt)
+	if !strings.HasPrefix(prompt, "/") {
+		return "", "", false
+	}
+	name, args, _ = strings.Cut(prompt[1:], " ")
+	return name, strings.TrimSpace(args), name != ""
+}
+
+func (c *Chat) display(reply *Reply) error {
+	defer reply.Close()
+	// Hide any ReadFrom method of Display, since reading the reply may also
+	// write reasoning to Display.
+	w := c.screen()
+	// Math is rendered before tables are, so that the widths of their
+	// columns fit the rendered math.
+	var flushers []interface{ Flush() error }
+	if c.RenderTables {
+		t := newTableWriter(w, func() int { return termWidth(c.Display) })
+		flushers = append(flushers, t)
+		w = t
+	}
+	if c.RenderMath {
+		m := &mathWriter{w: w}
+		flushers = append(flushers, m)
+		w = m
+	}
+	if c.Out != nil {
+		w = io.MultiWriter(w, c.Out)
+	}
+	_, err := io.Copy(struct{ io.Writer }{w}, reply)
+	for i := len(flushers) - 1; i >= 0; i-- {
+		if ferr := flushers[i].Flush(); err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+func addUsage(total, u *llm.Usage) {
+	if u != nil {
+		total.InputTokens += u.InputTokens
+		total.CachedInputTokens += u.CachedInputTokens
+		total.OutputTokens += u.OutputTokens
+	}
+}
+
+// UsageLine summarizes the tokens used by a request, like "1200 input
+// (1024 cached, 85%), 50 output, $0.0008, first token 0.42s, 85 tokens/s".
+// The cost is left out for models with unknown pricing, and timings if
+// metrics is nil or too short to show, as for replies served from a cache.
+func UsageLine(model string, u *llm.Usage, metrics *llm.Metrics) string {
+	line := fmt.Sprintf("%d input", u.InputTokens)
+	if u.CachedInputTokens > 0 {
+		line += fmt.Sprintf(" (%d cached, %d%%)", u.CachedInputTokens, 100*u.CachedInputTokens/max(u.InputTokens, 1))
+	}
+	line += fmt.Sprintf(", %d output", u.OutputTokens)
+	if m, ok := models.Lookup(model); ok && m.InputPrice > 0 {
+		line += fmt.Sprintf(", $%.4f", m.Cost(u.InputTokens, u.CachedInputTokens, u.OutputTokens))
+	}
+	if metrics != nil && metrics.TimeToFirstToken >= 10*time.Millisecond {
+		line += fmt.Sprintf(", first token %.2fs", metrics.TimeToFirstToken.Seconds())
+		if tps := metrics.TokensPerSecond(u.OutputTokens); tps > 0 {
+			line += fmt.Sprintf(", %.0f tokens/s", tps)
+		}
+	}
+	return line
+}
+
+// warnFinishReason lets the user know if the reply ended for any reason
+// other than the model finishing normally.
+func (c *Chat) warnFinishReason(reason string) {
+	var msg string
+	switch reason {
+	case llm.FinishReasonLength:
+		msg = "response truncated by max tokens"
+	case llm.FinishReasonContentFilter:
+		msg = "response blocked by content filter"
+	default:
+		return
+	}
+	io.WriteString(c.notes(), Styled(StyleWarning, "warning: "+msg)+"\n")
+}
+
+// Notef displays a line in the given style, along with the other output
+// that isn't reply text. See Notes.
+func (c *Chat) Notef(style Style, format string, args ...any) {
+	io.WriteString(c.notes(), Styled(style, fmt.Sprintf(format, args...))+"\n")
+}
+
+func (c *Chat) notes() io.Writer {
+	if c.Notes != nil {
+		return c.Notes
+	}
+	return c.screen()
+}
+
+// screen returns the writer for Display, which wraps lines if Wrap is set.
+func (c *Chat) screen() io.Writer {
+	if !c.Wrap {
+		return c.Display
+	}
+	if c.wrapper == nil || c.wrapper.w != c.Display {
+		c.wrapper = newWrapper(c.Display)
+	}
+	return c.wrapper
+}
+
+func Esc(code ...int) string {
+	if os.Getenv("NO_COLOR") != "" {
+		return ""
+	}
+	codes := make([]string, len(code))
+	for i := range code {
+		codes[i] = strconv.Itoa(code[i])
+	}
+	return fmt.Sprintf("\x1b[%sm", strings.Join(codes, ";"))
+}
@@ -0,0 +1,372 @@
+package chat_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/llm/llmtest"
+)
+
+func newChat(t *testing.T, client llm.CompletionClient, prompt string) (*chat.Chat, *bytes.Buffer) {
+	t.Helper()
+	t.Setenv("NO_COLOR", "1")
+	c, err := chat.New(client, []llm.Message{{Role: llm.RoleSystem, Content: "Be brief."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	display := &bytes.Buffer{}
+	c.Display = display
+	c.PromptReader = strings.NewReader(prompt)
+	c.Interactive = false
+	return c, display
+}
+
+func TestRun(t *testing.T) {
+	client := llmtest.NewClient(llmtest.Text("Hi there!"))
+	c, display := newChat(t, client, "Hello")
+	c.Model = "gpt-test"
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := display.String(), "Hi there!\n"; got != want {
+		t.Errorf("display = %q, want %q", got, want)
+	}
+	want := []llm.Message{
+		{Role: llm.RoleSystem, Content: "Be brief."},
+		{Role: llm.RoleUser, Content: "Hello"},
+		{Role: llm.RoleAssistant, Content: "Hi there!"},
+	}
+	if !equalMessages(c.Messages, want) {
+		t.Errorf("messages = %q, want %q", c.Messages, want)
+	}
+	req := client.Requests()[0]
+	if req.Model != "gpt-test" || !equalMessages(req.Messages, want[:2]) {
+		t.Errorf("unexpected request %+v", req)
+	}
+}
+
+func TestRunAutoContinue(t *testing.T) {
+	client := llmtest.NewClient(llmtest.Truncated("Hel"), llmtest.Text("lo"))
+	c, display := newChat(t, client, "Hello")
+	c.AutoContinue = 1
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := display.String(), "Hello\n"; got != want {
+		t.Errorf("display = %q, want %q", got, want)
+	}
+	if got := c.Messages[len(c.Messages)-1]; got.Role != llm.RoleAssistant || got.Content != "Hello" {
+		t.Errorf("last message = %+v, want the stitched reply", got)
+	}
+	// The continuation request ends with an instruction to continue, which
+	// isn't kept in the history.
+	reqs := client.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("got %d requests, want 2", len(reqs))
+	}
+	if n := len(reqs[1].Messages); n != len(c.Messages)+1 || reqs[1].Messages[n-1].Role != llm.RoleUser {
+		t.Errorf("unexpected continuation request messages %q", reqs[1].Messages)
+	}
+}
+
+func TestRunWarnsWhenTruncated(t *testing.T) {
+	client := llmtest.NewClient(llmtest.Truncated("Hel"))
+	c, display := newChat(t, client, "Hello")
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := display.String(), "Hel\nwarning: response truncated by max tokens\n"; got != want {
+		t.Errorf("display = %q, want %q", got, want)
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	client := llmtest.NewClient(llmtest.Text("Paris"))
+	c, _ := newChat(t, client, "Capital of France?")
+	c.PromptHooks = append(c.PromptHooks, func(ctx context.Context, prompt string) (string, error) {
+		return "Context: geography\n\n" + prompt, nil
+	})
+	var replies []string
+	c.ReplyHooks = append(c.ReplyHooks, func(ctx context.Context, reply string) error {
+		replies = append(replies, reply)
+		return nil
+	})
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	msgs := client.Requests()[0].Messages
+	if got, want := msgs[len(msgs)-1].Content, "Context: geography\n\nCapital of France?"; got != want {
+		t.Errorf("sent prompt %q, want %q", got, want)
+	}
+	if len(replies) != 1 || replies[0] != "Paris" {
+		t.Errorf("reply hooks got %q, want [Paris]", replies)
+	}
+}
+
+func TestRunShowThinking(t *testing.T) {
+	client := llmtest.NewClient(&llmtest.Response{Events: []llm.Event{
+		llm.ReasoningDelta{Text: "Easy."},
+		llm.TextDelta{Text: "4"},
+	}})
+	c, display := newChat(t, client, "2+2?")
+	c.ShowThinking = true
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := display.String(), "Easy.\n\n4\n"; got != want {
+		t.Errorf("display = %q, want %q", got, want)
+	}
+	if got := c.Messages[len(c.Messages)-1].Content; got != "4" {
+		t.Errorf("reply = %q, want reasoning excluded", got)
+	}
+}
+
+func TestRunReturnsErrors(t *testing.T) {
+	errTimeout := &llm.TimeoutError{Waiting: "the first token"}
+	client := llmtest.NewClient(llmtest.Error(errTimeout))
+	c, _ := newChat(t, client, "Hello")
+
+	if err := c.Run(context.Background()); !errors.Is(err, errTimeout) {
+		t.Errorf("Run error = %v, want %v", err, errTimeout)
+	}
+}
+
+func TestSendBlocked(t *testing.T) {
+	client := llmtest.NewClient(llmtest.Error(&llm.BlockedError{Reason: "policy"}))
+	c, _ := newChat(t, client, "")
+	n := len(c.Messages)
+	if _, err := c.Send(context.Background(), "My SSN is ..."); err == nil {
+		t.Fatal("Send succeeded, want blocked")
+	}
+	if len(c.Messages) != n {
+		t.Errorf("Messages = %v, want the blocked prompt left out", c.Messages)
+	}
+}
+
+func equalMessages(a, b []llm.Message) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func TestRunCommand(t *testing.T) {
+	client := llmtest.NewClient()
+	c, _ := newChat(t, client, "/echo hello  ")
+	var got string
+	c.Commands = map[string]chat.Command{
+		"echo": func(ctx context.Context, args string) error {
+			got = args
+			return nil
+		},
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got != "hello" {
+		t.Errorf("command got args %q, want %q", got, "hello")
+	}
+	if n := len(client.Requests()); n != 0 {
+		t.Errorf("got %d requests, want the command handled locally", n)
+	}
+}
+
+func TestRunTurnModel(t *testing.T) {
+	for _, prompt := range []string{"@@gpt-big: Prove it.", "/model-once gpt-big Prove it."} {
+		client := llmtest.NewClient(llmtest.Text("Done."))
+		c, _ := newChat(t, client, prompt)
+		c.Model = "gpt-test"
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		req := client.Requests()[0]
+		if got := req.Messages[len(req.Messages)-1].Content; req.Model != "gpt-big" || got != "Prove it." {
+			t.Errorf("%q: sent %q to %s, want %q to gpt-big", prompt, got, req.Model, "Prove it.")
+		}
+		if c.Model != "gpt-test" {
+			t.Errorf("%q: model = %s after the turn, want gpt-test", prompt, c.Model)
+		}
+	}
+}
+
+func TestMessageHooks(t *testing.T) {
+	client := llmtest.NewClient(llmtest.Text("OK"))
+	c, _ := newChat(t, client, "Hello")
+	c.MessageHooks = append(c.MessageHooks, func(ctx context.Context, messages []llm.Message) ([]llm.Message, error) {
+		return append(messages, llm.Message{Role: llm.RoleUser, Content: "(context)"}), nil
+	})
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := client.Requests()[0].Messages; len(got) != 3 || got[2].Content != "(context)" {
+		t.Errorf("request messages = %q, want the hook's message added", got)
+	}
+	if len(c.Messages) != 3 {
+		t.Errorf("history has %d messages, want 3 without the hook's message", len(c.Messages))
+	}
+}
+
+func TestNotes(t *testing.T) {
+	rsp := llmtest.Truncated("Hel")
+	n := len(rsp.Events)
+	events := []llm.Event{llm.ReasoningDelta{Text: "Hmm."}}
+	events = append(events, rsp.Events[:n-1]...)
+	rsp.Events = append(events, &llm.Usage{InputTokens: 20, OutputTokens: 3}, rsp.Events[n-1])
+	client := llmtest.NewClient(rsp)
+	c, display := newChat(t, client, "Hello")
+	c.Model = "gpt-test"
+	notes := &bytes.Buffer{}
+	c.Notes = notes
+	c.ShowThinking = true
+	c.ShowUsage = true
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := display.String(), "Hel\n"; got != want {
+		t.Errorf("display = %q, want %q", got, want)
+	}
+	if got, want := notes.String(), "Hmm.\n\nwarning: response truncated by max tokens\n20 input, 3 output\n"; got != want {
+		t.Errorf("notes = %q, want %q", got, want)
+	}
+}
+
+func TestSpinner(t *testing.T) {
+	rsp := llmtest.Text("Hi")
+	rsp.Latency = 500 * time.Millisecond
+	c, display := newChat(t, llmtest.NewClient(rsp), "Hello")
+	notes := &bytes.Buffer{}
+	c.Notes = notes
+	c.Spinner = true
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := display.String(), "Hi\n"; got != want {
+		t.Errorf("display = %q, want %q", got, want)
+	}
+	if got := notes.String(); !strings.Contains(got, "\x1b7 ⠋ thinking… 0s\x1b8") || !strings.HasSuffix(got, "\x1b[K") {
+		t.Errorf("notes = %q, want a spinner that's cleared", got)
+	}
+}
+
+func TestSpinnerReasoningProgress(t *testing.T) {
+	rsp := &llmtest.Response{Events: []llm.Event{
+		llm.ReasoningDelta{Text: "First, factor it.\nTry 7: "},
+		llm.ReasoningDelta{Text: "7 × 143 = 1001."},
+		llm.TextDelta{Text: "No."},
+	}, Latency: 250 * time.Millisecond}
+	c, display := newChat(t, llmtest.NewClient(rsp), "Is 1001 prime?")
+	notes := &bytes.Buffer{}
+	c.Notes = notes
+	c.Spinner = true
+	c.ReasoningProgress = true
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := display.String(), "No.\n"; got != want {
+		t.Errorf("display = %q, want %q", got, want)
+	}
+	if got := notes.String(); !strings.Contains(got, " · Try 7: 7 × 143 = 1001.") || strings.Contains(got, "First") {
+		t.Errorf("notes = %q, want the last line of reasoning after the spinner", got)
+	}
+}
+
+func TestOut(t *testing.T) {
+	client := llmtest.NewClient(llmtest.Truncated("Hel"), llmtest.Text("lo"))
+	c, display := newChat(t, client, "Hello")
+	c.Model = "gpt-test"
+	c.AutoContinue = 1
+	out := &bytes.Buffer{}
+	c.Out = out
+	c.OutPrompts = true
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := display.String(), "Hello\n"; got != want {
+		t.Errorf("display = %q, want %q", got, want)
+	}
+	if got, want := out.String(), "### you\n\nHello\n\n### gpt-test\n\nHello\n\n"; got != want {
+		t.Errorf("out = %q, want %q", got, want)
+	}
+}
+
+func TestShowUsage(t *testing.T) {
+	rsp := llmtest.Text("Hi")
+	rsp.Events = append(rsp.Events, &llm.Usage{InputTokens: 2000, CachedInputTokens: 1500, OutputTokens: 10})
+	client := llmtest.NewClient(rsp)
+	c, display := newChat(t, client, "Hello")
+	c.Model = "gpt-test"
+	c.ShowUsage = true
+	c.CacheKey = "session-1"
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := display.String(), "Hi\n2000 input (1500 cached, 75%), 10 output\n"; got != want {
+		t.Errorf("display = %q, want %q", got, want)
+	}
+	if got := client.Requests()[0].CacheKey; got != "session-1" {
+		t.Errorf("request cache key = %q, want session-1", got)
+	}
+}
+
+func TestUsageLineMetrics(t *testing.T) {
+	u := &llm.Usage{InputTokens: 100, OutputTokens: 51}
+	m := &llm.Metrics{TimeToFirstToken: 500 * time.Millisecond, Duration: 1500 * time.Millisecond}
+	if got, want := chat.UsageLine("gpt-test", u, m), "100 input, 51 output, first token 0.50s, 50 tokens/s"; got != want {
+		t.Errorf("UsageLine = %q, want %q", got, want)
+	}
+}
+
+func TestUsageHooks(t *testing.T) {
+	rsp := llmtest.Text("Hi")
+	rsp.Events = append(rsp.Events, &llm.Usage{InputTokens: 20, OutputTokens: 2})
+	c, _ := newChat(t, llmtest.NewClient(rsp), "Hello")
+	c.Model = "gpt-test"
+	var got []*llm.Usage
+	c.UsageHooks = append(c.UsageHooks, func(model string, u *llm.Usage, m *llm.Metrics) {
+		if model != "gpt-test" || m == nil {
+			t.Errorf("hook called with model %q, metrics %v", model, m)
+		}
+		got = append(got, u)
+	})
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] == nil || got[0].OutputTokens != 2 {
+		t.Errorf("hook got usage %v, want one call with 2 output tokens", got)
+	}
+}
+
+func TestRenderMath(t *testing.T) {
+	reply := "Area is $\\pi r^2$, not \\(2\\pi r\\). It costs $5 and $10.\n\n" +
+		"$$\nE = mc^2\n$$\n\n`$x^2$` and\n```\n$y^2$\n```"
+	client := llmtest.NewClient(llmtest.Text(reply))
+	c, display := newChat(t, client, "Hello")
+	c.RenderMath = true
+	c.Out = &bytes.Buffer{}
+
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := "Area is π r², not 2π r. It costs $5 and $10.\n\n" +
+		"E = mc²\n\n`$x^2$` and\n```\n$y^2$\n```\n"
+	if got := display.String(); got != want {
+		t.Errorf("display = %q, want %q", got, want)
+	}
+	if got := c.Out.(*bytes.Buffer).String(); got != reply+"\n" {
+		t.Errorf("out = %q, want the reply as it is", got)
+	}
+}
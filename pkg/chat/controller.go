@@ -0,0 +1,99 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/mattn/go-isatty"
+)
+
+// StoppedTag ends a reply in the history if the user stopped it while it
+// streamed, so that the model knows it was cut short.
+const StoppedTag = "\n\n[Reply stopped by the user.]"
+
+var (
+	// errStopped is returned for a reply stopped with Esc, which is kept.
+	errStopped = errors.New("reply stopped")
+	// errRegenerate is the cause of canceling a reply with Ctrl+R.
+	errRegenerate = errors.New("regenerate reply")
+)
+
+// Keys read while a reply streams, in raw mode.
+const (
+	keyInterrupt  = "\x03" // Ctrl+C
+	keyRegenerate = "\x12" // Ctrl+R
+	keyStop       = "\x1b" // Esc, alone rather than starting a sequence
+)
+
+// streamControlled sends a request with send and displays its reply,
+// letting the user control it as it streams, in interactive mode on a
+// terminal: Esc stops the reply and passes what was received to keep,
+// marked with StoppedTag, and Ctrl+R discards it and sends the request
+// again. Ctrl+C stops the reply without keeping it, as does SIGINT
+// elsewhere.
+func (c *Chat) streamControlled(ctx context.Context, send func(context.Context) (*Reply, error), keep func(partial string)) (*Reply, error) {
+	for {
+		ctx, cancel := context.WithCancelCause(ctx)
+		reply, err := send(ctx)
+		if err == nil {
+			err = c.displayControlled(reply, cancel)
+		}
+		cause := context.Cause(ctx)
+		cancel(nil)
+		if err == nil {
+			return reply, nil
+		}
+		switch cause {
+		case errStopped:
+			io.WriteString(c.screen(), "\n")
+			keep(reply.content.String() + StoppedTag)
+			c.Notef(StyleWarning, "warning: response stopped")
+			return nil, errStopped
+		case errRegenerate:
+			io.WriteString(c.screen(), "\n")
+			c.Notef(StyleNote, "Regenerating the response…")
+			continue
+		}
+		return nil, err
+	}
+}
+
+// displayControlled displays reply, canceling it with a cause for the keys
+// that control it. Keys are only read if there's a terminal to read them
+// from; otherwise the reply is displayed as usual.
+func (c *Chat) displayControlled(reply *Reply, cancel context.CancelCauseFunc) error {
+	if tty := c.keyTerminal(); tty != nil {
+		stop, err := watchKeys(tty, func(key []byte) {
+			switch string(key) {
+			case keyInterrupt:
+				// Raw mode turns off SIGINT, so Ctrl+C is read as a key.
+				cancel(context.Canceled)
+			case keyRegenerate:
+				cancel(errRegenerate)
+			case keyStop:
+				cancel(errStopped)
+			}
+		})
+		if err == nil {
+			defer stop()
+		}
+	}
+	return c.display(reply)
+}
+
+// keyTerminal returns the terminal that prompts are read from, in
+// interactive mode, or nil.
+func (c *Chat) keyTerminal() *os.File {
+	if !c.Interactive {
+		return nil
+	}
+	if c.Terminal != nil {
+		return c.Terminal
+	}
+	if isatty.IsTerminal(os.Stdin.Fd()) {
+		return os.Stdin
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+//go:build linux
+
+package chat_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bduffany/gpt-cli/pkg/chat"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/llm/llmtest"
+	"golang.org/x/sys/unix"
+)
+
+// openPTY returns the controller and terminal ends of a new pseudoterminal.
+func openPTY(t *testing.T) (ptm, pts *os.File) {
+	t.Helper()
+	ptm, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("no pseudoterminals: %s", err)
+	}
+	t.Cleanup(func() { ptm.Close() })
+	fd := int(ptm.Fd())
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		t.Fatal(err)
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pts, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pts.Close() })
+	// Drain the output echoed to the terminal, so that writes don't block.
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			if _, err := ptm.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	return ptm, pts
+}
+
+// runWithKeys runs an interactive chat on a terminal, pressing each key
+// once the reply has started streaming, then ends the session with Ctrl+D.
+func runWithKeys(t *testing.T, client llm.CompletionClient, keys ...string) *chat.Chat {
+	t.Helper()
+	ptm, pts := openPTY(t)
+	c, _ := newChat(t, client, "Hello")
+	c.Interactive = true
+	c.Terminal = pts
+	go func() {
+		for _, key := range keys {
+			time.Sleep(200 * time.Millisecond)
+			ptm.WriteString(key)
+		}
+		time.Sleep(200 * time.Millisecond)
+		ptm.WriteString("\x04")
+	}()
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func slowText(text string) *llmtest.Response {
+	rsp := llmtest.Text(text)
+	rsp.Latency = 50 * time.Millisecond
+	return rsp
+}
+
+func TestStopKeepsPartialReply(t *testing.T) {
+	client := llmtest.NewClient(slowText(strings.Repeat("word ", 100)))
+	c := runWithKeys(t, client, "\x1b")
+
+	last := c.Messages[len(c.Messages)-1]
+	if last.Role != llm.RoleAssistant || !strings.HasPrefix(last.Content, "word ") || !strings.HasSuffix(last.Content, chat.StoppedTag) {
+		t.Errorf("last message = %+v, want the partial reply marked as stopped", last)
+	}
+	if len(last.Content) >= 500 {
+		t.Errorf("reply wasn't stopped: %q", last.Content)
+	}
+}
+
+func TestRegenerateResendsPrompt(t *testing.T) {
+	client := llmtest.NewClient(slowText(strings.Repeat("word ", 100)), llmtest.Text("Hi there!"))
+	c := runWithKeys(t, client, "\x12")
+
+	want := []llm.Message{
+		{Role: llm.RoleSystem, Content: "Be brief."},
+		{Role: llm.RoleUser, Content: "Hello"},
+		{Role: llm.RoleAssistant, Content: "Hi there!"},
+	}
+	if !equalMessages(c.Messages, want) {
+		t.Errorf("messages = %q, want %q", c.Messages, want)
+	}
+	if reqs := client.Requests(); len(reqs) != 2 || !equalMessages(reqs[1].Messages, want[:2]) {
+		t.Errorf("requests = %+v, want the prompt sent again", reqs)
+	}
+}
@@ -0,0 +1,56 @@
+//go:build !windows
+
+package chat
+
+import (
+	"os"
+
+	"github.com/chzyer/readline"
+	"golang.org/x/sys/unix"
+)
+
+// keyPollTimeout is how often watchKeys checks whether it's been stopped
+// while no key is pressed.
+const keyPollTimeout = 50 // ms
+
+// watchKeys puts the terminal f in raw mode and calls key with each chunk
+// of input read from it, until stop is called, which restores the terminal.
+// Input is only read once it's available, so that none is left to be read
+// by a blocked read after stop, such as the next prompt's first key.
+func watchKeys(f *os.File, key func([]byte)) (stop func(), err error) {
+	fd := int(f.Fd())
+	state, err := readline.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	quit, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		defer readline.Restore(fd, state)
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+		buf := make([]byte, 16)
+		for {
+			select {
+			case <-quit:
+				return
+			default:
+			}
+			n, err := unix.Poll(fds, keyPollTimeout)
+			if err == unix.EINTR || n == 0 {
+				continue
+			}
+			if err != nil {
+				return
+			}
+			n, err = unix.Read(fd, buf)
+			if err != nil || n == 0 {
+				return
+			}
+			key(buf[:n])
+		}
+	}()
+	return func() {
+		close(quit)
+		<-done
+	}, nil
+}
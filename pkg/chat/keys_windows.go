@@ -0,0 +1,13 @@
+//go:build windows
+
+package chat
+
+import (
+	"errors"
+	"os"
+)
+
+// watchKeys isn't supported on Windows, where only Ctrl+C stops a reply.
+func watchKeys(f *os.File, key func([]byte)) (stop func(), err error) {
+	return nil, errors.ErrUnsupported
+}
@@ -0,0 +1,135 @@
+package chat
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/bduffany/gpt-cli/internal/mathtext"
+)
+
+// maxMath is the longest math span rendered. A longer one is more likely
+// an unmatched delimiter, so it's written as it is.
+const maxMath = 4000
+
+// mathWriter renders the LaTeX math in text written to it as unicode, for
+// RenderMath: inline math like $x^2$ or \(x^2\), and display math like
+// $$x^2$$ or \[x^2\]. Math is held until it's complete, and written as it
+// is if it never is. Code spans and fenced code blocks are left alone.
+type mathWriter struct {
+	w io.Writer
+	// held is a possible delimiter, or the math span so far, starting with
+	// its delimiter, which close ends.
+	held  []byte
+	close string
+	// line is the start of the current line, to find code fences.
+	line     []byte
+	code     bool
+	codeSpan bool
+	out      bytes.Buffer
+}
+
+func (m *mathWriter) Write(p []byte) (int, error) {
+	m.process(p)
+	_, err := m.w.Write(m.out.Bytes())
+	m.out.Reset()
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes any text held as the start of math that was never closed.
+func (m *mathWriter) Flush() error {
+	m.out.Write(m.held)
+	m.held, m.close = nil, ""
+	_, err := m.w.Write(m.out.Bytes())
+	m.out.Reset()
+	return err
+}
+
+func (m *mathWriter) process(p []byte) {
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if m.close != "" {
+			m.math(c)
+			continue
+		}
+		if len(m.held) > 0 {
+			held := m.held[0]
+			m.held = nil
+			switch {
+			case held == '\\' && (c == '[' || c == '('):
+				m.held, m.close = []byte{'\\', c}, `\]`
+				if c == '(' {
+					m.close = `\)`
+				}
+				continue
+			case held == '$' && c == '$':
+				m.held, m.close = []byte("$$"), "$$"
+				continue
+			case held == '$' && c != ' ' && c != '\n' && c != '\t':
+				m.held, m.close = []byte{'$', c}, "$"
+				continue
+			case c == '\\' || c == '$':
+				// An escaped delimiter, like \$.
+				m.out.Write([]byte{held, c})
+				continue
+			}
+			m.out.WriteByte(held)
+		}
+		m.text(c)
+	}
+}
+
+// text handles a byte outside of math.
+func (m *mathWriter) text(c byte) {
+	if len(bytes.TrimLeft(m.line, " ")) < len("```") && c != '\n' {
+		m.line = append(m.line, c)
+		if string(bytes.TrimLeft(m.line, " ")) == "```" {
+			m.code = !m.code
+		}
+	}
+	switch {
+	case c == '\n':
+		m.line, m.codeSpan = m.line[:0], false
+	case m.code:
+	case c == '`':
+		m.codeSpan = !m.codeSpan
+	case !m.codeSpan && (c == '\\' || c == '$'):
+		m.held = []byte{c}
+		return
+	}
+	m.out.WriteByte(c)
+}
+
+// math handles a byte of math, rendering the math once it's closed.
+func (m *mathWriter) math(c byte) {
+	m.held = append(m.held, c)
+	open := len(m.close)
+	if m.close == "$" {
+		open = 1
+	}
+	inner := m.held[open:]
+	switch {
+	case bytes.HasSuffix(inner, []byte(m.close)) && len(inner) > len(m.close) && m.closes(inner):
+		m.out.WriteString(mathtext.Render(string(inner[:len(inner)-len(m.close)])))
+		m.held, m.close = nil, ""
+	case m.close == "$" && c == '\n', bytes.HasSuffix(inner, []byte("\n\n")), len(m.held) > maxMath:
+		// This isn't math after all, so write the delimiter as it is, and
+		// look again for math in the rest.
+		rest := inner
+		m.out.Write(m.held[:open])
+		m.held, m.close = nil, ""
+		m.process(rest)
+	}
+}
+
+// closes reports whether the delimiter ending inner closes the math. A $
+// only does if it follows a non-space, so that "$5 and $10" isn't math.
+func (m *mathWriter) closes(inner []byte) bool {
+	if m.close != "$" {
+		return true
+	}
+	before := inner[len(inner)-2]
+	return before != ' ' && before != '\\'
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package chat
+
+import "os"
+
+// notifyResize does nothing on Windows, which has no signal for resizing,
+// so the width is checked only once.
+func notifyResize(c chan<- os.Signal) {}
@@ -0,0 +1,125 @@
+package chat
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chzyer/readline"
+)
+
+// spinnerFrames are drawn in turn, one per spinnerInterval.
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+const (
+	spinnerInterval = 100 * time.Millisecond
+	// spinnerDelay is how long a request waits before the spinner is drawn,
+	// so that it doesn't flash before quick replies.
+	spinnerDelay = 300 * time.Millisecond
+	// spinnerMargin is left free of the spinner at the end of the line,
+	// for a label before it, since a spinner that wraps can't be cleared.
+	spinnerMargin = 20
+)
+
+// spinner draws an animated "thinking" indicator with the elapsed time
+// while waiting for a reply to start. It's drawn after the cursor, which it
+// saves and restores, so that it needn't own the line, and is cleared by
+// erasing to the end of the line.
+type spinner struct {
+	w     io.Writer
+	start time.Time
+	quit  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+
+	mu sync.Mutex
+	// status is shown after the elapsed time, such as the latest line of
+	// the model's reasoning.
+	status string
+}
+
+func startSpinner(w io.Writer) *spinner {
+	s := &spinner{w: w, start: time.Now(), quit: make(chan struct{}), done: make(chan struct{})}
+	go s.run()
+	return s
+}
+
+func (s *spinner) run() {
+	defer close(s.done)
+	select {
+	case <-s.quit:
+		return
+	case <-time.After(spinnerDelay):
+	}
+	t := time.NewTicker(spinnerInterval)
+	defer t.Stop()
+	for i := 0; ; i++ {
+		io.WriteString(s.w, "\x1b[K\x1b7"+Styled(StyleThinking, s.line(i))+"\x1b8")
+		select {
+		case <-s.quit:
+			io.WriteString(s.w, "\x1b[K")
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// line returns the ith frame of the spinner.
+func (s *spinner) line(i int) string {
+	elapsed := time.Since(s.start).Truncate(time.Second)
+	line := fmt.Sprintf(" %s thinking… %s", spinnerFrames[i%len(spinnerFrames)], elapsed)
+	s.mu.Lock()
+	status := s.status
+	s.mu.Unlock()
+	if status == "" {
+		return line
+	}
+	line += " · " + status
+	width := readline.GetScreenWidth()
+	if width <= 0 {
+		width = 80
+	}
+	if r := []rune(line); len(r) > width-spinnerMargin {
+		line = string(r[:max(width-spinnerMargin-1, 0)]) + "…"
+	}
+	return line
+}
+
+// setStatus sets the text shown after the elapsed time.
+func (s *spinner) setStatus(status string) {
+	s.mu.Lock()
+	s.status = strings.Join(strings.Fields(status), " ")
+	s.mu.Unlock()
+}
+
+// progress is a writer that shows the last line of the text written to it
+// as the status of a spinner, such as to show reasoning as it streams.
+type progress struct {
+	spinner *spinner
+	buf     strings.Builder
+}
+
+func (p *progress) Write(b []byte) (int, error) {
+	p.buf.Write(b)
+	text := p.buf.String()
+	if i := strings.LastIndexByte(strings.TrimRight(text, "\n"), '\n'); i >= 0 {
+		// Keep only the last line, which may still be being written.
+		text = text[i+1:]
+		p.buf.Reset()
+		p.buf.WriteString(text)
+	}
+	p.spinner.setStatus(text)
+	return len(b), nil
+}
+
+// stop clears the spinner, returning once it's cleared. It may be called
+// more than once, and on a nil spinner.
+func (s *spinner) stop() {
+	if s == nil {
+		return
+	}
+	s.once.Do(func() { close(s.quit) })
+	<-s.done
+}
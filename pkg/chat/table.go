@@ -0,0 +1,293 @@
+package chat
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// tableDelimiter matches the row under a markdown table's header, like
+// "|---|:---:|", whose colons set the alignment of each column.
+var tableDelimiter = regexp.MustCompile(`^\s*\|?(\s*:?-+:?\s*\|)*\s*:?-+:?\s*\|?\s*$`)
+
+// tableWriter draws the markdown tables in text written to it with box
+// drawing characters, for RenderTables. Lines starting with "|" are held
+// until it's clear whether they're a table, which needs a delimiter row
+// under the first, and then until the table ends, since every row sets the
+// widths of the columns. Tables in fenced code blocks are left alone.
+type tableWriter struct {
+	w io.Writer
+	// width is the width of the terminal, which tables are fit to.
+	width func() int
+	// rows are the lines of a possible table, held until it ends.
+	rows []string
+	// line is the current line, held if it starts with "|", and start is
+	// whether it's still unclear whether it does.
+	line    []byte
+	start   bool
+	holding bool
+	// fence is the start of the current line, to find code fences.
+	fence []byte
+	code  bool
+	out   bytes.Buffer
+}
+
+func newTableWriter(w io.Writer, width func() int) *tableWriter {
+	return &tableWriter{w: w, width: width, start: true}
+}
+
+func (t *tableWriter) Write(p []byte) (int, error) {
+	for _, c := range p {
+		t.byte(c)
+	}
+	_, err := t.w.Write(t.out.Bytes())
+	t.out.Reset()
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush draws or writes the lines held, such as a table at the end of a
+// reply.
+func (t *tableWriter) Flush() error {
+	t.flushRows()
+	t.out.Write(t.line)
+	t.line, t.holding = nil, false
+	_, err := t.w.Write(t.out.Bytes())
+	t.out.Reset()
+	return err
+}
+
+func (t *tableWriter) byte(c byte) {
+	if len(bytes.TrimLeft(t.fence, " ")) < len("```") && c != '\n' {
+		t.fence = append(t.fence, c)
+		if string(bytes.TrimLeft(t.fence, " ")) == "```" {
+			t.code = !t.code
+		}
+	}
+	if t.start {
+		t.line = append(t.line, c)
+		switch {
+		case c == ' ' || c == '\t':
+			return
+		case c == '|' && !t.code:
+			t.start, t.holding = false, true
+			return
+		}
+		// This line isn't part of a table, so neither are the lines held.
+		t.flushRows()
+		t.out.Write(t.line)
+		t.line, t.start = t.line[:0], false
+		if c == '\n' {
+			t.start, t.fence = true, t.fence[:0]
+		}
+		return
+	}
+	if !t.holding {
+		t.out.WriteByte(c)
+		if c == '\n' {
+			t.start, t.fence = true, t.fence[:0]
+		}
+		return
+	}
+	if c != '\n' {
+		t.line = append(t.line, c)
+		return
+	}
+	t.rows = append(t.rows, string(t.line))
+	t.line, t.start, t.holding, t.fence = t.line[:0], true, false, t.fence[:0]
+	if len(t.rows) == 2 && !tableDelimiter.MatchString(t.rows[1]) {
+		// The first line isn't a header, but the second may be.
+		t.out.WriteString(t.rows[0] + "\n")
+		t.rows = t.rows[1:]
+	}
+}
+
+// flushRows writes the rows held, drawn as a table if they are one.
+func (t *tableWriter) flushRows() {
+	if len(t.rows) >= 2 {
+		t.out.WriteString(drawTable(t.rows, t.width()))
+	} else {
+		for _, row := range t.rows {
+			t.out.WriteString(row + "\n")
+		}
+	}
+	t.rows = nil
+}
+
+// drawTable draws a markdown table, whose second row is the delimiter row,
+// with box drawing characters. If it's wider than width, the widest
+// columns are narrowed, and the text in their cells wrapped.
+func drawTable(rows []string, width int) string {
+	header := tableCells(rows[0])
+	var align []byte
+	for _, d := range tableCells(rows[1]) {
+		switch {
+		case strings.HasPrefix(d, ":") && strings.HasSuffix(d, ":"):
+			align = append(align, 'c')
+		case strings.HasSuffix(d, ":"):
+			align = append(align, 'r')
+		default:
+			align = append(align, 'l')
+		}
+	}
+	body := [][]string{header}
+	for _, row := range rows[2:] {
+		body = append(body, tableCells(row))
+	}
+	n := 0
+	for _, cells := range body {
+		n = max(n, len(cells))
+	}
+	for len(align) < n {
+		align = append(align, 'l')
+	}
+
+	widths := make([]int, n)
+	for _, cells := range body {
+		for i, cell := range cells {
+			widths[i] = max(widths[i], textWidth(cell))
+		}
+	}
+	// Each column takes up its width and a space on each side, and there's
+	// a border between and around them.
+	for avail := width - 3*n - 1; sum(widths) > avail; {
+		widest := 0
+		for i, w := range widths {
+			if w > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] <= 3 {
+			break
+		}
+		widths[widest]--
+	}
+
+	var b strings.Builder
+	border := func(left, mid, right string) {
+		b.WriteString(left)
+		for i, w := range widths {
+			if i > 0 {
+				b.WriteString(mid)
+			}
+			b.WriteString(strings.Repeat("─", w+2))
+		}
+		b.WriteString(right + "\n")
+	}
+	border("┌", "┬", "┐")
+	for r, cells := range body {
+		if r == 1 {
+			border("├", "┼", "┤")
+		}
+		lines := make([][]string, n)
+		height := 1
+		for i := range widths {
+			cell := ""
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			lines[i] = wrapCell(cell, widths[i])
+			height = max(height, len(lines[i]))
+		}
+		for l := 0; l < height; l++ {
+			b.WriteString("│")
+			for i, w := range widths {
+				text := ""
+				if l < len(lines[i]) {
+					text = lines[i][l]
+				}
+				b.WriteString(" " + pad(text, w, align[i]) + " │")
+			}
+			b.WriteString("\n")
+		}
+	}
+	border("└", "┴", "┘")
+	return b.String()
+}
+
+// tableCells splits a table row into its cells, without the outer pipes,
+// and with escaped pipes unescaped.
+func tableCells(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(row, "|")
+	if strings.HasSuffix(row, "|") && !strings.HasSuffix(row, `\|`) {
+		row = row[:len(row)-1]
+	}
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(row); i++ {
+		switch {
+		case row[i] == '\\' && i+1 < len(row) && row[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case row[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(row[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// wrapCell breaks text into lines no wider than width, between words where
+// possible.
+func wrapCell(text string, width int) []string {
+	var lines []string
+	var line strings.Builder
+	lineWidth := 0
+	for _, word := range strings.Fields(text) {
+		w := textWidth(word)
+		if lineWidth > 0 && lineWidth+1+w > width {
+			lines = append(lines, line.String())
+			line.Reset()
+			lineWidth = 0
+		}
+		if lineWidth > 0 {
+			line.WriteByte(' ')
+			lineWidth++
+		}
+		for _, r := range word {
+			if rw := runeWidth(r); lineWidth+rw > width && lineWidth > 0 {
+				lines = append(lines, line.String())
+				line.Reset()
+				lineWidth = 0
+			}
+			line.WriteRune(r)
+			lineWidth += runeWidth(r)
+		}
+	}
+	return append(lines, line.String())
+}
+
+// pad pads text with spaces to width, aligned left, right, or center.
+func pad(text string, width int, align byte) string {
+	space := max(width-textWidth(text), 0)
+	switch align {
+	case 'r':
+		return strings.Repeat(" ", space) + text
+	case 'c':
+		return strings.Repeat(" ", space/2) + text + strings.Repeat(" ", space-space/2)
+	}
+	return text + strings.Repeat(" ", space)
+}
+
+// textWidth returns the number of columns text takes up.
+func textWidth(text string) int {
+	w := 0
+	for _, r := range text {
+		w += runeWidth(r)
+	}
+	return w
+}
+
+func sum(ns []int) int {
+	total := 0
+	for _, n := range ns {
+		total += n
+	}
+	return total
+}
@@ -0,0 +1,58 @@
+package chat
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDrawTable(t *testing.T) {
+	got := drawTable([]string{
+		"| Name | Count | Notes |",
+		"|:-----|------:|:-----:|",
+		"| apples | 3 | red |",
+		"| 日本 | 12 | \\| |",
+	}, 80)
+	want := strings.Join([]string{
+		"┌────────┬───────┬───────┐",
+		"│ Name   │ Count │ Notes │",
+		"├────────┼───────┼───────┤",
+		"│ apples │     3 │  red  │",
+		"│ 日本   │    12 │   |   │",
+		"└────────┴───────┴───────┘",
+	}, "\n") + "\n"
+	if got != want {
+		t.Errorf("drawTable =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDrawTableFitsWidth(t *testing.T) {
+	got := drawTable([]string{
+		"| Term | Meaning |",
+		"|---|---|",
+		"| wrap | break lines between words to fit the terminal |",
+	}, 30)
+	for _, line := range strings.Split(strings.TrimSuffix(got, "\n"), "\n") {
+		if w := textWidth(line); w > 30 {
+			t.Errorf("line %q is %d columns wide, want at most 30", line, w)
+		}
+	}
+	if !strings.Contains(got, "│ wrap │ break lines between │\n│      │ words to fit the    │") {
+		t.Errorf("drawTable didn't wrap the long cell:\n%s", got)
+	}
+}
+
+func TestTableWriter(t *testing.T) {
+	text := "Fruit:\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\nNot a table:\n| x |\n```\n| a | b |\n|---|---|\n```\n"
+	var buf bytes.Buffer
+	tw := newTableWriter(&buf, func() int { return 80 })
+	// Write a few bytes at a time, as replies stream.
+	for i := 0; i < len(text); i += 3 {
+		tw.Write([]byte(text[i:min(i+3, len(text))]))
+	}
+	tw.Flush()
+	want := "Fruit:\n\n┌───┬───┐\n│ a │ b │\n├───┼───┤\n│ 1 │ 2 │\n└───┴───┘\n\nNot a table:\n| x |\n```\n| a | b |\n|---|---|\n```\n"
+	if got := buf.String(); got != want {
+		t.Errorf("tableWriter wrote\n%s\nwant\n%s", got, want)
+	}
+}
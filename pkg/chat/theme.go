@@ -0,0 +1,206 @@
+package chat
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Style is the role of a piece of terminal output, which the theme maps to
+// a color.
+type Style string
+
+const (
+	// StylePrompt colors the label before user prompts.
+	StylePrompt Style = "prompt"
+	// StyleAIPrompt colors the label before the agent's output.
+	StyleAIPrompt Style = "ai_prompt"
+	// StyleNote colors status messages, like the usage line.
+	StyleNote     Style = "note"
+	StyleWarning  Style = "warning"
+	StyleError    Style = "error"
+	StyleThinking Style = "thinking"
+	StyleHeading  Style = "heading"
+	// Diff styles color the lines of diffs shown for review.
+	StyleDiffAdd    Style = "diff_add"
+	StyleDiffRemove Style = "diff_remove"
+	StyleDiffHunk   Style = "diff_hunk"
+)
+
+var defaultStyles = map[Style]string{
+	StylePrompt:     "bright-black",
+	StyleAIPrompt:   "bright-black",
+	StyleNote:       "bright-black",
+	StyleWarning:    "bright-yellow",
+	StyleError:      "bright-red",
+	StyleThinking:   "dim",
+	StyleHeading:    "bold",
+	StyleDiffAdd:    "green",
+	StyleDiffRemove: "red",
+	StyleDiffHunk:   "cyan",
+}
+
+// Theme sets the prompt labels and colors of terminal output.
+type Theme struct {
+	// Prompt is the label before each user prompt, like "you> ". It may
+	// contain {model}, replaced by the model name, and {time}, replaced by
+	// the time the prompt is shown, like 15:04.
+	Prompt string `yaml:"prompt,omitempty"`
+	// AIPrompt is the label before each line of the agent's output, like
+	// "gpt> ", with the same placeholders as Prompt.
+	AIPrompt string `yaml:"ai_prompt,omitempty"`
+	// Colors map styles, like "warning", to colors. A color is any of a hex
+	// true color like "#ffaa00", a name like "bold" or "bright-red", or an
+	// SGR code like "1;34", separated by spaces. Prefix a hex color with
+	// "bg:" to set the background. Styles not listed keep their default.
+	Colors map[string]string `yaml:"colors,omitempty"`
+}
+
+var (
+	themeMu sync.RWMutex
+	theme   = &Theme{Prompt: "you> ", AIPrompt: "gpt> "}
+	// sgr is the parsed escape code of each style.
+	sgr = mustParseStyles(defaultStyles)
+)
+
+// SetTheme sets the theme used by all chats. Empty fields keep their
+// defaults.
+func SetTheme(t *Theme) error {
+	styles := map[Style]string{}
+	for s, color := range defaultStyles {
+		styles[s] = color
+	}
+	for name, color := range t.Colors {
+		if _, ok := defaultStyles[Style(name)]; !ok {
+			return fmt.Errorf("theme: unknown style %q", name)
+		}
+		styles[Style(name)] = color
+	}
+	codes, err := parseStyles(styles)
+	if err != nil {
+		return err
+	}
+	next := &Theme{Prompt: t.Prompt, AIPrompt: t.AIPrompt, Colors: t.Colors}
+	if next.Prompt == "" {
+		next.Prompt = "you> "
+	}
+	if next.AIPrompt == "" {
+		next.AIPrompt = "gpt> "
+	}
+	themeMu.Lock()
+	defer themeMu.Unlock()
+	theme, sgr = next, codes
+	return nil
+}
+
+// Color returns the escape sequence that starts text in a style. Esc()
+// ends it.
+func Color(s Style) string {
+	if os.Getenv("NO_COLOR") != "" {
+		return ""
+	}
+	themeMu.RLock()
+	defer themeMu.RUnlock()
+	if sgr[s] == "" {
+		return ""
+	}
+	return "\x1b[" + sgr[s] + "m"
+}
+
+// Styled returns text in a style.
+func Styled(s Style, text string) string {
+	if c := Color(s); c != "" {
+		return c + text + Esc()
+	}
+	return text
+}
+
+// UserPrompt returns the colored label before user prompts.
+func UserPrompt(model string) string {
+	themeMu.RLock()
+	label := theme.Prompt
+	themeMu.RUnlock()
+	return styleLabel(StylePrompt, expandLabel(label, model))
+}
+
+// AIPrompt returns the colored label before the agent's output.
+func AIPrompt(model string) string {
+	themeMu.RLock()
+	label := theme.AIPrompt
+	themeMu.RUnlock()
+	return styleLabel(StyleAIPrompt, expandLabel(label, model))
+}
+
+// styleLabel styles a label, leaving its trailing space unstyled.
+func styleLabel(s Style, label string) string {
+	text := strings.TrimRight(label, " ")
+	return Styled(s, text) + label[len(text):]
+}
+
+func expandLabel(label, model string) string {
+	return strings.NewReplacer("{model}", model, "{time}", time.Now().Format("15:04")).Replace(label)
+}
+
+var namedColors = map[string]string{
+	"bold": "1", "dim": "2", "italic": "3", "underline": "4",
+	"black": "30", "red": "31", "green": "32", "yellow": "33",
+	"blue": "34", "magenta": "35", "cyan": "36", "white": "37",
+	"bright-black": "90", "gray": "90", "grey": "90",
+	"bright-red": "91", "bright-green": "92", "bright-yellow": "93",
+	"bright-blue": "94", "bright-magenta": "95", "bright-cyan": "96", "bright-white": "97",
+}
+
+var (
+	hexColor = regexp.MustCompile(`^(bg:)?#([0-9a-fA-F]{6})$`)
+	sgrCode  = regexp.MustCompile(`^\d+(;\d+)*$`)
+)
+
+// parseColor converts a color, as described in Theme, to SGR parameters.
+func parseColor(color string) (string, error) {
+	var codes []string
+	for _, field := range strings.Fields(color) {
+		if code, ok := namedColors[strings.ToLower(field)]; ok {
+			codes = append(codes, code)
+			continue
+		}
+		if m := hexColor.FindStringSubmatch(field); m != nil {
+			rgb, _ := strconv.ParseUint(m[2], 16, 32)
+			layer := "38"
+			if m[1] != "" {
+				layer = "48"
+			}
+			codes = append(codes, fmt.Sprintf("%s;2;%d;%d;%d", layer, rgb>>16, rgb>>8&0xff, rgb&0xff))
+			continue
+		}
+		if sgrCode.MatchString(field) {
+			codes = append(codes, field)
+			continue
+		}
+		return "", fmt.Errorf("invalid color %q", field)
+	}
+	return strings.Join(codes, ";"), nil
+}
+
+func parseStyles(styles map[Style]string) (map[Style]string, error) {
+	codes := map[Style]string{}
+	for s, color := range styles {
+		code, err := parseColor(color)
+		if err != nil {
+			return nil, fmt.Errorf("theme: %s: %w", s, err)
+		}
+		codes[s] = code
+	}
+	return codes, nil
+}
+
+func mustParseStyles(styles map[Style]string) map[Style]string {
+	codes, err := parseStyles(styles)
+	if err != nil {
+		panic(err)
+	}
+	return codes
+}
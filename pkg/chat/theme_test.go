@@ -0,0 +1,53 @@
+package chat_test
+
+import (
+	"testing"
+
+	"github.com/bduffany/gpt-cli/pkg/chat"
+)
+
+func TestTheme(t *testing.T) {
+	t.Setenv("NO_COLOR", "")
+	t.Cleanup(func() { chat.SetTheme(&chat.Theme{}) })
+
+	if got, want := chat.AIPrompt("gpt-4o"), "\x1b[90mgpt>\x1b[m "; got != want {
+		t.Errorf("default AIPrompt = %q, want %q", got, want)
+	}
+	err := chat.SetTheme(&chat.Theme{
+		Prompt: "[{model}] you> ",
+		Colors: map[string]string{"prompt": "bold #ff8800", "warning": "bg:#000000 1;4", "note": ""},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := chat.UserPrompt("gpt-4o"), "\x1b[1;38;2;255;136;0m[gpt-4o] you>\x1b[m "; got != want {
+		t.Errorf("UserPrompt = %q, want %q", got, want)
+	}
+	if got, want := chat.Styled(chat.StyleWarning, "careful"), "\x1b[48;2;0;0;0;1;4mcareful\x1b[m"; got != want {
+		t.Errorf("warning = %q, want %q", got, want)
+	}
+	if got := chat.Styled(chat.StyleNote, "plain"); got != "plain" {
+		t.Errorf("note with no color = %q, want plain text", got)
+	}
+	if got, want := chat.AIPrompt(""), "\x1b[90mgpt>\x1b[m "; got != want {
+		t.Errorf("AIPrompt = %q, want the default %q", got, want)
+	}
+
+	t.Setenv("NO_COLOR", "1")
+	if got := chat.UserPrompt("gpt-4o"); got != "[gpt-4o] you> " {
+		t.Errorf("UserPrompt with NO_COLOR = %q", got)
+	}
+}
+
+func TestThemeErrors(t *testing.T) {
+	t.Cleanup(func() { chat.SetTheme(&chat.Theme{}) })
+	for _, colors := range []map[string]string{
+		{"unknown": "red"},
+		{"error": "#ff00"},
+		{"error": "reddish"},
+	} {
+		if err := chat.SetTheme(&chat.Theme{Colors: colors}); err == nil {
+			t.Errorf("SetTheme(%v) = nil, want an error", colors)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package chat
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/chzyer/readline"
+)
+
+// wrapper word-wraps the text written to a terminal, so that the terminal
+// doesn't break lines mid-word. Escape sequences take up no columns, and
+// wide characters, such as CJK, take up two, and may be broken between.
+// Lines in fenced code blocks are left as they are, so that code copied
+// from the terminal isn't broken up.
+type wrapper struct {
+	w io.Writer
+
+	mu    sync.Mutex
+	width int
+	// col is the column that the cursor is at, not counting word.
+	col int
+	// word is the part of a word written so far, which is held until its
+	// end shows whether it fits on the line.
+	word      []byte
+	wordWidth int
+	// spaces is the number of spaces before word, which are dropped if the
+	// line breaks there.
+	spaces int
+	// esc is an escape sequence that's been partly written, and partial a
+	// rune.
+	esc     []byte
+	partial []byte
+	// saved is the column saved with ESC 7, such as by the spinner, which
+	// ESC 8 returns to. Text between them is written as it is, since it
+	// doesn't move the cursor.
+	saved  int
+	saving bool
+	// line is the start of the current line, to find code fences.
+	line []byte
+	code bool
+}
+
+// newWrapper returns a wrapper for w, which wraps to the width of the
+// terminal, checked again each time it's resized.
+func newWrapper(w io.Writer) *wrapper {
+	ww := &wrapper{w: w}
+	ww.width = termWidth(w)
+	resized := make(chan os.Signal, 1)
+	notifyResize(resized)
+	go func() {
+		for range resized {
+			width := termWidth(w)
+			ww.mu.Lock()
+			ww.width = width
+			ww.mu.Unlock()
+		}
+	}()
+	return ww
+}
+
+// termWidth returns the width of the terminal that w writes to, or else of
+// the one that stdout does, or else 80.
+func termWidth(w io.Writer) int {
+	if f, ok := w.(*os.File); ok {
+		if width, _, err := readline.GetSize(int(f.Fd())); err == nil && width > 0 {
+			return width
+		}
+	}
+	if width := readline.GetScreenWidth(); width > 0 {
+		return width
+	}
+	return 80
+}
+
+func (ww *wrapper) Write(p []byte) (int, error) {
+	ww.mu.Lock()
+	defer ww.mu.Unlock()
+	var out bytes.Buffer
+	b := p
+	if len(ww.partial) > 0 {
+		b = append(ww.partial, p...)
+		ww.partial = nil
+	}
+	for i := 0; i < len(b); {
+		if len(ww.esc) > 0 || b[i] == '\x1b' {
+			ww.esc = append(ww.esc, b[i])
+			i++
+			if escapeDone(ww.esc) {
+				ww.escape(&out)
+			}
+			continue
+		}
+		if !utf8.FullRune(b[i:]) {
+			// Hold the start of a rune that's split across writes.
+			ww.partial = append([]byte{}, b[i:]...)
+			break
+		}
+		r, size := utf8.DecodeRune(b[i:])
+		ww.rune(&out, r, b[i:i+size])
+		i += size
+	}
+	if _, err := ww.w.Write(out.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// rune handles the next rune of text, encoded as b.
+func (ww *wrapper) rune(out *bytes.Buffer, r rune, b []byte) {
+	if ww.saving {
+		out.Write(b)
+		return
+	}
+	if len(bytes.TrimLeft(ww.line, " ")) < len("```") && r != '\n' {
+		ww.line = append(ww.line, b...)
+		if string(bytes.TrimLeft(ww.line, " ")) == "```" {
+			ww.code = !ww.code
+		}
+	}
+	switch {
+	case r == '\n' || r == '\r':
+		ww.flush(out)
+		ww.writeSpaces(out)
+		out.Write(b)
+		ww.col = 0
+		if r == '\n' {
+			ww.line = ww.line[:0]
+		}
+	case ww.code:
+		ww.flush(out)
+		ww.writeSpaces(out)
+		out.Write(b)
+		ww.col += runeWidth(r)
+	case r == ' ':
+		ww.flush(out)
+		ww.spaces++
+	case r == '\t':
+		ww.flush(out)
+		ww.writeSpaces(out)
+		out.Write(b)
+		ww.col = min(ww.col/8*8+8, ww.width)
+	case runeWidth(r) == 2:
+		// Wide characters can be broken between, like spaces.
+		ww.flush(out)
+		ww.word, ww.wordWidth = append(ww.word, b...), 2
+		ww.flush(out)
+	default:
+		ww.word = append(ww.word, b...)
+		ww.wordWidth += runeWidth(r)
+	}
+}
+
+// flush writes the word so far, on the next line if it doesn't fit on this
+// one, or broken over lines if it doesn't fit on any.
+func (ww *wrapper) flush(out *bytes.Buffer) {
+	if len(ww.word) == 0 {
+		return
+	}
+	if ww.col > 0 && ww.col+ww.spaces+ww.wordWidth > ww.width {
+		out.WriteByte('\n')
+		ww.col, ww.spaces = 0, 0
+	}
+	ww.writeSpaces(out)
+	for rest := ww.word; len(rest) > 0; {
+		if rest[0] == '\x1b' {
+			// An escape sequence inside a word, such as a style.
+			n := 1
+			for n < len(rest) && !escapeDone(rest[:n]) {
+				n++
+			}
+			out.Write(rest[:n])
+			rest = rest[n:]
+			continue
+		}
+		r, size := utf8.DecodeRune(rest)
+		if w := runeWidth(r); ww.col+w > ww.width && ww.col > 0 {
+			out.WriteByte('\n')
+			ww.col = 0
+		}
+		out.Write(rest[:size])
+		ww.col += runeWidth(r)
+		rest = rest[size:]
+	}
+	ww.word, ww.wordWidth = ww.word[:0], 0
+}
+
+// writeSpaces writes the spaces before the next word, or as many as fit.
+func (ww *wrapper) writeSpaces(out *bytes.Buffer) {
+	n := max(min(ww.spaces, ww.width-ww.col), 0)
+	out.WriteString(strings.Repeat(" ", n))
+	ww.col += n
+	ww.spaces = 0
+}
+
+// escape handles a complete escape sequence.
+func (ww *wrapper) escape(out *bytes.Buffer) {
+	switch string(ww.esc) {
+	case "\x1b7":
+		ww.flush(out)
+		ww.saved, ww.saving = ww.col, true
+		out.Write(ww.esc)
+	case "\x1b8":
+		ww.flush(out)
+		ww.col, ww.saving = ww.saved, false
+		out.Write(ww.esc)
+	default:
+		// Keep a style that starts or ends a word with it.
+		if len(ww.word) > 0 || ww.spaces > 0 {
+			ww.word = append(ww.word, ww.esc...)
+		} else {
+			out.Write(ww.esc)
+		}
+	}
+	ww.esc = ww.esc[:0]
+}
+
+// escapeDone reports whether esc is a complete escape sequence: a CSI
+// sequence like "\x1b[1;31m", an OSC sequence like a title ending in BEL
+// or ST, or ESC and a single character.
+func escapeDone(esc []byte) bool {
+	if len(esc) < 2 {
+		return false
+	}
+	last := esc[len(esc)-1]
+	switch esc[1] {
+	case '[':
+		return len(esc) > 2 && last >= 0x40 && last <= 0x7e
+	case ']':
+		return last == '\a' || bytes.HasSuffix(esc, []byte("\x1b\\"))
+	}
+	return true
+}
+
+// runeWidth returns the number of columns r takes up: two for East Asian
+// wide characters and emoji, none for control characters and combining
+// marks, and one otherwise.
+func runeWidth(r rune) int {
+	switch {
+	case unicode.IsControl(r) || unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	case r >= 0x1100 && r <= 0x115f, // Hangul Jamo
+		r >= 0x2e80 && r <= 0x303e, // CJK radicals and punctuation
+		r >= 0x3041 && r <= 0x33ff, // Kana and CJK symbols
+		r >= 0x3400 && r <= 0x4dbf, // CJK extension A
+		r >= 0x4e00 && r <= 0x9fff, // CJK unified ideographs
+		r >= 0xa000 && r <= 0xa4cf, // Yi
+		r >= 0xac00 && r <= 0xd7a3, // Hangul syllables
+		r >= 0xf900 && r <= 0xfaff, // CJK compatibility ideographs
+		r >= 0xfe30 && r <= 0xfe4f, // CJK compatibility forms
+		r >= 0xff00 && r <= 0xff60, // Fullwidth forms
+		r >= 0xffe0 && r <= 0xffe6,
+		r >= 0x1f300 && r <= 0x1f64f, // Emoji
+		r >= 0x1f900 && r <= 0x1f9ff,
+		r >= 0x20000 && r <= 0x3fffd:
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,36 @@
+package chat
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWrapper(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"fits", []string{"one two\n"}, "one two\n"},
+		{"words", []string{"the quick brown fox jumps\n"}, "the quick\nbrown fox\njumps\n"},
+		{"streamed", []string{"the qu", "ick br", "own fox", " jumps\n"}, "the quick\nbrown fox\njumps\n"},
+		{"long word", []string{"a abcdefghijklmno\n"}, "a\nabcdefghij\nklmno\n"},
+		{"styles", []string{"the \x1b[1mquick\x1b[m brown\n"}, "the \x1b[1mquick\x1b[m\nbrown\n"},
+		{"wide", []string{"日本語のテキストです\n"}, "日本語のテ\nキストです\n"},
+		{"split rune", []string{"ab \xe6\x97", "\xa5\n"}, "ab 日\n"},
+		{"code", []string{"```\nthe quick brown fox\n```\nthe quick brown\n"}, "```\nthe quick brown fox\n```\nthe quick\nbrown\n"},
+		{"saved cursor", []string{"abcdefgh\x1b7 ⠋ thinking… 1s\x1b8 ij\n"}, "abcdefgh\x1b7 ⠋ thinking… 1s\x1b8\nij\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := &wrapper{w: &buf, width: 10}
+			for _, s := range tc.writes {
+				w.Write([]byte(s))
+			}
+			if got := buf.String(); got != tc.want {
+				t.Errorf("wrapped %q = %q, want %q", strings.Join(tc.writes, ""), got, tc.want)
+			}
+		})
+	}
+}
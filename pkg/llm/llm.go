@@ -0,0 +1,313 @@
+// Package llm defines a provider-neutral interface for streaming chat
+// completions.
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	// RoleTool messages hold the result of a tool call.
+	RoleTool = "tool"
+)
+
+type Message struct {
+	// "system" | "user" | "assistant" | "tool"
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+	// ToolCalls are the tools called by an assistant message.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID is the ID of the call that a tool message is the result
+	// of, and Name is the name of the tool.
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	Name       string `json:"name,omitempty"`
+}
+
+// CheckMessages returns an error if any message has an unknown role, or a
+// tool result isn't for a call, so that corrupt histories are rejected
+// before they're sent.
+func CheckMessages(messages []Message) error {
+	for i, m := range messages {
+		switch m.Role {
+		case RoleSystem, RoleUser, RoleAssistant:
+		case RoleTool:
+			if m.ToolCallID == "" {
+				return fmt.Errorf("message %d: tool message has no tool_call_id", i)
+			}
+		default:
+			return fmt.Errorf("message %d: unknown role %q", i, m.Role)
+		}
+	}
+	return nil
+}
+
+// ToolCall is a call to a tool requested by the model.
+type ToolCall struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Arguments are the call's arguments, usually as a JSON object.
+	Arguments string `json:"arguments"`
+}
+
+// Request is a request for a chat completion.
+type Request struct {
+	Model    string
+	Messages []Message
+	// ReasoningEffort is passed to reasoning models, such as "low" or "high".
+	// Empty uses the model's default.
+	ReasoningEffort string
+	// ResponseFormat is the type of reply to request, such as "json_object".
+	// Empty means plain text.
+	ResponseFormat string
+	// WebSearch lets the model search the web before replying, on models
+	// that support it.
+	WebSearch bool
+	// CacheKey groups requests that share a long prefix, such as the turns
+	// of one session, so that providers that cache prompts can route them to
+	// the same cache. Empty leaves routing to the provider.
+	CacheKey string
+
+	Options RequestOptions
+}
+
+// RequestOptions bounds how long a streaming request may take. Zero values
+// disable the corresponding limit.
+type RequestOptions struct {
+	// ConnectTimeout is the max time to wait for response headers.
+	ConnectTimeout time.Duration
+	// FirstTokenTimeout is the max time from sending the request until the
+	// first token is streamed back.
+	FirstTokenTimeout time.Duration
+	// Timeout is the max total time for the request, including streaming the
+	// full response.
+	Timeout time.Duration
+}
+
+// CompletionClient is implemented by each provider.
+type CompletionClient interface {
+	// GetCompletion sends the request and returns the streamed reply.
+	// Canceling ctx aborts the stream.
+	GetCompletion(ctx context.Context, req *Request) (Stream, error)
+}
+
+// Stream is a streamed reply, read as a sequence of events.
+type Stream interface {
+	// Next returns the next event. The last event is always Done, after which
+	// Next returns io.EOF.
+	Next() (Event, error)
+	Close() error
+}
+
+// Event is one of TextDelta, ReasoningDelta, ToolCallDelta, *Usage, or Done.
+type Event interface {
+	isEvent()
+}
+
+// TextDelta is the next part of the reply text.
+type TextDelta struct {
+	Text string
+}
+
+// ReasoningDelta is the next part of the model's reasoning, for providers
+// that expose it. It is not part of the reply text.
+type ReasoningDelta struct {
+	Text string
+}
+
+// ToolCallDelta is the next part of a tool call. Deltas for the same call
+// share an Index. ID and Name are only set on the first delta of each call;
+// Arguments are streamed in parts.
+type ToolCallDelta struct {
+	Index     int
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// Done ends a stream.
+type Done struct {
+	// FinishReason is the reason the model stopped generating, such as
+	// FinishReasonLength.
+	FinishReason string
+}
+
+func (TextDelta) isEvent()      {}
+func (ReasoningDelta) isEvent() {}
+func (ToolCallDelta) isEvent()  {}
+func (*Usage) isEvent()         {}
+func (Done) isEvent()           {}
+
+// Finish reasons reported in Done.
+const (
+	FinishReasonStop          = "stop"
+	FinishReasonLength        = "length"
+	FinishReasonToolCalls     = "tool_calls"
+	FinishReasonContentFilter = "content_filter"
+)
+
+// Reader adapts a Stream to a plain reader of the reply text, for consumers
+// that don't need the other events.
+type Reader struct {
+	stream Stream
+	buf    string
+
+	// FinishReason and Usage are set once the reader is read to EOF. Usage is
+	// nil if the provider doesn't report it.
+	FinishReason string
+	Usage        *Usage
+	// ToolCalls are the complete tool calls assembled from the stream, set
+	// as they are read.
+	ToolCalls []ToolCall
+	// Reasoning, if set, receives the model's reasoning as it is read.
+	Reasoning io.Writer
+	// Start is when the request was sent, which defaults to when the reader
+	// was created. Metrics are measured from it.
+	Start time.Time
+	// Metrics are the timings of the reply, complete once the reader is read
+	// to EOF.
+	Metrics Metrics
+}
+
+func NewReader(s Stream) *Reader {
+	return &Reader{stream: s, Start: time.Now()}
+}
+
+// Metrics are the timings of a streamed reply.
+type Metrics struct {
+	// TimeToFirstToken is from sending the request until the first text or
+	// reasoning is received.
+	TimeToFirstToken time.Duration
+	// Duration is from sending the request until the end of the reply.
+	Duration time.Duration
+}
+
+// TokensPerSecond is the rate at which tokens were generated, after the
+// first one, or 0 if it can't be measured.
+func (m *Metrics) TokensPerSecond(outputTokens int) float64 {
+	d := m.Duration - m.TimeToFirstToken
+	if outputTokens <= 1 || d <= 0 {
+		return 0
+	}
+	return float64(outputTokens-1) / d.Seconds()
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	for r.buf == "" {
+		event, err := r.stream.Next()
+		if err == io.EOF && r.Metrics.Duration == 0 {
+			r.Metrics.Duration = time.Since(r.Start)
+		}
+		if err != nil {
+			return 0, err
+		}
+		switch event.(type) {
+		case TextDelta, ReasoningDelta:
+			if r.Metrics.TimeToFirstToken == 0 {
+				r.Metrics.TimeToFirstToken = time.Since(r.Start)
+			}
+		}
+		switch e := event.(type) {
+		case TextDelta:
+			r.buf = e.Text
+		case ReasoningDelta:
+			if r.Reasoning != nil {
+				if _, err := io.WriteString(r.Reasoning, e.Text); err != nil {
+					return 0, err
+				}
+			}
+		case ToolCallDelta:
+			r.addToolCall(e)
+		case *Usage:
+			r.Usage = e
+		case Done:
+			r.FinishReason = e.FinishReason
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// addToolCall adds a delta to the call at its index.
+func (r *Reader) addToolCall(d ToolCallDelta) {
+	for len(r.ToolCalls) <= d.Index {
+		r.ToolCalls = append(r.ToolCalls, ToolCall{})
+	}
+	tc := &r.ToolCalls[d.Index]
+	if d.ID != "" {
+		tc.ID = d.ID
+	}
+	if d.Name != "" {
+		tc.Name = d.Name
+	}
+	tc.Arguments += d.Arguments
+}
+
+func (r *Reader) Close() error {
+	return r.stream.Close()
+}
+
+type Usage struct {
+	InputTokens int `json:"input_tokens"`
+	// CachedInputTokens is the subset of InputTokens read from the
+	// provider's prompt cache.
+	CachedInputTokens int `json:"cached_input_tokens,omitempty"`
+	OutputTokens      int `json:"output_tokens"`
+}
+
+func (u *Usage) TotalTokens() int {
+	return u.InputTokens + u.OutputTokens
+}
+
+// TimeoutError is returned when a request exceeds one of the limits in
+// RequestOptions.
+type TimeoutError struct {
+	// Waiting describes what the request was waiting on when it timed out.
+	Waiting string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s waiting for %s", e.Timeout, e.Waiting)
+}
+
+func (e *TimeoutError) Retryable() bool {
+	return true
+}
+
+// BlockedError is returned when a client refuses to send a request, such
+// as because a prompt breaks a data-handling policy.
+type BlockedError struct {
+	Reason string
+}
+
+func (e *BlockedError) Error() string {
+	return "not sent: " + e.Reason
+}
+
+// IsRateLimited reports whether a request failed with err for exceeding a
+// provider's rate limit, and how long the provider asked to wait before
+// retrying, or 0 if it didn't say. Providers mark these errors by
+// implementing a RateLimited() (time.Duration, bool) method.
+func IsRateLimited(err error) (wait time.Duration, ok bool) {
+	var r interface{ RateLimited() (time.Duration, bool) }
+	if !errors.As(err, &r) {
+		return 0, false
+	}
+	return r.RateLimited()
+}
+
+// IsRetryable reports whether a request that failed with err may succeed if
+// retried, such as after a rate limit, server error, or timeout. Providers
+// mark retryable errors by implementing a Retryable() bool method.
+func IsRetryable(err error) bool {
+	var r interface{ Retryable() bool }
+	return errors.As(err, &r) && r.Retryable()
+}
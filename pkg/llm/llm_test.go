@@ -0,0 +1,79 @@
+package llm_test
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/llm/llmtest"
+)
+
+func TestCheckMessages(t *testing.T) {
+	for _, test := range []struct {
+		messages []llm.Message
+		ok       bool
+	}{
+		{[]llm.Message{{Role: llm.RoleSystem}, {Role: llm.RoleUser}, {Role: llm.RoleAssistant}}, true},
+		{[]llm.Message{{Role: llm.RoleTool, ToolCallID: "call_1", Content: "42"}}, true},
+		{[]llm.Message{{Role: llm.RoleTool, Content: "42"}}, false},
+		{[]llm.Message{{Role: "robot"}}, false},
+		{[]llm.Message{{Content: "no role"}}, false},
+	} {
+		if err := llm.CheckMessages(test.messages); (err == nil) != test.ok {
+			t.Errorf("CheckMessages(%+v) = %v, want ok %t", test.messages, err, test.ok)
+		}
+	}
+}
+
+func TestReaderToolCalls(t *testing.T) {
+	client := llmtest.NewClient(&llmtest.Response{Events: []llm.Event{
+		llm.ToolCallDelta{Index: 0, ID: "call_1", Name: "weather", Arguments: `{"city":`},
+		llm.ToolCallDelta{Index: 1, ID: "call_2", Name: "time", Arguments: `{}`},
+		llm.ToolCallDelta{Index: 0, Arguments: `"Paris"}`},
+		llm.Done{FinishReason: llm.FinishReasonToolCalls},
+	}})
+	s, err := client.GetCompletion(context.Background(), &llm.Request{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := llm.NewReader(s)
+	if _, err := io.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+	want := []llm.ToolCall{
+		{ID: "call_1", Name: "weather", Arguments: `{"city":"Paris"}`},
+		{ID: "call_2", Name: "time", Arguments: `{}`},
+	}
+	if !reflect.DeepEqual(r.ToolCalls, want) || r.FinishReason != llm.FinishReasonToolCalls {
+		t.Errorf("tool calls = %+v, finish reason %q, want %+v", r.ToolCalls, r.FinishReason, want)
+	}
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	tag := func(name string) llm.Middleware {
+		return func(next llm.CompletionClient) llm.CompletionClient {
+			return llm.ClientFunc(func(ctx context.Context, req *llm.Request) (llm.Stream, error) {
+				order = append(order, name)
+				r := *req
+				r.Model += "+" + name
+				return next.GetCompletion(ctx, &r)
+			})
+		}
+	}
+	client := llmtest.NewClient(llmtest.Text("hi"))
+	c := llm.Chain(client, tag("outer"), tag("inner"))
+	s, err := c.GetCompletion(context.Background(), &llm.Request{Model: "m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if want := []string{"outer", "inner"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %q, want %q", order, want)
+	}
+	if got := client.Requests()[0].Model; got != "m+outer+inner" {
+		t.Errorf("model = %q, want m+outer+inner", got)
+	}
+}
@@ -0,0 +1,149 @@
+// Package llmtest provides a scripted llm.CompletionClient for tests and
+// offline demos, and an HTTP recorder for replaying real provider traffic.
+package llmtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+// Response is a scripted reply.
+type Response struct {
+	// Events are streamed in order. Done is appended if it's not the last
+	// event.
+	Events []llm.Event
+	// Err, if set, is returned by GetCompletion instead of a stream.
+	Err error
+	// StreamErr, if set, is returned by the stream after Events, in place of
+	// Done.
+	StreamErr error
+	// Latency is the delay before each event.
+	Latency time.Duration
+}
+
+// Text returns a response that streams text a few bytes at a time, then
+// finishes normally.
+func Text(text string) *Response {
+	return &Response{Events: chunk(text, 4)}
+}
+
+// Truncated returns a response that streams text, then finishes as if it
+// hit max tokens.
+func Truncated(text string) *Response {
+	return &Response{Events: append(chunk(text, 4), llm.Done{FinishReason: llm.FinishReasonLength})}
+}
+
+// Error returns a response that fails with err before streaming.
+func Error(err error) *Response {
+	return &Response{Err: err}
+}
+
+func chunk(text string, size int) []llm.Event {
+	var events []llm.Event
+	for len(text) > 0 {
+		n := min(size, len(text))
+		events = append(events, llm.TextDelta{Text: text[:n]})
+		text = text[n:]
+	}
+	return events
+}
+
+// Client replies to each request with the next scripted response.
+type Client struct {
+	mu        sync.Mutex
+	responses []*Response
+	requests  []*llm.Request
+}
+
+func NewClient(responses ...*Response) *Client {
+	return &Client{responses: responses}
+}
+
+// Push scripts more responses, after any not yet used.
+func (c *Client) Push(responses ...*Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.responses = append(c.responses, responses...)
+}
+
+// Requests returns the requests received so far.
+func (c *Client) Requests() []*llm.Request {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*llm.Request{}, c.requests...)
+}
+
+func (c *Client) GetCompletion(ctx context.Context, req *llm.Request) (llm.Stream, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Copy the messages, since callers may reuse the backing array.
+	r := *req
+	r.Messages = append([]llm.Message{}, req.Messages...)
+	c.requests = append(c.requests, &r)
+	if len(c.responses) == 0 {
+		return nil, fmt.Errorf("llmtest: no response scripted for request %d", len(c.requests))
+	}
+	rsp := c.responses[0]
+	c.responses = c.responses[1:]
+	if rsp.Err != nil {
+		return nil, rsp.Err
+	}
+	events := append([]llm.Event{}, rsp.Events...)
+	if rsp.StreamErr == nil {
+		if _, ok := last(events).(llm.Done); !ok {
+			events = append(events, llm.Done{FinishReason: llm.FinishReasonStop})
+		}
+	}
+	return &stream{ctx: ctx, rsp: rsp, events: events}, nil
+}
+
+func last(events []llm.Event) llm.Event {
+	if len(events) == 0 {
+		return nil
+	}
+	return events[len(events)-1]
+}
+
+type stream struct {
+	ctx    context.Context
+	rsp    *Response
+	events []llm.Event
+	closed bool
+}
+
+func (s *stream) Next() (llm.Event, error) {
+	if s.closed {
+		return nil, fmt.Errorf("llmtest: stream closed")
+	}
+	if len(s.events) == 0 {
+		if s.rsp.StreamErr != nil {
+			return nil, s.rsp.StreamErr
+		}
+		return nil, io.EOF
+	}
+	if s.rsp.Latency > 0 {
+		t := time.NewTimer(s.rsp.Latency)
+		defer t.Stop()
+		select {
+		case <-s.ctx.Done():
+			return nil, s.ctx.Err()
+		case <-t.C:
+		}
+	}
+	if err := s.ctx.Err(); err != nil {
+		return nil, err
+	}
+	e := s.events[0]
+	s.events = s.events[1:]
+	return e, nil
+}
+
+func (s *stream) Close() error {
+	s.closed = true
+	return nil
+}
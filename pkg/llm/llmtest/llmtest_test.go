@@ -0,0 +1,143 @@
+package llmtest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bduffany/gpt-cli/pkg/llm"
+	"github.com/bduffany/gpt-cli/pkg/llm/llmtest"
+	"github.com/bduffany/gpt-cli/pkg/openai"
+)
+
+func TestClientStreamsScriptedResponses(t *testing.T) {
+	c := llmtest.NewClient(llmtest.Text("Hello, world"), llmtest.Truncated("abc"))
+	ctx := context.Background()
+
+	r := readAll(t, c, &llm.Request{Model: "m1"})
+	if r.text != "Hello, world" || r.finishReason != llm.FinishReasonStop {
+		t.Errorf("first reply = %q (%s), want %q (stop)", r.text, r.finishReason, "Hello, world")
+	}
+	r = readAll(t, c, &llm.Request{Model: "m2"})
+	if r.text != "abc" || r.finishReason != llm.FinishReasonLength {
+		t.Errorf("second reply = %q (%s), want %q (length)", r.text, r.finishReason, "abc")
+	}
+	if _, err := c.GetCompletion(ctx, &llm.Request{}); err == nil {
+		t.Error("GetCompletion with no scripted responses succeeded, want error")
+	}
+	if got := len(c.Requests()); got != 3 {
+		t.Errorf("got %d requests, want 3", got)
+	}
+	if got := c.Requests()[1].Model; got != "m2" {
+		t.Errorf("second request model = %q, want m2", got)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	errReq := errors.New("request failed")
+	errStream := errors.New("stream failed")
+	c := llmtest.NewClient(
+		llmtest.Error(errReq),
+		&llmtest.Response{Events: []llm.Event{llm.TextDelta{Text: "partial"}}, StreamErr: errStream},
+	)
+	ctx := context.Background()
+	if _, err := c.GetCompletion(ctx, &llm.Request{}); err != errReq {
+		t.Errorf("GetCompletion error = %v, want %v", err, errReq)
+	}
+	s, err := c.GetCompletion(ctx, &llm.Request{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(llm.NewReader(s))
+	if string(b) != "partial" || err != errStream {
+		t.Errorf("read %q, %v; want %q, %v", b, err, "partial", errStream)
+	}
+}
+
+func TestClientLatencyRespectsContext(t *testing.T) {
+	c := llmtest.NewClient(&llmtest.Response{
+		Events:  []llm.Event{llm.TextDelta{Text: "slow"}},
+		Latency: time.Hour,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	s, err := c.GetCompletion(ctx, &llm.Request{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Next(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Next error = %v, want deadline exceeded", err)
+	}
+}
+
+func TestRecorderReplaysRecordedStream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\" there\"},\"finish_reason\":\"stop\"}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":5,\"completion_tokens\":2}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	req := &llm.Request{Model: "gpt-4.1", Messages: []llm.Message{{Role: llm.RoleUser, Content: "Hello"}}}
+
+	rec, err := llmtest.NewRecorder(path, llmtest.Record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &openai.Client{Token: "secret", BaseURL: srv.URL, HTTPClient: rec.Client()}
+	recorded := readAll(t, client, req)
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	rep, err := llmtest.NewRecorder(path, llmtest.Replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client = &openai.Client{Token: "secret", BaseURL: srv.URL, HTTPClient: rep.Client()}
+	replayed := readAll(t, client, req)
+	if replayed != recorded {
+		t.Errorf("replayed %+v, want %+v", replayed, recorded)
+	}
+	if replayed.text != "Hi there" || replayed.usage.InputTokens != 5 {
+		t.Errorf("unexpected reply %+v", replayed)
+	}
+
+	// Each interaction is only replayed once.
+	if _, err := client.GetCompletion(context.Background(), req); err == nil {
+		t.Error("second replay succeeded, want error")
+	}
+}
+
+type result struct {
+	text         string
+	finishReason string
+	usage        llm.Usage
+}
+
+func readAll(t *testing.T, c llm.CompletionClient, req *llm.Request) result {
+	t.Helper()
+	s, err := c.GetCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	r := llm.NewReader(s)
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := result{text: string(b), finishReason: r.FinishReason}
+	if r.Usage != nil {
+		res.usage = *r.Usage
+	}
+	return res
+}
@@ -0,0 +1,161 @@
+package llmtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+type Mode int
+
+const (
+	// Replay serves responses from the cassette and never touches the
+	// network.
+	Replay Mode = iota
+	// Record sends requests to the real server and saves each interaction to
+	// the cassette.
+	Record
+)
+
+// Interaction is a recorded request and its response. Request headers are
+// not recorded, so API keys never end up in cassettes.
+type Interaction struct {
+	Method       string `json:"method"`
+	Path         string `json:"path"`
+	RequestBody  string `json:"request_body,omitempty"`
+	StatusCode   int    `json:"status_code"`
+	ContentType  string `json:"content_type,omitempty"`
+	ResponseBody string `json:"response_body"`
+}
+
+// Recorder is an http.RoundTripper that records HTTP traffic to a cassette
+// file, or replays it from one. Use it as the transport of a provider
+// client's HTTP client to test the client against real responses offline.
+type Recorder struct {
+	Mode Mode
+	// Path is the cassette file.
+	Path string
+	// Transport sends requests in Record mode. Nil means
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+}
+
+// NewRecorder returns a recorder for the cassette at path. In Replay mode,
+// the cassette is loaded immediately.
+func NewRecorder(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{Mode: mode, Path: path}
+	if mode == Record {
+		return r, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &r.interactions); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	r.used = make([]bool, len(r.interactions))
+	return r, nil
+}
+
+// Client returns an HTTP client that uses the recorder.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+		req.Body = io.NopCloser(bytes.NewReader(b))
+	}
+	if r.Mode == Record {
+		return r.record(req, body)
+	}
+	return r.replay(req, body)
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	rsp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	b, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	r.interactions = append(r.interactions, &Interaction{
+		Method:       req.Method,
+		Path:         req.URL.RequestURI(),
+		RequestBody:  string(body),
+		StatusCode:   rsp.StatusCode,
+		ContentType:  rsp.Header.Get("Content-Type"),
+		ResponseBody: string(b),
+	})
+	r.used = append(r.used, true)
+	r.mu.Unlock()
+	rsp.Body = io.NopCloser(bytes.NewReader(b))
+	return rsp, nil
+}
+
+// replay serves the first unused interaction that matches the request.
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, in := range r.interactions {
+		if r.used[i] || in.Method != req.Method || in.Path != req.URL.RequestURI() || in.RequestBody != string(body) {
+			continue
+		}
+		r.used[i] = true
+		header := http.Header{}
+		if in.ContentType != "" {
+			header.Set("Content-Type", in.ContentType)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.StatusCode, http.StatusText(in.StatusCode)),
+			StatusCode:    in.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader([]byte(in.ResponseBody))),
+			ContentLength: int64(len(in.ResponseBody)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("llmtest: no recorded response for %s %s in %s", req.Method, req.URL.RequestURI(), r.Path)
+}
+
+// Save writes the recorded interactions to the cassette. It is a no-op in
+// Replay mode.
+func (r *Recorder) Save() error {
+	if r.Mode != Record {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, err := json.MarshalIndent(r.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.Path, append(b, '\n'), 0644)
+}
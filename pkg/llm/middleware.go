@@ -0,0 +1,26 @@
+package llm
+
+import "context"
+
+// Middleware wraps a CompletionClient to add to what it does with each
+// request, such as caching replies, tracing, or masking secrets, so that
+// these compose without any provider knowing about them.
+type Middleware func(next CompletionClient) CompletionClient
+
+// Chain returns c wrapped in each middleware in turn, with the first
+// outermost: it sees each request first, before passing it on to the next
+// middleware, and the last passes it on to c.
+func Chain(c CompletionClient, middleware ...Middleware) CompletionClient {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		c = middleware[i](c)
+	}
+	return c
+}
+
+// ClientFunc is a CompletionClient implemented by a func, for middleware
+// that only needs to look at or change requests.
+type ClientFunc func(ctx context.Context, req *Request) (Stream, error)
+
+func (f ClientFunc) GetCompletion(ctx context.Context, req *Request) (Stream, error) {
+	return f(ctx, req)
+}
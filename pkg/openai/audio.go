@@ -0,0 +1,91 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+)
+
+// Audio API definitions
+
+type TranscriptionRequest struct {
+	Model string
+	// Filename is used by the API to detect the audio format.
+	Filename string
+	Audio    io.Reader
+	// Language is an optional ISO-639-1 code for the spoken language.
+	Language string
+	// Prompt optionally guides the transcription's style or vocabulary.
+	Prompt string
+}
+
+// Transcribe returns the text spoken in the given audio.
+func (c *Client) Transcribe(ctx context.Context, req *TranscriptionRequest) (string, error) {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	fields := map[string]string{
+		"model":           req.Model,
+		"language":        req.Language,
+		"prompt":          req.Prompt,
+		"response_format": "json",
+	}
+	for k, v := range fields {
+		if v == "" {
+			continue
+		}
+		if err := w.WriteField(k, v); err != nil {
+			return "", err
+		}
+	}
+	fw, err := w.CreateFormFile("file", req.Filename)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(fw, req.Audio); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	res, err := c.RequestWithContentType(ctx, "POST", "/v1/audio/transcriptions", w.FormDataContentType(), body)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	rsp := &struct {
+		Text string `json:"text"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(rsp); err != nil {
+		return "", err
+	}
+	return rsp.Text, nil
+}
+
+type SpeechRequest struct {
+	Model string `json:"model"`
+	Input string `json:"input"`
+	Voice string `json:"voice"`
+	// Speed is between 0.25 and 4.0. Zero uses the default speed.
+	Speed float64 `json:"speed,omitempty"`
+	// ResponseFormat is the audio format, such as "mp3" or "wav".
+	ResponseFormat string `json:"response_format,omitempty"`
+	// Instructions optionally control the tone of the voice. Not supported
+	// by older models.
+	Instructions string `json:"instructions,omitempty"`
+}
+
+// Speech returns audio of the request input being spoken. The caller must
+// close the returned reader.
+func (c *Client) Speech(ctx context.Context, req *SpeechRequest) (io.ReadCloser, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.Request(ctx, "POST", "/v1/audio/speech", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
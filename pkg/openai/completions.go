@@ -0,0 +1,279 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/sse"
+	"github.com/bduffany/gpt-cli/pkg/llm"
+)
+
+// Completions API definitions
+
+type Data struct {
+	Choices []*Choice
+	// Usage is only set on the last chunk of a stream, when requested with
+	// stream_options.include_usage.
+	Usage *Usage `json:"usage"`
+}
+
+type Usage struct {
+	PromptTokens        int                  `json:"prompt_tokens"`
+	CompletionTokens    int                  `json:"completion_tokens"`
+	TotalTokens         int                  `json:"total_tokens"`
+	PromptTokensDetails *PromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+}
+
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"`
+}
+
+type Choice struct {
+	Delta        *Delta
+	FinishReason string `json:"finish_reason"`
+}
+
+type Delta struct {
+	Content string
+	// ReasoningContent or Reasoning hold reasoning text on some
+	// OpenAI-compatible servers. OpenAI itself doesn't stream reasoning here.
+	ReasoningContent string           `json:"reasoning_content"`
+	Reasoning        string           `json:"reasoning"`
+	ToolCalls        []*ToolCallDelta `json:"tool_calls"`
+}
+
+type ToolCallDelta struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// Message is a chat message in the completions API format, which differs
+// from llm.Message in how tool calls are nested.
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content,omitempty"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+	Name       string     `json:"name,omitempty"`
+}
+
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+func convertMessages(messages []llm.Message) []Message {
+	out := make([]Message, 0, len(messages))
+	for _, m := range messages {
+		msg := Message{Role: m.Role, Content: m.Content, ToolCallID: m.ToolCallID}
+		// The API only accepts a name on tool messages for the legacy
+		// "function" role; tool results are matched by ID.
+		if m.Role != llm.RoleTool {
+			msg.Name = m.Name
+		}
+		for _, tc := range m.ToolCalls {
+			msg.ToolCalls = append(msg.ToolCalls, ToolCall{
+				ID:       tc.ID,
+				Type:     "function",
+				Function: FunctionCall{Name: tc.Name, Arguments: tc.Arguments},
+			})
+		}
+		out = append(out, msg)
+	}
+	return out
+}
+
+// CompletionRequestBody returns the JSON body that GetCompletion sends to
+// the chat completions API for req.
+func CompletionRequestBody(req *llm.Request) ([]byte, error) {
+	if err := llm.CheckMessages(req.Messages); err != nil {
+		return nil, err
+	}
+	payload := map[string]any{
+		"model":          req.Model,
+		"stream":         true,
+		"stream_options": map[string]any{"include_usage": true},
+		"messages":       convertMessages(req.Messages),
+	}
+	if req.ReasoningEffort != "" {
+		payload["reasoning_effort"] = req.ReasoningEffort
+	}
+	if req.ResponseFormat != "" {
+		payload["response_format"] = map[string]any{"type": req.ResponseFormat}
+	}
+	if req.WebSearch {
+		payload["web_search_options"] = map[string]any{}
+	}
+	// Prompts of 1024+ tokens are cached automatically; the key only
+	// improves the hit rate.
+	if req.CacheKey != "" {
+		payload["prompt_cache_key"] = req.CacheKey
+	}
+	return json.Marshal(payload)
+}
+
+// GetCompletion implements llm.CompletionClient using the streaming chat
+// completions API.
+func (c *Client) GetCompletion(ctx context.Context, req *llm.Request) (llm.Stream, error) {
+	body, err := CompletionRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	opts := req.Options
+	stopTotal := cancelAfter(cancel, opts.Timeout, "the full response")
+	stopFirstToken := cancelAfter(cancel, opts.FirstTokenTimeout, "the first token")
+	stopConnect := cancelAfter(cancel, opts.ConnectTimeout, "response headers")
+	rsp, err := c.Request(ctx, "POST", "/v1/chat/completions", bytes.NewReader(body))
+	stopConnect()
+	if err != nil {
+		stopFirstToken()
+		stopTotal()
+		cancel(nil)
+		return nil, timeoutCause(ctx, err)
+	}
+
+	var r io.Reader = rsp.Body
+	if c.RawStream != nil {
+		r = io.TeeReader(rsp.Body, c.RawStream)
+	}
+	return &stream{
+		ctx:            ctx,
+		cancel:         cancel,
+		body:           rsp.Body,
+		events:         sse.NewReader(r),
+		stopFirstToken: stopFirstToken,
+		stopTotal:      stopTotal,
+	}, nil
+}
+
+// stream implements llm.Stream by parsing server-sent events as they are
+// read.
+type stream struct {
+	ctx            context.Context
+	cancel         context.CancelCauseFunc
+	body           io.ReadCloser
+	events         *sse.Reader
+	stopFirstToken func()
+	stopTotal      func()
+
+	pending      []llm.Event
+	finishReason string
+	done         bool
+}
+
+func (s *stream) Next() (llm.Event, error) {
+	for len(s.pending) == 0 {
+		if s.done {
+			return nil, io.EOF
+		}
+		if err := s.readEvent(); err != nil {
+			return nil, timeoutCause(s.ctx, err)
+		}
+	}
+	e := s.pending[0]
+	s.pending = s.pending[1:]
+	return e, nil
+}
+
+// readEvent reads the next server-sent event and queues the llm events
+// parsed from it.
+func (s *stream) readEvent() error {
+	event, err := s.events.Next()
+	if err == io.EOF || (err == nil && event.Data == "[DONE]") {
+		s.done = true
+		s.pending = append(s.pending, llm.Done{FinishReason: s.finishReason})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data := &Data{}
+	if err := json.Unmarshal([]byte(event.Data), data); err != nil {
+		return fmt.Errorf("failed to parse event data %q: %s", event.Data, err)
+	}
+	if u := data.Usage; u != nil {
+		usage := &llm.Usage{
+			InputTokens:  u.PromptTokens,
+			OutputTokens: u.CompletionTokens,
+		}
+		if u.PromptTokensDetails != nil {
+			usage.CachedInputTokens = u.PromptTokensDetails.CachedTokens
+		}
+		s.pending = append(s.pending, usage)
+	}
+	if len(data.Choices) == 0 {
+		return nil
+	}
+	s.stopFirstToken()
+	choice := data.Choices[0]
+	if choice.FinishReason != "" {
+		s.finishReason = choice.FinishReason
+	}
+	if choice.Delta == nil {
+		return nil
+	}
+	if r := choice.Delta.ReasoningContent + choice.Delta.Reasoning; r != "" {
+		s.pending = append(s.pending, llm.ReasoningDelta{Text: r})
+	}
+	if choice.Delta.Content != "" {
+		s.pending = append(s.pending, llm.TextDelta{Text: choice.Delta.Content})
+	}
+	for _, tc := range choice.Delta.ToolCalls {
+		s.pending = append(s.pending, llm.ToolCallDelta{
+			Index:     tc.Index,
+			ID:        tc.ID,
+			Name:      tc.Function.Name,
+			Arguments: tc.Function.Arguments,
+		})
+	}
+	return nil
+}
+
+func (s *stream) Close() error {
+	s.stopFirstToken()
+	s.stopTotal()
+	s.cancel(nil)
+	return s.body.Close()
+}
+
+// cancelAfter cancels a request with a TimeoutError if the returned stop func
+// is not called within the given timeout. A zero timeout never cancels.
+func cancelAfter(cancel context.CancelCauseFunc, timeout time.Duration, waiting string) (stop func()) {
+	if timeout <= 0 {
+		return func() {}
+	}
+	t := time.AfterFunc(timeout, func() {
+		cancel(&llm.TimeoutError{Waiting: waiting, Timeout: timeout})
+	})
+	return func() { t.Stop() }
+}
+
+// timeoutCause returns the TimeoutError that canceled ctx, if any. Otherwise
+// it returns err unchanged.
+func timeoutCause(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	var te *llm.TimeoutError
+	if errors.As(context.Cause(ctx), &te) {
+		return te
+	}
+	return err
+}
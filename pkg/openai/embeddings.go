@@ -0,0 +1,48 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+)
+
+// Embeddings API definitions
+
+type EmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+	// Dimensions optionally shortens the returned vectors. Only supported by
+	// newer models.
+	Dimensions int `json:"dimensions,omitempty"`
+}
+
+type EmbeddingResponse struct {
+	Data  []*Embedding `json:"data"`
+	Model string       `json:"model"`
+}
+
+type Embedding struct {
+	// Index is the position of the corresponding input in the request.
+	Index     int       `json:"index"`
+	Embedding []float64 `json:"embedding"`
+}
+
+// CreateEmbeddings returns one embedding vector per input, in input order.
+func (c *Client) CreateEmbeddings(ctx context.Context, req *EmbeddingRequest) ([][]float64, error) {
+	rsp := &EmbeddingResponse{}
+	if err := c.PostJSON(ctx, "/v1/embeddings", req, rsp); err != nil {
+		return nil, err
+	}
+	vectors := make([][]float64, len(req.Input))
+	for _, e := range rsp.Data {
+		if e.Index < 0 || e.Index >= len(vectors) {
+			return nil, fmt.Errorf("embedding index %d out of range", e.Index)
+		}
+		vectors[e.Index] = e.Embedding
+	}
+	for i, v := range vectors {
+		if v == nil {
+			return nil, fmt.Errorf("missing embedding for input %d", i)
+		}
+	}
+	return vectors, nil
+}
@@ -0,0 +1,182 @@
+// Package openai is a client for the OpenAI API.
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bduffany/gpt-cli/internal/httpx"
+)
+
+// DefaultBaseURL is the API server used when Client.BaseURL is empty.
+const DefaultBaseURL = "https://api.openai.com"
+
+type Client struct {
+	Token string
+	// BaseURL is the API server to send requests to, for use with
+	// OpenAI-compatible servers. Empty means DefaultBaseURL.
+	BaseURL string
+	// HTTPClient sends requests. Nil means a shared client that pools
+	// connections across requests.
+	HTTPClient *http.Client
+	// RawStream, if set, receives a copy of the body of each streamed
+	// completion, with the server-sent events as the server sent them, as
+	// it's read.
+	RawStream io.Writer
+}
+
+func (c *Client) GetJSON(ctx context.Context, endpoint string, obj any) error {
+	rsp, err := c.Request(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	b, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil
+	}
+	if err := json.Unmarshal(b, obj); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Client) PostJSON(ctx context.Context, endpoint string, req, rsp any) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	res, err := c.Request(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return json.NewDecoder(res.Body).Decode(rsp)
+}
+
+func (c *Client) Request(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	return c.RequestWithContentType(ctx, method, path, "application/json", body)
+}
+
+func (c *Client) RequestWithContentType(ctx context.Context, method, path, contentType string, body io.Reader) (*http.Response, error) {
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(baseURL, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = httpx.Default
+	}
+	rsp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if rsp.StatusCode >= 300 {
+		defer rsp.Body.Close()
+		return nil, &HTTPError{StatusCode: rsp.StatusCode, RetryAfter: retryAfter(rsp), Err: readError(rsp)}
+	}
+
+	return rsp, nil
+}
+
+func readError(rsp *http.Response) error {
+	b, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return fmt.Errorf("HTTP %d, body_read_error=%s", rsp.StatusCode, err)
+	}
+	e := &ErrorResponse{}
+	if err := json.Unmarshal(b, e); err != nil {
+		return fmt.Errorf("HTTP %d, body=%q", rsp.StatusCode, string(b))
+	}
+	if e.Error == nil {
+		return fmt.Errorf("HTTP %d, body=%q", rsp.StatusCode, string(b))
+	}
+	return e.Error
+}
+
+// HTTPError is returned for unsuccessful responses. It wraps the API's
+// *Error when the response body contains one.
+type HTTPError struct {
+	StatusCode int
+	// RetryAfter is how long the server asked to wait before retrying, from
+	// the Retry-After header, or 0 if it didn't say.
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *HTTPError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the request may succeed if retried, such as
+// after a rate limit or server error.
+func (e *HTTPError) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// RateLimited reports whether the request was refused for exceeding a rate
+// limit, and how long to wait before retrying.
+func (e *HTTPError) RateLimited() (time.Duration, bool) {
+	return e.RetryAfter, e.StatusCode == http.StatusTooManyRequests
+}
+
+// retryAfter parses the Retry-After header of a response, in seconds or as
+// a date.
+func retryAfter(rsp *http.Response) time.Duration {
+	v := rsp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(v); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+	return 0
+}
+
+// Common API definitions
+
+type GenericObject struct {
+	// "list" | "model"
+	Object string `json:"object"`
+	// TODO: should be any?
+	Data    []GenericObject `json:"data"`
+	ID      string          `json:"id"`
+	Created int64           `json:"created"`
+	OwnedBy string          `json:"owned_by"`
+}
+
+type ErrorResponse struct {
+	Error *Error `json:"error,omitEmpty"`
+}
+
+type Error struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+	Param   any    `json:"param"`
+	Code    any    `json:"code"`
+}
+
+func (a *Error) Error() string {
+	return fmt.Sprintf("%s: %s", a.Type, a.Message)
+}